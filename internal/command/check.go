@@ -0,0 +1,121 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newCheckCmd() *cobra.Command {
+	var (
+		hashOnly        bool
+		keepAll         bool
+		noSeparateVideo bool
+		asJSON          bool
+		quiet           bool
+		hashAlgo        string
+		extractor       extractorOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check <path>...",
+		Short: "Report whether files are already in the library, without importing them",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, false); err != nil {
+				return err
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+
+			var ext importer.MetadataExtractor
+			if !hashOnly {
+				e, err := newExtractor(extractor, logger)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = e.Close() }()
+				ext = e
+			}
+
+			imp, err := importer.New(importer.Config{
+				LibraryPath:   libraryPath,
+				SeparateVideo: !noSeparateVideo,
+				HashAlgo:      hashAlgo,
+				KeepAll:       keepAll,
+			}, ext, logger)
+			if err != nil {
+				return err
+			}
+
+			var results []importer.CheckResult
+			if hashOnly {
+				results, err = imp.CheckByHash(args)
+			} else {
+				results, err = imp.Check(args)
+			}
+			if err != nil {
+				return err
+			}
+			logger.ClearProgress()
+
+			counts := make(map[importer.CheckStatus]int)
+			for _, r := range results {
+				counts[r.Status]++
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+			} else {
+				for _, r := range results {
+					if quiet && r.Status == importer.CheckPresent {
+						continue
+					}
+					line := fmt.Sprintf("%-25s %s", r.Status, r.Path)
+					if r.LibraryPath != "" {
+						line += " → " + r.LibraryPath
+					}
+					if r.Reason != "" {
+						line += " (" + r.Reason + ")"
+					}
+					fmt.Println(line)
+				}
+				logger.PrintSummary([]logging.SummaryField{
+					{Label: "Present", Value: logging.FormatNumber(counts[importer.CheckPresent])},
+					{Label: "Different content", Value: logging.FormatNumber(counts[importer.CheckDifferent])},
+					{Label: "Missing", Value: logging.FormatNumber(counts[importer.CheckMissing])},
+				})
+			}
+
+			if n := counts[importer.CheckMissing] + counts[importer.CheckDifferent]; n > 0 {
+				return fmt.Errorf("%d of %d files are not in the library", n, len(results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&hashOnly, "hash-only", false, "Look files up by content hash only, without reading metadata (no exiftool needed)")
+	cmd.Flags().BoolVar(&keepAll, "keep-all", false, "Check non-media files at their import path too, as import --keep-all would place them")
+	cmd.Flags().BoolVar(&noSeparateVideo, "no-separate-video", false, "Expect videos in the same device dir as photos")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the results as JSON")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only list files that are not present")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
+
+	return cmd
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/spf13/cobra"
+)
+
+// extractorOptions are the flags of a command that reads metadata.
+type extractorOptions struct {
+	name    string
+	noCache bool
+}
+
+// addExtractorFlag registers --extractor and --no-metadata-cache on a
+// command that reads metadata.
+func addExtractorFlag(cmd *cobra.Command, opts *extractorOptions) {
+	cmd.Flags().StringVar(&opts.name, "extractor", metadata.ExtractorAuto, "Metadata extractor: auto (exiftool if installed), exiftool or native")
+	cmd.Flags().BoolVar(&opts.noCache, "no-metadata-cache", false, "Don't read or write the metadata cache in the user cache directory")
+}
+
+// newExtractor creates the extractor chosen with --extractor, noting when
+// auto falls back to the native one, and puts the metadata cache in front
+// of it. A cache that cannot be opened is reported and skipped.
+func newExtractor(opts extractorOptions, logger *logging.Logger) (metadata.Extractor, error) {
+	ext, err := metadata.NewExtractor(opts.name)
+	if err != nil {
+		return nil, fmt.Errorf("create metadata extractor: %w", err)
+	}
+	if _, native := ext.(*metadata.NativeExtractor); native && opts.name == metadata.ExtractorAuto {
+		logger.Info("exiftool not found; using the native metadata extractor")
+	}
+	if opts.noCache {
+		return ext, nil
+	}
+
+	inner, ok := ext.(interface {
+		metadata.Extractor
+		metadata.FieldReader
+	})
+	if !ok {
+		return ext, nil
+	}
+	path, err := metadata.DefaultCachePath()
+	if err != nil {
+		logger.Warn("metadata cache: %v", err)
+		return ext, nil
+	}
+	cache, err := metadata.LoadCache(path, metadata.DefaultCacheMaxBytes)
+	if err != nil {
+		logger.Warn("metadata cache: load failed: %v", err)
+		if cache == nil {
+			return ext, nil
+		}
+	}
+	return &cachingExtractor{metadata.NewCachingExtractor(inner, cache), logger}, nil
+}
+
+// cachingExtractor reports a cache that could not be written on Close
+// rather than failing the command over it.
+type cachingExtractor struct {
+	*metadata.CachingExtractor
+	logger *logging.Logger
+}
+
+func (c *cachingExtractor) Close() error {
+	if err := c.CachingExtractor.Close(); err != nil {
+		c.logger.Warn("close metadata extractor: %v", err)
+	}
+	return nil
+}
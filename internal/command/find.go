@@ -0,0 +1,162 @@
+package command
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newFindCmd() *cobra.Command {
+	var (
+		from, to   string
+		device     string
+		mediaType  string
+		exts       []string
+		minSize    string
+		maxSize    string
+		hashPrefix string
+		bbox       string
+		country    string
+		region     string
+		lens       string
+		software   string
+		serial     string
+		codec      string
+		session    string
+		asJSON     bool
+		print0     bool
+		absolute   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "find",
+		Short: "Query the library metadata index (run from library root)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if asJSON && print0 {
+				return fmt.Errorf("--json and --print0 are mutually exclusive")
+			}
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			q := index.Query{
+				Device:     device,
+				HashPrefix: hashPrefix,
+				Country:    country,
+				Region:     region,
+				Lens:       lens,
+				Software:   software,
+				Serial:     serial,
+				Codec:      codec,
+				Session:    session,
+			}
+			if from != "" {
+				if q.From, _, err = index.ParsePeriod(from); err != nil {
+					return fmt.Errorf("--from: %w", err)
+				}
+			}
+			if to != "" {
+				if _, q.To, err = index.ParsePeriod(to); err != nil {
+					return fmt.Errorf("--to: %w", err)
+				}
+			}
+			if mediaType != "" {
+				switch t := defaults.MediaType(mediaType); t {
+				case defaults.MediaTypePhoto, defaults.MediaTypeVideo, defaults.MediaTypeAudio, defaults.MediaTypeOther:
+					q.MediaType = t
+				default:
+					return fmt.Errorf("--type: unknown media type %q", mediaType)
+				}
+			}
+			for _, e := range exts {
+				for _, e := range strings.Split(e, ",") {
+					e = strings.ToLower(strings.TrimSpace(e))
+					if e != "" && !strings.HasPrefix(e, ".") {
+						e = "." + e
+					}
+					q.Extensions = append(q.Extensions, e)
+				}
+			}
+			if minSize != "" {
+				if q.MinSize, err = logging.ParseBytes(minSize); err != nil {
+					return fmt.Errorf("--min-size: %w", err)
+				}
+			}
+			if maxSize != "" {
+				if q.MaxSize, err = logging.ParseBytes(maxSize); err != nil {
+					return fmt.Errorf("--max-size: %w", err)
+				}
+			}
+			if bbox != "" {
+				b, err := index.ParseBBox(bbox)
+				if err != nil {
+					return fmt.Errorf("--bbox: %w", err)
+				}
+				q.BBox = &b
+			}
+
+			ix, err := index.Load(index.FilePath(libraryPath))
+			if err != nil {
+				return err
+			}
+			if ix.Len() == 0 {
+				logging.New(os.Stdout, os.Stderr, isTTY()).Warn("the library index is empty; run `imv index rebuild` to create it")
+			}
+
+			w := bufio.NewWriter(os.Stdout)
+			enc := json.NewEncoder(w)
+			for _, r := range ix.Find(q) {
+				if asJSON {
+					if err := enc.Encode(r); err != nil {
+						return fmt.Errorf("encode JSON: %w", err)
+					}
+					continue
+				}
+				p := r.Path
+				if absolute {
+					p = filepath.Join(libraryPath, filepath.FromSlash(p))
+				}
+				sep := "\n"
+				if print0 {
+					sep = "\x00"
+				}
+				if _, err := w.WriteString(p + sep); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Captured on or after this date (YYYY, YYYY-MM or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&to, "to", "", "Captured on or before this date (YYYY, YYYY-MM or YYYY-MM-DD)")
+	cmd.Flags().StringVar(&device, "device", "", "Device dir contains this text (case-insensitive)")
+	cmd.Flags().StringVar(&mediaType, "type", "", "Media type: image, video, audio or other")
+	cmd.Flags().StringSliceVar(&exts, "ext", nil, "File extension, e.g. jpg (repeatable or comma-separated)")
+	cmd.Flags().StringVar(&minSize, "min-size", "", "Minimum file size (e.g. 10MB)")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Maximum file size (e.g. 2GB)")
+	cmd.Flags().StringVar(&hashPrefix, "hash", "", "Full content hash starts with this prefix")
+	cmd.Flags().StringVar(&bbox, "bbox", "", "GPS position inside minLat,minLon,maxLat,maxLon")
+	cmd.Flags().StringVar(&country, "country", "", "Captured in this country (ISO code or name, e.g. US)")
+	cmd.Flags().StringVar(&region, "region", "", "Captured in this state or province (e.g. California)")
+	cmd.Flags().StringVar(&lens, "lens", "", "Lens model contains this (case-insensitive)")
+	cmd.Flags().StringVar(&software, "software", "", "Last written by software containing this, e.g. lightroom (case-insensitive)")
+	cmd.Flags().StringVar(&serial, "serial", "", "Camera serial number")
+	cmd.Flags().StringVar(&codec, "codec", "", "Video codec (e.g. hvc1)")
+	cmd.Flags().StringVar(&session, "session", "", "Imported in this import session")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print matching index records as JSON lines")
+	cmd.Flags().BoolVarP(&print0, "print0", "0", false, "Separate paths with NUL instead of newline, for xargs -0")
+	cmd.Flags().BoolVar(&absolute, "absolute", false, "Print absolute paths instead of library-relative ones")
+
+	return cmd
+}
@@ -7,8 +7,8 @@ import (
 
 	"github.com/askolesov/image-vault/internal/defaults"
 	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/logging"
-	"github.com/askolesov/image-vault/internal/metadata"
 	"github.com/spf13/cobra"
 )
 
@@ -22,7 +22,9 @@ func newImportCmd() *cobra.Command {
 		noSeparateVideo bool
 		noVerify        bool
 		noRandomize     bool
+		noPHash         bool
 		hashAlgo        string
+		extractor       extractorOptions
 	)
 
 	cmd := &cobra.Command{
@@ -40,11 +42,15 @@ func newImportCmd() *cobra.Command {
 				return fmt.Errorf("resolve source path: %w", err)
 			}
 
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, !dryRun); err != nil {
+				return err
+			}
+
 			logger := logging.New(os.Stdout, os.Stderr, isTTY())
 
-			ext, err := metadata.NewExifExtractor()
+			ext, err := newExtractor(extractor, logger)
 			if err != nil {
-				return fmt.Errorf("create exif extractor: %w", err)
+				return err
 			}
 			defer func() { _ = ext.Close() }()
 
@@ -59,6 +65,8 @@ func newImportCmd() *cobra.Command {
 				SkipCompare:   noVerify,
 				Randomize:     !noRandomize,
 				YearFilter:    year,
+
+				NoPerceptualHash: noPHash,
 			}
 
 			imp, err := importer.New(cfg, ext, logger)
@@ -70,14 +78,21 @@ func newImportCmd() *cobra.Command {
 				return err
 			}
 
-			logger.PrintSummary([]logging.SummaryField{
+			summary := []logging.SummaryField{
 				{Label: "Imported", Value: logging.FormatNumber(result.Imported)},
 				{Label: "Skipped", Value: logging.FormatNumber(result.Skipped)},
 				{Label: "Replaced", Value: logging.FormatNumber(result.Replaced)},
 				{Label: "Dropped", Value: logging.FormatNumber(result.Dropped)},
 				{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
 				{Label: "Processed", Value: logging.FormatBytes(result.ProcessedBytes)},
-			})
+			}
+			if result.Derived > 0 {
+				summary = append(summary, logging.SummaryField{Label: "Edited exports", Value: logging.FormatNumber(result.Derived)})
+			}
+			if !dryRun && result.Imported+result.Replaced > 0 {
+				summary = append(summary, logging.SummaryField{Label: "Session", Value: result.Session})
+			}
+			logger.PrintSummary(summary)
 
 			return nil
 		},
@@ -91,7 +106,9 @@ func newImportCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&noSeparateVideo, "no-separate-video", false, "Do not separate video files into a different directory")
 	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Skip hash verification of existing destination files (faster, less safe)")
 	cmd.Flags().BoolVar(&noRandomize, "no-randomize", false, "Import files in directory order instead of randomized")
-	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha256)")
+	cmd.Flags().BoolVar(&noPHash, "no-phash", false, "Skip computing perceptual hashes of imported images (faster); only JPEG, PNG and GIF get one")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
 
 	return cmd
 }
@@ -0,0 +1,80 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newIndexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Maintain the library metadata index",
+	}
+	cmd.AddCommand(newIndexRebuildCmd())
+	return cmd
+}
+
+func newIndexRebuildCmd() *cobra.Command {
+	var (
+		noFailFast bool
+		noPHash    bool
+		hashAlgo   string
+		extractor  extractorOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Regenerate the metadata index from the library files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, false); err != nil {
+				return err
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+
+			ext, err := newExtractor(extractor, logger)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = ext.Close() }()
+
+			result, err := index.Rebuild(index.RebuildConfig{
+				LibraryPath:      libraryPath,
+				HashAlgo:         hashAlgo,
+				NoPerceptualHash: noPHash,
+				FailFast:         !noFailFast,
+			}, ext, logger)
+			if err != nil {
+				return err
+			}
+
+			logger.PrintSummary([]logging.SummaryField{
+				{Label: "Indexed", Value: logging.FormatNumber(result.Indexed)},
+				{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
+			})
+			if result.Errors > 0 {
+				return fmt.Errorf("%d files could not be indexed", result.Errors)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&noFailFast, "no-fail-fast", false, "Continue on errors instead of stopping")
+	cmd.Flags().BoolVar(&noPHash, "no-phash", false, "Skip computing perceptual hashes of images not already hashed; only JPEG, PNG and GIF get one")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
+
+	return cmd
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/verifier"
+	"github.com/spf13/cobra"
+)
+
+func newOwnersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "owners",
+		Short: "List the owner labels of cameras, by serial number (run from library root)",
+		Long: "Owner labels tell apart identical devices: files from a camera with a mapped\n" +
+			"serial number go to \"<Make> <Model> - <Owner> (<type>)\". imv tools info shows\n" +
+			"a file's SerialNumber.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+			c, err := library.LoadConfig(libraryPath)
+			if err != nil {
+				return err
+			}
+			serials := make([]string, 0, len(c.Owners))
+			for s := range c.Owners {
+				serials = append(serials, s)
+			}
+			sort.Strings(serials)
+			for _, s := range serials {
+				fmt.Printf("%s\t%s\n", s, c.Owners[s])
+			}
+			return nil
+		},
+	}
+	cmd.AddCommand(newOwnersSetCmd(), newOwnersUnsetCmd())
+	return cmd
+}
+
+func newOwnersSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <serial> <owner>",
+		Short: "Label the files of the camera with this serial number with an owner",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := library.ValidateOwner(args[1]); err != nil {
+				return err
+			}
+			return updateOwners(func(owners map[string]string) {
+				owners[args[0]] = args[1]
+			})
+		},
+	}
+}
+
+func newOwnersUnsetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "unset <serial>",
+		Short: "Remove the owner label of a camera",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateOwners(func(owners map[string]string) {
+				delete(owners, args[0])
+			})
+		},
+	}
+}
+
+// updateOwners changes the owner mapping of the library in the working
+// directory. Files already in the library keep their device dirs until
+// verify --fix moves them, so the verify caches, which would skip them,
+// are dropped.
+func updateOwners(change func(map[string]string)) error {
+	libraryPath, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+	c, err := library.LoadConfig(libraryPath)
+	if err != nil {
+		return err
+	}
+	if c.Owners == nil {
+		c.Owners = make(map[string]string)
+	}
+	change(c.Owners)
+	if err := library.SaveConfig(libraryPath, c); err != nil {
+		return err
+	}
+	if err := verifier.DropCaches(libraryPath); err != nil {
+		return err
+	}
+	fmt.Println("Run imv verify --fix to move files already in the library.")
+	return nil
+}
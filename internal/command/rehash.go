@@ -0,0 +1,78 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/rehash"
+	"github.com/spf13/cobra"
+)
+
+func newRehashCmd() *cobra.Command {
+	var (
+		to         string
+		noFailFast bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "rehash",
+		Short: "Convert the library to another hash algorithm (run from library root)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+
+			var cache *metadata.Cache
+			if path, err := metadata.DefaultCachePath(); err == nil {
+				if cache, err = metadata.LoadCache(path, metadata.DefaultCacheMaxBytes); err != nil {
+					logger.Warn("metadata cache: %v (continuing without it)", err)
+				}
+			}
+			defer func() {
+				if err := cache.Close(); err != nil {
+					logger.Warn("%v", err)
+				}
+			}()
+
+			result, err := rehash.Run(rehash.Config{
+				LibraryPath:   libraryPath,
+				To:            to,
+				FailFast:      !noFailFast,
+				MetadataCache: cache,
+			}, logger)
+			if err != nil {
+				return err
+			}
+
+			from := strings.Join(result.From, ", ")
+			if from == "" {
+				from = "-"
+			}
+			logger.PrintSummary([]logging.SummaryField{
+				{Label: "From", Value: from},
+				{Label: "Renamed", Value: logging.FormatNumber(result.Renamed)},
+				{Label: "Unchanged", Value: logging.FormatNumber(result.Unchanged)},
+				{Label: "Skipped", Value: logging.FormatNumber(result.Skipped)},
+				{Label: "Mismatched", Value: logging.FormatNumber(result.Mismatched)},
+				{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
+			})
+			if result.Errors > 0 {
+				return fmt.Errorf("%d files could not be rehashed; the library stays marked as being rehashed until imv rehash --to %s completes", result.Errors, to)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "Hash algorithm to convert to (md5, sha1, sha256, blake3, xxh3)")
+	cmd.Flags().BoolVar(&noFailFast, "no-fail-fast", false, "Continue on errors instead of stopping")
+	_ = cmd.MarkFlagRequired("to")
+
+	return cmd
+}
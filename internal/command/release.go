@@ -0,0 +1,98 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newReleaseCmd() *cobra.Command {
+	var (
+		dryRun          bool
+		hashOnly        bool
+		keepAll         bool
+		noSeparateVideo bool
+		hashAlgo        string
+		extractor       extractorOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "release <source-path>...",
+		Short: "Delete source files that are confirmed to be in the library",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, false); err != nil {
+				return err
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+
+			var ext importer.MetadataExtractor
+			if !hashOnly {
+				e, err := newExtractor(extractor, logger)
+				if err != nil {
+					return err
+				}
+				defer func() { _ = e.Close() }()
+				ext = e
+			}
+
+			imp, err := importer.New(importer.Config{
+				LibraryPath:   libraryPath,
+				SeparateVideo: !noSeparateVideo,
+				HashAlgo:      hashAlgo,
+				KeepAll:       keepAll,
+				DryRun:        dryRun,
+			}, ext, logger)
+			if err != nil {
+				return err
+			}
+
+			result, err := imp.Release(args, hashOnly)
+			if err != nil {
+				return err
+			}
+			logger.ClearProgress()
+
+			if len(result.Remaining) > 0 {
+				fmt.Println("Remaining:")
+				for _, r := range result.Remaining {
+					fmt.Printf("  %-25s %s (%s)\n", r.Status, r.Path, r.Reason)
+				}
+			}
+
+			deleted := "Deleted"
+			if dryRun {
+				deleted = "Would delete"
+			}
+			logger.PrintSummary([]logging.SummaryField{
+				{Label: deleted, Value: fmt.Sprintf("%s (%s)", logging.FormatNumber(result.Deleted), logging.FormatBytes(result.DeletedBytes))},
+				{Label: "Remaining", Value: logging.FormatNumber(len(result.Remaining))},
+				{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
+			})
+			if result.Errors > 0 {
+				return fmt.Errorf("%d files could not be deleted", result.Errors)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+	cmd.Flags().BoolVar(&hashOnly, "hash-only", false, "Look files up by content hash alone, without reading metadata")
+	cmd.Flags().BoolVar(&keepAll, "keep-all", false, "Look for non-media files at their import --keep-all path too")
+	cmd.Flags().BoolVar(&noSeparateVideo, "no-separate-video", false, "Expect videos in the same device dir as photos")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
+
+	return cmd
+}
@@ -0,0 +1,122 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/stats"
+	"github.com/spf13/cobra"
+)
+
+func newStatsCmd() *cobra.Command {
+	var (
+		year   string
+		top    int
+		minGap int
+		asJSON bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show library statistics (run from library root)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+			s, err := stats.Collect(stats.Config{
+				LibraryPath: libraryPath,
+				YearFilter:  year,
+				Top:         top,
+				MinGap:      minGap,
+			}, logger)
+			if err != nil {
+				return err
+			}
+			logger.ClearProgress()
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(s); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+				return nil
+			}
+			return printStats(os.Stdout, libraryPath, s)
+		},
+	}
+
+	cmd.Flags().StringVar(&year, "year", "", "Only count files from this year")
+	cmd.Flags().IntVar(&top, "top", stats.DefaultTop, "Number of largest files to list")
+	cmd.Flags().IntVar(&minGap, "min-gap", stats.DefaultMinGap, "Shortest run of days without files to report as a gap")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the statistics as JSON")
+
+	return cmd
+}
+
+func printStats(out io.Writer, libraryPath string, s *stats.Stats) error {
+	fmt.Fprintf(out, "Total: %s files, %s\n", logging.FormatNumber(s.Files), logging.FormatBytes(s.Bytes))
+	if s.Undated > 0 {
+		fmt.Fprintf(out, "Undated: %s files\n", logging.FormatNumber(s.Undated))
+	}
+
+	for _, section := range []struct {
+		title   string
+		buckets []stats.Bucket
+	}{
+		{"Year", s.ByYear},
+		{"Device", s.ByDevice},
+		{"Media type", s.ByMediaType},
+		{"Extension", s.ByExtension},
+	} {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "\n%s\tFiles\tSize\n", section.title)
+		for _, b := range section.buckets {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", b.Key, logging.FormatNumber(b.Files), logging.FormatBytes(b.Bytes))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Growth) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "\nMonth\tFiles\tSize\tTotal files\tTotal size\n")
+		for _, m := range s.Growth {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Month,
+				logging.FormatNumber(m.Files), logging.FormatBytes(m.Bytes),
+				logging.FormatNumber(m.TotalFiles), logging.FormatBytes(m.TotalBytes))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.Largest) > 0 {
+		fmt.Fprintln(out, "\nLargest files")
+		for _, f := range s.Largest {
+			p := f.Path
+			if rel, err := filepath.Rel(libraryPath, p); err == nil {
+				p = rel
+			}
+			fmt.Fprintf(out, "  %10s  %s\n", logging.FormatBytes(f.Size), p)
+		}
+	}
+
+	if len(s.Gaps) > 0 {
+		fmt.Fprintln(out, "\nCoverage gaps")
+		for _, g := range s.Gaps {
+			fmt.Fprintf(out, "  %s – %s  (%d days)\n", g.From.Format("2006-01-02"), g.To.Format("2006-01-02"), g.Days)
+		}
+	}
+	return nil
+}
@@ -12,6 +12,8 @@ func newToolsCmd() *cobra.Command {
 		newToolsScanCmd(),
 		newToolsDiffCmd(),
 		newToolsInfoCmd(),
+		newToolsDupesCmd(),
+		newToolsSimilarCmd(),
 	)
 	return cmd
 }
@@ -0,0 +1,136 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/dupes"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newToolsDupesCmd() *cobra.Command {
+	var (
+		year     string
+		noPixels bool
+		asJSON   bool
+		remove   bool
+		keep     string
+		hashAlgo string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "dupes",
+		Short: "Find duplicate files in the library by content and by pixel data",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+			policy, err := dupes.ParseKeepPolicy(keep)
+			if err != nil {
+				return fmt.Errorf("--keep: %w", err)
+			}
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, false); err != nil {
+				return err
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+			finder, err := dupes.New(dupes.Config{
+				LibraryPath: libraryPath,
+				HashAlgo:    hashAlgo,
+				YearFilter:  year,
+				NoPixels:    noPixels,
+			}, logger)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := finder.Close(); err != nil {
+					logger.Warn("%v", err)
+				}
+			}()
+
+			groups, err := finder.Find()
+			if err != nil {
+				return err
+			}
+			logger.ClearProgress()
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(groups); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+			}
+
+			// Content groups come first, so by the time pixel groups are
+			// handled their byte-identical extras are already gone (or,
+			// without --remove, already counted).
+			removed := make(map[string]bool)
+			var reported, extras, removedCount int
+			var reclaimable int64
+			for _, g := range groups {
+				live := g
+				live.Files = nil
+				for _, f := range g.Files {
+					if !removed[f.Path] {
+						live.Files = append(live.Files, f)
+					}
+				}
+				if len(live.Files) < 2 {
+					continue
+				}
+
+				reported++
+				kept, rest := live.Split(policy)
+				if !asJSON {
+					fmt.Printf("%s %s (%d files)\n", g.Kind, g.Hash, len(live.Files))
+					fmt.Printf("  keep   %s (%s)\n", kept.Path, logging.FormatBytes(kept.Size))
+				}
+				for _, f := range rest {
+					extras++
+					reclaimable += f.Size
+					if !asJSON {
+						fmt.Printf("  extra  %s (%s)\n", f.Path, logging.FormatBytes(f.Size))
+					}
+					if remove {
+						if err := finder.Remove(live, f, kept); err != nil {
+							logger.Error("remove %s: %v", f.Path, err)
+							continue
+						}
+						removedCount++
+					}
+					removed[f.Path] = true
+				}
+			}
+
+			if !asJSON {
+				summary := []logging.SummaryField{
+					{Label: "Groups", Value: logging.FormatNumber(reported)},
+					{Label: "Extra copies", Value: logging.FormatNumber(extras)},
+					{Label: "Reclaimable", Value: logging.FormatBytes(reclaimable)},
+				}
+				if remove {
+					summary = append(summary, logging.SummaryField{Label: "Removed", Value: logging.FormatNumber(removedCount)})
+				}
+				logger.PrintSummary(summary)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&year, "year", "", "Only scan files from this year")
+	cmd.Flags().BoolVar(&noPixels, "no-pixels", false, "Only report byte-identical files, skip pixel-data hashing")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the groups as JSON")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Delete the extra copies, keeping one per group; their sidecars pass to the kept copy")
+	cmd.Flags().StringVar(&keep, "keep", string(dupes.KeepOldest), "Which copy to keep: oldest, newest, largest, smallest, first")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+
+	return cmd
+}
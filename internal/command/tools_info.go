@@ -6,19 +6,21 @@ import (
 	"os"
 
 	"github.com/askolesov/image-vault/internal/defaults"
-	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/logging"
 	"github.com/spf13/cobra"
 )
 
 func newToolsInfoCmd() *cobra.Command {
-	return &cobra.Command{
+	var extractor extractorOptions
+
+	cmd := &cobra.Command{
 		Use:   "info <file>",
 		Short: "Show metadata for a file as JSON",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ext, err := metadata.NewExifExtractor()
+			ext, err := newExtractor(extractor, logging.New(os.Stdout, os.Stderr, isTTY()))
 			if err != nil {
-				return fmt.Errorf("create exif extractor: %w", err)
+				return err
 			}
 			defer func() { _ = ext.Close() }()
 
@@ -41,4 +43,8 @@ func newToolsInfoCmd() *cobra.Command {
 			return nil
 		},
 	}
+
+	addExtractorFlag(cmd, &extractor)
+
+	return cmd
 }
@@ -0,0 +1,93 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/dupes"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newToolsSimilarCmd() *cobra.Command {
+	var (
+		year     string
+		distance int
+		noUpdate bool
+		asJSON   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "similar",
+		Short: "Find visually similar images (resized, re-encoded or screenshotted copies)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if distance < 0 || distance > 64 {
+				return fmt.Errorf("--distance must be between 0 and 64, got %d", distance)
+			}
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+			clusters, err := dupes.FindSimilar(dupes.SimilarConfig{
+				LibraryPath: libraryPath,
+				YearFilter:  year,
+				MaxDistance: distance,
+				NoUpdate:    noUpdate,
+			}, logger)
+			if err != nil {
+				return err
+			}
+			logger.ClearProgress()
+
+			if asJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(clusters); err != nil {
+					return fmt.Errorf("encode JSON: %w", err)
+				}
+				return nil
+			}
+
+			var images int
+			for i, c := range clusters {
+				images += len(c.Files)
+				fmt.Printf("cluster %d (%d images)\n", i+1, len(c.Files))
+				for j, f := range c.Files {
+					var marks []string
+					if j == c.Best {
+						marks = append(marks, "best resolution")
+					}
+					if j == c.Earliest {
+						marks = append(marks, "earliest")
+					}
+					line := fmt.Sprintf("  %s  %dx%d  %s", f.Path, f.Width, f.Height, logging.FormatBytes(f.Size))
+					if !f.Date.IsZero() {
+						line += "  " + f.Date.Format("2006-01-02 15:04:05")
+					}
+					if len(marks) > 0 {
+						line += "  [" + strings.Join(marks, ", ") + "]"
+					}
+					fmt.Println(line)
+				}
+			}
+
+			logger.PrintSummary([]logging.SummaryField{
+				{Label: "Clusters", Value: logging.FormatNumber(len(clusters))},
+				{Label: "Images", Value: logging.FormatNumber(images)},
+			})
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&year, "year", "", "Only scan images from this year")
+	cmd.Flags().IntVar(&distance, "distance", dupes.DefaultMaxDistance, "Maximum Hamming distance (0-64) between perceptual hashes of similar images")
+	cmd.Flags().BoolVar(&noUpdate, "no-update", false, "Only use hashes already in the index, do not hash new images")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the clusters as JSON")
+
+	return cmd
+}
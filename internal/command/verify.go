@@ -2,11 +2,14 @@ package command
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/logging"
-	"github.com/askolesov/image-vault/internal/metadata"
 	"github.com/askolesov/image-vault/internal/verifier"
 	"github.com/spf13/cobra"
 )
@@ -14,12 +17,24 @@ import (
 func newVerifyCmd() *cobra.Command {
 	var (
 		fix         bool
+		fixStruct   bool
+		dryRun      bool
+		planOut     string
+		applyPlan   string
 		fast        bool
 		year        string
 		noFailFast  bool
 		noRandomize bool
 		noCache     bool
+		scrub       bool
+		maxAge      string
+		budget      string
+		sample      string
+		sampleBy    string
 		hashAlgo    string
+		extractor   extractorOptions
+		ignoreKinds []string
+		onlyKinds   []string
 	)
 
 	cmd := &cobra.Command{
@@ -32,11 +47,62 @@ func newVerifyCmd() *cobra.Command {
 				return fmt.Errorf("get working directory: %w", err)
 			}
 
+			ignore, err := parseFindingKinds(ignoreKinds)
+			if err != nil {
+				return fmt.Errorf("--ignore-kind: %w", err)
+			}
+			only, err := parseFindingKinds(onlyKinds)
+			if err != nil {
+				return fmt.Errorf("--only-kind: %w", err)
+			}
+
+			var cfgMaxAge time.Duration
+			if maxAge != "" {
+				if cfgMaxAge, err = verifier.ParseDuration(maxAge); err != nil || cfgMaxAge <= 0 {
+					return fmt.Errorf("--max-age: invalid duration %q", maxAge)
+				}
+			}
+			if dryRun && !fix {
+				return fmt.Errorf("--dry-run requires --fix")
+			}
+			if planOut != "" && !dryRun {
+				return fmt.Errorf("--plan-out requires --dry-run")
+			}
+			if ext := filepath.Ext(planOut); planOut != "" && ext != ".json" && ext != ".sh" {
+				return fmt.Errorf("--plan-out: expected a .json or .sh file, got %q", planOut)
+			}
+
+			var spec verifier.SampleSpec
+			if sample != "" {
+				if spec, err = verifier.ParseSampleSpec(sample); err != nil {
+					return fmt.Errorf("--sample: %w", err)
+				}
+				switch sampleBy {
+				case "count":
+				case "size":
+					spec.BySize = true
+				default:
+					return fmt.Errorf("--sample-weight: expected count or size, got %q", sampleBy)
+				}
+			}
+			var cfgBudget verifier.Budget
+			if budget != "" {
+				if cfgBudget, err = verifier.ParseBudget(budget); err != nil {
+					return fmt.Errorf("--budget: %w", err)
+				}
+			}
+
+			// Only a run that changes the library records its algorithm.
+			writes := (fix || fixStruct || applyPlan != "") && !dryRun
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, writes); err != nil {
+				return err
+			}
+
 			logger := logging.New(os.Stdout, os.Stderr, isTTY())
 
-			ext, err := metadata.NewExifExtractor()
+			ext, err := newExtractor(extractor, logger)
 			if err != nil {
-				return fmt.Errorf("create exif extractor: %w", err)
+				return err
 			}
 			defer func() { _ = ext.Close() }()
 
@@ -46,32 +112,82 @@ func newVerifyCmd() *cobra.Command {
 				HashAlgo:      hashAlgo,
 				FailFast:      !noFailFast,
 				Fix:           fix,
+				FixStructure:  fixStruct,
+				DryRun:        dryRun,
 				Fast:          fast,
 				Randomize:     !noRandomize,
 				YearFilter:    year,
 				NoCache:       noCache,
+				Scrub:         scrub,
+				MaxAge:        cfgMaxAge,
+				Budget:        cfgBudget,
+				IgnoreKinds:   ignore,
+				OnlyKinds:     only,
 			}
 
 			v, err := verifier.New(cfg, ext, logger)
 			if err != nil {
 				return err
 			}
+			if sample != "" {
+				return runSample(v, spec, logger)
+			}
+			if applyPlan != "" {
+				return runApplyPlan(v, applyPlan, logger)
+			}
 			result, err := v.Verify()
 			if err != nil {
 				return err
 			}
 
-			logger.PrintSummary([]logging.SummaryField{
+			summary := []logging.SummaryField{
 				{Label: "Verified", Value: logging.FormatNumber(result.Verified)},
 				{Label: "Cache hits", Value: logging.FormatNumber(result.CacheHits)},
-				{Label: "Inconsistent", Value: logging.FormatNumber(result.Inconsistent)},
-				{Label: "Fixed", Value: logging.FormatNumber(result.Fixed)},
-				{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
-				{Label: "Processed", Value: logging.FormatBytes(result.ProcessedBytes)},
-			})
+			}
+			if cfgBudget.IsSet() {
+				summary = append(summary,
+					logging.SummaryField{Label: "Refreshed", Value: logging.FormatNumber(result.Refreshed)},
+					logging.SummaryField{Label: "Deferred", Value: logging.FormatNumber(result.Deferred)},
+				)
+			}
+			summary = append(summary, logging.SummaryField{Label: "Inconsistent", Value: logging.FormatNumber(result.Inconsistent)})
+			for _, kc := range result.CountByKind() {
+				value := logging.FormatNumber(kc.Count)
+				if kc.Ignored > 0 {
+					value += fmt.Sprintf(" (+%s ignored)", logging.FormatNumber(kc.Ignored))
+				}
+				summary = append(summary, logging.SummaryField{Label: "  " + string(kc.Kind), Value: value})
+			}
+			summary = append(summary,
+				logging.SummaryField{Label: "Corrupted", Value: logging.FormatNumber(result.Corrupted)},
+				logging.SummaryField{Label: "Fixed", Value: logging.FormatNumber(result.Fixed)},
+				logging.SummaryField{Label: "Quarantined", Value: logging.FormatNumber(result.Quarantined)},
+				logging.SummaryField{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
+				logging.SummaryField{Label: "Processed", Value: logging.FormatBytes(result.ProcessedBytes)},
+			)
+			if result.Plan != nil {
+				logger.ClearProgress()
+				printPlan(os.Stdout, result.Plan)
+				summary = append(summary,
+					logging.SummaryField{Label: "Planned moves", Value: logging.FormatNumber(len(result.Plan.Moves))},
+					logging.SummaryField{Label: "Conflicts", Value: logging.FormatNumber(result.Plan.Conflicts())},
+				)
+			}
+			logger.PrintSummary(summary)
+
+			if planOut != "" {
+				if err := writePlan(result.Plan, planOut); err != nil {
+					return fmt.Errorf("write plan: %w", err)
+				}
+				fmt.Fprintf(os.Stderr, "Plan written to %s\n", planOut)
+			}
 
-			if result.Inconsistent > 0 && !fix {
-				return fmt.Errorf("found %d inconsistencies (run with --fix to repair)", result.Inconsistent)
+			if result.Corrupted > 0 {
+				return fmt.Errorf("found %d files whose content no longer matches the recorded hash (restore them from a backup)", result.Corrupted)
+			}
+			// A dry run repairs nothing, whatever it was asked to fix.
+			if unrepaired := countUnrepaired(result, fix && !dryRun, fixStruct && !dryRun); unrepaired > 0 {
+				return fmt.Errorf("found %d inconsistencies (run with --fix or --fix-structure to repair)", unrepaired)
 			}
 
 			return nil
@@ -79,12 +195,150 @@ func newVerifyCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&fix, "fix", false, "Automatically fix inconsistencies")
+	cmd.Flags().BoolVar(&fixStruct, "fix-structure", false, "Re-import stray media and move other unexpected entries to .imv/quarantine/")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --fix, print the relocation plan instead of moving files")
+	cmd.Flags().StringVar(&planOut, "plan-out", "", "With --dry-run, also write the plan as JSON (.json) or a shell script (.sh)")
+	cmd.Flags().StringVar(&applyPlan, "apply-plan", "", "Execute a reviewed JSON plan written by --dry-run --plan-out")
 	cmd.Flags().StringVar(&year, "year", "", "Only verify files from this year")
 	cmd.Flags().BoolVar(&noFailFast, "no-fail-fast", false, "Continue on errors instead of stopping")
 	cmd.Flags().BoolVar(&fast, "fast", false, "Fast mode: validate filenames and structure only, skip hash verification")
 	cmd.Flags().BoolVar(&noRandomize, "no-randomize", false, "Verify files in directory order instead of randomized")
+	cmd.Flags().BoolVar(&scrub, "scrub", false, "Re-hash every file with a recorded full hash and report silent corruption (ignores the cache)")
+	cmd.Flags().StringVar(&maxAge, "max-age", "", "Re-verify files whose cache entry is older than this (e.g. 90d, 12h)")
+	cmd.Flags().StringVar(&budget, "budget", "", "Cap content verification per run by bytes (e.g. 500GB) or time (e.g. 2h); oldest entries are re-verified first")
+	cmd.Flags().StringVar(&sample, "sample", "", "Fully verify a random sample of files, e.g. 2% or 5000, and estimate the error rate")
+	cmd.Flags().StringVar(&sampleBy, "sample-weight", "count", "Sample weighting: count (every file equally likely) or size (proportional to bytes)")
 	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Disable the verification cache for this run (don't read or write .imv/verify.cache)")
-	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha256)")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
+	cmd.Flags().StringSliceVar(&ignoreKinds, "ignore-kind", nil, "Finding kinds that do not fail the run (repeatable or comma-separated)")
+	cmd.Flags().StringSliceVar(&onlyKinds, "only-kind", nil, "Only these finding kinds fail the run (repeatable or comma-separated)")
+
+	cmd.MarkFlagsMutuallyExclusive("sample", "fix")
+	cmd.MarkFlagsMutuallyExclusive("sample", "fix-structure")
+	cmd.MarkFlagsMutuallyExclusive("sample", "apply-plan")
+	cmd.MarkFlagsMutuallyExclusive("apply-plan", "fix")
+	cmd.MarkFlagsMutuallyExclusive("apply-plan", "fix-structure")
+	cmd.MarkFlagsMutuallyExclusive("apply-plan", "fast")
+	cmd.MarkFlagsMutuallyExclusive("apply-plan", "scrub")
+	cmd.MarkFlagsMutuallyExclusive("apply-plan", "budget")
+	cmd.MarkFlagsMutuallyExclusive("sample", "fast")
+	cmd.MarkFlagsMutuallyExclusive("sample", "scrub")
+	cmd.MarkFlagsMutuallyExclusive("sample", "budget")
 
 	return cmd
 }
+
+// runSample runs a sampled verification and prints its estimate.
+func runSample(v *verifier.Verifier, spec verifier.SampleSpec, logger *logging.Logger) error {
+	sr, err := v.Sample(spec)
+	if err != nil {
+		return err
+	}
+
+	unit := "files"
+	if sr.BySize {
+		unit = "bytes"
+	}
+	logger.PrintSummary([]logging.SummaryField{
+		{Label: "Population", Value: fmt.Sprintf("%s files, %s", logging.FormatNumber(sr.Population), logging.FormatBytes(sr.PopulationBytes))},
+		{Label: "Sampled", Value: fmt.Sprintf("%s files, %s", logging.FormatNumber(sr.Sampled), logging.FormatBytes(sr.SampledBytes))},
+		{Label: "Failed", Value: logging.FormatNumber(sr.Failed)},
+		{Label: "Estimated error rate", Value: fmt.Sprintf("%.2f%% of %s (95%% CI %.2f%%–%.2f%%)", sr.ErrorRate*100, unit, sr.Low*100, sr.High*100)},
+	})
+
+	if sr.Failed > 0 {
+		return fmt.Errorf("%d of %d sampled files failed verification", sr.Failed, sr.Sampled)
+	}
+	return nil
+}
+
+// printPlan lists the moves of a dry run, marking duplicates and conflicts.
+func printPlan(w io.Writer, plan *verifier.Plan) {
+	for _, m := range plan.Moves {
+		note := ""
+		switch {
+		case m.Conflict != "":
+			note = "  [CONFLICT: " + m.Conflict + "]"
+		case m.Duplicate:
+			note = "  [duplicate: source will be removed]"
+		}
+		_, _ = fmt.Fprintf(w, "%s → %s%s\n", m.From, m.To, note)
+	}
+}
+
+// writePlan saves the plan as JSON or, for a .sh path, as a shell script.
+func writePlan(plan *verifier.Plan, path string) error {
+	if filepath.Ext(path) == ".json" {
+		return plan.SaveToFile(path)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	if err := plan.WriteScript(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// runApplyPlan executes a reviewed plan file.
+func runApplyPlan(v *verifier.Verifier, path string, logger *logging.Logger) error {
+	plan, err := verifier.LoadPlanFromFile(path)
+	if err != nil {
+		return fmt.Errorf("load plan: %w", err)
+	}
+	res, err := v.ApplyPlan(plan)
+	if err != nil {
+		return err
+	}
+
+	logger.PrintSummary([]logging.SummaryField{
+		{Label: "Moved", Value: logging.FormatNumber(res.Moved)},
+		{Label: "Skipped", Value: logging.FormatNumber(res.Skipped)},
+		{Label: "Errors", Value: logging.FormatNumber(res.Errors)},
+	})
+
+	if res.Errors > 0 {
+		return fmt.Errorf("%d moves failed", res.Errors)
+	}
+	return nil
+}
+
+// countUnrepaired returns how many failing findings the run did not
+// attempt to repair. --fix covers every finding, as it always has;
+// --fix-structure covers misplaced entries and directories.
+func countUnrepaired(result *verifier.Result, fix, fixStruct bool) int {
+	if fix {
+		return 0
+	}
+	if !fixStruct {
+		return result.Inconsistent
+	}
+	n := 0
+	for _, f := range result.Findings {
+		if f.Ignored {
+			continue
+		}
+		switch f.Kind {
+		case verifier.FindingUnexpectedEntry, verifier.FindingInvalidDeviceDir, verifier.FindingInvalidDateDir:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// parseFindingKinds converts flag values to verifier finding kinds.
+func parseFindingKinds(names []string) ([]verifier.FindingKind, error) {
+	kinds := make([]verifier.FindingKind, 0, len(names))
+	for _, n := range names {
+		k, err := verifier.ParseFindingKind(n)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
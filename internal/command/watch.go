@@ -0,0 +1,123 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	var (
+		move            bool
+		keepAll         bool
+		noSeparateVideo bool
+		noVerify        bool
+		noPHash         bool
+		settle          time.Duration
+		hashAlgo        string
+		extractor       extractorOptions
+	)
+
+	cmd := &cobra.Command{
+		Use:   "watch <source-path>",
+		Short: "Import files from a source directory as they arrive (run from library root)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			libraryPath, err := os.Getwd()
+			if err != nil {
+				return fmt.Errorf("get working directory: %w", err)
+			}
+
+			sourcePath, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("resolve source path: %w", err)
+			}
+
+			if err := library.CheckHashAlgo(libraryPath, hashAlgo, true); err != nil {
+				return err
+			}
+
+			logger := logging.New(os.Stdout, os.Stderr, isTTY())
+
+			ext, err := newExtractor(extractor, logger)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = ext.Close() }()
+
+			imp, err := importer.New(importer.Config{
+				LibraryPath:   libraryPath,
+				SeparateVideo: !noSeparateVideo,
+				HashAlgo:      hashAlgo,
+				KeepAll:       keepAll,
+				Move:          move,
+				SkipCompare:   noVerify,
+
+				NoPerceptualHash: noPHash,
+			}, ext, logger)
+			if err != nil {
+				return err
+			}
+
+			w, err := watcher.New(watcher.Config{
+				SourceDir:   sourcePath,
+				LibraryPath: libraryPath,
+				Settle:      settle,
+			}, imp, logger)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			go func() {
+				<-ctx.Done()
+				// A second signal kills the process as usual.
+				stop()
+				logger.Info("shutting down after the current batch")
+			}()
+
+			result, err := w.Run(ctx)
+			if result != nil {
+				summary := []logging.SummaryField{
+					{Label: "Imported", Value: logging.FormatNumber(result.Imported)},
+					{Label: "Skipped", Value: logging.FormatNumber(result.Skipped)},
+					{Label: "Replaced", Value: logging.FormatNumber(result.Replaced)},
+					{Label: "Dropped", Value: logging.FormatNumber(result.Dropped)},
+					{Label: "Errors", Value: logging.FormatNumber(result.Errors)},
+					{Label: "Processed", Value: logging.FormatBytes(result.ProcessedBytes)},
+				}
+				if result.Derived > 0 {
+					summary = append(summary, logging.SummaryField{Label: "Edited exports", Value: logging.FormatNumber(result.Derived)})
+				}
+				if result.Imported+result.Replaced > 0 {
+					summary = append(summary, logging.SummaryField{Label: "Session", Value: result.Session})
+				}
+				logger.PrintSummary(summary)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&move, "move", false, "Move files instead of copying")
+	cmd.Flags().BoolVar(&keepAll, "keep-all", false, "Keep non-media files")
+	cmd.Flags().BoolVar(&noSeparateVideo, "no-separate-video", false, "Do not separate video files into a different directory")
+	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Skip hash verification of existing destination files (faster, less safe)")
+	cmd.Flags().BoolVar(&noPHash, "no-phash", false, "Skip computing perceptual hashes of imported images (faster); only JPEG, PNG and GIF get one")
+	cmd.Flags().DurationVar(&settle, "settle", watcher.DefaultSettle, "How long a file must stay unchanged before it is imported")
+	cmd.Flags().StringVar(&hashAlgo, "hash-algo", defaults.DefaultHashAlgorithm, "Hash algorithm to use (md5, sha1, sha256, blake3, xxh3)")
+	addExtractorFlag(cmd, &extractor)
+
+	return cmd
+}
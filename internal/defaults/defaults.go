@@ -2,10 +2,15 @@ package defaults
 
 import (
 	"crypto/md5"
+	"crypto/sha1"
 	"crypto/sha256"
 	"fmt"
 	"hash"
+	"slices"
 	"strings"
+
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 )
 
 // MediaType represents the type of media file.
@@ -68,6 +73,29 @@ func IsSidecarExtension(ext string) bool {
 	return ok
 }
 
+// EditingSoftware lists the names that mark a file as an edited export
+// rather than a camera original when they appear as whole words, ignoring
+// case, in its Software or XMP history tags, unless a library's settings
+// replace them. Camera firmware versions match none of them.
+var EditingSoftware = []string{
+	"Lightroom",
+	"Photoshop",
+	"Snapseed",
+	"Photos",
+	"GIMP",
+	"Affinity Photo",
+	"Capture One",
+	"darktable",
+	"RawTherapee",
+	"Luminar",
+	"Pixelmator",
+	"Picasa",
+	"DxO PhotoLab",
+	"ON1 Photo",
+	"VSCO",
+	"Instagram",
+}
+
 // MediaTypeFromMIME classifies a MIME type string into a MediaType.
 func MediaTypeFromMIME(mime string) MediaType {
 	if mime == "" {
@@ -113,22 +141,39 @@ func NormalizeModel(model string) string {
 // DefaultHashAlgorithm is the default hash algorithm used for file hashing.
 const DefaultHashAlgorithm = "md5"
 
+// HashAlgorithms lists the supported hash algorithms. blake3 is fast
+// and cryptographic; xxh3 is faster still but only fit for telling files
+// apart, not for proving they were not tampered with; sha1 reads
+// manifests written with it.
+var HashAlgorithms = []string{"md5", "sha1", "sha256", "blake3", "xxh3"}
+
+// IsHashAlgorithm reports whether algo is a supported hash algorithm.
+func IsHashAlgorithm(algo string) bool {
+	return slices.Contains(HashAlgorithms, algo)
+}
+
 // Hasher wraps a hash algorithm with convenience methods.
 type Hasher struct {
 	algo    string
 	newFunc func() hash.Hash
 }
 
-// NewHasher creates a new Hasher for the given algorithm.
-// Supported algorithms: "md5", "sha256".
+// NewHasher creates a new Hasher for the given algorithm, one of
+// HashAlgorithms.
 func NewHasher(algo string) (*Hasher, error) {
 	var newFunc func() hash.Hash
 
 	switch algo {
 	case "md5":
 		newFunc = md5.New
+	case "sha1":
+		newFunc = sha1.New
 	case "sha256":
 		newFunc = sha256.New
+	case "blake3":
+		newFunc = func() hash.Hash { return blake3.New() }
+	case "xxh3":
+		newFunc = func() hash.Hash { return xxh3.New() }
 	default:
 		return nil, fmt.Errorf("unsupported hash algorithm: %s", algo)
 	}
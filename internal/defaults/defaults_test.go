@@ -1,6 +1,7 @@
 package defaults
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -114,6 +115,42 @@ func TestNewHasher(t *testing.T) {
 		assert.NotNil(t, h.New())
 	})
 
+	t.Run("digests", func(t *testing.T) {
+		want := map[string]string{
+			"md5":    "900150983cd24fb0d6963f7d28e17f72",
+			"sha1":   "a9993e364706816aba3e25717850c26c9cd0d89d",
+			"sha256": "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+			"blake3": "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85",
+			"xxh3":   "78af5f94892f3950",
+		}
+		for _, algo := range HashAlgorithms {
+			h, err := NewHasher(algo)
+			require.NoError(t, err)
+			assert.Equal(t, algo, h.Algo())
+			d := h.New()
+			_, _ = d.Write([]byte("abc"))
+			assert.Equal(t, want[algo], hex.EncodeToString(d.Sum(nil)), algo)
+			assert.True(t, IsHashAlgorithm(algo))
+		}
+		assert.False(t, IsHashAlgorithm("sha512"))
+	})
+
+	t.Run("xxh3 long input", func(t *testing.T) {
+		// Past the streaming buffer and across stripe blocks, so sums
+		// recorded in existing libraries stay valid.
+		data := make([]byte, 100003)
+		for i := range data {
+			data[i] = byte(uint32(i) * 2654435761 >> 13)
+		}
+		h, err := NewHasher("xxh3")
+		require.NoError(t, err)
+		d := h.New()
+		for i := 0; i < len(data); i += 4096 {
+			_, _ = d.Write(data[i:min(i+4096, len(data))])
+		}
+		assert.Equal(t, "25ba638a3c66d20f", hex.EncodeToString(d.Sum(nil)))
+	})
+
 	t.Run("unsupported", func(t *testing.T) {
 		h, err := NewHasher("sha512")
 		assert.Error(t, err)
@@ -131,6 +168,26 @@ func TestHasherShortLen(t *testing.T) {
 	assert.Equal(t, 8, h.ShortLen())
 }
 
+func BenchmarkHashers(b *testing.B) {
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	for _, algo := range HashAlgorithms {
+		b.Run(algo, func(b *testing.B) {
+			h, err := NewHasher(algo)
+			require.NoError(b, err)
+			d := h.New()
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				d.Reset()
+				_, _ = d.Write(data)
+				d.Sum(nil)
+			}
+		})
+	}
+}
+
 func TestDefaultHashAlgorithm(t *testing.T) {
 	assert.Equal(t, "md5", DefaultHashAlgorithm)
 }
@@ -0,0 +1,410 @@
+package dupes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+)
+
+// Kind says what the files of a group have in common.
+type Kind string
+
+const (
+	// KindContent groups byte-identical files.
+	KindContent Kind = "content"
+	// KindPixels groups files whose image data is identical but whose
+	// metadata differs.
+	KindPixels Kind = "pixels"
+)
+
+// File is one library source file considered for duplicate detection.
+type File struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	Date      time.Time `json:"date"`
+	FullHash  string    `json:"full_hash"`
+	PixelHash string    `json:"pixel_hash,omitempty"`
+}
+
+// Group is a set of files sharing a content or pixel hash.
+type Group struct {
+	Kind  Kind   `json:"kind"`
+	Hash  string `json:"hash"`
+	Files []File `json:"files"`
+}
+
+// Config controls which files are scanned and how.
+type Config struct {
+	LibraryPath string
+	HashAlgo    string
+	YearFilter  string
+	// NoPixels skips pixel hashing, reporting byte-identical files only.
+	NoPixels bool
+}
+
+// Finder scans a library for duplicate files.
+type Finder struct {
+	cfg    Config
+	logger *logging.Logger
+	hasher *defaults.Hasher
+
+	// manifests holds the hash manifest of every year scanned, keyed by
+	// year dir name; Remove forgets removed files in them.
+	manifests map[string]*library.Manifest
+	// idx is the library index, loaded by the first Remove.
+	idx       *index.Index
+	idxLoaded bool
+}
+
+// New creates a Finder. Returns an error for an unsupported cfg.HashAlgo.
+func New(cfg Config, logger *logging.Logger) (*Finder, error) {
+	hasher, err := defaults.NewHasher(cfg.HashAlgo)
+	if err != nil {
+		return nil, fmt.Errorf("dupes: %w", err)
+	}
+	return &Finder{cfg: cfg, logger: logger, hasher: hasher, manifests: make(map[string]*library.Manifest)}, nil
+}
+
+// Find hashes every source file (reusing full hashes recorded in the year
+// manifests) and returns the duplicate groups: content groups first, then
+// pixel groups whose members are not all byte-identical. Groups and the
+// files in them are sorted by path.
+func (f *Finder) Find() ([]Group, error) {
+	files, err := f.collect()
+	if err != nil {
+		return nil, err
+	}
+
+	byContent := make(map[string][]File)
+	byPixels := make(map[string][]File)
+	for _, file := range files {
+		byContent[file.FullHash] = append(byContent[file.FullHash], file)
+		if file.PixelHash != "" {
+			byPixels[file.PixelHash] = append(byPixels[file.PixelHash], file)
+		}
+	}
+
+	var groups []Group
+	for h, fs := range byContent {
+		if len(fs) > 1 {
+			groups = append(groups, Group{Kind: KindContent, Hash: h, Files: fs})
+		}
+	}
+	for h, fs := range byPixels {
+		if len(fs) > 1 && !sameContent(fs) {
+			groups = append(groups, Group{Kind: KindPixels, Hash: h, Files: fs})
+		}
+	}
+
+	for _, g := range groups {
+		sort.Slice(g.Files, func(i, j int) bool { return g.Files[i].Path < g.Files[j].Path })
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Kind != groups[j].Kind {
+			return groups[i].Kind == KindContent
+		}
+		return groups[i].Files[0].Path < groups[j].Files[0].Path
+	})
+	return groups, nil
+}
+
+func sameContent(fs []File) bool {
+	for _, f := range fs[1:] {
+		if f.FullHash != fs[0].FullHash {
+			return false
+		}
+	}
+	return true
+}
+
+// collect hashes every primary source file of the selected years.
+func (f *Finder) collect() ([]File, error) {
+	years, err := library.ListYearsFiltered(f.cfg.LibraryPath, f.cfg.YearFilter)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+
+	type pending struct {
+		path, year, rel string
+	}
+	var paths []pending
+	for _, year := range years {
+		yearDir := filepath.Join(f.cfg.LibraryPath, year)
+		found, err := library.ListSourceFiles(yearDir)
+		if err != nil {
+			return nil, fmt.Errorf("list source files for %s: %w", year, err)
+		}
+		for _, p := range found {
+			base := filepath.Base(p)
+			if defaults.IsIgnoredFile(base) || defaults.IsSidecarExtension(filepath.Ext(base)) {
+				continue
+			}
+			rel, err := filepath.Rel(yearDir, p)
+			if err != nil {
+				continue
+			}
+			paths = append(paths, pending{path: p, year: year, rel: filepath.ToSlash(rel)})
+		}
+	}
+
+	files := make([]File, 0, len(paths))
+	for i, p := range paths {
+		f.logger.ProgressWithStats(i+1, len(paths), "[hash] ", "", p.path)
+
+		info, err := os.Stat(p.path)
+		if err != nil {
+			f.logger.Warn("stat %s: %v", p.path, err)
+			continue
+		}
+		file := File{Path: p.path, Size: info.Size()}
+		if parsed, err := pathbuilder.ParseSourceFilename(filepath.Base(p.path)); err == nil {
+			file.Date = parsed.DateTime
+		}
+
+		m, ok := f.manifests[p.year]
+		if !ok {
+			m, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(f.cfg.LibraryPath, p.year)))
+			if err != nil {
+				f.logger.Warn("hash manifest for %s: load failed: %v", p.year, err)
+			}
+			f.manifests[p.year] = m
+		}
+		if e, ok := m.Lookup(p.rel); ok && e.HashAlgo == f.cfg.HashAlgo {
+			file.FullHash = e.FullHash
+		} else if file.FullHash, _, err = metadata.ComputeFileHash(p.path, f.hasher); err != nil {
+			f.logger.Warn("hash %s: %v", p.path, err)
+			continue
+		}
+
+		if !f.cfg.NoPixels {
+			if sum, ok, err := PixelHash(p.path, f.hasher.New); err != nil {
+				f.logger.Warn("pixel hash %s: %v", p.path, err)
+			} else if ok {
+				file.PixelHash = sum
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// KeepPolicy chooses which file of a group survives removal.
+type KeepPolicy string
+
+const (
+	// KeepOldest keeps the file with the earliest capture date.
+	KeepOldest KeepPolicy = "oldest"
+	// KeepNewest keeps the file with the latest capture date.
+	KeepNewest KeepPolicy = "newest"
+	// KeepLargest keeps the biggest file — for pixel duplicates, the one
+	// with the most metadata.
+	KeepLargest KeepPolicy = "largest"
+	// KeepSmallest keeps the smallest file.
+	KeepSmallest KeepPolicy = "smallest"
+	// KeepFirst keeps the first file in path order.
+	KeepFirst KeepPolicy = "first"
+)
+
+// KeepPolicies lists every policy.
+var KeepPolicies = []KeepPolicy{KeepOldest, KeepNewest, KeepLargest, KeepSmallest, KeepFirst}
+
+// ParseKeepPolicy returns the policy named s.
+func ParseKeepPolicy(s string) (KeepPolicy, error) {
+	names := make([]string, len(KeepPolicies))
+	for i, p := range KeepPolicies {
+		if string(p) == s {
+			return p, nil
+		}
+		names[i] = string(p)
+	}
+	return "", fmt.Errorf("unknown keep policy %q (valid: %s)", s, strings.Join(names, ", "))
+}
+
+// Split returns the file the policy keeps and the extras. Ties fall back
+// to path order, so the choice is deterministic.
+func (g Group) Split(policy KeepPolicy) (keep File, extras []File) {
+	best := 0
+	for i := 1; i < len(g.Files); i++ {
+		if better(g.Files[i], g.Files[best], policy) {
+			best = i
+		}
+	}
+	for i, f := range g.Files {
+		if i != best {
+			extras = append(extras, f)
+		}
+	}
+	return g.Files[best], extras
+}
+
+func better(a, b File, policy KeepPolicy) bool {
+	switch policy {
+	case KeepOldest:
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+	case KeepNewest:
+		if !a.Date.Equal(b.Date) {
+			return a.Date.After(b.Date)
+		}
+	case KeepLargest:
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	case KeepSmallest:
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+	}
+	return a.Path < b.Path
+}
+
+// Remove deletes extra, a duplicate of keep in group g found by Find, and
+// forgets it in the library index and its year's manifest. Both files are
+// re-hashed first, as g may come from manifest hashes: when either no
+// longer has g's hash, nothing is removed. Its sidecars pass to keep before
+// extra goes: each is moved next to keep when keep has none of its kind,
+// and dropped when keep's is identical. When keep has a different one,
+// nothing is removed, as the edits in it would be lost.
+func (f *Finder) Remove(g Group, extra, keep File) error {
+	for _, path := range []string{keep.Path, extra.Path} {
+		if err := f.recheck(g, path); err != nil {
+			return err
+		}
+	}
+
+	sidecars, err := findSidecars(extra.Path)
+	if err != nil {
+		return err
+	}
+	moves := make(map[string]string)
+	var drops []string
+	for _, sc := range sidecars {
+		target := pathbuilder.BuildSidecarPath(keep.Path, filepath.Ext(sc))
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			moves[sc] = target
+			continue
+		}
+		same, err := f.sameContent(sc, target)
+		if err != nil {
+			return err
+		}
+		if !same {
+			return fmt.Errorf("sidecar %s differs from %s; merge them by hand first", sc, target)
+		}
+		drops = append(drops, sc)
+	}
+
+	for sc, target := range moves {
+		if err := os.Rename(sc, target); err != nil {
+			return fmt.Errorf("move sidecar: %w", err)
+		}
+	}
+	for _, sc := range drops {
+		if err := os.Remove(sc); err != nil {
+			return fmt.Errorf("remove sidecar: %w", err)
+		}
+	}
+	if err := os.Remove(extra.Path); err != nil {
+		return fmt.Errorf("remove: %w", err)
+	}
+	f.forget(extra.Path)
+	return nil
+}
+
+// recheck re-hashes path the way g was formed and fails unless it still
+// has g's hash.
+func (f *Finder) recheck(g Group, path string) error {
+	var sum string
+	var err error
+	if g.Kind == KindPixels {
+		sum, _, err = PixelHash(path, f.hasher.New)
+	} else {
+		sum, _, err = metadata.ComputeFileHash(path, f.hasher)
+	}
+	if err != nil {
+		return fmt.Errorf("rehash %s: %w", path, err)
+	}
+	if g.Hash == "" || sum != g.Hash {
+		return fmt.Errorf("%s no longer matches %s group %s; run verify first", path, g.Kind, g.Hash)
+	}
+	return nil
+}
+
+// Close flushes the manifests and index Remove changed.
+func (f *Finder) Close() error {
+	for year, m := range f.manifests {
+		if m.Dirty() {
+			if err := m.Persist(); err != nil {
+				return fmt.Errorf("hash manifest for %s: %w", year, err)
+			}
+		}
+	}
+	err := f.idx.Close()
+	f.idx, f.idxLoaded = nil, false
+	return err
+}
+
+// forget drops a removed library file from its year's manifest and the
+// library index.
+func (f *Finder) forget(path string) {
+	rel, err := filepath.Rel(f.cfg.LibraryPath, path)
+	if err != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+	if year, relToYear, ok := strings.Cut(rel, "/"); ok {
+		f.manifests[year].Delete(relToYear)
+	}
+	if !f.idxLoaded {
+		f.idxLoaded = true
+		if f.idx, err = index.Load(index.FilePath(f.cfg.LibraryPath)); err != nil {
+			f.logger.Warn("library index: load failed: %v", err)
+		}
+	}
+	if err := f.idx.Delete(rel); err != nil {
+		f.logger.Warn("index %s: %v", rel, err)
+	}
+}
+
+func (f *Finder) sameContent(a, b string) (bool, error) {
+	ha, _, err := metadata.ComputeFileHash(a, f.hasher)
+	if err != nil {
+		return false, err
+	}
+	hb, _, err := metadata.ComputeFileHash(b, f.hasher)
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
+
+// findSidecars returns the sidecars beside path: files with its name and
+// a sidecar extension.
+func findSidecars(path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+	var sidecars []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && defaults.IsSidecarExtension(filepath.Ext(name)) &&
+			strings.TrimSuffix(name, filepath.Ext(name)) == stem {
+			sidecars = append(sidecars, filepath.Join(dir, name))
+		}
+	}
+	return sidecars, nil
+}
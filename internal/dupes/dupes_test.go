@@ -0,0 +1,180 @@
+package dupes
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestFindGroupsByContentAndPixels(t *testing.T) {
+	libDir := t.TempDir()
+	dev := filepath.Join(libDir, "2024", "sources", "Apple iPhone (image)")
+	orig := encodeJPEG(t, 10)
+	edited := withJPEGSegment(orig, 0xE1, "Exif\x00\x00other date")
+
+	a := filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_aaaaaaaa.jpg")
+	b := filepath.Join(dev, "2024-03-01", "2024-03-01_09-00-00_aaaaaaaa.jpg")
+	c := filepath.Join(dev, "2024-06-01", "2024-06-01_10-00-00_cccccccc.jpg")
+	writeFile(t, a, orig)
+	writeFile(t, b, orig)
+	writeFile(t, c, edited)
+	writeFile(t, filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_aaaaaaaa.xmp"), []byte("xmp"))
+	writeFile(t, filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_dddddddd.jpg"), encodeJPEG(t, 99))
+
+	f, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	groups, err := f.Find()
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+
+	assert.Equal(t, KindContent, groups[0].Kind)
+	require.Len(t, groups[0].Files, 2)
+	assert.Equal(t, a, groups[0].Files[0].Path)
+	assert.Equal(t, b, groups[0].Files[1].Path)
+	assert.Equal(t, int64(len(orig)), groups[0].Files[0].Size)
+
+	assert.Equal(t, KindPixels, groups[1].Kind)
+	assert.Len(t, groups[1].Files, 3)
+
+	// A pixel duplicate is re-checked by its pixels, not its bytes.
+	require.NoError(t, f.Remove(groups[1], File{Path: c}, File{Path: a}))
+	assert.NoFileExists(t, c)
+	require.NoError(t, f.Close())
+
+	f, err = New(Config{LibraryPath: libDir, HashAlgo: "md5", NoPixels: true}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	groups, err = f.Find()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, KindContent, groups[0].Kind)
+}
+
+func TestGroupSplit(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	g := Group{Files: []File{
+		{Path: "a", Size: 10, Date: day(3)},
+		{Path: "b", Size: 30, Date: day(1)},
+		{Path: "c", Size: 20, Date: day(2)},
+	}}
+
+	tests := map[KeepPolicy]string{
+		KeepOldest:   "b",
+		KeepNewest:   "a",
+		KeepLargest:  "b",
+		KeepSmallest: "a",
+		KeepFirst:    "a",
+	}
+	for policy, want := range tests {
+		keep, extras := g.Split(policy)
+		assert.Equal(t, want, keep.Path, policy)
+		assert.Len(t, extras, 2, policy)
+	}
+
+	// Ties fall back to path order.
+	tie := Group{Files: []File{{Path: "z", Size: 1}, {Path: "m", Size: 1}}}
+	keep, _ := tie.Split(KeepLargest)
+	assert.Equal(t, "m", keep.Path)
+}
+
+func TestParseKeepPolicy(t *testing.T) {
+	p, err := ParseKeepPolicy("largest")
+	require.NoError(t, err)
+	assert.Equal(t, KeepLargest, p)
+	_, err = ParseKeepPolicy("best")
+	assert.Error(t, err)
+}
+
+func TestRemoveHandsSidecarsToKeptCopy(t *testing.T) {
+	libDir := t.TempDir()
+	dev := filepath.Join(libDir, "2024", "sources", "Apple iPhone (image)")
+	keep := filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_aaaaaaaa.jpg")
+	moved := filepath.Join(dev, "2024-03-01", "2024-03-01_09-00-00_aaaaaaaa.jpg")
+	same := filepath.Join(dev, "2024-03-02", "2024-03-02_09-00-00_aaaaaaaa.jpg")
+	clash := filepath.Join(dev, "2024-03-03", "2024-03-03_09-00-00_aaaaaaaa.jpg")
+	sidecar := func(p string) string { return strings.TrimSuffix(p, ".jpg") + ".xmp" }
+	for _, p := range []string{keep, moved, same, clash} {
+		writeFile(t, p, []byte("jpg"))
+	}
+	writeFile(t, sidecar(moved), []byte("rating 5"))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+	sum, _, err := metadata.ComputeFileHash(keep, hasher)
+	require.NoError(t, err)
+	g := Group{Kind: KindContent, Hash: sum}
+
+	m, err := library.LoadManifest(library.ManifestFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	for _, p := range []string{keep, moved} {
+		rel, _ := filepath.Rel(libDir, p)
+		require.NoError(t, m.Record(library.ManifestEntry{RelPath: strings.TrimPrefix(filepath.ToSlash(rel), "2024/"), HashAlgo: "md5", FullHash: sum}))
+		require.NoError(t, ix.Put(index.Record{Path: filepath.ToSlash(rel)}))
+	}
+	require.NoError(t, m.Persist())
+	require.NoError(t, ix.Close())
+
+	f, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", NoPixels: true}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	_, err = f.Find()
+	require.NoError(t, err)
+
+	// The kept copy has no sidecar: the extra's moves to it.
+	require.NoError(t, f.Remove(g, File{Path: moved}, File{Path: keep}))
+	assert.NoFileExists(t, moved)
+	assert.NoFileExists(t, sidecar(moved))
+	data, err := os.ReadFile(sidecar(keep))
+	require.NoError(t, err)
+	assert.Equal(t, "rating 5", string(data))
+
+	// An identical sidecar is dropped.
+	writeFile(t, sidecar(same), []byte("rating 5"))
+	require.NoError(t, f.Remove(g, File{Path: same}, File{Path: keep}))
+	assert.NoFileExists(t, same)
+	assert.NoFileExists(t, sidecar(same))
+
+	// A different one is not lost: nothing is removed.
+	writeFile(t, sidecar(clash), []byte("rating 1"))
+	assert.ErrorContains(t, f.Remove(g, File{Path: clash}, File{Path: keep}), "merge them by hand")
+	assert.FileExists(t, clash)
+	assert.FileExists(t, sidecar(clash))
+
+	// A stale group hash, or a kept copy that rotted since, removes nothing.
+	assert.ErrorContains(t, f.Remove(Group{Kind: KindContent, Hash: "stale"}, File{Path: clash}, File{Path: keep}), "no longer matches")
+	data, err = os.ReadFile(keep)
+	require.NoError(t, err)
+	writeFile(t, keep, []byte("jpG"))
+	assert.ErrorContains(t, f.Remove(g, File{Path: clash}, File{Path: keep}), "no longer matches")
+	assert.FileExists(t, clash)
+	assert.FileExists(t, sidecar(clash))
+	writeFile(t, keep, data)
+	require.NoError(t, f.Close())
+
+	// The removed copy is forgotten in the manifest and the index.
+	m, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	assert.Len(t, m.Entries(), 1)
+	ix, err = index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	defer ix.Close()
+	assert.Equal(t, 1, ix.Len())
+	rel, _ := filepath.Rel(libDir, keep)
+	_, ok := ix.Get(filepath.ToSlash(rel))
+	assert.True(t, ok)
+}
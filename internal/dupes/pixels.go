@@ -0,0 +1,138 @@
+package dupes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// PixelHash hashes the image data of a JPEG or PNG file, leaving out
+// metadata: JPEG APPn (EXIF, XMP, ICC, JFIF) and COM segments, and every
+// PNG chunk except IHDR, PLTE and IDAT. Two files that differ only in
+// their metadata get the same pixel hash. ok is false for other formats.
+func PixelHash(path string, newHash func() hash.Hash) (sum string, ok bool, err error) {
+	var hashFn func(*bufio.Reader, hash.Hash) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		hashFn = hashJPEGPixels
+	case ".png":
+		hashFn = hashPNGPixels
+	default:
+		return "", false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := newHash()
+	if err := hashFn(bufio.NewReader(f), h); err != nil {
+		return "", false, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true, nil
+}
+
+// hashJPEGPixels walks the marker segments up to the first start-of-scan,
+// hashing all but APPn and COM, then hashes the rest of the file as is.
+func hashJPEGPixels(r *bufio.Reader, h hash.Hash) error {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return errors.New("not a JPEG file")
+	}
+
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("read marker: %w", err)
+		}
+		if b != 0xFF {
+			return fmt.Errorf("expected marker, got 0x%02x", b)
+		}
+		marker, err := r.ReadByte()
+		for err == nil && marker == 0xFF { // fill bytes
+			marker, err = r.ReadByte()
+		}
+		if err != nil {
+			return fmt.Errorf("read marker: %w", err)
+		}
+
+		// Standalone markers carry no length.
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			h.Write([]byte{0xFF, marker})
+			continue
+		}
+		if marker == 0xD9 {
+			return nil
+		}
+
+		var lenBuf [2]byte
+		if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+			return fmt.Errorf("read segment length: %w", err)
+		}
+		n := int64(binary.BigEndian.Uint16(lenBuf[:])) - 2
+		if n < 0 {
+			return errors.New("invalid segment length")
+		}
+
+		if (marker >= 0xE0 && marker <= 0xEF) || marker == 0xFE {
+			if _, err := io.CopyN(io.Discard, r, n); err != nil {
+				return fmt.Errorf("skip segment: %w", err)
+			}
+			continue
+		}
+
+		h.Write([]byte{0xFF, marker})
+		h.Write(lenBuf[:])
+		if marker == 0xDA {
+			// Start of scan: entropy-coded data and any later segments
+			// are all image data.
+			_, err := io.Copy(h, r)
+			return err
+		}
+		if _, err := io.CopyN(h, r, n); err != nil {
+			return fmt.Errorf("read segment: %w", err)
+		}
+	}
+}
+
+// hashPNGPixels hashes the type and data of the IHDR, PLTE and IDAT chunks.
+func hashPNGPixels(r *bufio.Reader, h hash.Hash) error {
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, sig); err != nil || !bytes.Equal(sig, pngSignature) {
+		return errors.New("not a PNG file")
+	}
+
+	var hdr [8]byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return fmt.Errorf("read chunk header: %w", err)
+		}
+		n := int64(binary.BigEndian.Uint32(hdr[:4]))
+		typ := string(hdr[4:])
+
+		dst := io.Discard
+		switch typ {
+		case "IHDR", "PLTE", "IDAT":
+			h.Write(hdr[4:])
+			dst = h
+		}
+		if _, err := io.CopyN(dst, r, n+4); err != nil { // data + CRC
+			return fmt.Errorf("read %s chunk: %w", typ, err)
+		}
+		if typ == "IEND" {
+			return nil
+		}
+	}
+}
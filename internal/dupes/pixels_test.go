@@ -0,0 +1,112 @@
+package dupes
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(shade uint8) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			img.Set(x, y, color.RGBA{R: shade, G: uint8(x * 16), B: uint8(y * 16), A: 255})
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	require.NoError(t, jpeg.Encode(&b, testImage(shade), nil))
+	return b.Bytes()
+}
+
+func encodePNG(t *testing.T, shade uint8) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	require.NoError(t, png.Encode(&b, testImage(shade)))
+	return b.Bytes()
+}
+
+// withJPEGSegment inserts a marker segment right after SOI.
+func withJPEGSegment(data []byte, marker byte, payload string) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	seg = append(seg, payload...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, seg...)
+	return append(out, data[2:]...)
+}
+
+// withPNGChunk inserts a chunk right after IHDR (signature + 25 bytes).
+func withPNGChunk(data []byte, typ, payload string) []byte {
+	chunk := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, payload...)
+	crc := crc32.ChecksumIEEE(chunk[4:])
+	chunk = binary.BigEndian.AppendUint32(chunk, crc)
+	at := len(pngSignature) + 25
+	out := append([]byte{}, data[:at]...)
+	out = append(out, chunk...)
+	return append(out, data[at:]...)
+}
+
+func pixelHashOf(t *testing.T, name string, data []byte) (string, bool) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, data, 0o644))
+	sum, ok, err := PixelHash(p, md5.New)
+	require.NoError(t, err)
+	return sum, ok
+}
+
+func TestPixelHashJPEGIgnoresMetadata(t *testing.T) {
+	orig := encodeJPEG(t, 10)
+	edited := withJPEGSegment(withJPEGSegment(orig, 0xE1, "Exif\x00\x00fake"), 0xFE, "a comment")
+	require.NotEqual(t, orig, edited)
+
+	a, ok := pixelHashOf(t, "a.jpg", orig)
+	require.True(t, ok)
+	b, _ := pixelHashOf(t, "b.JPEG", edited)
+	assert.Equal(t, a, b)
+
+	c, _ := pixelHashOf(t, "c.jpg", encodeJPEG(t, 200))
+	assert.NotEqual(t, a, c)
+}
+
+func TestPixelHashPNGIgnoresMetadata(t *testing.T) {
+	orig := encodePNG(t, 10)
+	edited := withPNGChunk(orig, "tEXt", "Comment\x00hello")
+
+	a, ok := pixelHashOf(t, "a.png", orig)
+	require.True(t, ok)
+	b, _ := pixelHashOf(t, "b.png", edited)
+	assert.Equal(t, a, b)
+
+	c, _ := pixelHashOf(t, "c.png", encodePNG(t, 200))
+	assert.NotEqual(t, a, c)
+}
+
+func TestPixelHashUnsupportedAndInvalid(t *testing.T) {
+	_, ok := pixelHashOf(t, "a.mov", []byte("movie"))
+	assert.False(t, ok)
+
+	p := filepath.Join(t.TempDir(), "broken.jpg")
+	require.NoError(t, os.WriteFile(p, []byte("not a jpeg"), 0o644))
+	_, _, err := PixelHash(p, md5.New)
+	assert.Error(t, err)
+}
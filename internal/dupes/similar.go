@@ -0,0 +1,163 @@
+package dupes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/phash"
+)
+
+// DefaultMaxDistance is the default Hamming distance under which two
+// perceptual hashes are considered the same picture.
+const DefaultMaxDistance = 10
+
+// SimilarConfig controls a near-duplicate scan.
+type SimilarConfig struct {
+	LibraryPath string
+	YearFilter  string
+	// MaxDistance is the largest Hamming distance between the perceptual
+	// hashes of two images in the same cluster.
+	MaxDistance int
+	// NoUpdate uses the index as it is, without hashing images that are
+	// missing from it or changed since they were indexed.
+	NoUpdate bool
+}
+
+// SimilarFile is one image of a near-duplicate cluster.
+type SimilarFile struct {
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	Date   time.Time `json:"date"`
+	PHash  string    `json:"phash"`
+}
+
+// Pixels returns the image's pixel count.
+func (f SimilarFile) Pixels() int {
+	return f.Width * f.Height
+}
+
+// Cluster is a set of visually similar images. Best and Earliest index
+// into Files: the copy with the most pixels and the one with the earliest
+// capture date, ties broken by path.
+type Cluster struct {
+	Files    []SimilarFile `json:"files"`
+	Best     int           `json:"best"`
+	Earliest int           `json:"earliest"`
+}
+
+// FindSimilar clusters the library's images by perceptual hash. Hashes
+// come from the library index; unless cfg.NoUpdate is set, images missing
+// from it are hashed and added first. Clusters are sorted by their first
+// path, and files within them by path.
+func FindSimilar(cfg SimilarConfig, logger *logging.Logger) ([]Cluster, error) {
+	ix, err := index.Load(index.FilePath(cfg.LibraryPath))
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := collectSimilar(cfg, ix, logger)
+	if cerr := ix.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]phash.Hash, len(files))
+	for i, f := range files {
+		hashes[i], _ = phash.Parse(f.PHash)
+	}
+
+	var clusters []Cluster
+	for _, ids := range phash.Cluster(hashes, cfg.MaxDistance) {
+		c := Cluster{Files: make([]SimilarFile, len(ids))}
+		for i, id := range ids {
+			c.Files[i] = files[id]
+		}
+		sort.Slice(c.Files, func(i, j int) bool { return c.Files[i].Path < c.Files[j].Path })
+		for i, f := range c.Files {
+			if f.Pixels() > c.Files[c.Best].Pixels() {
+				c.Best = i
+			}
+			if !f.Date.IsZero() && (c.Files[c.Earliest].Date.IsZero() || f.Date.Before(c.Files[c.Earliest].Date)) {
+				c.Earliest = i
+			}
+		}
+		clusters = append(clusters, c)
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Files[0].Path < clusters[j].Files[0].Path })
+	return clusters, nil
+}
+
+// collectSimilar returns every hashable image of the selected years with
+// its perceptual hash, refreshing stale index records on the way.
+func collectSimilar(cfg SimilarConfig, ix *index.Index, logger *logging.Logger) ([]SimilarFile, error) {
+	years, err := library.ListYearsFiltered(cfg.LibraryPath, cfg.YearFilter)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+
+	var paths []string
+	for _, year := range years {
+		found, err := library.ListSourceFiles(filepath.Join(cfg.LibraryPath, year))
+		if err != nil {
+			return nil, fmt.Errorf("list source files for %s: %w", year, err)
+		}
+		for _, p := range found {
+			base := filepath.Base(p)
+			if defaults.IsIgnoredFile(base) || !phash.Supported(base) {
+				continue
+			}
+			paths = append(paths, p)
+		}
+	}
+
+	files := make([]SimilarFile, 0, len(paths))
+	for i, p := range paths {
+		logger.ProgressWithStats(i+1, len(paths), "[phash] ", "", p)
+
+		info, err := os.Stat(p)
+		if err != nil {
+			logger.Warn("stat %s: %v", p, err)
+			continue
+		}
+		rel, err := filepath.Rel(cfg.LibraryPath, p)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+
+		rec, ok := ix.Get(rel)
+		if !ok || rec.PHash == "" || rec.Size != info.Size() {
+			if cfg.NoUpdate {
+				continue
+			}
+			h, w, ht, err := phash.FromFile(p)
+			if err != nil {
+				logger.Warn("perceptual hash %s: %v", p, err)
+				continue
+			}
+			rec.Path, rec.Size, rec.PHash, rec.Width, rec.Height = rel, info.Size(), h.String(), w, ht
+			if err := ix.Put(rec); err != nil {
+				logger.Warn("index %s: %v", rel, err)
+			}
+		}
+
+		file := SimilarFile{Path: p, Size: info.Size(), Width: rec.Width, Height: rec.Height, PHash: rec.PHash}
+		if parsed, err := pathbuilder.ParseSourceFilename(filepath.Base(p)); err == nil {
+			file.Date = parsed.DateTime
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
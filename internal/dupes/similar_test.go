@@ -0,0 +1,84 @@
+package dupes
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bars draws w×h vertical stripes; flip mirrors the pattern so that the
+// result looks nothing like the unflipped one.
+func bars(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if (x*9/w)%2 == 1 {
+				v = 255 - v
+			}
+			if flip {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	return img
+}
+
+func TestFindSimilar(t *testing.T) {
+	libDir := t.TempDir()
+	dev := filepath.Join(libDir, "2024", "sources", "Apple iPhone (image)")
+
+	var big, small, other bytes.Buffer
+	require.NoError(t, png.Encode(&big, bars(360, 240, false)))
+	require.NoError(t, jpeg.Encode(&small, bars(90, 60, false), &jpeg.Options{Quality: 50}))
+	require.NoError(t, png.Encode(&other, bars(360, 240, true)))
+
+	a := filepath.Join(dev, "2024-03-01", "2024-03-01_09-00-00_aaaaaaaa.png")
+	b := filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_bbbbbbbb.jpg")
+	c := filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_cccccccc.png")
+	writeFile(t, a, big.Bytes())
+	writeFile(t, b, small.Bytes())
+	writeFile(t, c, other.Bytes())
+	writeFile(t, filepath.Join(dev, "2024-01-15", "2024-01-15_12-00-00_dddddddd.mov"), []byte("movie"))
+
+	logger := logging.New(os.Stdout, os.Stderr, false)
+	cfg := SimilarConfig{LibraryPath: libDir, MaxDistance: DefaultMaxDistance}
+
+	// Without an index and without updating it there is nothing to compare.
+	cfg.NoUpdate = true
+	clusters, err := FindSimilar(cfg, logger)
+	require.NoError(t, err)
+	assert.Empty(t, clusters)
+
+	cfg.NoUpdate = false
+	clusters, err = FindSimilar(cfg, logger)
+	require.NoError(t, err)
+	require.Len(t, clusters, 1)
+	c0 := clusters[0]
+	require.Len(t, c0.Files, 2)
+	assert.Equal(t, b, c0.Files[0].Path)
+	assert.Equal(t, a, c0.Files[1].Path)
+	assert.Equal(t, 1, c0.Best)
+	assert.Equal(t, 0, c0.Earliest)
+	assert.Equal(t, 360, c0.Files[1].Width)
+
+	// The hashes were stored, so a second scan can use the index alone.
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	assert.Equal(t, 3, ix.Len())
+	cfg.NoUpdate = true
+	again, err := FindSimilar(cfg, logger)
+	require.NoError(t, err)
+	assert.Equal(t, clusters, again)
+}
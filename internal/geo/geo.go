@@ -0,0 +1,133 @@
+// Package geo reverse-geocodes GPS positions offline, against a bundled
+// table of reference places. A position takes the country and first-level
+// region of the nearest place, which is right away from borders and coarse
+// near them; no network is needed.
+package geo
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxDistanceKm is how far from the nearest reference place a position may
+// lie and still be placed. Positions further out, mostly at sea, are not.
+const MaxDistanceKm = 600
+
+const earthRadiusKm = 6371
+
+//go:embed countries.tsv
+var countriesTSV string
+
+//go:embed places.tsv
+var placesTSV string
+
+// Place is the country and region a position lies in.
+type Place struct {
+	// CountryCode is the ISO 3166-1 alpha-2 code, e.g. "US".
+	CountryCode string `json:"country_code"`
+	Country     string `json:"country"`
+	// Region is the first-level region (state, province, ...); empty
+	// where the bundled data does not track regions.
+	Region string `json:"region,omitempty"`
+}
+
+// String formats p as "Region, Country", or just the country.
+func (p Place) String() string {
+	if p.Region == "" {
+		return p.Country
+	}
+	return p.Region + ", " + p.Country
+}
+
+type refPlace struct {
+	code, region string
+	lat, lon     float64 // radians
+}
+
+type table struct {
+	countries map[string]string
+	places    []refPlace
+}
+
+var loadTable = sync.OnceValue(func() *table {
+	t, err := parseTable(countriesTSV, placesTSV)
+	if err != nil {
+		panic(err)
+	}
+	return t
+})
+
+// parseTable reads the bundled tab-separated files. Lines starting with #
+// are comments.
+func parseTable(countries, places string) (*table, error) {
+	t := &table{countries: make(map[string]string)}
+	for n, line := range strings.Split(countries, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code, name, ok := strings.Cut(line, "\t")
+		if !ok || len(code) != 2 || name == "" {
+			return nil, fmt.Errorf("countries.tsv line %d: want code and name", n+1)
+		}
+		t.countries[code] = name
+	}
+	for n, line := range strings.Split(places, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, "\t")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("places.tsv line %d: want 4 fields, got %d", n+1, len(f))
+		}
+		if _, ok := t.countries[f[0]]; !ok {
+			return nil, fmt.Errorf("places.tsv line %d: unknown country %q", n+1, f[0])
+		}
+		lat, err1 := strconv.ParseFloat(f[2], 64)
+		lon, err2 := strconv.ParseFloat(f[3], 64)
+		if err1 != nil || err2 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			return nil, fmt.Errorf("places.tsv line %d: invalid position", n+1)
+		}
+		t.places = append(t.places, refPlace{code: f[0], region: f[1], lat: radians(lat), lon: radians(lon)})
+	}
+	return t, nil
+}
+
+// Lookup returns the place at latitude lat and longitude lon, in decimal
+// degrees, or false when it lies more than MaxDistanceKm from every
+// reference place.
+func Lookup(lat, lon float64) (Place, bool) {
+	t := loadTable()
+	la, lo := radians(lat), radians(lon)
+	best, bestDist := -1, math.Inf(1)
+	for i, p := range t.places {
+		if d := distance(la, lo, p.lat, p.lon); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	if best < 0 || bestDist*earthRadiusKm > MaxDistanceKm {
+		return Place{}, false
+	}
+	p := t.places[best]
+	return Place{CountryCode: p.code, Country: t.countries[p.code], Region: p.region}, true
+}
+
+// CountryName returns the name of the country with ISO code code, or ""
+// if the bundled data does not know it.
+func CountryName(code string) string {
+	return loadTable().countries[strings.ToUpper(code)]
+}
+
+// distance is the central angle between two positions in radians, by the
+// haversine formula.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	s1 := math.Sin((lat2 - lat1) / 2)
+	s2 := math.Sin((lon2 - lon1) / 2)
+	h := s1*s1 + math.Cos(lat1)*math.Cos(lat2)*s2*s2
+	return 2 * math.Asin(math.Sqrt(math.Min(1, h)))
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
@@ -0,0 +1,68 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundledTable(t *testing.T) {
+	tbl, err := parseTable(countriesTSV, placesTSV)
+	require.NoError(t, err)
+	assert.Greater(t, len(tbl.places), 500)
+
+	// Every country has at least one reference place.
+	seen := make(map[string]bool)
+	for _, p := range tbl.places {
+		seen[p.code] = true
+	}
+	for code := range tbl.countries {
+		assert.True(t, seen[code], code)
+	}
+}
+
+func TestParseTableRejectsBadLines(t *testing.T) {
+	_, err := parseTable("US\tUnited States\n", "XX\t\t1\t2\n")
+	assert.ErrorContains(t, err, "unknown country")
+	_, err = parseTable("US\tUnited States\n", "US\tTexas\t95\t2\n")
+	assert.ErrorContains(t, err, "invalid position")
+	_, err = parseTable("USA\tUnited States\n", "")
+	assert.Error(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     Place
+	}{
+		{"Golden Gate Bridge", 37.8199, -122.4783, Place{"US", "United States", "California"}},
+		{"Yosemite Valley", 37.7456, -119.5936, Place{"US", "United States", "California"}},
+		{"Eiffel Tower", 48.8584, 2.2945, Place{"FR", "France", "Île-de-France"}},
+		{"Brandenburg Gate", 52.5163, 13.3777, Place{"DE", "Germany", "Berlin"}},
+		{"Sydney Opera House", -33.8568, 151.2153, Place{"AU", "Australia", "New South Wales"}},
+		{"Uluru", -25.3444, 131.0369, Place{"AU", "Australia", "Northern Territory"}},
+		{"Lake Kawaguchi", 35.5170, 138.7510, Place{"JP", "Japan", "Yamanashi"}},
+		{"Machu Picchu", -13.1631, -72.5450, Place{"PE", "Peru", ""}},
+		{"Banff", 51.1784, -115.5708, Place{"CA", "Canada", "Alberta"}},
+		{"Petra", 30.3285, 35.4444, Place{"JO", "Jordan", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Lookup(tt.lat, tt.lon)
+			require.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, ok := Lookup(0, -140)
+	assert.False(t, ok, "the middle of the Pacific")
+}
+
+func TestPlaceString(t *testing.T) {
+	assert.Equal(t, "California, United States", Place{"US", "United States", "California"}.String())
+	assert.Equal(t, "Peru", Place{"PE", "Peru", ""}.String())
+	assert.Equal(t, "Japan", CountryName("jp"))
+	assert.Empty(t, CountryName("XX"))
+}
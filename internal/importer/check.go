@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+)
+
+// CheckStatus says whether a source file is already in the library.
+type CheckStatus string
+
+const (
+	// CheckPresent: the library holds a file with the same content.
+	CheckPresent CheckStatus = "present"
+	// CheckDifferent: the file's library path exists but holds other
+	// content, and no library file has this file's content.
+	CheckDifferent CheckStatus = "present-different-content"
+	// CheckMissing: the library has no copy of the file.
+	CheckMissing CheckStatus = "missing"
+)
+
+// CheckResult is the verdict on one source file.
+type CheckResult struct {
+	Path   string      `json:"path"`
+	Status CheckStatus `json:"status"`
+	// LibraryPath is the library-relative path where the file was found
+	// or, if missing, where an import would put it.
+	LibraryPath string `json:"library_path,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// Check reports whether each file under paths (files or directories) is
+// already in the library, without changing anything. Each file goes
+// through the same extraction and path building as an import; a file not
+// at its expected path is still found if a library file with the same
+// full hash is recorded in the index or a hash manifest.
+func (imp *Importer) Check(paths []string) ([]CheckResult, error) {
+	return imp.check(paths, false)
+}
+
+// CheckByHash is Check without metadata extraction: files are looked up
+// by full content hash alone, and the library copy found is re-hashed.
+// Use it when EXIF would place a file somewhere other than where an
+// earlier import did.
+func (imp *Importer) CheckByHash(paths []string) ([]CheckResult, error) {
+	return imp.check(paths, true)
+}
+
+func (imp *Importer) check(paths []string, byHash bool) ([]CheckResult, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("stat %s: %w", p, err)
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		found, err := enumerateFiles(p)
+		if err != nil {
+			return nil, fmt.Errorf("enumerate files: %w", err)
+		}
+		files = append(files, found...)
+	}
+
+	var results []CheckResult
+	groups := linkSidecars(files)
+	if byHash {
+		for i, g := range groups {
+			imp.logger.ProgressWithStats(i+1, len(groups), "[check] ", "", g.Path)
+			res := imp.checkByHash(g.Path, "")
+			results = append(results, res)
+			results = append(results, imp.checkSidecars(g.Sidecars, res)...)
+		}
+		return results, nil
+	}
+
+	pf := metadata.NewPrefetch(imp.ext, primaryPaths(groups), imp.hasher)
+	defer pf.Close()
+	for i, g := range groups {
+		imp.logger.ProgressWithStats(i+1, len(groups), "[check] ", "", g.Path)
+		md, err := pf.Next()
+		results = append(results, imp.checkGroup(g, md, err)...)
+	}
+	return results, nil
+}
+
+// checkGroup checks a primary, whose metadata extraction gave md or err,
+// at its expected library path, and its sidecars next to it.
+func (imp *Importer) checkGroup(g fileWithSidecars, md *metadata.FileMetadata, err error) []CheckResult {
+	var res CheckResult
+	switch {
+	case err != nil:
+		res = imp.checkByHash(g.Path, fmt.Sprintf("metadata extraction failed (%v)", err))
+	case md.MediaType == defaults.MediaTypeOther && !imp.cfg.KeepAll:
+		res = imp.lookupHash(g.Path, md.FullHash, "not a media file, import drops it")
+	default:
+		relPath, _ := pathbuilder.BuildPath(md, imp.pbOpts)
+		res = imp.checkAt(g.Path, md.FullHash, relPath)
+	}
+	return append([]CheckResult{res}, imp.checkSidecars(g.Sidecars, res)...)
+}
+
+// checkSidecars checks sidecars next to where their primary is, or would
+// be, in the library.
+func (imp *Importer) checkSidecars(sidecars []string, primary CheckResult) []CheckResult {
+	var results []CheckResult
+	for _, sc := range sidecars {
+		full, _, err := metadata.ComputeFileHash(sc, imp.hasher)
+		switch {
+		case err != nil:
+			results = append(results, CheckResult{Path: sc, Status: CheckMissing, Reason: err.Error()})
+		case primary.LibraryPath == "":
+			results = append(results, imp.lookupHash(sc, full, ""))
+		default:
+			results = append(results, imp.checkAt(sc, full, pathbuilder.BuildSidecarPath(primary.LibraryPath, filepath.Ext(sc))))
+		}
+	}
+	return results
+}
+
+// checkAt compares a file whose full hash is known against the library
+// file at relPath, falling back to a lookup by hash.
+func (imp *Importer) checkAt(path, fullHash, relPath string) CheckResult {
+	destPath := filepath.Join(imp.cfg.LibraryPath, filepath.FromSlash(relPath))
+	if _, err := os.Stat(destPath); err != nil {
+		res := imp.lookupHash(path, fullHash, "")
+		if res.Status == CheckPresent {
+			res.Reason = "found by content at a different path"
+		} else {
+			res.LibraryPath = relPath
+		}
+		return res
+	}
+
+	destHash, _, err := metadata.ComputeFileHash(destPath, imp.hasher)
+	if err == nil && destHash == fullHash {
+		return CheckResult{Path: path, Status: CheckPresent, LibraryPath: relPath}
+	}
+	if res := imp.lookupHash(path, fullHash, ""); res.Status == CheckPresent {
+		res.Reason = "found by content at a different path"
+		return res
+	}
+	reason := "library file has different content"
+	if err != nil {
+		reason = fmt.Sprintf("library file unreadable (%v)", err)
+	}
+	return CheckResult{Path: path, Status: CheckDifferent, LibraryPath: relPath, Reason: reason}
+}
+
+// checkByHash hashes path and looks the hash up in the library.
+func (imp *Importer) checkByHash(path, reason string) CheckResult {
+	full, _, err := metadata.ComputeFileHash(path, imp.hasher)
+	if err != nil {
+		return CheckResult{Path: path, Status: CheckMissing, Reason: err.Error()}
+	}
+	return imp.lookupHash(path, full, reason)
+}
+
+// lookupHash finds a library file recorded with fullHash and re-hashes
+// it, so a library copy that changed since it was recorded doesn't count.
+func (imp *Importer) lookupHash(path, fullHash, reason string) CheckResult {
+	if rel, ok := imp.libraryHashes()[fullHash]; ok {
+		actual, _, err := metadata.ComputeFileHash(filepath.Join(imp.cfg.LibraryPath, filepath.FromSlash(rel)), imp.hasher)
+		if err == nil && actual == fullHash {
+			return CheckResult{Path: path, Status: CheckPresent, LibraryPath: rel, Reason: reason}
+		}
+	}
+	if reason == "" {
+		reason = "no library file has this content"
+	}
+	return CheckResult{Path: path, Status: CheckMissing, Reason: reason}
+}
+
+// libraryHashes maps every full hash recorded in the library index or
+// the year hash manifests, for this importer's algorithm, to a library
+// path holding that content. Built on first use.
+func (imp *Importer) libraryHashes() map[string]string {
+	if imp.hashes != nil {
+		return imp.hashes
+	}
+	imp.hashes = make(map[string]string)
+
+	for _, r := range imp.index().Records() {
+		if r.FullHash != "" && r.HashAlgo == imp.cfg.HashAlgo {
+			imp.hashes[r.FullHash] = r.Path
+		}
+	}
+
+	years, err := library.ListYears(imp.cfg.LibraryPath)
+	if err != nil {
+		imp.logger.Warn("list years: %v", err)
+		return imp.hashes
+	}
+	for _, year := range years {
+		m, err := library.LoadManifest(library.ManifestFilePath(filepath.Join(imp.cfg.LibraryPath, year)))
+		if err != nil {
+			imp.logger.Warn("hash manifest for %s: load failed: %v", year, err)
+			continue
+		}
+		entries := m.Entries()
+		rels := make([]string, 0, len(entries))
+		for rel := range entries {
+			rels = append(rels, rel)
+		}
+		sort.Strings(rels)
+		for _, rel := range rels {
+			e := entries[rel]
+			if _, ok := imp.hashes[e.FullHash]; !ok && e.HashAlgo == imp.cfg.HashAlgo {
+				imp.hashes[e.FullHash] = year + "/" + rel
+			}
+		}
+	}
+	return imp.hashes
+}
@@ -0,0 +1,127 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statuses(results []CheckResult) map[string]CheckStatus {
+	out := make(map[string]CheckStatus)
+	for _, r := range results {
+		out[filepath.Base(r.Path)] = r.Status
+	}
+	return out
+}
+
+func TestCheck(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(srcDir, "imported.jpg"), "jpeg-imported")
+	createTestFile(t, filepath.Join(srcDir, "imported.xmp"), "xmp-imported")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+
+	createTestFile(t, filepath.Join(srcDir, "new.jpg"), "jpeg-new")
+	createTestFile(t, filepath.Join(srcDir, "notes.txt"), "text")
+	before := listFiles(t, libDir)
+
+	ext := &fakeExtractor{results: map[string]*metadata.FileMetadata{}}
+	full, short, err := metadata.ComputeFileHash(filepath.Join(srcDir, "notes.txt"), mustHasher("md5"))
+	require.NoError(t, err)
+	ext.results[filepath.Join(srcDir, "notes.txt")] = &metadata.FileMetadata{
+		Extension: ".txt", MediaType: defaults.MediaTypeOther, FullHash: full, ShortHash: short,
+	}
+
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, ext, newTestLogger())
+	require.NoError(t, err)
+	results, err := imp.Check([]string{srcDir})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]CheckStatus{
+		"imported.jpg": CheckPresent,
+		"imported.xmp": CheckPresent,
+		"new.jpg":      CheckMissing,
+		"notes.txt":    CheckMissing,
+	}, statuses(results))
+	for _, r := range results {
+		if filepath.Base(r.Path) == "new.jpg" {
+			assert.Contains(t, r.LibraryPath, "2024/sources/TestMake TestModel (image)/2024-01-15/")
+		}
+	}
+
+	results, err = imp.CheckByHash([]string{filepath.Join(srcDir, "imported.jpg"), filepath.Join(srcDir, "imported.xmp")})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]CheckStatus{
+		"imported.jpg": CheckPresent,
+		"imported.xmp": CheckPresent,
+	}, statuses(results))
+
+	// Nothing was written.
+	assert.Equal(t, before, listFiles(t, libDir))
+}
+
+func TestCheckDifferentContentAndHashFallback(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	photo := filepath.Join(srcDir, "photo.jpg")
+	createTestFile(t, photo, "jpeg-original")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	matches, _ := filepath.Glob(filepath.Join(libDir, "2024", "sources", "*", "*", "*.jpg"))
+	require.Len(t, matches, 1)
+	libFile := matches[0]
+
+	// EXIF now disagrees with the earlier import: the expected path is
+	// elsewhere, but the content is still found by hash.
+	full, short, err := metadata.ComputeFileHash(photo, mustHasher("md5"))
+	require.NoError(t, err)
+	moved := &fakeExtractor{results: map[string]*metadata.FileMetadata{photo: {
+		Extension: ".jpg", Make: "Other", MediaType: defaults.MediaTypePhoto, FullHash: full, ShortHash: short,
+	}}}
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, moved, newTestLogger())
+	require.NoError(t, err)
+	results, err := imp.Check([]string{photo})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, CheckPresent, results[0].Status)
+	assert.NotEmpty(t, results[0].Reason)
+
+	results, err = imp.CheckByHash([]string{photo})
+	require.NoError(t, err)
+	assert.Equal(t, CheckPresent, results[0].Status)
+
+	// The library copy changes: the path exists with other content.
+	require.NoError(t, os.WriteFile(libFile, []byte("tampered"), 0o644))
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	results, err = imp.Check([]string{photo})
+	require.NoError(t, err)
+	assert.Equal(t, CheckDifferent, results[0].Status)
+
+	results, err = imp.CheckByHash([]string{photo})
+	require.NoError(t, err)
+	assert.Equal(t, CheckMissing, results[0].Status)
+}
+
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var out []string
+	require.NoError(t, filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			out = append(out, p)
+		}
+		return err
+	}))
+	return out
+}
@@ -5,13 +5,18 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/logging"
 	"github.com/askolesov/image-vault/internal/metadata"
 	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/phash"
 	"github.com/askolesov/image-vault/internal/transfer"
 )
 
@@ -32,6 +37,9 @@ type Config struct {
 	SkipCompare   bool
 	Randomize     bool
 	YearFilter    string
+	// NoPerceptualHash skips decoding imported images to compute the
+	// perceptual hash stored in the library index.
+	NoPerceptualHash bool
 }
 
 // Result holds the outcome counts of an import operation.
@@ -42,6 +50,14 @@ type Result struct {
 	Dropped        int
 	Errors         int
 	ProcessedBytes int64
+	// Derived counts the files that look like edited exports, whether
+	// the rules route them to processed/ or just flag them.
+	Derived int
+	// Session identifies this importer's run in the library index.
+	Session string
+	// Placed maps the source path of every primary file now in the
+	// library (imported, replaced or already there) to its library path.
+	Placed map[string]string
 }
 
 // fileWithSidecars groups a primary file with its sidecar files.
@@ -56,31 +72,73 @@ type Importer struct {
 	ext    MetadataExtractor
 	logger *logging.Logger
 	hasher *defaults.Hasher
+	// pbOpts places files in the library, with the library's owner
+	// mapping and edited-export rules.
+	pbOpts pathbuilder.Options
+
+	// manifests holds the hash manifest of every year touched so far,
+	// keyed by year dir name. Loaded lazily, persisted at the end.
+	manifests map[string]*library.Manifest
+
+	// session tags the files this importer brings in, in the index.
+	session string
+
+	// idx is the library metadata index, loaded on first use.
+	idx       *index.Index
+	idxLoaded bool
+
+	// hashes maps recorded full hashes to library paths, for Check.
+	hashes map[string]string
+
+	// noPHash holds the photo extensions already reported as getting no
+	// perceptual hash, so each is reported once per run.
+	noPHash map[string]bool
 }
 
-// New creates a new Importer, initializing the hasher from cfg.HashAlgo.
-// Returns an error if cfg.HashAlgo is unsupported so callers can surface
-// the misconfiguration instead of silently substituting the default.
+// New creates a new Importer, initializing the hasher from cfg.HashAlgo
+// and reading the owner mapping and edited-export rules from the library
+// config. Returns an error if cfg.HashAlgo is unsupported so callers can
+// surface the misconfiguration instead of silently substituting the
+// default.
 func New(cfg Config, ext MetadataExtractor, logger *logging.Logger) (*Importer, error) {
 	hasher, err := defaults.NewHasher(cfg.HashAlgo)
 	if err != nil {
 		return nil, fmt.Errorf("importer: %w", err)
 	}
+	lc, err := library.LoadConfig(cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("importer: %w", err)
+	}
 	return &Importer{
-		cfg:    cfg,
-		ext:    ext,
-		logger: logger,
-		hasher: hasher,
+		cfg:       cfg,
+		ext:       ext,
+		logger:    logger,
+		hasher:    hasher,
+		pbOpts:    pathbuilder.Options{SeparateVideo: cfg.SeparateVideo, Owners: lc.Owners, Derived: lc.Derived},
+		session:   newSessionID(time.Now()),
+		manifests: make(map[string]*library.Manifest),
+		noPHash:   make(map[string]bool),
 	}, nil
 }
 
+// newSessionID returns an import session ID: the start time in UTC, plus
+// a random suffix to tell apart runs started in the same second.
+func newSessionID(now time.Time) string {
+	return fmt.Sprintf("%s-%04x", now.UTC().Format("20060102T150405Z"), rand.Intn(1<<16))
+}
+
 // ImportDir imports all files from sourceDir into the library.
 func (imp *Importer) ImportDir(sourceDir string) (*Result, error) {
 	files, err := enumerateFiles(sourceDir)
 	if err != nil {
 		return nil, fmt.Errorf("enumerate files: %w", err)
 	}
+	return imp.ImportFiles(files)
+}
 
+// ImportFiles imports the given files into the library. Sidecars among
+// them travel with the primary of the same name in the same directory.
+func (imp *Importer) ImportFiles(files []string) (*Result, error) {
 	groups := linkSidecars(files)
 
 	if imp.cfg.Randomize {
@@ -89,15 +147,26 @@ func (imp *Importer) ImportDir(sourceDir string) (*Result, error) {
 		})
 	}
 
-	result := &Result{}
+	result := &Result{Session: imp.session, Placed: make(map[string]string)}
 	total := len(groups)
+	defer imp.persistManifests()
+	defer imp.closeIndex()
+
+	pf := metadata.NewPrefetch(imp.ext, primaryPaths(groups), imp.hasher)
+	defer pf.Close()
 
 	for i, g := range groups {
 		stats := fmt.Sprintf("new:%d skipped:%d dropped:%d %s",
 			result.Imported, result.Skipped, result.Dropped, logging.FormatBytes(result.ProcessedBytes))
 		imp.logger.ProgressWithStats(i+1, total, "", stats, g.Path)
 
-		if err := imp.importFile(g, result); err != nil {
+		md, err := pf.Next()
+		if err != nil {
+			err = fmt.Errorf("extract metadata: %w", err)
+		} else {
+			err = imp.importFile(g, md, result)
+		}
+		if err != nil {
 			result.Errors++
 			imp.logger.Error("import %s: %v", g.Path, err)
 			if imp.cfg.FailFast {
@@ -109,12 +178,7 @@ func (imp *Importer) ImportDir(sourceDir string) (*Result, error) {
 	return result, nil
 }
 
-func (imp *Importer) importFile(g fileWithSidecars, result *Result) error {
-	md, err := imp.ext.Extract(g.Path, imp.hasher)
-	if err != nil {
-		return fmt.Errorf("extract metadata: %w", err)
-	}
-
+func (imp *Importer) importFile(g fileWithSidecars, md *metadata.FileMetadata, result *Result) error {
 	// Drop non-media files unless KeepAll
 	if md.MediaType == defaults.MediaTypeOther && !imp.cfg.KeepAll {
 		result.Dropped++
@@ -131,9 +195,14 @@ func (imp *Importer) importFile(g fileWithSidecars, result *Result) error {
 	}
 
 	// Build destination path
-	pbOpts := pathbuilder.Options{SeparateVideo: imp.cfg.SeparateVideo}
-	relPath := pathbuilder.BuildSourcePath(md, pbOpts)
+	relPath, derived := pathbuilder.BuildPath(md, imp.pbOpts)
 	destPath := filepath.Join(imp.cfg.LibraryPath, relPath)
+	if derived != "" {
+		result.Derived++
+		if imp.pbOpts.Derived.Mode() == library.DerivedFlag {
+			imp.logger.Warn("%s: %s, keeping it in sources/", g.Path, derived)
+		}
+	}
 
 	// Transfer — pass hasher and pre-computed source hash to avoid re-reading the file
 	tOpts := transfer.Options{
@@ -169,19 +238,141 @@ func (imp *Importer) importFile(g fileWithSidecars, result *Result) error {
 	case transfer.ActionSkipped:
 		result.Skipped++
 	}
+	if result.Placed != nil {
+		result.Placed[g.Path] = destPath
+	}
+
+	if !imp.cfg.DryRun {
+		imp.recordHash(relPath, md.FullHash, action == transfer.ActionReplaced)
+		imp.indexFile(relPath, destPath, md, sourceSize, action)
+	}
+
+	return imp.transferSidecars(g.Sidecars, destPath, tOpts)
+}
+
+// ImportSidecars brings sidecars whose primary is already in the library,
+// at libraryFile, in next to it, as if they had been imported with it.
+func (imp *Importer) ImportSidecars(sidecars []string, libraryFile string) error {
+	return imp.transferSidecars(sidecars, libraryFile, transfer.Options{
+		Move:        imp.cfg.Move,
+		DryRun:      imp.cfg.DryRun,
+		NewHash:     imp.hasher.New,
+		SkipCompare: imp.cfg.SkipCompare,
+	})
+}
 
-	// Transfer sidecars
-	for _, sidecar := range g.Sidecars {
+func (imp *Importer) transferSidecars(sidecars []string, destPath string, tOpts transfer.Options) error {
+	tOpts.SourceHash = ""
+	for _, sidecar := range sidecars {
 		sidecarExt := filepath.Ext(sidecar)
 		sidecarDest := pathbuilder.BuildSidecarPath(destPath, sidecarExt)
 		if _, err := transfer.TransferFile(sidecar, sidecarDest, tOpts); err != nil {
 			return fmt.Errorf("transfer sidecar %s: %w", sidecar, err)
 		}
 	}
-
 	return nil
 }
 
+// recordHash stores the full content hash of the library file at relPath
+// (library-relative, slash-separated) in its year's manifest. An existing
+// entry is kept unless overwrite is set: the first recorded hash is the
+// evidence later scrubs compare against.
+func (imp *Importer) recordHash(relPath, fullHash string, overwrite bool) {
+	year, relToYear, ok := strings.Cut(relPath, "/")
+	if !ok {
+		return
+	}
+
+	m, ok := imp.manifests[year]
+	if !ok {
+		var err error
+		m, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(imp.cfg.LibraryPath, year)))
+		if err != nil {
+			imp.logger.Warn("hash manifest for %s: load failed: %v", year, err)
+		}
+		// A nil manifest is cached too, so a broken file is reported once.
+		imp.manifests[year] = m
+	}
+
+	if e, ok := m.Lookup(relToYear); ok && e.HashAlgo == imp.cfg.HashAlgo && !overwrite {
+		return
+	}
+	if err := m.Record(library.ManifestEntry{
+		RelPath:  relToYear,
+		HashAlgo: imp.cfg.HashAlgo,
+		FullHash: fullHash,
+	}); err != nil {
+		imp.logger.Warn("hash manifest record failed for %s: %v", relPath, err)
+	}
+}
+
+// indexFile records a library file in the library index. A file the run
+// brought in is tagged with its session; one that was already there keeps
+// the session and perceptual hash of its existing record.
+func (imp *Importer) indexFile(relPath, destPath string, md *metadata.FileMetadata, size int64, action transfer.Action) {
+	r := index.FromMetadata(relPath, md, imp.cfg.HashAlgo, size)
+	prev, ok := imp.index().Get(relPath)
+	if action == transfer.ActionSkipped {
+		if ok && prev.SameContent(r) {
+			r.Session, r.PHash = prev.Session, prev.PHash
+		}
+	} else {
+		r.Session = imp.session
+	}
+
+	if r.PHash == "" && !imp.cfg.NoPerceptualHash && md.MediaType == defaults.MediaTypePhoto {
+		if ext := strings.ToLower(filepath.Ext(destPath)); !phash.Supported(destPath) {
+			if !imp.noPHash[ext] {
+				imp.noPHash[ext] = true
+				imp.logger.Info("%s files get no perceptual hash (only JPEG, PNG and GIF do); tools similar leaves them out", ext)
+			}
+		} else if err := r.AddPerceptualHash(destPath); err != nil {
+			imp.logger.Warn("perceptual hash %s: %v", relPath, err)
+		}
+	}
+	if ok && reflect.DeepEqual(r, prev) {
+		return
+	}
+	if err := imp.index().Put(r); err != nil {
+		imp.logger.Warn("index %s: %v", relPath, err)
+	}
+}
+
+// index returns the library index, loading it on first use. A load
+// failure is reported once and leaves a nil (no-op) index.
+func (imp *Importer) index() *index.Index {
+	if !imp.idxLoaded {
+		imp.idxLoaded = true
+		ix, err := index.Load(index.FilePath(imp.cfg.LibraryPath))
+		if err != nil {
+			imp.logger.Warn("library index: load failed: %v", err)
+		}
+		imp.idx = ix
+	}
+	return imp.idx
+}
+
+// closeIndex flushes the library index, if it was opened. The next use
+// loads it again, so an Importer can run several imports.
+func (imp *Importer) closeIndex() {
+	if err := imp.idx.Close(); err != nil {
+		imp.logger.Warn("library index: %v", err)
+	}
+	imp.idx, imp.idxLoaded = nil, false
+}
+
+// persistManifests writes every manifest with unsaved entries.
+func (imp *Importer) persistManifests() {
+	for year, m := range imp.manifests {
+		if !m.Dirty() {
+			continue
+		}
+		if err := m.Persist(); err != nil {
+			imp.logger.Warn("hash manifest for %s: persist failed: %v", year, err)
+		}
+	}
+}
+
 // enumerateFiles walks sourceDir recursively, returning all files (skipping
 // directories, permission errors, and OS junk files).
 func enumerateFiles(sourceDir string) ([]string, error) {
@@ -205,6 +396,15 @@ func enumerateFiles(sourceDir string) ([]string, error) {
 	return files, err
 }
 
+// primaryPaths returns the path of each group's primary file.
+func primaryPaths(groups []fileWithSidecars) []string {
+	paths := make([]string, len(groups))
+	for i, g := range groups {
+		paths[i] = g.Path
+	}
+	return paths
+}
+
 // linkSidecars groups files by base name without extension.
 // Primary = non-sidecar extension, sidecar = sidecar extension.
 // If no primary exists, sidecars become primaries (orphan sidecars).
@@ -1,14 +1,21 @@
 package importer
 
 import (
+	"bytes"
 	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/phash"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -83,6 +90,36 @@ func TestImportSingleFile(t *testing.T) {
 	assert.Len(t, matches, 1)
 }
 
+func TestImportLabelsOwnedDevices(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	require.NoError(t, library.SaveConfig(libDir, library.Config{Owners: map[string]string{"SN-A": "Alice"}}))
+
+	ext := &fakeExtractor{results: make(map[string]*metadata.FileMetadata)}
+	for name, serial := range map[string]string{"alice.jpg": "SN-A", "bob.jpg": "SN-B"} {
+		p := filepath.Join(srcDir, name)
+		createTestFile(t, p, name)
+		full, short, err := metadata.ComputeFileHash(p, mustHasher("md5"))
+		require.NoError(t, err)
+		ext.results[p] = &metadata.FileMetadata{
+			Path: p, Extension: ".jpg", Make: "Apple", Model: "iPhone 15 Pro",
+			DateTime:  time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+			MediaType: defaults.MediaTypePhoto, FullHash: full, ShortHash: short, SerialNumber: serial,
+		}
+	}
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, ext, newTestLogger())
+	require.NoError(t, err)
+	result, err := imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Imported)
+
+	for dir, want := range map[string]int{"Apple iPhone 15 Pro - Alice (image)": 1, "Apple iPhone 15 Pro (image)": 1} {
+		matches, _ := filepath.Glob(filepath.Join(libDir, "2024", "sources", dir, "2024-01-15", "*.jpg"))
+		assert.Len(t, matches, want, dir)
+	}
+}
+
 func TestImportSkipsDuplicate(t *testing.T) {
 	srcDir := t.TempDir()
 	libDir := t.TempDir()
@@ -433,3 +470,190 @@ func TestLinkSidecarsSameBase(t *testing.T) {
 	}
 	assert.Equal(t, 2, totalPaths)
 }
+
+func TestImportRecordsHashManifest(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(srcDir, "photo.jpg"), "jpeg-manifest-test")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+
+	full, short, err := metadata.ComputeFileHash(filepath.Join(srcDir, "photo.jpg"), mustHasher("md5"))
+	require.NoError(t, err)
+
+	m, err := library.LoadManifest(library.ManifestFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	rel := "sources/TestMake TestModel (image)/2024-01-15/2024-01-15_12-00-00_" + short + ".jpg"
+	e, ok := m.Lookup(rel)
+	require.True(t, ok)
+	assert.Equal(t, full, e.FullHash)
+	assert.Equal(t, "md5", e.HashAlgo)
+}
+
+func TestImportFilesOnlyImportsListedFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+
+	createTestFile(t, filepath.Join(srcDir, "photo.jpg"), "jpeg-import-files")
+	createTestFile(t, filepath.Join(srcDir, "photo.xmp"), "xmp-import-files")
+	createTestFile(t, filepath.Join(srcDir, "other.jpg"), "jpeg-not-listed")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Move: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := imp.ImportFiles([]string{
+		filepath.Join(srcDir, "photo.jpg"),
+		filepath.Join(srcDir, "photo.xmp"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+
+	matches, _ := filepath.Glob(filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15", "*.xmp"))
+	assert.Len(t, matches, 1)
+	_, err = os.Stat(filepath.Join(srcDir, "other.jpg"))
+	assert.NoError(t, err)
+}
+
+func TestImportFilesTwiceReloadsIndex(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	first := filepath.Join(srcDir, "first.jpg")
+	second := filepath.Join(srcDir, "second.jpg")
+	createTestFile(t, first, "jpeg-first")
+	createTestFile(t, second, "jpeg-second")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", NoPerceptualHash: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	for _, f := range []string{first, second} {
+		result, err := imp.ImportFiles([]string{f})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+	}
+
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	assert.Len(t, ix.Records(), 2)
+}
+
+func TestImportIndexesFiles(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+
+	img := image.NewGray(image.Rect(0, 0, 32, 24))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	createTestFile(t, filepath.Join(srcDir, "photo.png"), buf.String())
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, result.Session)
+
+	full, short, err := metadata.ComputeFileHash(filepath.Join(srcDir, "photo.png"), mustHasher("md5"))
+	require.NoError(t, err)
+
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	records := ix.Records()
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, "2024/sources/TestMake TestModel (image)/2024-01-15/2024-01-15_12-00-00_"+short+".png", r.Path)
+	assert.Equal(t, full, r.FullHash)
+	assert.Equal(t, "md5", r.HashAlgo)
+	assert.Equal(t, "TestMake", r.Make)
+	assert.Equal(t, defaults.MediaTypePhoto, r.MediaType)
+	assert.Equal(t, result.Session, r.Session)
+	assert.Equal(t, phash.DHash(img).String(), r.PHash)
+	assert.Equal(t, 32, r.Width)
+	assert.Equal(t, 24, r.Height)
+	assert.Equal(t, int64(buf.Len()), r.Size)
+
+	// A re-import skips the file and keeps the original session.
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	again, err := imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, again.Skipped)
+	ix, err = index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	got, ok := ix.Get(r.Path)
+	require.True(t, ok)
+	assert.Equal(t, result.Session, got.Session)
+
+	// Opting out of perceptual hashing still indexes the metadata.
+	libDir = t.TempDir()
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5", NoPerceptualHash: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	ix, err = index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	records = ix.Records()
+	require.Len(t, records, 1)
+	assert.Empty(t, records[0].PHash)
+	assert.Equal(t, full, records[0].FullHash)
+}
+
+func TestImportReportsUnhashableImagesOnce(t *testing.T) {
+	srcDir := t.TempDir()
+	createTestFile(t, filepath.Join(srcDir, "a.heic"), "heic a")
+	createTestFile(t, filepath.Join(srcDir, "b.HEIC"), "heic b")
+
+	var stderr bytes.Buffer
+	imp, err := New(Config{LibraryPath: t.TempDir(), HashAlgo: "md5"}, &fakeExtractor{}, logging.New(&bytes.Buffer{}, &stderr, false))
+	require.NoError(t, err)
+	result, err := imp.ImportDir(srcDir)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, 1, strings.Count(stderr.String(), ".heic files get no perceptual hash"))
+	assert.NotContains(t, stderr.String(), "[warn]")
+}
+
+func TestImportRoutesEditedExports(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		rules library.DerivedRules
+		area  string
+	}{
+		{"processed", library.DerivedRules{Action: library.DerivedToProcessed}, "processed"},
+		{"flag", library.DerivedRules{Action: library.DerivedFlag}, "sources"},
+		{"off", library.DerivedRules{Action: library.DerivedOff}, "sources"},
+		{"default", library.DerivedRules{}, "sources"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir := t.TempDir()
+			libDir := t.TempDir()
+			require.NoError(t, library.SaveConfig(libDir, library.Config{Derived: tt.rules}))
+
+			p := filepath.Join(srcDir, "export.jpg")
+			createTestFile(t, p, "snapseed export")
+			full, short, err := metadata.ComputeFileHash(p, mustHasher("md5"))
+			require.NoError(t, err)
+			ext := &fakeExtractor{results: map[string]*metadata.FileMetadata{p: {
+				Path: p, Extension: ".jpg", Make: "Apple", Model: "iPhone 15 Pro",
+				DateTime:  time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+				MediaType: defaults.MediaTypePhoto, FullHash: full, ShortHash: short, Software: "Snapseed 2.0",
+			}}}
+
+			imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, ext, newTestLogger())
+			require.NoError(t, err)
+			result, err := imp.ImportDir(srcDir)
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.Imported)
+			if tt.rules.Mode() == library.DerivedOff {
+				assert.Zero(t, result.Derived)
+			} else {
+				assert.Equal(t, 1, result.Derived)
+			}
+
+			matches, _ := filepath.Glob(filepath.Join(libDir, "2024", tt.area, "Apple iPhone 15 Pro (image)", "2024-01-15", "*.jpg"))
+			assert.Len(t, matches, 1)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReleaseResult holds the outcome of a release.
+type ReleaseResult struct {
+	Deleted      int
+	DeletedBytes int64
+	Errors       int
+	// Remaining lists the files left in place, with the reason why.
+	Remaining []CheckResult
+}
+
+// Release deletes the files under paths that Check (or CheckByHash, with
+// byHash) confirms are in the library, and leaves everything else. With
+// cfg.DryRun nothing is deleted. Paths inside the library are refused.
+func (imp *Importer) Release(paths []string, byHash bool) (*ReleaseResult, error) {
+	lib, err := filepath.Abs(imp.cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve library path: %w", err)
+	}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", p, err)
+		}
+		if rel, err := filepath.Rel(lib, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is inside the library; release only deletes source copies", p)
+		}
+		if rel, err := filepath.Rel(abs, lib); err == nil && !strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("%s contains the library; release only deletes source copies", p)
+		}
+	}
+
+	results, err := imp.check(paths, byHash)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ReleaseResult{}
+	for _, r := range results {
+		if r.Status != CheckPresent {
+			res.Remaining = append(res.Remaining, r)
+			continue
+		}
+		info, err := os.Stat(r.Path)
+		if err != nil {
+			res.Errors++
+			imp.logger.Error("release %s: %v", r.Path, err)
+			continue
+		}
+		if !imp.cfg.DryRun {
+			if err := os.Remove(r.Path); err != nil {
+				res.Errors++
+				imp.logger.Error("release %s: %v", r.Path, err)
+				r.Reason = fmt.Sprintf("delete failed (%v)", err)
+				res.Remaining = append(res.Remaining, r)
+				continue
+			}
+		}
+		res.Deleted++
+		res.DeletedBytes += info.Size()
+	}
+	return res, nil
+}
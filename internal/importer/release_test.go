@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelease(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(srcDir, "imported.jpg"), "jpeg-imported")
+	createTestFile(t, filepath.Join(srcDir, "imported.xmp"), "xmp-imported")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+
+	createTestFile(t, filepath.Join(srcDir, "new.jpg"), "jpeg-new")
+	notes := filepath.Join(srcDir, "notes.txt")
+	createTestFile(t, notes, "text")
+	ext := &fakeExtractor{results: map[string]*metadata.FileMetadata{}}
+	full, short, err := metadata.ComputeFileHash(notes, mustHasher("md5"))
+	require.NoError(t, err)
+	ext.results[notes] = &metadata.FileMetadata{
+		Extension: ".txt", MediaType: defaults.MediaTypeOther, FullHash: full, ShortHash: short,
+	}
+	libBefore := listFiles(t, libDir)
+
+	// A dry run deletes nothing.
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5", DryRun: true}, ext, newTestLogger())
+	require.NoError(t, err)
+	res, err := imp.Release([]string{srcDir}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Deleted)
+	assert.Len(t, listFiles(t, srcDir), 4)
+
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, ext, newTestLogger())
+	require.NoError(t, err)
+	res, err = imp.Release([]string{srcDir}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Deleted)
+	assert.Equal(t, int64(len("jpeg-imported")+len("xmp-imported")), res.DeletedBytes)
+	assert.Zero(t, res.Errors)
+	assert.Equal(t, []string{filepath.Join(srcDir, "new.jpg"), notes}, listFiles(t, srcDir))
+
+	reasons := make(map[string]string)
+	for _, r := range res.Remaining {
+		assert.Equal(t, CheckMissing, r.Status)
+		reasons[filepath.Base(r.Path)] = r.Reason
+	}
+	assert.Equal(t, "not a media file, import drops it", reasons["notes.txt"])
+	assert.Contains(t, reasons, "new.jpg")
+
+	// The library is untouched.
+	assert.Equal(t, libBefore, listFiles(t, libDir))
+}
+
+func TestReleaseKeepsTamperedLibraryCopy(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	photo := filepath.Join(srcDir, "photo.jpg")
+	createTestFile(t, photo, "jpeg-original")
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.ImportDir(srcDir)
+	require.NoError(t, err)
+
+	for _, f := range listFiles(t, libDir) {
+		if filepath.Ext(f) == ".jpg" {
+			require.NoError(t, os.WriteFile(f, []byte("bit rot"), 0o644))
+		}
+	}
+
+	imp, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	res, err := imp.Release([]string{srcDir}, true)
+	require.NoError(t, err)
+	assert.Zero(t, res.Deleted)
+	require.Len(t, res.Remaining, 1)
+	assert.FileExists(t, photo)
+}
+
+func TestReleaseRefusesLibraryPaths(t *testing.T) {
+	libDir := t.TempDir()
+	yearDir := filepath.Join(libDir, "2024")
+	require.NoError(t, os.MkdirAll(yearDir, 0o755))
+
+	imp, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = imp.Release([]string{yearDir}, true)
+	assert.ErrorContains(t, err, "inside the library")
+	_, err = imp.Release([]string{filepath.Dir(libDir)}, true)
+	assert.ErrorContains(t, err, "contains the library")
+}
@@ -0,0 +1,368 @@
+// Package index maintains the library's metadata index: one record per
+// library file, stored under .imv/ so questions about the library can be
+// answered without re-reading every file.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/geo"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/phash"
+)
+
+const (
+	indexFileName = "index.jsonl"
+	flushEvery    = 30 * time.Second
+)
+
+// Record describes one library file. Path is library-relative and
+// slash-separated. Optional fields are empty when unknown.
+type Record struct {
+	Path string `json:"path"`
+	Size int64  `json:"size,omitempty"`
+
+	Extension string             `json:"ext,omitempty"`
+	Make      string             `json:"make,omitempty"`
+	Model     string             `json:"model,omitempty"`
+	DateTime  time.Time          `json:"datetime,omitzero"`
+	MIMEType  string             `json:"mime,omitempty"`
+	MediaType defaults.MediaType `json:"media_type,omitempty"`
+	FullHash  string             `json:"hash,omitempty"`
+	HashAlgo  string             `json:"hash_algo,omitempty"`
+
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Duration is the running time of audio and video, in seconds.
+	Duration float64       `json:"duration,omitempty"`
+	GPS      *metadata.GPS `json:"gps,omitempty"`
+	// Place is the country and region of GPS.
+	Place *geo.Place `json:"place,omitempty"`
+
+	// Descriptors copied from metadata.FileMetadata; zero when unknown.
+	Orientation     int     `json:"orientation,omitempty"`
+	VideoCodec      string  `json:"codec,omitempty"`
+	FrameRate       float64 `json:"fps,omitempty"`
+	AudioSampleRate int     `json:"sample_rate,omitempty"`
+	LensModel       string  `json:"lens,omitempty"`
+	ISO             int     `json:"iso,omitempty"`
+	Aperture        float64 `json:"aperture,omitempty"`
+	ExposureTime    float64 `json:"exposure,omitempty"`
+	Software        string  `json:"software,omitempty"`
+	SerialNumber    string  `json:"serial,omitempty"`
+
+	// Session identifies the import run that brought the file in.
+	Session string `json:"session,omitempty"`
+
+	// PHash is the perceptual hash of an image (see package phash), as
+	// 16 hex digits.
+	PHash string `json:"phash,omitempty"`
+
+	// Deleted marks a tombstone line in the log; never set on records
+	// returned by Get or Records.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// FromMetadata builds the record of the library file at path (library-
+// relative) from its extracted metadata.
+func FromMetadata(path string, md *metadata.FileMetadata, hashAlgo string, size int64) Record {
+	return Record{
+		Path:      path,
+		Size:      size,
+		Extension: md.Extension,
+		Make:      md.Make,
+		Model:     md.Model,
+		DateTime:  md.DateTime,
+		MIMEType:  md.MIMEType,
+		MediaType: md.MediaType,
+		FullHash:  md.FullHash,
+		HashAlgo:  hashAlgo,
+		Width:     md.Width,
+		Height:    md.Height,
+		Duration:  md.Duration.Seconds(),
+		GPS:       md.GPS,
+		Place:     md.Place,
+
+		Orientation:     md.Orientation,
+		VideoCodec:      md.VideoCodec,
+		FrameRate:       md.FrameRate,
+		AudioSampleRate: md.AudioSampleRate,
+		LensModel:       md.LensModel,
+		ISO:             md.ISO,
+		Aperture:        md.Aperture,
+		ExposureTime:    md.ExposureTime,
+		Software:        md.Software,
+		SerialNumber:    md.SerialNumber,
+	}
+}
+
+// SameContent reports whether r and other describe the same bytes, as far
+// as their hashes tell.
+func (r Record) SameContent(other Record) bool {
+	return r.FullHash != "" && r.FullHash == other.FullHash && r.HashAlgo == other.HashAlgo
+}
+
+// AddPerceptualHash decodes the image at absPath and sets PHash, filling
+// in the dimensions if they are unknown. Files phash cannot decode are
+// left unchanged.
+func (r *Record) AddPerceptualHash(absPath string) error {
+	if !phash.Supported(absPath) {
+		return nil
+	}
+	h, w, ht, err := phash.FromFile(absPath)
+	if err != nil {
+		return err
+	}
+	r.PHash = h.String()
+	if r.Width == 0 || r.Height == 0 {
+		r.Width, r.Height = w, ht
+	}
+	return nil
+}
+
+// Index is the in-memory view of the index file. Changes are appended to
+// the file as JSON lines — later lines for the same path win, and a
+// tombstone removes it — so an interrupted run loses at most the lines
+// not yet flushed and never corrupts earlier ones. Compact rewrites the
+// file atomically with just the live records.
+//
+// A nil *Index is a valid no-op receiver for every method.
+type Index struct {
+	path    string
+	records map[string]Record
+
+	f         *os.File
+	w         *bufio.Writer
+	lines     int // lines in the file, live or superseded
+	lastFlush time.Time
+	needsNL   bool // the file ends in a partial line
+	detached  bool // changes stay in memory until Compact
+}
+
+// FilePath returns the index file path of a library.
+func FilePath(libraryPath string) string {
+	return filepath.Join(libraryPath, library.StateDirName, indexFileName)
+}
+
+// Load reads the index at path. A missing file yields an empty index.
+// Malformed lines, such as one cut short by a crash, are skipped.
+func Load(path string) (*Index, error) {
+	ix := &Index{
+		path:      path,
+		records:   make(map[string]Record),
+		lastFlush: time.Now(),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ix, nil
+		}
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+	ix.needsNL = len(data) > 0 && data[len(data)-1] != '\n'
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		ix.lines++
+		var r Record
+		if err := json.Unmarshal(line, &r); err != nil || r.Path == "" {
+			continue
+		}
+		if r.Deleted {
+			delete(ix.records, r.Path)
+		} else {
+			ix.records[r.Path] = r
+		}
+	}
+	return ix, nil
+}
+
+// NewDetached returns an empty index for path that ignores the existing
+// file: changes stay in memory until Compact replaces the file with them.
+// An interrupted rebuild therefore leaves the old index intact.
+func NewDetached(path string) *Index {
+	return &Index{
+		path:      path,
+		records:   make(map[string]Record),
+		lastFlush: time.Now(),
+		detached:  true,
+	}
+}
+
+// Len returns the number of live records.
+func (ix *Index) Len() int {
+	if ix == nil {
+		return 0
+	}
+	return len(ix.records)
+}
+
+// Get returns the record for a library-relative path.
+func (ix *Index) Get(path string) (Record, bool) {
+	if ix == nil {
+		return Record{}, false
+	}
+	r, ok := ix.records[path]
+	return r, ok
+}
+
+// Records returns every live record, sorted by path.
+func (ix *Index) Records() []Record {
+	if ix == nil {
+		return nil
+	}
+	out := make([]Record, 0, len(ix.records))
+	for _, r := range ix.records {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Put stores r, replacing any record for the same path.
+func (ix *Index) Put(r Record) error {
+	if ix == nil {
+		return nil
+	}
+	if r.Path == "" || strings.ContainsRune(r.Path, '\n') {
+		return fmt.Errorf("index: invalid path %q", r.Path)
+	}
+	r.Deleted = false
+	ix.records[r.Path] = r
+	return ix.append(r)
+}
+
+// Delete removes the record for path, if any.
+func (ix *Index) Delete(path string) error {
+	if ix == nil {
+		return nil
+	}
+	if _, ok := ix.records[path]; !ok {
+		return nil
+	}
+	delete(ix.records, path)
+	return ix.append(Record{Path: path, Deleted: true})
+}
+
+func (ix *Index) append(r Record) error {
+	if ix.detached {
+		return nil
+	}
+	if ix.w == nil {
+		if err := os.MkdirAll(filepath.Dir(ix.path), 0o755); err != nil {
+			return fmt.Errorf("index: mkdir: %w", err)
+		}
+		f, err := os.OpenFile(ix.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("index: open: %w", err)
+		}
+		ix.f = f
+		ix.w = bufio.NewWriter(f)
+		if ix.needsNL {
+			_ = ix.w.WriteByte('\n')
+			ix.needsNL = false
+		}
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("index: encode: %w", err)
+	}
+	line = append(line, '\n')
+	if _, err := ix.w.Write(line); err != nil {
+		return fmt.Errorf("index: write: %w", err)
+	}
+	ix.lines++
+
+	if time.Since(ix.lastFlush) > flushEvery {
+		return ix.Flush()
+	}
+	return nil
+}
+
+// Flush writes buffered lines and fsyncs the file.
+func (ix *Index) Flush() error {
+	if ix == nil || ix.w == nil {
+		return nil
+	}
+	if err := ix.w.Flush(); err != nil {
+		return fmt.Errorf("index: flush: %w", err)
+	}
+	if err := ix.f.Sync(); err != nil {
+		return fmt.Errorf("index: fsync: %w", err)
+	}
+	ix.lastFlush = time.Now()
+	return nil
+}
+
+// Compact atomically rewrites the file with only the live records.
+func (ix *Index) Compact() error {
+	if ix == nil {
+		return nil
+	}
+	if err := ix.closeFile(); err != nil {
+		return err
+	}
+	records := ix.Records()
+	err := library.WriteFileAtomic(ix.path, func(w *bufio.Writer) error {
+		return writeRecords(w, records)
+	})
+	if err != nil {
+		return fmt.Errorf("index: compact: %w", err)
+	}
+	ix.lines = len(records)
+	ix.needsNL = false
+	ix.detached = false
+	return nil
+}
+
+// Close flushes pending lines and compacts the file when superseded lines
+// outnumber live ones. A detached index is discarded.
+func (ix *Index) Close() error {
+	if ix == nil || ix.detached {
+		return nil
+	}
+	if err := ix.closeFile(); err != nil {
+		return err
+	}
+	if ix.lines > 2*len(ix.records) && ix.lines > 100 {
+		return ix.Compact()
+	}
+	return nil
+}
+
+func (ix *Index) closeFile() error {
+	if ix.w == nil {
+		return nil
+	}
+	err := ix.Flush()
+	if cerr := ix.f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("index: close: %w", cerr)
+	}
+	ix.f, ix.w = nil, nil
+	return err
+}
+
+func writeRecords(w io.Writer, records []Record) error {
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
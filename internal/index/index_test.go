@@ -0,0 +1,85 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutDeleteReload(t *testing.T) {
+	path := FilePath(t.TempDir())
+
+	ix, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0, ix.Len())
+
+	require.NoError(t, ix.Put(Record{Path: "2024/sources/a.jpg", Size: 1, PHash: "00000000000000ff"}))
+	require.NoError(t, ix.Put(Record{Path: "2024/sources/b.jpg", Size: 2}))
+	require.NoError(t, ix.Put(Record{Path: "2024/sources/a.jpg", Size: 3, Width: 4, Height: 5}))
+	require.NoError(t, ix.Delete("2024/sources/b.jpg"))
+	require.NoError(t, ix.Delete("2024/sources/missing.jpg"))
+	require.NoError(t, ix.Close())
+
+	ix, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Record{{Path: "2024/sources/a.jpg", Size: 3, Width: 4, Height: 5}}, ix.Records())
+	r, ok := ix.Get("2024/sources/a.jpg")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), r.Size)
+	_, ok = ix.Get("2024/sources/b.jpg")
+	assert.False(t, ok)
+
+	assert.Error(t, ix.Put(Record{}))
+	assert.Error(t, ix.Put(Record{Path: "a\nb"}))
+}
+
+func TestLoadSkipsPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(`{"path":"a.jpg","size":1}`+"\n"+`{"path":"b.jp`), 0o644))
+
+	ix, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ix.Len())
+
+	// The next append starts on a fresh line.
+	require.NoError(t, ix.Put(Record{Path: "c.jpg", Size: 3}))
+	require.NoError(t, ix.Close())
+	ix, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ix.Len())
+	_, ok := ix.Get("c.jpg")
+	assert.True(t, ok)
+}
+
+func TestCloseCompactsSupersededLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	ix, err := Load(path)
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		require.NoError(t, ix.Put(Record{Path: fmt.Sprintf("f%d.jpg", i%3), Size: int64(i)}))
+	}
+	require.NoError(t, ix.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(data), "\n"))
+
+	ix, err = Load(path)
+	require.NoError(t, err)
+	r, _ := ix.Get("f1.jpg")
+	assert.Equal(t, int64(199), r.Size)
+}
+
+func TestNilIndex(t *testing.T) {
+	var ix *Index
+	assert.Equal(t, 0, ix.Len())
+	assert.NoError(t, ix.Put(Record{Path: "a"}))
+	assert.NoError(t, ix.Delete("a"))
+	assert.NoError(t, ix.Close())
+	assert.Nil(t, ix.Records())
+}
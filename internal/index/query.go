@@ -0,0 +1,198 @@
+package index
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/metadata"
+)
+
+// Query selects index records. Zero-valued fields match everything; a
+// record must satisfy every set field.
+type Query struct {
+	// From and To bound the capture date: From inclusive, To exclusive.
+	// Records without a date never match a date bound.
+	From, To time.Time
+	// Device matches a case-insensitive substring of the device dir
+	// (e.g. "iphone 15" matches "Apple iPhone 15 Pro (image)").
+	Device    string
+	MediaType defaults.MediaType
+	// Extensions lists accepted extensions, lower-case with the dot.
+	Extensions []string
+	// MinSize and MaxSize bound the size in bytes, inclusive; 0 is unbounded.
+	MinSize, MaxSize int64
+	// HashPrefix matches the start of the full hash, case-insensitively.
+	HashPrefix string
+	// BBox limits results to files with a GPS position inside it.
+	BBox *BBox
+	// Country matches the ISO code or name of the country a file was
+	// captured in, and Region its first-level region; both ignore case.
+	Country string
+	Region  string
+	// Lens and Software match case-insensitive substrings of the lens
+	// model and of the software that last wrote a file (e.g. "lightroom"
+	// finds edited files); Serial and Codec match the camera serial number
+	// and video codec, ignoring case.
+	Lens     string
+	Software string
+	Serial   string
+	Codec    string
+	Session  string
+}
+
+// BBox is a latitude/longitude rectangle. MinLon > MaxLon describes a box
+// crossing the antimeridian.
+type BBox struct {
+	MinLat, MinLon, MaxLat, MaxLon float64
+}
+
+// ParseBBox reads "minLat,minLon,maxLat,maxLon".
+func ParseBBox(s string) (BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return BBox{}, fmt.Errorf("invalid bounding box %q: want minLat,minLon,maxLat,maxLon", s)
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BBox{}, fmt.Errorf("invalid bounding box %q: %q is not a number", s, p)
+		}
+		v[i] = f
+	}
+	b := BBox{MinLat: v[0], MinLon: v[1], MaxLat: v[2], MaxLon: v[3]}
+	if b.MinLat > b.MaxLat || b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 {
+		return BBox{}, fmt.Errorf("invalid bounding box %q", s)
+	}
+	return b, nil
+}
+
+// Contains reports whether g lies inside the box.
+func (b BBox) Contains(g metadata.GPS) bool {
+	if g.Latitude < b.MinLat || g.Latitude > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return g.Longitude >= b.MinLon && g.Longitude <= b.MaxLon
+	}
+	return g.Longitude >= b.MinLon || g.Longitude <= b.MaxLon
+}
+
+// ParsePeriod reads a date as YYYY, YYYY-MM or YYYY-MM-DD and returns the
+// start of that period and the start of the next one, in UTC.
+func ParsePeriod(s string) (start, end time.Time, err error) {
+	for _, p := range []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	} {
+		if t, err := time.Parse(p.layout, s); err == nil {
+			return t, p.next(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: want YYYY, YYYY-MM or YYYY-MM-DD", s)
+}
+
+// Match reports whether r satisfies every set field of q.
+func (q Query) Match(r Record) bool {
+	if !q.From.IsZero() && (r.DateTime.IsZero() || r.DateTime.Before(q.From)) {
+		return false
+	}
+	if !q.To.IsZero() && (r.DateTime.IsZero() || !r.DateTime.Before(q.To)) {
+		return false
+	}
+	if q.Device != "" && !containsFoldSubstring(DeviceDir(r.Path), q.Device) {
+		return false
+	}
+	if q.MediaType != "" && r.MediaType != q.MediaType {
+		return false
+	}
+	if len(q.Extensions) > 0 && !containsFold(q.Extensions, r.Extension) {
+		return false
+	}
+	if q.MinSize > 0 && r.Size < q.MinSize {
+		return false
+	}
+	if q.MaxSize > 0 && r.Size > q.MaxSize {
+		return false
+	}
+	if q.HashPrefix != "" && !strings.HasPrefix(strings.ToLower(r.FullHash), strings.ToLower(q.HashPrefix)) {
+		return false
+	}
+	if q.BBox != nil && (r.GPS == nil || !q.BBox.Contains(*r.GPS)) {
+		return false
+	}
+	if q.Country != "" || q.Region != "" {
+		p := r.Place
+		if p == nil {
+			// Records indexed before places were recorded.
+			p = r.GPS.Place()
+		}
+		if p == nil {
+			return false
+		}
+		if q.Country != "" && !strings.EqualFold(p.CountryCode, q.Country) && !strings.EqualFold(p.Country, q.Country) {
+			return false
+		}
+		if q.Region != "" && !strings.EqualFold(p.Region, q.Region) {
+			return false
+		}
+	}
+	if q.Lens != "" && !containsFoldSubstring(r.LensModel, q.Lens) {
+		return false
+	}
+	if q.Software != "" && !containsFoldSubstring(r.Software, q.Software) {
+		return false
+	}
+	if q.Serial != "" && !strings.EqualFold(r.SerialNumber, q.Serial) {
+		return false
+	}
+	if q.Codec != "" && !strings.EqualFold(r.VideoCodec, q.Codec) {
+		return false
+	}
+	if q.Session != "" && r.Session != q.Session {
+		return false
+	}
+	return true
+}
+
+// Find returns the records matching q, sorted by path.
+func (ix *Index) Find(q Query) []Record {
+	var out []Record
+	for _, r := range ix.Records() {
+		if q.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// DeviceDir returns the device dir of a library-relative source path
+// ("<year>/sources/<device>/..."), or "" for other paths.
+func DeviceDir(path string) string {
+	parts := strings.SplitN(path, "/", 4)
+	if len(parts) < 4 || parts[1] != "sources" {
+		return ""
+	}
+	return parts[2]
+}
+
+// containsFoldSubstring reports whether substr is within s, ignoring case.
+func containsFoldSubstring(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
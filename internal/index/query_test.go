@@ -0,0 +1,141 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/geo"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queryFixture(t *testing.T) *Index {
+	t.Helper()
+	ix := NewDetached(t.TempDir() + "/index.jsonl")
+	for _, r := range []Record{
+		{
+			Path:         "2023/sources/Fujifilm X100V (image)/2023-06-01/2023-06-01_10-00-00_aaaa1111.jpg",
+			Size:         5 << 20,
+			Extension:    ".jpg",
+			DateTime:     time.Date(2023, 6, 1, 10, 0, 0, 0, time.UTC),
+			MediaType:    defaults.MediaTypePhoto,
+			FullHash:     "aaaa1111ffff",
+			GPS:          &metadata.GPS{Latitude: 48.85, Longitude: 2.35},
+			Session:      "s1",
+			LensModel:    "23mm F2",
+			Software:     "Adobe Lightroom Classic 13.0",
+			SerialNumber: "0123456789",
+		},
+		{
+			Path:       "2023/sources/Apple iPhone 15 Pro (video)/2023-12-31/2023-12-31_23-59-59_bbbb2222.mov",
+			Size:       300 << 20,
+			Extension:  ".mov",
+			DateTime:   time.Date(2023, 12, 31, 23, 59, 59, 0, time.UTC),
+			MediaType:  defaults.MediaTypeVideo,
+			FullHash:   "bbbb2222ffff",
+			Session:    "s2",
+			VideoCodec: "hvc1",
+			LensModel:  "iPhone 15 Pro back camera 6.765mm f/1.78",
+			Software:   "17.1",
+		},
+		{
+			Path:      "2024/sources/Unknown (image)/2024-01-01/2024-01-01_00-00-00_cccc3333.PNG",
+			Size:      100,
+			Extension: ".png",
+			MediaType: defaults.MediaTypePhoto,
+			FullHash:  "cccc3333ffff",
+			GPS:       &metadata.GPS{Latitude: -17.7, Longitude: 178.0},
+			Place:     &geo.Place{CountryCode: "FJ", Country: "Fiji"},
+		},
+	} {
+		require.NoError(t, ix.Put(r))
+	}
+	return ix
+}
+
+func findNames(ix *Index, q Query) []string {
+	var out []string
+	for _, r := range ix.Find(q) {
+		out = append(out, r.Path[len(r.Path)-12:])
+	}
+	return out
+}
+
+func TestFind(t *testing.T) {
+	ix := queryFixture(t)
+	from, _, err := ParsePeriod("2023-06")
+	require.NoError(t, err)
+	_, to, err := ParsePeriod("2023")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"all", Query{}, []string{"bbbb2222.mov", "aaaa1111.jpg", "cccc3333.PNG"}},
+		{"date range", Query{From: from, To: to}, []string{"bbbb2222.mov", "aaaa1111.jpg"}},
+		{"undated never matches a date", Query{To: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, []string{"bbbb2222.mov", "aaaa1111.jpg"}},
+		{"device", Query{Device: "x100v"}, []string{"aaaa1111.jpg"}},
+		{"media type", Query{MediaType: defaults.MediaTypeVideo}, []string{"bbbb2222.mov"}},
+		{"extension", Query{Extensions: []string{".png", ".mov"}}, []string{"bbbb2222.mov", "cccc3333.PNG"}},
+		{"size", Query{MinSize: 1 << 20, MaxSize: 10 << 20}, []string{"aaaa1111.jpg"}},
+		{"hash prefix", Query{HashPrefix: "BBBB"}, []string{"bbbb2222.mov"}},
+		{"bbox", Query{BBox: &BBox{MinLat: 40, MinLon: -5, MaxLat: 55, MaxLon: 10}}, []string{"aaaa1111.jpg"}},
+		{"bbox across antimeridian", Query{BBox: &BBox{MinLat: -20, MinLon: 170, MaxLat: -10, MaxLon: -170}}, []string{"cccc3333.PNG"}},
+		{"country code, placed from GPS", Query{Country: "fr"}, []string{"aaaa1111.jpg"}},
+		{"country name", Query{Country: "FIJI"}, []string{"cccc3333.PNG"}},
+		{"region", Query{Country: "France", Region: "île-de-france"}, []string{"aaaa1111.jpg"}},
+		{"other region", Query{Region: "Texas"}, nil},
+		{"lens", Query{Lens: "IPHONE 15"}, []string{"bbbb2222.mov"}},
+		{"edited", Query{Software: "lightroom"}, []string{"aaaa1111.jpg"}},
+		{"serial", Query{Serial: "0123456789"}, []string{"aaaa1111.jpg"}},
+		{"serial is not a substring", Query{Serial: "01234"}, nil},
+		{"codec", Query{Codec: "HVC1"}, []string{"bbbb2222.mov"}},
+		{"session", Query{Session: "s2"}, []string{"bbbb2222.mov"}},
+		{"combined", Query{MediaType: defaults.MediaTypePhoto, Session: "s2"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, findNames(ix, tt.q))
+		})
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	b, err := ParseBBox("40, -5, 55, 10")
+	require.NoError(t, err)
+	assert.Equal(t, BBox{MinLat: 40, MinLon: -5, MaxLat: 55, MaxLon: 10}, b)
+
+	for _, s := range []string{"1,2,3", "a,b,c,d", "50,0,40,10", "0,-200,10,10"} {
+		_, err := ParseBBox(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end string
+	}{
+		{"2024", "2024-01-01", "2025-01-01"},
+		{"2024-02", "2024-02-01", "2024-03-01"},
+		{"2024-02-29", "2024-02-29", "2024-03-01"},
+	}
+	for _, tt := range tests {
+		start, end, err := ParsePeriod(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.start, start.Format("2006-01-02"))
+		assert.Equal(t, tt.end, end.Format("2006-01-02"))
+	}
+	_, _, err := ParsePeriod("last week")
+	assert.Error(t, err)
+}
+
+func TestDeviceDir(t *testing.T) {
+	assert.Equal(t, "Apple iPhone (image)", DeviceDir("2024/sources/Apple iPhone (image)/2024-01-01/a.jpg"))
+	assert.Equal(t, "", DeviceDir("2024/processed/a.jpg"))
+	assert.Equal(t, "", DeviceDir("a.jpg"))
+}
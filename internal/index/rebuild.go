@@ -0,0 +1,152 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+)
+
+// MetadataExtractor extracts metadata from a file.
+type MetadataExtractor interface {
+	Extract(path string, hasher *defaults.Hasher) (*metadata.FileMetadata, error)
+}
+
+// RebuildConfig controls an index rebuild.
+type RebuildConfig struct {
+	LibraryPath string
+	HashAlgo    string
+	// NoPerceptualHash skips decoding images; perceptual hashes already in
+	// the old index are still kept for files whose content is unchanged.
+	NoPerceptualHash bool
+	FailFast         bool
+}
+
+// RebuildResult holds the outcome counts of a rebuild.
+type RebuildResult struct {
+	Indexed int
+	Errors  int
+}
+
+// Rebuild regenerates the index of a library from the files themselves:
+// every source file, and the edited exports in processed/ that the hash
+// manifests track.
+// The new index replaces the old one atomically once every file has been
+// read. Import sessions, which the files cannot tell, are carried over
+// from the old index for unchanged content, as are perceptual hashes.
+func Rebuild(cfg RebuildConfig, ext MetadataExtractor, logger *logging.Logger) (*RebuildResult, error) {
+	hasher, err := defaults.NewHasher(cfg.HashAlgo)
+	if err != nil {
+		return nil, fmt.Errorf("index: %w", err)
+	}
+
+	path := FilePath(cfg.LibraryPath)
+	old, err := Load(path)
+	if err != nil {
+		logger.Warn("library index: old index unreadable, starting empty: %v", err)
+	}
+
+	years, err := library.ListYears(cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+	var files []string
+	for _, year := range years {
+		yearDir := filepath.Join(cfg.LibraryPath, year)
+		found, err := library.ListSourceFiles(yearDir)
+		if err != nil {
+			return nil, fmt.Errorf("list source files for %s: %w", year, err)
+		}
+		processed, err := trackedProcessedFiles(yearDir, logger)
+		if err != nil {
+			return nil, fmt.Errorf("list processed files for %s: %w", year, err)
+		}
+		for _, p := range append(found, processed...) {
+			base := filepath.Base(p)
+			if defaults.IsIgnoredFile(base) || defaults.IsSidecarExtension(filepath.Ext(base)) {
+				continue
+			}
+			files = append(files, p)
+		}
+	}
+
+	ix := NewDetached(path)
+	result := &RebuildResult{}
+	for i, p := range files {
+		stats := fmt.Sprintf("indexed:%d errors:%d", result.Indexed, result.Errors)
+		logger.ProgressWithStats(i+1, len(files), "[index] ", stats, p)
+
+		if err := rebuildFile(cfg, ix, old, p, ext, hasher, logger); err != nil {
+			result.Errors++
+			logger.Error("index %s: %v", p, err)
+			if cfg.FailFast {
+				return result, err
+			}
+			continue
+		}
+		result.Indexed++
+	}
+
+	if err := ix.Compact(); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// trackedProcessedFiles returns the files in yearDir's processed/ that its
+// hash manifest tracks: those import or verify put there. The rest of
+// processed/ is the user's own and stays out of the index.
+func trackedProcessedFiles(yearDir string, logger *logging.Logger) ([]string, error) {
+	found, err := library.ListProcessedFiles(yearDir)
+	if err != nil || len(found) == 0 {
+		return nil, err
+	}
+	m, err := library.LoadManifest(library.ManifestFilePath(yearDir))
+	if err != nil {
+		logger.Warn("hash manifest for %s: load failed: %v", filepath.Base(yearDir), err)
+	}
+	var tracked []string
+	for _, p := range found {
+		rel, err := filepath.Rel(yearDir, p)
+		if err != nil {
+			continue
+		}
+		if _, ok := m.Lookup(filepath.ToSlash(rel)); ok {
+			tracked = append(tracked, p)
+		}
+	}
+	return tracked, nil
+}
+
+func rebuildFile(cfg RebuildConfig, ix, old *Index, absPath string, ext MetadataExtractor, hasher *defaults.Hasher, logger *logging.Logger) error {
+	rel, err := filepath.Rel(cfg.LibraryPath, absPath)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return err
+	}
+	md, err := ext.Extract(absPath, hasher)
+	if err != nil {
+		return fmt.Errorf("extract metadata: %w", err)
+	}
+
+	r := FromMetadata(rel, md, cfg.HashAlgo, info.Size())
+	if prev, ok := old.Get(rel); ok && prev.SameContent(r) {
+		r.Session = prev.Session
+		r.PHash = prev.PHash
+	}
+	if r.PHash == "" && !cfg.NoPerceptualHash && md.MediaType == defaults.MediaTypePhoto {
+		if err := r.AddPerceptualHash(absPath); err != nil {
+			logger.Warn("perceptual hash %s: %v", rel, err)
+		}
+	}
+	return ix.Put(r)
+}
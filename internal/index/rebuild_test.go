@@ -0,0 +1,117 @@
+package index
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeExtractor struct{}
+
+func (fakeExtractor) Extract(path string, hasher *defaults.Hasher) (*metadata.FileMetadata, error) {
+	full, short, err := metadata.ComputeFileHash(path, hasher)
+	if err != nil {
+		return nil, err
+	}
+	return &metadata.FileMetadata{
+		Path:      path,
+		Extension: filepath.Ext(path),
+		Make:      "TestMake",
+		Model:     "TestModel",
+		DateTime:  time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		MIMEType:  "image/png",
+		MediaType: defaults.MediaTypePhoto,
+		FullHash:  full,
+		ShortHash: short,
+		GPS:       &metadata.GPS{Latitude: 1.5, Longitude: -2.5},
+	}, nil
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+func TestRebuild(t *testing.T) {
+	libDir := t.TempDir()
+	dir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 20, 10))))
+	writeFile(t, filepath.Join(dir, "a.png"), buf.Bytes())
+	writeFile(t, filepath.Join(dir, "a.xmp"), []byte("xmp"))
+	writeFile(t, filepath.Join(dir, ".DS_Store"), []byte("junk"))
+
+	// The old index holds a session worth keeping and a stale record.
+	full, _, err := metadata.ComputeFileHash(filepath.Join(dir, "a.png"), mustHasher(t, "md5"))
+	require.NoError(t, err)
+	relA := "2024/sources/TestMake TestModel (image)/2024-01-15/a.png"
+	old, err := Load(FilePath(libDir))
+	require.NoError(t, err)
+	require.NoError(t, old.Put(Record{Path: relA, FullHash: full, HashAlgo: "md5", Session: "s1"}))
+	require.NoError(t, old.Put(Record{Path: "2023/sources/gone.jpg"}))
+	require.NoError(t, old.Close())
+
+	res, err := Rebuild(RebuildConfig{LibraryPath: libDir, HashAlgo: "md5"}, fakeExtractor{}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Indexed)
+	assert.Equal(t, 0, res.Errors)
+
+	ix, err := Load(FilePath(libDir))
+	require.NoError(t, err)
+	records := ix.Records()
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, relA, r.Path)
+	assert.Equal(t, "s1", r.Session)
+	assert.Equal(t, full, r.FullHash)
+	assert.Equal(t, int64(buf.Len()), r.Size)
+	assert.Equal(t, 20, r.Width)
+	assert.Equal(t, 10, r.Height)
+	assert.NotEmpty(t, r.PHash)
+	assert.Equal(t, &metadata.GPS{Latitude: 1.5, Longitude: -2.5}, r.GPS)
+	assert.True(t, r.DateTime.Equal(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestRebuildKeepsTrackedProcessedFiles(t *testing.T) {
+	libDir := t.TempDir()
+	yearDir := filepath.Join(libDir, "2024")
+	dir := filepath.Join(yearDir, "processed", "TestMake TestModel (image)", "2024-01-15")
+	writeFile(t, filepath.Join(dir, "export.jpg"), []byte("edited export"))
+	writeFile(t, filepath.Join(dir, "mine.jpg"), []byte("user's own file"))
+
+	m, err := library.LoadManifest(library.ManifestFilePath(yearDir))
+	require.NoError(t, err)
+	require.NoError(t, m.Record(library.ManifestEntry{RelPath: "processed/TestMake TestModel (image)/2024-01-15/export.jpg", HashAlgo: "md5", FullHash: "x"}))
+	require.NoError(t, m.Persist())
+
+	res, err := Rebuild(RebuildConfig{LibraryPath: libDir, HashAlgo: "md5", NoPerceptualHash: true}, fakeExtractor{}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Indexed)
+
+	ix, err := Load(FilePath(libDir))
+	require.NoError(t, err)
+	defer ix.Close()
+	records := ix.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, "2024/processed/TestMake TestModel (image)/2024-01-15/export.jpg", records[0].Path)
+}
+
+func mustHasher(t *testing.T, algo string) *defaults.Hasher {
+	t.Helper()
+	h, err := defaults.NewHasher(algo)
+	require.NoError(t, err)
+	return h
+}
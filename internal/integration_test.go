@@ -3,6 +3,7 @@ package internal_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -445,3 +446,321 @@ func (d *dateForcedExtractor) Extract(path string, hasher *defaults.Hasher) (*me
 	md.DateTime = d.dt
 	return md, nil
 }
+
+// --- Hash manifest / scrub integration tests ---
+
+// rotFile flips bytes of path in place while keeping its size and mtime,
+// the way silent disk corruption would.
+func rotFile(t *testing.T, path string) {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+}
+
+// TestHashManifest_ImportRecordsFullHashes: import stores the full hash of
+// every imported file in its year's manifest.
+func TestHashManifest_ImportRecordsFullHashes(t *testing.T) {
+	libDir, _, _ := setupCachedLib(t)
+
+	m, err := library.LoadManifest(library.ManifestFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	entries := m.Entries()
+	require.Len(t, entries, 2)
+
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+	for rel, e := range entries {
+		full, _, err := metadata.ComputeFileHash(filepath.Join(libDir, "2024", rel), hasher)
+		require.NoError(t, err)
+		assert.Equal(t, full, e.FullHash)
+		assert.Equal(t, "md5", e.HashAlgo)
+	}
+}
+
+// TestHashManifest_ScrubDetectsBitRotBehindCache: corruption that keeps
+// size and mtime is invisible to a cached verify but caught by --scrub.
+func TestHashManifest_ScrubDetectsBitRotBehindCache(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+
+	v := newVerifier(t, libDir, ext, logger, false)
+	_, err := v.Verify()
+	require.NoError(t, err)
+
+	files, err := library.ListSourceFiles(filepath.Join(libDir, "2024"))
+	require.NoError(t, err)
+	rotFile(t, files[0])
+
+	// Cached verify trusts size+mtime and misses it.
+	r, err := newVerifier(t, libDir, ext, logger, false).Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, r.Corrupted)
+
+	ext.extractCalls.Store(0)
+	vs, err := verifier.New(verifier.Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		Scrub:       true,
+	}, ext, logger)
+	require.NoError(t, err)
+	r, err = vs.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Corrupted)
+	assert.Equal(t, 1, r.Verified)
+	assert.Equal(t, 0, r.CacheHits, "scrub bypasses the cache")
+	assert.Equal(t, int64(0), ext.extractCalls.Load(), "scrub re-hashes without extracting metadata")
+	require.Len(t, r.Findings, 1)
+	assert.Equal(t, verifier.FindingContentCorrupted, r.Findings[0].Kind)
+	assert.Equal(t, files[0], r.Findings[0].Path)
+}
+
+// TestHashManifest_CorruptionNotMovedByFix: a full verify reports a file
+// with a changed full hash as corrupted, not as a path mismatch, and --fix
+// leaves it in place.
+func TestHashManifest_CorruptionNotMovedByFix(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+
+	files, err := library.ListSourceFiles(filepath.Join(libDir, "2024"))
+	require.NoError(t, err)
+	rotFile(t, files[0])
+
+	v, err := verifier.New(verifier.Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		Fix:         true,
+		NoCache:     true,
+	}, ext, logger)
+	require.NoError(t, err)
+	r, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Corrupted)
+	assert.Equal(t, 0, r.Fixed)
+	assert.FileExists(t, files[0])
+}
+
+// TestHashManifest_VerifyBackfillsMissingEntries: files imported before
+// the manifest existed get their hash recorded on the first full verify.
+func TestHashManifest_VerifyBackfillsMissingEntries(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+	manifestPath := library.ManifestFilePath(filepath.Join(libDir, "2024"))
+	require.NoError(t, os.Remove(manifestPath))
+
+	_, err := newVerifier(t, libDir, ext, logger, true).Verify()
+	require.NoError(t, err)
+
+	m, err := library.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	assert.Len(t, m.Entries(), 2)
+}
+
+// --- Cache age / budget integration tests ---
+
+// ageCacheEntries rewrites the 2024 cache so each listed file's VerifiedAt
+// is the given Unix time.
+func ageCacheEntries(t *testing.T, libDir string, verifiedAt map[string]int64) {
+	t.Helper()
+	yearDir := filepath.Join(libDir, "2024")
+	c, err := verifier.Load(verifier.CacheFilePath(yearDir))
+	require.NoError(t, err)
+	for abs, ts := range verifiedAt {
+		rel, err := filepath.Rel(yearDir, abs)
+		require.NoError(t, err)
+		e, ok := c.Lookup(filepath.ToSlash(rel))
+		require.True(t, ok, "no cache entry for %s", rel)
+		e.VerifiedAt = ts
+		require.NoError(t, c.Record(e))
+	}
+	require.NoError(t, c.Persist())
+}
+
+// TestVerifyCache_MaxAgeExpiresOldEntries: entries verified longer ago than
+// MaxAge are misses; fresher ones still hit.
+func TestVerifyCache_MaxAgeExpiresOldEntries(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+	_, err := newVerifier(t, libDir, ext, logger, false).Verify()
+	require.NoError(t, err)
+
+	files, err := library.ListSourceFiles(filepath.Join(libDir, "2024"))
+	require.NoError(t, err)
+	ageCacheEntries(t, libDir, map[string]int64{
+		files[0]: time.Now().Add(-100 * 24 * time.Hour).Unix(),
+	})
+
+	ext.extractCalls.Store(0)
+	v, err := verifier.New(verifier.Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		FailFast:    true,
+		MaxAge:      90 * 24 * time.Hour,
+	}, ext, logger)
+	require.NoError(t, err)
+	r, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Verified)
+	assert.Equal(t, 1, r.CacheHits)
+	assert.Equal(t, int64(1), ext.extractCalls.Load(), "only the expired entry is re-verified")
+
+	// The re-verified entry is fresh again.
+	c, err := verifier.Load(verifier.CacheFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	for _, e := range c.Entries() {
+		assert.WithinDuration(t, time.Now(), time.Unix(e.VerifiedAt, 0), time.Minute)
+	}
+}
+
+// TestVerifyCache_BudgetRefreshesOldestFirst: with a byte budget smaller
+// than one file, exactly the least recently verified entry is re-verified
+// and the other stays a plain cache hit.
+func TestVerifyCache_BudgetRefreshesOldestFirst(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+	_, err := newVerifier(t, libDir, ext, logger, false).Verify()
+	require.NoError(t, err)
+
+	files, err := library.ListSourceFiles(filepath.Join(libDir, "2024"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	oldest, newer := files[1], files[0]
+	ageCacheEntries(t, libDir, map[string]int64{oldest: 1000, newer: 2000})
+
+	ext.extractCalls.Store(0)
+	v, err := verifier.New(verifier.Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		FailFast:    true,
+		Budget:      verifier.Budget{Bytes: 1},
+	}, ext, logger)
+	require.NoError(t, err)
+	r, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Verified)
+	assert.Equal(t, 1, r.Refreshed)
+	assert.Equal(t, 1, r.CacheHits)
+	assert.Equal(t, int64(1), ext.extractCalls.Load())
+
+	c, err := verifier.Load(verifier.CacheFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, err)
+	rel := func(p string) string {
+		r, err := filepath.Rel(filepath.Join(libDir, "2024"), p)
+		require.NoError(t, err)
+		return filepath.ToSlash(r)
+	}
+	eOld, _ := c.Lookup(rel(oldest))
+	eNew, _ := c.Lookup(rel(newer))
+	assert.Greater(t, eOld.VerifiedAt, int64(2000), "oldest entry was refreshed")
+	assert.Equal(t, int64(2000), eNew.VerifiedAt, "newer entry untouched")
+}
+
+// TestVerifyCache_BudgetDefersUnverifiedFiles: files never verified are
+// checked first, and those beyond the budget are deferred, not failed.
+func TestVerifyCache_BudgetDefersUnverifiedFiles(t *testing.T) {
+	libDir, ext, logger := setupCachedLib(t)
+
+	v, err := verifier.New(verifier.Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		FailFast:    true,
+		Budget:      verifier.Budget{Bytes: 1},
+	}, ext, logger)
+	require.NoError(t, err)
+	r, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, r.Verified)
+	assert.Equal(t, 1, r.Deferred)
+	assert.Equal(t, 0, r.Refreshed)
+}
+
+// editedExtractor marks files whose content mentions "export" as
+// Snapseed exports.
+type editedExtractor struct {
+	inner *fakeExtractor
+}
+
+func (e *editedExtractor) Extract(path string, hasher *defaults.Hasher) (*metadata.FileMetadata, error) {
+	md, err := e.inner.Extract(path, hasher)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(path); err == nil && strings.Contains(string(data), "export") {
+		md.Software = "Snapseed 2.0"
+	}
+	return md, nil
+}
+
+// TestHashManifest_ProcessedFilesStayTracked: edited exports in
+// processed/, whether import or verify --fix put them there, keep their
+// manifest entries across verify runs, so --scrub still checks them.
+func TestHashManifest_ProcessedFilesStayTracked(t *testing.T) {
+	srcDir := t.TempDir()
+	libDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "photo.jpg"), []byte("camera original"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "edit.jpg"), []byte("snapseed export"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "edit2.jpg"), []byte("second export"), 0o644))
+	logger := logging.New(os.Stdout, os.Stderr, false)
+	ext := &editedExtractor{inner: &fakeExtractor{}}
+
+	importFiles := func(names ...string) {
+		t.Helper()
+		imp, err := importer.New(importer.Config{LibraryPath: libDir, HashAlgo: "md5", FailFast: true}, ext, logger)
+		require.NoError(t, err)
+		var files []string
+		for _, n := range names {
+			files = append(files, filepath.Join(srcDir, n))
+		}
+		_, err = imp.ImportFiles(files)
+		require.NoError(t, err)
+	}
+	verify := func(cfg verifier.Config) *verifier.Result {
+		t.Helper()
+		cfg.LibraryPath, cfg.HashAlgo = libDir, "md5"
+		v, err := verifier.New(cfg, ext, logger)
+		require.NoError(t, err)
+		r, err := v.Verify()
+		require.NoError(t, err)
+		return r
+	}
+
+	// edit2.jpg lands in sources/ while the rules are off; verify --fix
+	// moves it to processed/ once they are back on.
+	require.NoError(t, library.SaveConfig(libDir, library.Config{Derived: library.DerivedRules{Action: library.DerivedOff}}))
+	importFiles("edit2.jpg")
+	require.NoError(t, library.SaveConfig(libDir, library.Config{Derived: library.DerivedRules{Action: library.DerivedToProcessed}}))
+	importFiles("photo.jpg", "edit.jpg")
+	r := verify(verifier.Config{Fix: true, NoCache: true})
+	assert.Equal(t, 1, r.Fixed)
+
+	yearDir := filepath.Join(libDir, "2024")
+	processed, err := library.ListProcessedFiles(yearDir)
+	require.NoError(t, err)
+	require.Len(t, processed, 2)
+
+	r = verify(verifier.Config{})
+	assert.Equal(t, 0, r.Inconsistent)
+	assert.Equal(t, 3, r.Verified)
+
+	m, err := library.LoadManifest(library.ManifestFilePath(yearDir))
+	require.NoError(t, err)
+	for _, p := range processed {
+		rel, err := filepath.Rel(yearDir, p)
+		require.NoError(t, err)
+		_, ok := m.Lookup(filepath.ToSlash(rel))
+		assert.True(t, ok, rel)
+	}
+
+	rotFile(t, processed[0])
+	r = verify(verifier.Config{Scrub: true})
+	assert.Equal(t, 1, r.Corrupted)
+	assert.Equal(t, 2, r.Verified)
+	require.Len(t, r.Findings, 1)
+	assert.Equal(t, processed[0], r.Findings[0].Path)
+
+	// Files of someone's own in processed/ are left alone.
+	require.NoError(t, os.MkdirAll(filepath.Join(yearDir, "processed", "Album"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(yearDir, "processed", "Album", "cover.jpg"), []byte("cover"), 0o644))
+	r = verify(verifier.Config{NoCache: true})
+	assert.Equal(t, 1, r.Corrupted)
+	assert.Equal(t, 1, r.Inconsistent)
+}
@@ -0,0 +1,213 @@
+package library
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+)
+
+const configFileName = "library.json"
+
+// ErrHashAlgoMismatch is returned by CheckHashAlgo when a command would
+// hash the library's files with an algorithm other than the library's.
+var ErrHashAlgoMismatch = errors.New("hash algorithm mismatch")
+
+// Config is the library-level settings file, .imv/library.json.
+type Config struct {
+	// HashAlgo is the algorithm the library's filenames and manifests
+	// were hashed with.
+	HashAlgo string `json:"hash_algo,omitempty"`
+	// RehashTo is set while a rehash to another algorithm is under way;
+	// until it finishes the library holds names of both algorithms.
+	RehashTo string `json:"rehash_to,omitempty"`
+	// Owners maps camera serial numbers to owner labels, which are added
+	// to the device dirs of those cameras' files ("Apple iPhone 15 Pro -
+	// Alice (image)") to keep identical devices apart.
+	Owners map[string]string `json:"owners,omitempty"`
+	// Derived decides which files are edited exports rather than camera
+	// originals, and where they go.
+	Derived DerivedRules `json:"derived,omitzero"`
+}
+
+// What import and verify do with edited exports (DerivedRules.Action).
+const (
+	// DerivedToProcessed imports them into <year>/processed/ and has
+	// verify report those in sources/.
+	DerivedToProcessed = "processed"
+	// DerivedFlag imports them into sources/ like originals, with a
+	// warning, and has verify report them.
+	DerivedFlag = "flag"
+	// DerivedOff treats them as originals. The default, so a library
+	// opts in to the others in its settings.
+	DerivedOff = "off"
+)
+
+// DerivedRules tells edited exports from camera originals, by the
+// software that wrote them or an XMP reference to the file they were
+// exported from.
+type DerivedRules struct {
+	// Action is DerivedToProcessed, DerivedFlag or DerivedOff; empty
+	// means DerivedOff.
+	Action string `json:"action,omitempty"`
+	// Software lists the names that mark an edit when they appear as
+	// whole words, ignoring case, in the Software and XMP history tags.
+	// It replaces
+	// defaults.EditingSoftware when set.
+	Software []string `json:"software,omitempty"`
+	// IgnoreDerivedFrom stops an XMP DerivedFrom reference alone from
+	// marking a file as edited.
+	IgnoreDerivedFrom bool `json:"ignore_derived_from,omitempty"`
+}
+
+// Mode returns the action of r, defaulted.
+func (r DerivedRules) Mode() string {
+	if r.Action == "" {
+		return DerivedOff
+	}
+	return r.Action
+}
+
+// ConfigFilePath returns the settings file path of a library.
+func ConfigFilePath(libraryPath string) string {
+	return filepath.Join(libraryPath, StateDirName, configFileName)
+}
+
+// LoadConfig reads the settings of the library at libraryPath. A missing
+// file yields the zero Config.
+func LoadConfig(libraryPath string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(ConfigFilePath(libraryPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return c, fmt.Errorf("read library config: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse library config: %w", err)
+	}
+	for serial, owner := range c.Owners {
+		if strings.TrimSpace(serial) == "" {
+			return c, fmt.Errorf("library config: empty serial number in owners")
+		}
+		if err := ValidateOwner(owner); err != nil {
+			return c, fmt.Errorf("library config: owner of %s: %w", serial, err)
+		}
+	}
+	switch c.Derived.Mode() {
+	case DerivedToProcessed, DerivedFlag, DerivedOff:
+	default:
+		return c, fmt.Errorf("library config: derived action %q: want %s, %s or %s",
+			c.Derived.Action, DerivedToProcessed, DerivedFlag, DerivedOff)
+	}
+	return c, nil
+}
+
+// ValidateOwner checks that an owner label can go into a device dir name:
+// it must be non-empty, without surrounding spaces, path separators,
+// parentheses or control characters.
+func ValidateOwner(owner string) error {
+	switch {
+	case owner == "":
+		return errors.New("owner label is empty")
+	case strings.TrimSpace(owner) != owner:
+		return fmt.Errorf("owner label %q has surrounding spaces", owner)
+	case strings.ContainsAny(owner, `/\()`) || strings.ContainsFunc(owner, unicode.IsControl):
+		return fmt.Errorf("owner label %q may not contain slashes, parentheses or control characters", owner)
+	}
+	return nil
+}
+
+// SaveConfig atomically writes the settings of the library at libraryPath.
+func SaveConfig(libraryPath string, c Config) error {
+	err := WriteFileAtomic(ConfigFilePath(libraryPath), func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	})
+	if err != nil {
+		return fmt.Errorf("write library config: %w", err)
+	}
+	return nil
+}
+
+// ManifestHashAlgos returns the hash algorithms found in the manifests of
+// every year of the library, sorted. Libraries created before the
+// algorithm was recorded in the settings file are told by these.
+func ManifestHashAlgos(libraryPath string) ([]string, error) {
+	years, err := ListYears(libraryPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, year := range years {
+		m, err := LoadManifest(ManifestFilePath(filepath.Join(libraryPath, year)))
+		if err != nil {
+			return nil, fmt.Errorf("hash manifest for %s: %w", year, err)
+		}
+		for _, e := range m.entries {
+			seen[e.HashAlgo] = true
+		}
+	}
+	algos := make([]string, 0, len(seen))
+	for a := range seen {
+		algos = append(algos, a)
+	}
+	sort.Strings(algos)
+	return algos, nil
+}
+
+// CheckHashAlgo refuses to let algo be used on a library hashed with
+// another algorithm, or one in the middle of a rehash: either would see
+// every file as misnamed. A library without a recorded algorithm is told
+// by its manifests; when record is set and nothing contradicts algo, it
+// is recorded as the library's.
+func CheckHashAlgo(libraryPath, algo string, record bool) error {
+	if !defaults.IsHashAlgorithm(algo) {
+		return fmt.Errorf("unsupported hash algorithm: %s", algo)
+	}
+	c, err := LoadConfig(libraryPath)
+	if err != nil {
+		return err
+	}
+	if c.RehashTo != "" {
+		return fmt.Errorf("%w: a rehash from %s to %s was interrupted; run imv rehash --to %s to finish it",
+			ErrHashAlgoMismatch, c.HashAlgo, c.RehashTo, c.RehashTo)
+	}
+	if c.HashAlgo != "" {
+		if c.HashAlgo != algo {
+			return mismatchError(c.HashAlgo, algo)
+		}
+		return nil
+	}
+
+	algos, err := ManifestHashAlgos(libraryPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(algos) > 1:
+		return fmt.Errorf("%w: the library mixes %v hashes; run imv rehash --to %s to convert it",
+			ErrHashAlgoMismatch, algos, algo)
+	case len(algos) == 1 && algos[0] != algo:
+		return mismatchError(algos[0], algo)
+	}
+	if !record {
+		return nil
+	}
+	c.HashAlgo = algo
+	return SaveConfig(libraryPath, c)
+}
+
+func mismatchError(library, algo string) error {
+	return fmt.Errorf("%w: the library uses %s, not %s; pass --hash-algo %s, or run imv rehash --to %s to convert it",
+		ErrHashAlgoMismatch, library, algo, library, algo)
+}
@@ -0,0 +1,127 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigRoundTrip(t *testing.T) {
+	lib := t.TempDir()
+	c, err := LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, Config{}, c)
+
+	require.NoError(t, SaveConfig(lib, Config{HashAlgo: "md5", RehashTo: "sha256"}))
+	assert.FileExists(t, filepath.Join(lib, ".imv", "library.json"))
+	c, err = LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, Config{HashAlgo: "md5", RehashTo: "sha256"}, c)
+
+	require.NoError(t, os.WriteFile(ConfigFilePath(lib), []byte("{"), 0o644))
+	_, err = LoadConfig(lib)
+	assert.Error(t, err)
+}
+
+func TestConfigOwners(t *testing.T) {
+	lib := t.TempDir()
+	owners := map[string]string{"F2LXK0ABCDEF": "Alice", "F2LXK0999999": "Bob Smith"}
+	require.NoError(t, SaveConfig(lib, Config{Owners: owners}))
+
+	// Recording the hash algorithm keeps the mapping.
+	require.NoError(t, CheckHashAlgo(lib, "md5", true))
+	c, err := LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, Config{HashAlgo: "md5", Owners: owners}, c)
+
+	for _, bad := range []map[string]string{
+		{"F2LXK0ABCDEF": ""},
+		{"F2LXK0ABCDEF": " Alice"},
+		{"F2LXK0ABCDEF": "Alice/Bob"},
+		{"F2LXK0ABCDEF": "Alice (work)"},
+		{" ": "Alice"},
+	} {
+		require.NoError(t, SaveConfig(lib, Config{Owners: bad}))
+		_, err := LoadConfig(lib)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestConfigDerivedRules(t *testing.T) {
+	lib := t.TempDir()
+	rules := DerivedRules{Action: DerivedFlag, Software: []string{"Snapseed"}, IgnoreDerivedFrom: true}
+	require.NoError(t, SaveConfig(lib, Config{Derived: rules}))
+	c, err := LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, rules, c.Derived)
+	assert.Equal(t, DerivedOff, DerivedRules{}.Mode())
+
+	require.NoError(t, SaveConfig(lib, Config{Derived: DerivedRules{Action: "move"}}))
+	_, err = LoadConfig(lib)
+	assert.ErrorContains(t, err, `derived action "move"`)
+}
+
+func writeManifest(t *testing.T, lib, year string, entries ...ManifestEntry) {
+	t.Helper()
+	m, err := LoadManifest(ManifestFilePath(filepath.Join(lib, year)))
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NoError(t, m.Record(e))
+	}
+	require.NoError(t, m.Persist())
+}
+
+func TestCheckHashAlgo(t *testing.T) {
+	t.Run("records the algorithm of a new library", func(t *testing.T) {
+		lib := t.TempDir()
+		require.NoError(t, CheckHashAlgo(lib, "sha256", false))
+		_, err := os.Stat(ConfigFilePath(lib))
+		assert.True(t, os.IsNotExist(err), "a read-only check records nothing")
+
+		require.NoError(t, CheckHashAlgo(lib, "sha256", true))
+		c, err := LoadConfig(lib)
+		require.NoError(t, err)
+		assert.Equal(t, "sha256", c.HashAlgo)
+
+		err = CheckHashAlgo(lib, "md5", true)
+		require.ErrorIs(t, err, ErrHashAlgoMismatch)
+		assert.Contains(t, err.Error(), "imv rehash --to md5")
+	})
+
+	t.Run("tells a legacy library by its manifests", func(t *testing.T) {
+		lib := t.TempDir()
+		writeManifest(t, lib, "2024", ManifestEntry{RelPath: "a.jpg", HashAlgo: "md5", FullHash: "aa"})
+		assert.ErrorIs(t, CheckHashAlgo(lib, "sha256", true), ErrHashAlgoMismatch)
+		require.NoError(t, CheckHashAlgo(lib, "md5", true))
+		c, err := LoadConfig(lib)
+		require.NoError(t, err)
+		assert.Equal(t, "md5", c.HashAlgo)
+	})
+
+	t.Run("refuses a mixed library", func(t *testing.T) {
+		lib := t.TempDir()
+		writeManifest(t, lib, "2023", ManifestEntry{RelPath: "a.jpg", HashAlgo: "md5", FullHash: "aa"})
+		writeManifest(t, lib, "2024", ManifestEntry{RelPath: "b.jpg", HashAlgo: "sha256", FullHash: "bb"})
+		assert.ErrorIs(t, CheckHashAlgo(lib, "md5", false), ErrHashAlgoMismatch)
+	})
+
+	t.Run("refuses a library being rehashed", func(t *testing.T) {
+		lib := t.TempDir()
+		require.NoError(t, SaveConfig(lib, Config{HashAlgo: "md5", RehashTo: "sha256"}))
+		for _, algo := range []string{"md5", "sha256"} {
+			err := CheckHashAlgo(lib, algo, false)
+			require.ErrorIs(t, err, ErrHashAlgoMismatch)
+			assert.Contains(t, err.Error(), "interrupted")
+		}
+	})
+
+	t.Run("rejects unknown algorithms", func(t *testing.T) {
+		lib := t.TempDir()
+		assert.Error(t, CheckHashAlgo(lib, "sha512", true))
+		_, err := os.Stat(ConfigFilePath(lib))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
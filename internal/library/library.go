@@ -56,21 +56,31 @@ func ListYearsFiltered(libraryPath, yearFilter string) ([]string, error) {
 // ListSourceFiles walks <yearDir>/sources/ recursively and returns all file paths (not dirs).
 // Skips permission errors. Returns nil if sources/ doesn't exist.
 func ListSourceFiles(yearDir string) ([]string, error) {
-	sourcesDir := filepath.Join(yearDir, "sources")
+	return listFiles(yearDir, "sources")
+}
+
+// ListProcessedFiles walks <yearDir>/processed/ like ListSourceFiles walks
+// sources/. Returns nil if processed/ doesn't exist.
+func ListProcessedFiles(yearDir string) ([]string, error) {
+	return listFiles(yearDir, "processed")
+}
+
+func listFiles(yearDir, area string) ([]string, error) {
+	dir := filepath.Join(yearDir, area)
 
-	info, err := os.Stat(sourcesDir)
+	info, err := os.Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("stat sources dir: %w", err)
+		return nil, fmt.Errorf("stat %s dir: %w", area, err)
 	}
 	if !info.IsDir() {
 		return nil, nil
 	}
 
 	var files []string
-	err = filepath.WalkDir(sourcesDir, func(path string, d os.DirEntry, err error) error {
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			if os.IsPermission(err) {
 				return nil
@@ -83,7 +93,7 @@ func ListSourceFiles(yearDir string) ([]string, error) {
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("walking sources: %w", err)
+		return nil, fmt.Errorf("walking %s: %w", area, err)
 	}
 
 	return files, nil
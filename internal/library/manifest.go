@@ -0,0 +1,259 @@
+package library
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StateDirName is the per-year (and library-level) directory holding
+	// imv's own state files. It is never treated as user content.
+	StateDirName = ".imv"
+
+	manifestFileName      = "hashes.manifest"
+	manifestFormatVersion = "v1"
+	manifestFieldSep      = "\t"
+	manifestPersistEvery  = 30 * time.Second
+)
+
+// ManifestEntry records the full content hash of one library file as it
+// was when the file entered (or was first verified in) the library.
+type ManifestEntry struct {
+	RelPath    string
+	HashAlgo   string
+	FullHash   string
+	RecordedAt int64
+}
+
+// Manifest holds the full content hashes of a year's source files. Unlike
+// the verify cache it is durable evidence: the filename only carries an
+// 8-char hash prefix, so the manifest is the only record of what a file's
+// bytes were supposed to be. Like the cache, it is an in-memory map that
+// Persist atomically rewrites as a whole.
+//
+// A nil *Manifest is a valid no-op receiver for every method.
+type Manifest struct {
+	path        string
+	entries     map[string]ManifestEntry
+	lastPersist time.Time
+	dirty       bool
+}
+
+// ManifestFilePath returns the canonical manifest path for a year directory.
+func ManifestFilePath(yearDir string) string {
+	return filepath.Join(yearDir, StateDirName, manifestFileName)
+}
+
+// LoadManifest parses the manifest at path. A missing file yields an empty
+// manifest. Malformed lines are skipped.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{
+		path:        path,
+		entries:     make(map[string]ManifestEntry),
+		lastPersist: time.Now(),
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("open manifest: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e, ok := parseManifestLine(line)
+		if !ok {
+			continue
+		}
+		m.entries[e.RelPath] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return m, fmt.Errorf("scan manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Lookup returns the entry for relPath, if any.
+func (m *Manifest) Lookup(relPath string) (ManifestEntry, bool) {
+	if m == nil {
+		return ManifestEntry{}, false
+	}
+	e, ok := m.entries[relPath]
+	return e, ok
+}
+
+// Entries returns a snapshot of current entries.
+func (m *Manifest) Entries() map[string]ManifestEntry {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]ManifestEntry, len(m.entries))
+	maps.Copy(out, m.entries)
+	return out
+}
+
+// Dirty reports whether there are changes not yet persisted.
+func (m *Manifest) Dirty() bool {
+	return m != nil && m.dirty
+}
+
+// Record stores e, replacing any entry for the same path, and persists
+// when the last persist is older than the persist interval. Paths with
+// tab or newline are rejected.
+func (m *Manifest) Record(e ManifestEntry) error {
+	if m == nil {
+		return nil
+	}
+	if strings.ContainsAny(e.RelPath, "\t\n") {
+		return fmt.Errorf("manifest: path contains tab or newline: %q", e.RelPath)
+	}
+	if e.RecordedAt == 0 {
+		e.RecordedAt = time.Now().Unix()
+	}
+	m.entries[e.RelPath] = e
+	m.dirty = true
+
+	if time.Since(m.lastPersist) > manifestPersistEvery {
+		return m.Persist()
+	}
+	return nil
+}
+
+// Delete removes the entry for relPath.
+func (m *Manifest) Delete(relPath string) {
+	if m == nil {
+		return
+	}
+	if _, ok := m.entries[relPath]; ok {
+		delete(m.entries, relPath)
+		m.dirty = true
+	}
+}
+
+// Retain drops every entry whose path is not in keep. Used to forget files
+// that no longer exist on disk.
+func (m *Manifest) Retain(keep map[string]bool) {
+	if m == nil {
+		return
+	}
+	for p := range m.entries {
+		if !keep[p] {
+			delete(m.entries, p)
+			m.dirty = true
+		}
+	}
+}
+
+// Persist atomically rewrites the manifest file from the in-memory entries.
+func (m *Manifest) Persist() error {
+	if m == nil {
+		return nil
+	}
+	err := WriteFileAtomic(m.path, func(w *bufio.Writer) error {
+		if _, err := fmt.Fprintf(w, "# imv hash-manifest %s — fields: path\\thash_algo\\tfull_hash\\trecorded_at_unix\n", manifestFormatVersion); err != nil {
+			return err
+		}
+		for _, e := range m.entries {
+			if _, err := fmt.Fprintln(w, formatManifestLine(e)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("persist manifest: %w", err)
+	}
+	m.lastPersist = time.Now()
+	m.dirty = false
+	return nil
+}
+
+// WriteFileAtomic writes path via a temporary sibling file: the contents
+// produced by write are flushed and fsync'd, then renamed over path. On
+// filesystems that refuse rename-over (SMB/CIFS, some FUSE mounts) the
+// destination is removed and the rename retried. On failure the original
+// file is left untouched unless that retry was reached.
+func WriteFileAtomic(path string, write func(w *bufio.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create tmp: %w", err)
+	}
+
+	fail := func(format string, err error) error {
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf(format, err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	if err := write(writer); err != nil {
+		return fail("write tmp: %w", err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fail("flush tmp: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail("fsync tmp: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("close tmp: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(path)
+		if err := os.Rename(tmpPath, path); err != nil {
+			_ = os.Remove(tmpPath)
+			return fmt.Errorf("rename: %w", err)
+		}
+	}
+	return nil
+}
+
+func formatManifestLine(e ManifestEntry) string {
+	return strings.Join([]string{
+		e.RelPath,
+		e.HashAlgo,
+		e.FullHash,
+		strconv.FormatInt(e.RecordedAt, 10),
+	}, manifestFieldSep)
+}
+
+func parseManifestLine(line string) (ManifestEntry, bool) {
+	parts := strings.Split(line, manifestFieldSep)
+	if len(parts) != 4 {
+		return ManifestEntry{}, false
+	}
+	if parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return ManifestEntry{}, false
+	}
+	recordedAt, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return ManifestEntry{}, false
+	}
+	return ManifestEntry{
+		RelPath:    parts[0],
+		HashAlgo:   parts[1],
+		FullHash:   parts[2],
+		RecordedAt: recordedAt,
+	}, true
+}
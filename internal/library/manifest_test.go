@@ -0,0 +1,129 @@
+package library
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadManifestMissingFile(t *testing.T) {
+	m, err := LoadManifest(filepath.Join(t.TempDir(), "nope"))
+	require.NoError(t, err)
+	assert.Empty(t, m.Entries())
+	assert.False(t, m.Dirty())
+}
+
+func TestManifestPersistRoundTrip(t *testing.T) {
+	yearDir := t.TempDir()
+	path := ManifestFilePath(yearDir)
+	assert.Equal(t, filepath.Join(yearDir, ".imv", "hashes.manifest"), path)
+
+	m, err := LoadManifest(path)
+	require.NoError(t, err)
+	require.NoError(t, m.Record(ManifestEntry{RelPath: "sources/D (image)/2024-01-15/a.jpg", HashAlgo: "md5", FullHash: "aaaa", RecordedAt: 10}))
+	require.NoError(t, m.Record(ManifestEntry{RelPath: "sources/D (image)/2024-01-15/b.jpg", HashAlgo: "sha256", FullHash: "bbbb"}))
+	assert.True(t, m.Dirty())
+	require.NoError(t, m.Persist())
+	assert.False(t, m.Dirty())
+
+	m2, err := LoadManifest(path)
+	require.NoError(t, err)
+	assert.Len(t, m2.Entries(), 2)
+	a, ok := m2.Lookup("sources/D (image)/2024-01-15/a.jpg")
+	require.True(t, ok)
+	assert.Equal(t, ManifestEntry{RelPath: "sources/D (image)/2024-01-15/a.jpg", HashAlgo: "md5", FullHash: "aaaa", RecordedAt: 10}, a)
+	b, ok := m2.Lookup("sources/D (image)/2024-01-15/b.jpg")
+	require.True(t, ok)
+	assert.NotZero(t, b.RecordedAt, "Record stamps RecordedAt when unset")
+}
+
+func TestLoadManifestSkipsMalformedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hashes.manifest")
+	content := "# header\n" +
+		"good.jpg\tmd5\tabcd\t1\n" +
+		"too\tfew\n" +
+		"\tmd5\tabcd\t1\n" +
+		"bad-time.jpg\tmd5\tabcd\tnope\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	m, err := LoadManifest(path)
+	require.NoError(t, err)
+	assert.Len(t, m.Entries(), 1)
+	_, ok := m.Lookup("good.jpg")
+	assert.True(t, ok)
+}
+
+func TestManifestRecordRejectsTab(t *testing.T) {
+	m, err := LoadManifest(filepath.Join(t.TempDir(), "m"))
+	require.NoError(t, err)
+	assert.Error(t, m.Record(ManifestEntry{RelPath: "a\tb", HashAlgo: "md5", FullHash: "x"}))
+	assert.Empty(t, m.Entries())
+}
+
+func TestManifestRecordPersistsAfterInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".imv", "hashes.manifest")
+	m, err := LoadManifest(path)
+	require.NoError(t, err)
+	m.lastPersist = time.Now().Add(-time.Hour)
+
+	require.NoError(t, m.Record(ManifestEntry{RelPath: "a.jpg", HashAlgo: "md5", FullHash: "x"}))
+	assert.FileExists(t, path)
+	assert.False(t, m.Dirty())
+}
+
+func TestManifestRetainAndDelete(t *testing.T) {
+	m, err := LoadManifest(filepath.Join(t.TempDir(), "m"))
+	require.NoError(t, err)
+	for _, p := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Record(ManifestEntry{RelPath: p, HashAlgo: "md5", FullHash: p}))
+	}
+
+	m.Retain(map[string]bool{"a": true, "b": true})
+	m.Delete("b")
+	m.Delete("missing")
+	assert.Equal(t, []string{"a"}, sortedKeys(m.Entries()))
+}
+
+func TestManifestNilReceiver(t *testing.T) {
+	var m *Manifest
+	_, ok := m.Lookup("x")
+	assert.False(t, ok)
+	assert.Nil(t, m.Entries())
+	assert.False(t, m.Dirty())
+	assert.NoError(t, m.Record(ManifestEntry{RelPath: "x"}))
+	assert.NoError(t, m.Persist())
+	m.Delete("x")
+	m.Retain(nil)
+}
+
+func TestWriteFileAtomicOverwrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "file")
+	write := func(s string) func(w *bufio.Writer) error {
+		return func(w *bufio.Writer) error {
+			_, err := w.WriteString(s)
+			return err
+		}
+	}
+	require.NoError(t, WriteFileAtomic(path, write("first")))
+	require.NoError(t, WriteFileAtomic(path, write("second")))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+	assert.NoFileExists(t, path+".tmp")
+}
+
+func sortedKeys(m map[string]ManifestEntry) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -33,6 +34,18 @@ func New(stdout, stderr io.Writer, isTTY bool) *Logger {
 	}
 }
 
+// Info logs an informational message to stderr.
+func (l *Logger) Info(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isTTY {
+		_, _ = fmt.Fprintf(l.stderr, "\r\033[K[info] %s\n", msg)
+	} else {
+		_, _ = fmt.Fprintf(l.stderr, "[info] %s\n", msg)
+	}
+}
+
 // Warn logs a warning message to stderr.
 func (l *Logger) Warn(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
@@ -169,6 +182,42 @@ func FormatBytes(b int64) string {
 	}
 }
 
+// ParseBytes parses a size with an optional binary unit suffix: B, K/KB/KiB,
+// M/MB/MiB, G/GB/GiB, T/TB/TiB (case-insensitive, 1 KB = 1024 B, matching
+// FormatBytes).
+func ParseBytes(s string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(upper, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := upper, ""
+	if i >= 0 {
+		num, unit = upper[:i], strings.TrimSpace(upper[i:])
+	}
+
+	var mult float64
+	switch strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I") {
+	case "":
+		mult = 1
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	case "T":
+		mult = 1 << 40
+	default:
+		return 0, fmt.Errorf("invalid size unit in %q", s)
+	}
+
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(f * mult), nil
+}
+
 // truncate shortens a string to maxLen, prefixing with "..." if truncated.
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
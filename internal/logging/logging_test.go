@@ -12,10 +12,12 @@ func TestLoggerNonTTY(t *testing.T) {
 	var stdout, stderr bytes.Buffer
 	l := New(&stdout, &stderr, false)
 
+	l.Info("something %s", "new")
 	l.Warn("something %s", "odd")
 	l.Error("something %s", "bad")
 
 	out := stderr.String()
+	assert.Contains(t, out, "[info] something new\n")
 	assert.Contains(t, out, "[warn] something odd\n")
 	assert.Contains(t, out, "[error] something bad\n")
 	assert.Empty(t, stdout.String())
@@ -212,3 +214,29 @@ func TestLoggerSummaryWithFixedAndVerified(t *testing.T) {
 	assert.Contains(t, out, "Errors: 0")
 	assert.Contains(t, out, "Processed: 0 B")
 }
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1048576", 1 << 20},
+		{"512B", 512},
+		{"10K", 10 << 10},
+		{"10kb", 10 << 10},
+		{"1.5MB", 3 << 19},
+		{"2GiB", 2 << 30},
+		{"500 GB", 500 << 30},
+		{"1TB", 1 << 40},
+	}
+	for _, tt := range tests {
+		got, err := ParseBytes(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, bad := range []string{"", "GB", "10XB", "1.2.3MB"} {
+		_, err := ParseBytes(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,348 @@
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+)
+
+const (
+	cacheFileName = "metadata.jsonl"
+	// DefaultCacheMaxBytes caps the metadata cache file.
+	DefaultCacheMaxBytes = 64 << 20
+	// touchInterval is how stale an entry's last-use time may get before
+	// a hit refreshes it; it keeps read-only runs from rewriting the file.
+	touchInterval = 24 * time.Hour
+)
+
+// DefaultCachePath returns the metadata cache file in the user's cache
+// directory. The cache is keyed by content, so one file serves every
+// library and source.
+func DefaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "imv", cacheFileName), nil
+}
+
+// cacheEntry is one cached extraction, as stored in the cache file.
+type cacheEntry struct {
+	Key    string                 `json:"key"`
+	Used   int64                  `json:"used"`
+	Fields map[string]interface{} `json:"fields"`
+
+	size int64 // bytes of the entry's line in the file
+}
+
+// Cache maps file contents to the fields an extractor read from them. It
+// is an in-memory map loaded from a JSON lines file and rewritten
+// atomically on Close. When the entries outgrow the size cap, the least
+// recently used are evicted.
+//
+// A nil *Cache is a valid no-op receiver for every method.
+type Cache struct {
+	path     string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+	dirty   bool
+	now     func() time.Time
+}
+
+// LoadCache reads the cache at path, capped at maxBytes. A missing file
+// yields an empty cache; malformed lines are skipped.
+func LoadCache(path string, maxBytes int64) (*Cache, error) {
+	c := &Cache{
+		path:     path,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+		now:      time.Now,
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("open metadata cache: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e cacheEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil || e.Key == "" || e.Fields == nil {
+			continue
+		}
+		c.add(&e, int64(len(scanner.Bytes()))+1)
+	}
+	if err := scanner.Err(); err != nil {
+		return c, fmt.Errorf("scan metadata cache: %w", err)
+	}
+	c.evict()
+	return c, nil
+}
+
+// cacheKey identifies the fields read by the reader version from a file
+// with the given content and extension. The extension is part of the key
+// because some formats are only told apart by it.
+func cacheKey(version string, f HashedFile) string {
+	return strings.Join([]string{version, f.HashAlgo + ":" + f.FullHash, strings.ToLower(filepath.Ext(f.Path))}, "|")
+}
+
+// Get returns the cached fields for key.
+func (c *Cache) Get(key string) (map[string]interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if now := c.now().Unix(); now-e.Used >= int64(touchInterval/time.Second) {
+		e.Used = now
+		c.dirty = true
+	}
+	return e.Fields, true
+}
+
+// Put caches fields under key, evicting old entries if the cache grows
+// past its cap.
+func (c *Cache) Put(key string, fields map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	e := &cacheEntry{Key: key, Fields: fields}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.Used = c.now().Unix()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	c.add(e, int64(len(line))+1)
+	c.dirty = true
+	c.evict()
+}
+
+// Len returns the number of cached entries.
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// AliasHashes copies every entry keyed by one of the content hashes in
+// aliases, given as "algo:hash", to the key of the hash it maps to, so
+// files rehashed with another algorithm still hit. The old entries stay
+// for other libraries.
+func (c *Cache) AliasHashes(aliases map[string]string) {
+	if c == nil || len(aliases) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var added []*cacheEntry
+	for _, e := range c.entries {
+		parts := strings.SplitN(e.Key, "|", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		to, ok := aliases[parts[1]]
+		if !ok {
+			continue
+		}
+		key := strings.Join([]string{parts[0], to, parts[2]}, "|")
+		if _, ok := c.entries[key]; !ok {
+			added = append(added, &cacheEntry{Key: key, Used: e.Used, Fields: e.Fields})
+		}
+	}
+	for _, e := range added {
+		line, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		c.add(e, int64(len(line))+1)
+		c.dirty = true
+	}
+	c.evict()
+}
+
+func (c *Cache) add(e *cacheEntry, size int64) {
+	if old, ok := c.entries[e.Key]; ok {
+		c.size -= old.size
+	}
+	e.size = size
+	c.entries[e.Key] = e
+	c.size += size
+}
+
+// evict drops the least recently used entries until the cache is back
+// under 90% of its cap, so it is not trimmed again on every Put.
+func (c *Cache) evict() {
+	if c.maxBytes <= 0 || c.size <= c.maxBytes {
+		return
+	}
+	byAge := make([]*cacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		byAge = append(byAge, e)
+	}
+	sort.Slice(byAge, func(i, j int) bool {
+		if byAge[i].Used != byAge[j].Used {
+			return byAge[i].Used < byAge[j].Used
+		}
+		return byAge[i].Key < byAge[j].Key
+	})
+	target := c.maxBytes / 10 * 9
+	for _, e := range byAge {
+		if c.size <= target {
+			break
+		}
+		delete(c.entries, e.Key)
+		c.size -= e.size
+	}
+	c.dirty = true
+}
+
+// Close writes the cache back if it changed.
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	err := library.WriteFileAtomic(c.path, func(w *bufio.Writer) error {
+		enc := json.NewEncoder(w)
+		for _, k := range keys {
+			if err := enc.Encode(c.entries[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("write metadata cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// CachingExtractor wraps an extractor with a Cache, so extracting a file
+// whose content was seen before is a lookup. Files are still hashed, and
+// the hash is what the lookup goes by, so a changed file is never served
+// stale metadata.
+type CachingExtractor struct {
+	inner interface {
+		Extractor
+		FieldReader
+	}
+	cache *Cache
+}
+
+// NewCachingExtractor wraps inner with cache. Closing the result closes
+// both.
+func NewCachingExtractor(inner interface {
+	Extractor
+	FieldReader
+}, cache *Cache) *CachingExtractor {
+	return &CachingExtractor{inner: inner, cache: cache}
+}
+
+// Extract hashes the file at path, then reads its fields from the cache
+// or, failing that, from the wrapped extractor, which is given the bytes
+// already read.
+func (c *CachingExtractor) Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error) {
+	return extractOnce(c, path, hasher)
+}
+
+// ReadFields returns cached fields where it has them and reads the rest,
+// in one call, from the wrapped extractor.
+func (c *CachingExtractor) ReadFields(files []HashedFile) ([]map[string]interface{}, []error) {
+	version := c.inner.Version()
+	if version == "" {
+		return c.inner.ReadFields(files)
+	}
+
+	fields := make([]map[string]interface{}, len(files))
+	errs := make([]error, len(files))
+	var missed []HashedFile
+	var missedAt []int
+	for i, f := range files {
+		if cached, ok := c.cache.Get(cacheKey(version, f)); ok {
+			fields[i] = cached
+			continue
+		}
+		missed = append(missed, f)
+		missedAt = append(missedAt, i)
+	}
+	if len(missed) == 0 {
+		return fields, errs
+	}
+
+	read, readErrs := c.inner.ReadFields(missed)
+	for j, i := range missedAt {
+		fields[i], errs[i] = read[j], readErrs[j]
+		if readErrs[j] == nil {
+			c.cache.Put(cacheKey(version, missed[j]), withoutSourceFile(read[j]))
+		}
+	}
+	return fields, errs
+}
+
+// withoutSourceFile drops the path exiftool adds to its output, which
+// would be wrong for the next file with the same content.
+func withoutSourceFile(fields map[string]interface{}) map[string]interface{} {
+	if _, ok := fields["SourceFile"]; !ok {
+		return fields
+	}
+	out := make(map[string]interface{}, len(fields)-1)
+	for k, v := range fields {
+		if k != "SourceFile" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func (c *CachingExtractor) ioCounter() *IOCounter { return counterOf(c.inner) }
+
+// Version is the wrapped extractor's version.
+func (c *CachingExtractor) Version() string {
+	return c.inner.Version()
+}
+
+// Close writes the cache back and closes the wrapped extractor.
+func (c *CachingExtractor) Close() error {
+	return errors.Join(c.cache.Close(), c.inner.Close())
+}
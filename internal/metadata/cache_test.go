@@ -0,0 +1,252 @@
+package metadata
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "imv", cacheFileName)
+	c, err := LoadCache(path, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	assert.Zero(t, c.Len())
+
+	c.Put("a", map[string]interface{}{"Make": "Canon", "ImageWidth": 4000})
+	c.Put("b", map[string]interface{}{"Make": "Nikon"})
+	fields, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "Canon", fields["Make"])
+	require.NoError(t, c.Close())
+
+	// A torn last line, as after a crash mid-write, is skipped.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"key":"c","fie`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c, err = LoadCache(path, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	assert.Equal(t, 2, c.Len())
+	fields, ok = c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, float64(4000), fields["ImageWidth"])
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+}
+
+func TestCacheCloseWritesOnlyChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), cacheFileName)
+	c, err := LoadCache(path, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	c.Put("a", map[string]interface{}{"Make": "Canon"})
+	require.NoError(t, c.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	c, err = LoadCache(path, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, c.Close())
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "a fresh hit must not rewrite the file")
+
+	// A hit on an entry unused for longer than touchInterval refreshes it.
+	c.now = func() time.Time { return time.Now().Add(2 * touchInterval) }
+	_, ok = c.Get("a")
+	require.True(t, ok)
+	require.NoError(t, c.Close())
+	info2, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), info2.Size())
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), cacheFileName)
+	c, err := LoadCache(path, 300)
+	require.NoError(t, err)
+	now := time.Unix(1_700_000_000, 0)
+	c.now = func() time.Time { return now }
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Put(k, map[string]interface{}{"Make": "Canon"})
+		now = now.Add(48 * time.Hour)
+	}
+	// Using "a" makes "b" the oldest.
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	for _, k := range []string{"e", "f", "g"} {
+		c.Put(k, map[string]interface{}{"Make": "Canon"})
+		now = now.Add(48 * time.Hour)
+	}
+
+	assert.LessOrEqual(t, c.size, int64(300))
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	_, ok = c.Get("g")
+	assert.True(t, ok)
+
+	require.NoError(t, c.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(300))
+}
+
+func TestNilCache(t *testing.T) {
+	var c *Cache
+	c.Put("a", map[string]interface{}{})
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Zero(t, c.Len())
+	assert.NoError(t, c.Close())
+}
+
+// countingReader is an Extractor and FieldReader that counts the files
+// it reads and fails files with no content.
+type countingReader struct {
+	reads   int
+	version string
+	closed  bool
+}
+
+func (r *countingReader) Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error) {
+	return nil, errors.New("not used")
+}
+
+func (r *countingReader) ReadFields(files []HashedFile) ([]map[string]interface{}, []error) {
+	fields := make([]map[string]interface{}, len(files))
+	errs := make([]error, len(files))
+	for i, f := range files {
+		r.reads++
+		data, err := os.ReadFile(f.Path)
+		if err == nil && len(data) == 0 {
+			err = errors.New("empty file")
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		fields[i] = map[string]interface{}{"SourceFile": f.Path, "MIMEType": "image/jpeg", "Make": string(data)}
+	}
+	return fields, errs
+}
+
+func (r *countingReader) Version() string { return r.version }
+
+func (r *countingReader) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestCachingExtractor(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+		return p
+	}
+	a := write("a.jpg", "Canon")
+	copyOfA := write("copy.jpg", "Canon")
+	otherExt := write("a.raw", "Canon")
+	empty := write("empty.jpg", "")
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	cachePath := filepath.Join(dir, "cache", cacheFileName)
+	cache, err := LoadCache(cachePath, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	inner := &countingReader{version: "fake 1"}
+	ext := NewCachingExtractor(inner, cache)
+
+	md, err := ext.Extract(a, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, "Canon", md.Make)
+	assert.Equal(t, 1, inner.reads)
+
+	// Same bytes and extension: a lookup, with the new path.
+	md, err = ext.Extract(copyOfA, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, copyOfA, md.Path)
+	assert.Equal(t, "Canon", md.Make)
+	assert.NotEmpty(t, md.ShortHash)
+	assert.Equal(t, 1, inner.reads)
+
+	// A different extension, or changed content, is read again.
+	_, err = ext.Extract(otherExt, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, 2, inner.reads)
+	write("a.jpg", "Nikon")
+	md, err = ext.Extract(a, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, "Nikon", md.Make)
+	assert.Equal(t, 3, inner.reads)
+
+	// Failures are not cached.
+	for range 2 {
+		_, err = ext.Extract(empty, hasher)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 5, inner.reads)
+
+	require.NoError(t, ext.Close())
+	assert.True(t, inner.closed)
+
+	// The next run, or another extractor version, starts from the file.
+	cache, err = LoadCache(cachePath, DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	assert.Equal(t, 3, cache.Len())
+	for _, fields := range cache.entries {
+		assert.NotContains(t, fields.Fields, "SourceFile")
+	}
+	inner = &countingReader{version: "fake 1"}
+	_, err = NewCachingExtractor(inner, cache).Extract(copyOfA, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, 0, inner.reads)
+	inner = &countingReader{version: "fake 2"}
+	_, err = NewCachingExtractor(inner, cache).Extract(copyOfA, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, 1, inner.reads)
+
+	// Without a version nothing is cached.
+	inner = &countingReader{}
+	ext = NewCachingExtractor(inner, cache)
+	for range 2 {
+		_, err = ext.Extract(otherExt, hasher)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, inner.reads)
+}
+
+func TestCachingExtractorPrefetchReadsOnlyMisses(t *testing.T) {
+	paths := writeCorpus(t, 10)
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+	cache, err := LoadCache(filepath.Join(t.TempDir(), cacheFileName), DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	inner := &countingReader{version: "fake 1"}
+	ext := NewCachingExtractor(inner, cache)
+
+	for _, p := range paths[:4] {
+		_, err := ext.Extract(p, hasher)
+		require.NoError(t, err)
+	}
+	pf := NewPrefetch(ext, paths, hasher)
+	for _, p := range paths {
+		md, err := pf.Next()
+		require.NoError(t, err)
+		assert.Equal(t, p, md.Path)
+	}
+	pf.Close()
+	assert.Equal(t, 10, inner.reads)
+}
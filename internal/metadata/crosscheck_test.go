@@ -0,0 +1,134 @@
+package metadata
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crosscheckPaths returns the synthetic fixtures and every file under
+// $IMV_CROSSCHECK_DIR.
+func crosscheckPaths(t *testing.T) []string {
+	t.Helper()
+	var paths []string
+	for _, p := range writeFixtures(t) {
+		paths = append(paths, p)
+	}
+	if dir := os.Getenv("IMV_CROSSCHECK_DIR"); dir != "" {
+		require.NoError(t, filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() && !defaults.IsIgnoredFile(d.Name()) {
+				paths = append(paths, p)
+			}
+			return err
+		}))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// TestNativeMatchesExiftool extracts the synthetic fixtures, and every
+// file under $IMV_CROSSCHECK_DIR, with both extractors and compares the
+// results. It is skipped when exiftool is not installed.
+func TestNativeMatchesExiftool(t *testing.T) {
+	exif, err := NewExifExtractor()
+	if err != nil {
+		t.Skipf("exiftool not available: %v", err)
+	}
+	defer func() { _ = exif.Close() }()
+	native := NewNativeExtractor()
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	for _, p := range crosscheckPaths(t) {
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			want, err := exif.Extract(p, hasher)
+			require.NoError(t, err)
+			got, err := native.Extract(p, hasher)
+			require.NoError(t, err)
+
+			// These decide where a file lands in the library.
+			assert.Equal(t, want.MIMEType, got.MIMEType, "MIMEType")
+			assert.Equal(t, want.MediaType, got.MediaType, "MediaType")
+			assert.Equal(t, want.Make, got.Make, "Make")
+			assert.Equal(t, want.Model, got.Model, "Model")
+			assert.Equal(t, want.DateTime, got.DateTime, "DateTime")
+			assert.Equal(t, want.FullHash, got.FullHash, "FullHash")
+
+			// RAW sizes differ between tools, which disagree on which of
+			// the embedded images is "the" image; MP3 durations are
+			// estimated by exiftool and not read natively.
+			if !strings.HasPrefix(got.MIMEType, "image/x-") {
+				assert.Equal(t, want.Width, got.Width, "Width")
+				assert.Equal(t, want.Height, got.Height, "Height")
+			}
+			if got.Duration != 0 || got.MIMEType != "audio/mpeg" {
+				assert.Equal(t, want.Duration, got.Duration, "Duration")
+			}
+			// The native readers skip maker notes, where some cameras keep
+			// their lens and serial number, so only compare what they
+			// found.
+			for _, f := range []struct {
+				name      string
+				want, got interface{}
+				found     bool
+			}{
+				{"Orientation", want.Orientation, got.Orientation, got.Orientation != 0},
+				{"VideoCodec", want.VideoCodec, got.VideoCodec, got.VideoCodec != ""},
+				{"FrameRate", want.FrameRate, got.FrameRate, got.FrameRate != 0},
+				{"AudioSampleRate", want.AudioSampleRate, got.AudioSampleRate, got.AudioSampleRate != 0},
+				{"LensModel", want.LensModel, got.LensModel, got.LensModel != ""},
+				{"ISO", want.ISO, got.ISO, got.ISO != 0},
+				{"Aperture", want.Aperture, got.Aperture, got.Aperture != 0},
+				{"ExposureTime", want.ExposureTime, got.ExposureTime, got.ExposureTime != 0},
+				{"Software", want.Software, got.Software, got.Software != ""},
+				{"SerialNumber", want.SerialNumber, got.SerialNumber, got.SerialNumber != ""},
+			} {
+				if f.found {
+					assert.Equal(t, f.want, f.got, f.name)
+				}
+			}
+			if want.GPS == nil || got.GPS == nil {
+				assert.Equal(t, want.GPS, got.GPS, "GPS")
+			} else {
+				assert.InDelta(t, want.GPS.Latitude, got.GPS.Latitude, 1e-6, "GPS latitude")
+				assert.InDelta(t, want.GPS.Longitude, got.GPS.Longitude, 1e-6, "GPS longitude")
+			}
+		})
+	}
+}
+
+// TestExiftoolUsedTagsMatchFullDump checks that asking exiftool for usedTags, in
+// one batch, gives the same metadata as a full per-file dump. It is
+// skipped when exiftool is not installed.
+func TestExiftoolUsedTagsMatchFullDump(t *testing.T) {
+	exif, err := NewExifExtractor()
+	if err != nil {
+		t.Skipf("exiftool not available: %v", err)
+	}
+	defer func() { _ = exif.Close() }()
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	paths := crosscheckPaths(t)
+	fields, errs := exif.et.readFields(paths, usedTags)
+	for i, p := range paths {
+		t.Run(filepath.Base(p), func(t *testing.T) {
+			full, fullErrs := exif.et.readFields([]string{p}, nil)
+			require.NoError(t, fullErrs[0])
+			want, err := BuildFileMetadata(p, full[0], hasher)
+			require.NoError(t, err)
+
+			require.NoError(t, errs[i])
+			got, err := BuildFileMetadata(p, fields[i], hasher)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
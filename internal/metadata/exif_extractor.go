@@ -1,21 +1,39 @@
 package metadata
 
 import (
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
-	"github.com/barasher/go-exiftool"
 )
 
-// ExifExtractor bridges go-exiftool and the MetadataExtractor interface.
+// ExifExtractor reads metadata with a running exiftool process.
 type ExifExtractor struct {
-	et *exiftool.Exiftool
+	et *exiftoolProcess
+
+	// Counter, when set, counts the files the extractor opens.
+	Counter *IOCounter
+
+	// tmpDir holds the named pipes that serve exiftool the heads of
+	// files instead of the files themselves; it is created on first use.
+	tmpMu   sync.Mutex
+	tmpDir  string
+	pipeSeq int
+
+	versionOnce sync.Once
+	ver         string
 }
 
 // NewExifExtractor creates a new ExifExtractor backed by a running exiftool process.
 // The caller must call Close() when done.
 func NewExifExtractor() (*ExifExtractor, error) {
-	et, err := exiftool.NewExiftool()
+	et, err := startExiftool()
 	if err != nil {
 		return nil, fmt.Errorf("create exiftool: %w", err)
 	}
@@ -24,24 +42,133 @@ func NewExifExtractor() (*ExifExtractor, error) {
 
 // Close shuts down the exiftool process.
 func (e *ExifExtractor) Close() error {
+	var err error
 	if e.et != nil {
-		return e.et.Close()
+		err = e.et.close()
 	}
-	return nil
+	if e.tmpDir != "" {
+		err = errors.Join(err, os.RemoveAll(e.tmpDir))
+	}
+	return err
 }
 
+func (e *ExifExtractor) ioCounter() *IOCounter { return e.Counter }
+
 // Extract reads EXIF metadata from the file at path and returns a FileMetadata.
 func (e *ExifExtractor) Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error) {
-	infos := e.et.ExtractMetadata(path)
+	f, short, err := hashFile(path, hasher, e.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("compute hash: %w", err)
+	}
+	fields, errs := e.ReadFields([]HashedFile{f})
+	if errs[0] != nil {
+		return nil, fmt.Errorf("exiftool error for %s: %w", path, errs[0])
+	}
+	return buildFileMetadata(path, fields[0], f.FullHash, short), nil
+}
+
+// ReadFields reads the tags BuildFileMetadata uses from all of files in
+// one exiftool call. A file whose Head holds all its metadata is not read
+// again: exiftool reads the head from a named pipe instead, so nothing is
+// written to disk. Where named pipes are not available it reads the file.
+func (e *ExifExtractor) ReadFields(files []HashedFile) ([]map[string]interface{}, []error) {
+	paths := make([]string, len(files))
+	var pipes []*headPipe
+	for i, f := range files {
+		paths[i] = f.Path
+		if !headSuffices(f) {
+			continue
+		}
+		if hp, err := e.pipeHead(f); err == nil {
+			paths[i] = hp.path
+			pipes = append(pipes, hp)
+		}
+	}
+	defer func() {
+		for _, hp := range pipes {
+			hp.close()
+		}
+	}()
+
+	fields, errs := e.et.readFields(paths, usedTags)
+	for i, f := range files {
+		if errs[i] == nil && paths[i] != f.Path {
+			fields[i]["SourceFile"] = f.Path
+		}
+	}
+	return fields, errs
+}
+
+// headPipe is a named pipe that serves one file's head to exiftool.
+type headPipe struct {
+	path string
+	done chan struct{}
+}
 
-	if len(infos) != 1 {
-		return nil, fmt.Errorf("expected 1 result, got %d", len(infos))
+// pipeHead makes a named pipe with f's extension, which exiftool goes by
+// for some formats, and starts writing f's Head to whoever opens it.
+func (e *ExifExtractor) pipeHead(f HashedFile) (*headPipe, error) {
+	e.tmpMu.Lock()
+	if e.tmpDir == "" {
+		dir, err := os.MkdirTemp("", "imv-heads-")
+		if err != nil {
+			e.tmpMu.Unlock()
+			return nil, err
+		}
+		e.tmpDir = dir
 	}
+	dir := e.tmpDir
+	e.pipeSeq++
+	path := filepath.Join(dir, fmt.Sprintf("%d%s", e.pipeSeq, filepath.Ext(f.Path)))
+	e.tmpMu.Unlock()
 
-	info := infos[0]
-	if info.Err != nil {
-		return nil, fmt.Errorf("exiftool error for %s: %w", path, info.Err)
+	if err := mkfifo(path); err != nil {
+		return nil, err
 	}
+	hp := &headPipe{path: path, done: make(chan struct{})}
+	go func() {
+		defer close(hp.done)
+		// Opening blocks until exiftool opens the pipe to read it. A
+		// write error means exiftool stopped reading early, which it
+		// does once it has the tags.
+		w, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		_, _ = w.Write(f.Head)
+		_ = w.Close()
+	}()
+	return hp, nil
+}
+
+// close releases the writer, should exiftool not have read the pipe,
+// waits for it and removes the pipe.
+func (hp *headPipe) close() {
+	for {
+		select {
+		case <-hp.done:
+			_ = os.Remove(hp.path)
+			return
+		default:
+		}
+		drainFIFO(hp.path)
+		select {
+		case <-hp.done:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
 
-	return BuildFileMetadata(path, info.Fields, hasher)
+// Version names the exiftool version and the tags asked for, which
+// together decide the fields ReadFields returns. It is empty when the
+// version cannot be read.
+func (e *ExifExtractor) Version() string {
+	e.versionOnce.Do(func() {
+		ver, err := e.et.version()
+		if err != nil || ver == "" {
+			return
+		}
+		e.ver = fmt.Sprintf("exiftool %s tags:%08x", ver, crc32.ChecksumIEEE([]byte(strings.Join(usedTags, ","))))
+	})
+	return e.ver
 }
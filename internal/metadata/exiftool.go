@@ -0,0 +1,203 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exiftoolBinary is the exiftool executable; tests point it at a fake.
+var exiftoolBinary = "exiftool"
+
+// exiftoolCloseTimeout bounds the wait for exiftool to exit on Close.
+const exiftoolCloseTimeout = time.Second
+
+// readyLine ends exiftool's output for each -execute in -stay_open mode.
+const readyLine = "{ready}"
+
+// usedTags are the tags BuildFileMetadata reads. Asking exiftool for these
+// alone keeps its JSON small; a full dump of a RAW file runs to hundreds
+// of tags.
+var usedTags = []string{
+	"MIMEType",
+	"DateTimeOriginal", "MediaCreateDate",
+	"Make", "DeviceManufacturer",
+	"Model", "DeviceModelName",
+	"ImageWidth", "ImageHeight", "ExifImageWidth", "ExifImageHeight",
+	"Duration",
+	"GPSLatitude", "GPSLatitudeRef", "GPSLongitude", "GPSLongitudeRef", "GPSPosition",
+	"GPSAltitude", "GPSAltitudeRef",
+	"Orientation", "CompressorID", "VideoFrameRate", "AudioSampleRate", "SampleRate",
+	"LensModel", "ISO", "FNumber", "ExposureTime", "Software",
+	"SerialNumber", "BodySerialNumber", "InternalSerialNumber",
+	"HistorySoftwareAgent", "DerivedFromDocumentID", "DerivedFromInstanceID", "DerivedFromOriginalDocumentID",
+}
+
+// exiftoolProcess drives one exiftool process in -stay_open mode, reading
+// the metadata of many files per -execute.
+type exiftoolProcess struct {
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// startExiftool starts exiftool in -stay_open mode.
+func startExiftool() (*exiftoolProcess, error) {
+	cmd := exec.Command(exiftoolBinary, "-stay_open", "True", "-@", "-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("pipe stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("pipe stdout: %w", err)
+	}
+	// Per-file errors also come back as an Error tag or a missing entry;
+	// stderr only repeats them.
+	cmd.Stderr = io.Discard
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start exiftool: %w", err)
+	}
+	return &exiftoolProcess{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// readFields reads tags (all of them when tags is nil) from every file in
+// paths with one -execute. The results line up with paths; a file
+// exiftool could not read gets an error instead of fields.
+func (p *exiftoolProcess) readFields(paths []string, tags []string) ([]map[string]interface{}, []error) {
+	fields := make([]map[string]interface{}, len(paths))
+	errs := make([]error, len(paths))
+
+	var args bytes.Buffer
+	args.WriteString("-json\n")
+	for _, tag := range tags {
+		args.WriteString("-" + tag + "\n")
+	}
+	// byName finds the entries for a SourceFile as exiftool reports it.
+	byName := make(map[string][]int)
+	for i, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			errs[i] = err
+			continue
+		case info.IsDir():
+			errs[i] = fmt.Errorf("%s is a directory", path)
+			continue
+		case strings.ContainsAny(path, "\r\n"):
+			errs[i] = errors.New("file name contains a line break")
+			continue
+		}
+		arg := path
+		if strings.HasPrefix(arg, "-") {
+			// Not an option.
+			arg = "." + string(filepath.Separator) + arg
+		}
+		byName[filepath.ToSlash(arg)] = append(byName[filepath.ToSlash(arg)], i)
+		args.WriteString(arg + "\n")
+	}
+	if len(byName) == 0 {
+		return fields, errs
+	}
+	args.WriteString("-execute\n")
+
+	out, err := p.run(args.Bytes())
+	if err != nil {
+		for i := range paths {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return fields, errs
+	}
+
+	var entries []map[string]interface{}
+	if len(bytes.TrimSpace(out)) > 0 {
+		if err := json.Unmarshal(out, &entries); err != nil {
+			err = fmt.Errorf("parse exiftool output: %w", err)
+			for i := range paths {
+				if errs[i] == nil {
+					errs[i] = err
+				}
+			}
+			return fields, errs
+		}
+	}
+	for _, e := range entries {
+		src, _ := e["SourceFile"].(string)
+		for _, i := range byName[filepath.ToSlash(src)] {
+			fields[i] = e
+		}
+	}
+	for i := range paths {
+		if errs[i] == nil && fields[i] == nil {
+			errs[i] = errors.New("exiftool returned no metadata")
+		}
+	}
+	return fields, errs
+}
+
+// version returns the version of the running exiftool.
+func (p *exiftoolProcess) version() (string, error) {
+	out, err := p.run([]byte("-ver\n-execute\n"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// run sends one command and returns its output, up to the ready line.
+func (p *exiftoolProcess) run(args []byte) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.stdin.Write(args); err != nil {
+		return nil, fmt.Errorf("write to exiftool: %w", err)
+	}
+	var out []byte
+	for {
+		line, err := p.stdout.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read from exiftool: %w", err)
+		}
+		if string(bytes.TrimRight(line, "\r\n")) == readyLine {
+			return out, nil
+		}
+		out = append(out, line...)
+	}
+}
+
+// close asks exiftool to exit and waits for it, briefly.
+func (p *exiftoolProcess) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, writeErr := io.WriteString(p.stdin, "-stay_open\nFalse\n")
+	_ = p.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- p.cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("wait for exiftool: %w", err)
+		}
+	case <-time.After(exiftoolCloseTimeout):
+		_ = p.cmd.Process.Kill()
+		return errors.New("timed out waiting for exiftool to exit")
+	}
+	if writeErr != nil {
+		return fmt.Errorf("stop exiftool: %w", writeErr)
+	}
+	return nil
+}
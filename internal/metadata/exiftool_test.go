@@ -0,0 +1,212 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeExiftool is a shell stand-in for exiftool -stay_open. It logs every
+// argument it receives to log and answers each -execute with a JSON entry
+// per file argument, skipping files named "unreadable*" as exiftool skips
+// files it cannot open. It reads the named pipes it is given for .jpg
+// files, logging "piped <bytes>", and leaves others unopened. It answers
+// -ver with 12.76.
+const fakeExiftool = `#!/bin/sh
+prev=""
+out=""
+ver=""
+while IFS= read -r line; do
+	echo "$line" >> "$LOG"
+	case "$line" in
+	-execute)
+		if [ -n "$ver" ]; then
+			printf '12.76\n{ready}\n'
+		else
+			printf '[%s]\n{ready}\n' "$out"
+		fi
+		out=""
+		ver=""
+		;;
+	-ver)
+		ver=1
+		;;
+	False)
+		[ "$prev" = "-stay_open" ] && exit 0
+		;;
+	-*) ;;
+	*)
+		case "$line" in
+		*.jpg) [ -p "$line" ] && echo "piped $(wc -c < "$line" | tr -d ' ')" >> "$LOG" ;;
+		esac
+		case "$(basename "$line")" in
+		unreadable*) ;;
+		*)
+			[ -n "$out" ] && out="$out,"
+			out="$out{\"SourceFile\":\"$line\",\"MIMEType\":\"image/jpeg\",\"Make\":\"Canon\",\"DateTimeOriginal\":\"2023:01:02 03:04:05\"}"
+			;;
+		esac
+		;;
+	esac
+	prev="$line"
+done
+`
+
+// useFakeExiftool points exiftoolBinary at fakeExiftool for the test and
+// returns the path of its argument log.
+func useFakeExiftool(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake exiftool is a shell script")
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "args.log")
+	script := strings.ReplaceAll(fakeExiftool, `"$LOG"`, `"`+log+`"`)
+	bin := filepath.Join(dir, "exiftool")
+	require.NoError(t, os.WriteFile(bin, []byte(script), 0o755))
+
+	prev := exiftoolBinary
+	exiftoolBinary = bin
+	t.Cleanup(func() { exiftoolBinary = prev })
+	return log
+}
+
+func readLog(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func countLines(lines []string, want string) int {
+	n := 0
+	for _, l := range lines {
+		if l == want {
+			n++
+		}
+	}
+	return n
+}
+
+func TestExifExtractorReadFieldsBatches(t *testing.T) {
+	log := useFakeExiftool(t)
+	dir := t.TempDir()
+	t.Chdir(dir)
+	var paths []string
+	for _, name := range []string{"a.jpg", "b.jpg", "unreadable.jpg"} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(name), 0o644))
+		paths = append(paths, p)
+	}
+	// A relative name that looks like an option.
+	require.NoError(t, os.WriteFile("-dash.jpg", nil, 0o644))
+	paths = append(paths, "-dash.jpg", filepath.Join(dir, "missing.jpg"), dir)
+
+	ext, err := NewExifExtractor()
+	require.NoError(t, err)
+	files := make([]HashedFile, len(paths))
+	for i, p := range paths {
+		files[i] = HashedFile{Path: p}
+	}
+	fields, errs := ext.ReadFields(files)
+	require.NoError(t, ext.Close())
+
+	for i, p := range paths[:2] {
+		require.NoError(t, errs[i], p)
+		assert.Equal(t, p, fields[i]["SourceFile"])
+		assert.Equal(t, "Canon", fields[i]["Make"])
+	}
+	assert.EqualError(t, errs[2], "exiftool returned no metadata")
+	require.NoError(t, errs[3])
+	assert.Equal(t, "./-dash.jpg", fields[3]["SourceFile"])
+	assert.ErrorIs(t, errs[4], os.ErrNotExist)
+	assert.Error(t, errs[5])
+
+	// One call for the batch, asking for the used tags only; missing
+	// files and directories are not passed on.
+	lines := readLog(t, log)
+	assert.Equal(t, 1, countLines(lines, "-execute"))
+	assert.Equal(t, 1, countLines(lines, "-json"))
+	for _, tag := range usedTags {
+		assert.Equal(t, 1, countLines(lines, "-"+tag), tag)
+	}
+	assert.Zero(t, countLines(lines, "-dash.jpg"))
+	assert.Zero(t, countLines(lines, paths[4]))
+	assert.Zero(t, countLines(lines, dir))
+}
+
+func TestExifExtractorExtract(t *testing.T) {
+	useFakeExiftool(t)
+	dir := t.TempDir()
+	p := filepath.Join(dir, "photo.jpg")
+	require.NoError(t, os.WriteFile(p, []byte("jpeg"), 0o644))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	ext, err := NewExifExtractor()
+	require.NoError(t, err)
+	defer func() { _ = ext.Close() }()
+
+	md, err := ext.Extract(p, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, "Canon", md.Make)
+	assert.Equal(t, 2023, md.DateTime.Year())
+	assert.Equal(t, defaults.MediaTypePhoto, md.MediaType)
+
+	_, err = ext.Extract(filepath.Join(dir, "unreadable.jpg"), hasher)
+	assert.Error(t, err)
+
+	assert.Regexp(t, `^exiftool 12\.76 tags:[0-9a-f]{8}$`, ext.Version())
+}
+
+// TestBuildFileMetadataReadsOnlyUsedTags guards usedTags: metadata built
+// from the used tags alone must equal that built from every field.
+func TestBuildFileMetadataReadsOnlyUsedTags(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "clip.mov")
+	require.NoError(t, os.WriteFile(p, []byte("movie"), 0o644))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	all := map[string]interface{}{
+		"SourceFile":         p,
+		"FileName":           "clip.mov",
+		"MIMEType":           "video/quicktime",
+		"DateTimeOriginal":   "0000:00:00 00:00:00",
+		"MediaCreateDate":    "2021:06:07 08:09:10",
+		"DeviceManufacturer": "Apple",
+		"DeviceModelName":    "iPhone 12",
+		"ImageWidth":         1920,
+		"ExifImageHeight":    1080,
+		"Duration":           "0:01:05",
+		"GPSPosition":        `37 deg 46' 29.64" N, 122 deg 25' 9.84" W`,
+		"Orientation":        "Rotate 90 CW",
+		"CompressorID":       "hvc1",
+		"VideoFrameRate":     29.97,
+		"AudioSampleRate":    44100,
+		"LensModel":          "iPhone 12 back camera",
+		"FNumber":            1.6,
+		"ExposureTime":       "1/60",
+		"ISO":                250,
+		"Software":           "16.1",
+		"SerialNumber":       float64(20231234567),
+		"HandlerVendorID":    "Apple",
+	}
+	used := make(map[string]interface{})
+	for _, tag := range usedTags {
+		if v, ok := all[tag]; ok {
+			used[tag] = v
+		}
+	}
+
+	want, err := BuildFileMetadata(p, all, hasher)
+	require.NoError(t, err)
+	got, err := BuildFileMetadata(p, used, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
@@ -0,0 +1,64 @@
+package metadata
+
+import (
+	"fmt"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+)
+
+// Extractor names accepted by NewExtractor.
+const (
+	ExtractorAuto     = "auto"
+	ExtractorExiftool = "exiftool"
+	ExtractorNative   = "native"
+)
+
+// FileExtractor extracts the metadata of one file.
+type FileExtractor interface {
+	Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error)
+}
+
+// Extractor is a metadata extractor that holds resources until closed.
+type Extractor interface {
+	FileExtractor
+	Close() error
+}
+
+// HashedFile is a file whose full content hash is known.
+type HashedFile struct {
+	Path     string
+	HashAlgo string
+	FullHash string
+	// Size and Head, the file's first bytes, are set when it was hashed
+	// by this package, so readers need not read those bytes again. Head
+	// is nil otherwise.
+	Size int64
+	Head []byte
+}
+
+// FieldReader is implemented by extractors that read the raw,
+// exiftool-named fields of many files at once more cheaply than one at a
+// time. The results line up with files. Version names the reader and
+// anything else that changes its output, for caches.
+type FieldReader interface {
+	ReadFields(files []HashedFile) ([]map[string]interface{}, []error)
+	Version() string
+}
+
+// NewExtractor creates the named extractor. ExtractorAuto uses exiftool
+// when it can be started and the native extractor otherwise.
+func NewExtractor(name string) (Extractor, error) {
+	switch name {
+	case ExtractorExiftool:
+		return NewExifExtractor()
+	case ExtractorNative:
+		return NewNativeExtractor(), nil
+	case ExtractorAuto, "":
+		if ext, err := NewExifExtractor(); err == nil {
+			return ext, nil
+		}
+		return NewNativeExtractor(), nil
+	default:
+		return nil, fmt.Errorf("unknown extractor %q (expected auto, exiftool or native)", name)
+	}
+}
@@ -0,0 +1,289 @@
+package metadata
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/geo"
+)
+
+// GPS is a position in decimal degrees; south and west are negative.
+// Altitude is in metres above sea level, negative below it, and nil when
+// the file does not record it.
+type GPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// Place reverse-geocodes g; nil for a nil g or a position far from every
+// place the geo package knows.
+func (g *GPS) Place() *geo.Place {
+	if g == nil {
+		return nil
+	}
+	p, ok := geo.Lookup(g.Latitude, g.Longitude)
+	if !ok {
+		return nil
+	}
+	return &p
+}
+
+// numberRe matches the unsigned decimal numbers in a formatted value.
+var numberRe = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// getNumberField returns the first of keys holding a number, either as a
+// JSON number or as a string starting with one ("4032", "12.5 s").
+func getNumberField(fields map[string]interface{}, keys ...string) (float64, bool) {
+	for _, key := range keys {
+		switch v := fields[key].(type) {
+		case float64:
+			return v, true
+		case int:
+			return float64(v), true
+		case string:
+			s := strings.TrimSpace(v)
+			if i := strings.IndexByte(s, ' '); i >= 0 {
+				s = s[:i]
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// getIntField is getNumberField rounded to an int; 0 when missing.
+func getIntField(fields map[string]interface{}, keys ...string) int {
+	f, ok := getNumberField(fields, keys...)
+	if !ok || f < 0 {
+		return 0
+	}
+	return int(math.Round(f))
+}
+
+// getFloatField is getNumberField with 0 for missing or negative values.
+func getFloatField(fields map[string]interface{}, keys ...string) float64 {
+	f, ok := getNumberField(fields, keys...)
+	if !ok || f < 0 {
+		return 0
+	}
+	return f
+}
+
+// getTextField returns the first non-empty text field among keys,
+// trimmed. exiftool prints values that look like numbers, such as many
+// serial numbers, as JSON numbers; they are formatted back without an
+// exponent.
+func getTextField(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		var s string
+		switch v := fields[key].(type) {
+		case string:
+			s = strings.TrimSpace(v)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			s = strconv.Itoa(v)
+		}
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// getTextList returns a list field, which exiftool prints as a string
+// when it has one item, without empty or repeated items.
+func getTextList(fields map[string]interface{}, key string) []string {
+	var items []interface{}
+	switch v := fields[key].(type) {
+	case []interface{}:
+		items = v
+	case nil:
+	default:
+		items = []interface{}{v}
+	}
+	var out []string
+	for _, item := range items {
+		s := getTextField(map[string]interface{}{key: item}, key)
+		if s != "" && !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// orientationNames are exiftool's names for EXIF orientations 1 to 8.
+var orientationNames = []string{
+	1: "Horizontal (normal)",
+	2: "Mirror horizontal",
+	3: "Rotate 180",
+	4: "Mirror vertical",
+	5: "Mirror horizontal and rotate 270 CW",
+	6: "Rotate 90 CW",
+	7: "Mirror horizontal and rotate 90 CW",
+	8: "Rotate 270 CW",
+}
+
+// parseOrientation reads an orientation by exiftool name or number; 0
+// when missing or unknown.
+func parseOrientation(v interface{}) int {
+	switch v := v.(type) {
+	case float64:
+		if v >= 1 && v <= 8 && v == math.Trunc(v) {
+			return int(v)
+		}
+	case string:
+		for i, name := range orientationNames {
+			if i > 0 && strings.EqualFold(strings.TrimSpace(v), name) {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// parseExposureTime reads an exposure time in seconds from a number or
+// exiftool's "1/250" form; 0 when missing.
+func parseExposureTime(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return max(v, 0)
+	case string:
+		s := strings.TrimSpace(v)
+		if num, den, ok := strings.Cut(s, "/"); ok {
+			n, err1 := strconv.ParseFloat(num, 64)
+			d, err2 := strconv.ParseFloat(den, 64)
+			if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+				return 0
+			}
+			return n / d
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+			return f
+		}
+	}
+	return 0
+}
+
+// parseDuration reads an exiftool duration: seconds as a number or as
+// "12.34 s", or "H:MM:SS" for longer media. "(approx)" suffixes are
+// ignored.
+func parseDuration(v interface{}) (time.Duration, bool) {
+	var secs float64
+	switch v := v.(type) {
+	case float64:
+		secs = v
+	case int:
+		secs = float64(v)
+	case string:
+		s := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(v), "(approx)"))
+		if strings.Contains(s, ":") {
+			for _, part := range strings.Split(s, ":") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+				if err != nil {
+					return 0, false
+				}
+				secs = secs*60 + f
+			}
+			break
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "s")), 64)
+		if err != nil {
+			return 0, false
+		}
+		secs = f
+	default:
+		return 0, false
+	}
+	if secs <= 0 {
+		return 0, false
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
+
+// parseCoordinate reads one exiftool GPS coordinate: a signed number, or a
+// formatted value like `37 deg 46' 29.64" N`. ref ("N", "South", ...) is
+// used when the value itself carries no hemisphere.
+func parseCoordinate(v interface{}, ref string) (float64, bool) {
+	var deg float64
+	switch v := v.(type) {
+	case float64:
+		deg = v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0, false
+		}
+		if last := s[len(s)-1]; strings.IndexByte("NSEWnsew", last) >= 0 {
+			ref = string(last)
+			s = s[:len(s)-1]
+		}
+		nums := numberRe.FindAllString(s, 3)
+		if len(nums) == 0 {
+			return 0, false
+		}
+		scale := 1.0
+		for _, n := range nums {
+			f, _ := strconv.ParseFloat(n, 64)
+			deg += f / scale
+			scale *= 60
+		}
+		if strings.HasPrefix(s, "-") {
+			deg = -deg
+		}
+	default:
+		return 0, false
+	}
+	if r := strings.ToUpper(strings.TrimSpace(ref)); r != "" && (r[0] == 'S' || r[0] == 'W') {
+		deg = -math.Abs(deg)
+	}
+	return deg, true
+}
+
+// parseGPS reads the position from GPSLatitude/GPSLongitude (with their
+// Ref tags) or, failing that, the composite GPSPosition.
+func parseGPS(fields map[string]interface{}) *GPS {
+	lat, okLat := parseCoordinate(fields["GPSLatitude"], getStringField(fields, "GPSLatitudeRef"))
+	lon, okLon := parseCoordinate(fields["GPSLongitude"], getStringField(fields, "GPSLongitudeRef"))
+	if !okLat || !okLon {
+		latS, lonS, ok := strings.Cut(getStringField(fields, "GPSPosition"), ",")
+		if !ok {
+			return nil
+		}
+		lat, okLat = parseCoordinate(latS, "")
+		lon, okLon = parseCoordinate(lonS, "")
+		if !okLat || !okLon {
+			return nil
+		}
+	}
+	if math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return nil
+	}
+	return &GPS{Latitude: lat, Longitude: lon, Altitude: parseAltitude(fields)}
+}
+
+// parseAltitude reads GPSAltitude ("12.3 m", or "12.3 m Below Sea Level"
+// from the composite tag) with its GPSAltitudeRef, rounded to 0.1 m, the
+// precision both extractors agree on.
+func parseAltitude(fields map[string]interface{}) *float64 {
+	alt, ok := getNumberField(fields, "GPSAltitude")
+	if !ok {
+		return nil
+	}
+	ref := getStringField(fields, "GPSAltitudeRef")
+	if s, ok := fields["GPSAltitude"].(string); ok && strings.Contains(s, "Below") {
+		ref = "Below"
+	}
+	if strings.HasPrefix(ref, "Below") || ref == "1" {
+		alt = -math.Abs(alt)
+	}
+	alt = math.Round(alt*10) / 10
+	return &alt
+}
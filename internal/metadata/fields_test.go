@@ -0,0 +1,176 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want time.Duration
+		ok   bool
+	}{
+		{12.5, 12500 * time.Millisecond, true},
+		{"12.34 s", 12340 * time.Millisecond, true},
+		{"0.5 s (approx)", 500 * time.Millisecond, true},
+		{"0:01:23", 83 * time.Second, true},
+		{"1:00:00", time.Hour, true},
+		{"", 0, false},
+		{"0 s", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDuration(tt.in)
+		assert.Equal(t, tt.ok, ok, "%v", tt.in)
+		assert.InDelta(t, float64(tt.want), float64(got), float64(time.Millisecond), "%v", tt.in)
+	}
+}
+
+func TestParseGPS(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]interface{}
+		want   *GPS
+	}{
+		{
+			name: "formatted with hemisphere",
+			fields: map[string]interface{}{
+				"GPSLatitude":  `37 deg 46' 30.00" N`,
+				"GPSLongitude": `122 deg 25' 12.00" W`,
+			},
+			want: &GPS{Latitude: 37.775, Longitude: -122.42},
+		},
+		{
+			name: "altitude above sea level",
+			fields: map[string]interface{}{
+				"GPSLatitude":    `37 deg 46' 30.00" N`,
+				"GPSLongitude":   `122 deg 25' 12.00" W`,
+				"GPSAltitude":    "12.34 m",
+				"GPSAltitudeRef": "Above Sea Level",
+			},
+			want: &GPS{Latitude: 37.775, Longitude: -122.42, Altitude: ptr(12.3)},
+		},
+		{
+			name: "composite altitude below sea level",
+			fields: map[string]interface{}{
+				"GPSLatitude":  31.5,
+				"GPSLongitude": 35.5,
+				"GPSAltitude":  "430 m Below Sea Level",
+			},
+			want: &GPS{Latitude: 31.5, Longitude: 35.5, Altitude: ptr(-430.0)},
+		},
+		{
+			name: "numbers with ref tags",
+			fields: map[string]interface{}{
+				"GPSLatitude":     33.8688,
+				"GPSLatitudeRef":  "South",
+				"GPSLongitude":    151.2093,
+				"GPSLongitudeRef": "East",
+			},
+			want: &GPS{Latitude: -33.8688, Longitude: 151.2093},
+		},
+		{
+			name:   "composite position",
+			fields: map[string]interface{}{"GPSPosition": `48 deg 51' 36.00" N, 2 deg 21' 0.00" E`},
+			want:   &GPS{Latitude: 48.86, Longitude: 2.35},
+		},
+		{
+			name:   "latitude only",
+			fields: map[string]interface{}{"GPSLatitude": 10.0},
+		},
+		{
+			name:   "none",
+			fields: map[string]interface{}{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGPS(tt.fields)
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.InDelta(t, tt.want.Latitude, got.Latitude, 1e-6)
+			assert.InDelta(t, tt.want.Longitude, got.Longitude, 1e-6)
+			assert.Equal(t, tt.want.Altitude, got.Altitude)
+		})
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
+
+func TestParseOrientation(t *testing.T) {
+	assert.Equal(t, 1, parseOrientation("Horizontal (normal)"))
+	assert.Equal(t, 6, parseOrientation("rotate 90 cw"))
+	assert.Equal(t, 8, parseOrientation(float64(8)))
+	assert.Equal(t, 0, parseOrientation(float64(9)))
+	assert.Equal(t, 0, parseOrientation("Unknown (0)"))
+	assert.Equal(t, 0, parseOrientation(nil))
+}
+
+func TestParseExposureTime(t *testing.T) {
+	assert.Equal(t, 1.0/250, parseExposureTime("1/250"))
+	assert.Equal(t, 2.5, parseExposureTime("2.5"))
+	assert.Equal(t, 0.5, parseExposureTime(0.5))
+	assert.Equal(t, 0.0, parseExposureTime("1/0"))
+	assert.Equal(t, 0.0, parseExposureTime("bulb"))
+	assert.Equal(t, 0.0, parseExposureTime(nil))
+}
+
+func TestGetTextField(t *testing.T) {
+	fields := map[string]interface{}{
+		"Text":   "  16.1 ",
+		"Serial": float64(20231234567),
+		"Count":  42,
+		"Flag":   true,
+	}
+	assert.Equal(t, "16.1", getTextField(fields, "Text"))
+	assert.Equal(t, "20231234567", getTextField(fields, "Serial"))
+	assert.Equal(t, "42", getTextField(fields, "Count"))
+	assert.Empty(t, getTextField(fields, "Flag"))
+	assert.Empty(t, getTextField(fields, "Missing"))
+	assert.Equal(t, "42", getTextField(fields, "Missing", "Flag", "Count", "Text"))
+}
+
+func TestGetTextList(t *testing.T) {
+	fields := map[string]interface{}{
+		"One":  " Snapseed ",
+		"Many": []interface{}{"Adobe Photoshop 25.0", "", "Adobe Photoshop 25.0", "GIMP 2.10", float64(3)},
+	}
+	assert.Equal(t, []string{"Snapseed"}, getTextList(fields, "One"))
+	assert.Equal(t, []string{"Adobe Photoshop 25.0", "GIMP 2.10", "3"}, getTextList(fields, "Many"))
+	assert.Empty(t, getTextList(fields, "Missing"))
+}
+
+func TestBuildFileMetadataDimensionsAndDuration(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "clip.mov")
+	require.NoError(t, os.WriteFile(tmpFile, []byte("fake video data"), 0o644))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	meta, err := BuildFileMetadata(tmpFile, map[string]interface{}{
+		"MIMEType":        "video/quicktime",
+		"ImageWidth":      float64(1920),
+		"ImageHeight":     "1080",
+		"Duration":        "0:00:42",
+		"CompressorID":    "hvc1",
+		"VideoFrameRate":  59.94,
+		"AudioSampleRate": float64(48000),
+	}, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, 1920, meta.Width)
+	assert.Equal(t, 1080, meta.Height)
+	assert.Equal(t, 42*time.Second, meta.Duration)
+	assert.Equal(t, "hvc1", meta.VideoCodec)
+	assert.Equal(t, 59.94, meta.FrameRate)
+	assert.Equal(t, 48000, meta.AudioSampleRate)
+	assert.Nil(t, meta.GPS)
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package metadata
+
+import "errors"
+
+// mkfifo fails: there are no named pipes to make.
+func mkfifo(string) error {
+	return errors.New("named pipes are not supported on this platform")
+}
+
+func drainFIFO(string) {}
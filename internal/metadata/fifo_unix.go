@@ -0,0 +1,26 @@
+//go:build unix
+
+package metadata
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// mkfifo makes a named pipe at path.
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, 0o600)
+}
+
+// drainFIFO opens the named pipe at path for reading without waiting for
+// a writer, reads whatever a writer sends and closes it, so a writer
+// blocked opening the pipe goes on.
+func drainFIFO(path string) {
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, r)
+	_ = r.Close()
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/geo"
 )
 
 // FileMetadata holds parsed metadata for a media file.
@@ -24,6 +25,43 @@ type FileMetadata struct {
 	MediaType defaults.MediaType
 	FullHash  string
 	ShortHash string
+
+	// Width and Height are the pixel dimensions; 0 when unknown.
+	Width  int
+	Height int
+	// Duration is the running time of audio and video; 0 for stills.
+	Duration time.Duration
+	// GPS is where the file was captured; nil when it carries no position.
+	GPS *GPS
+	// Place is the country and region of GPS, reverse-geocoded offline;
+	// nil without a position or far from land.
+	Place *geo.Place
+
+	// The fields below are zero when unknown.
+
+	// Orientation is the EXIF orientation, 1 (upright) to 8.
+	Orientation int
+	// VideoCodec is the four-character code of the first video track,
+	// such as "avc1" or "hvc1"; FrameRate is its frames per second.
+	VideoCodec string
+	FrameRate  float64
+	// AudioSampleRate is in Hz.
+	AudioSampleRate int
+	LensModel       string
+	ISO             int
+	// Aperture is the f-number; ExposureTime is in seconds.
+	Aperture     float64
+	ExposureTime float64
+	// Software is what last wrote the file, often an editor.
+	Software string
+	// SerialNumber is the camera's; a library's owner mapping keys on it
+	// to tell apart identical devices.
+	SerialNumber string
+	// HistorySoftware lists the software of the XMP edit history, and
+	// DerivedFrom is the XMP document ID of the file this one was exported
+	// from. Both, like Software, tell edited files from camera originals.
+	HistorySoftware []string
+	DerivedFrom     string
 }
 
 // ComputeFileHash opens the file at path, hashes it using the provided hasher,
@@ -41,13 +79,21 @@ func ComputeFileHash(path string, hasher *defaults.Hasher) (full string, short s
 	}
 
 	full = hex.EncodeToString(h.Sum(nil))
-	if hasher.ShortLen() > len(full) {
-		return "", "", fmt.Errorf("short length %d exceeds hash length %d", hasher.ShortLen(), len(full))
+	short, err = shortHash(full, hasher)
+	if err != nil {
+		return "", "", err
 	}
-	short = full[:hasher.ShortLen()]
 	return full, short, nil
 }
 
+// shortHash returns the prefix of full used in library file names.
+func shortHash(full string, hasher *defaults.Hasher) (string, error) {
+	if hasher.ShortLen() > len(full) {
+		return "", fmt.Errorf("short length %d exceeds hash length %d", hasher.ShortLen(), len(full))
+	}
+	return full[:hasher.ShortLen()], nil
+}
+
 // GetFileModTime returns the modification time of the file at path.
 func GetFileModTime(path string) (time.Time, error) {
 	info, err := os.Stat(path)
@@ -89,7 +135,11 @@ func BuildFileMetadata(path string, exifFields map[string]interface{}, hasher *d
 	if err != nil {
 		return nil, fmt.Errorf("compute hash: %w", err)
 	}
+	return buildFileMetadata(path, exifFields, fullHash, shortHash), nil
+}
 
+// buildFileMetadata is BuildFileMetadata for a file whose hash is known.
+func buildFileMetadata(path string, exifFields map[string]interface{}, fullHash, shortHash string) *FileMetadata {
 	// Determine DateTime: try DateTimeOriginal, then MediaCreateDate, then file mod time
 	var dt time.Time
 	if s := getStringField(exifFields, "DateTimeOriginal"); s != "" {
@@ -130,6 +180,9 @@ func BuildFileMetadata(path string, exifFields map[string]interface{}, hasher *d
 	// Extension
 	ext := strings.ToLower(filepath.Ext(path))
 
+	duration, _ := parseDuration(exifFields["Duration"])
+	gps := parseGPS(exifFields)
+
 	return &FileMetadata{
 		Path:      path,
 		Extension: ext,
@@ -140,7 +193,25 @@ func BuildFileMetadata(path string, exifFields map[string]interface{}, hasher *d
 		MediaType: mediaType,
 		FullHash:  fullHash,
 		ShortHash: shortHash,
-	}, nil
+		Width:     getIntField(exifFields, "ImageWidth", "ExifImageWidth"),
+		Height:    getIntField(exifFields, "ImageHeight", "ExifImageHeight"),
+		Duration:  duration,
+		GPS:       gps,
+		Place:     gps.Place(),
+
+		Orientation:     parseOrientation(exifFields["Orientation"]),
+		VideoCodec:      getTextField(exifFields, "CompressorID"),
+		FrameRate:       getFloatField(exifFields, "VideoFrameRate"),
+		AudioSampleRate: getIntField(exifFields, "AudioSampleRate", "SampleRate"),
+		LensModel:       getTextField(exifFields, "LensModel"),
+		ISO:             getIntField(exifFields, "ISO"),
+		Aperture:        getFloatField(exifFields, "FNumber"),
+		ExposureTime:    parseExposureTime(exifFields["ExposureTime"]),
+		Software:        getTextField(exifFields, "Software"),
+		SerialNumber:    getTextField(exifFields, "SerialNumber", "BodySerialNumber", "InternalSerialNumber"),
+		HistorySoftware: getTextList(exifFields, "HistorySoftwareAgent"),
+		DerivedFrom:     getTextField(exifFields, "DerivedFromDocumentID", "DerivedFromInstanceID", "DerivedFromOriginalDocumentID"),
+	}
 }
 
 // getStringField returns the string value for a key in the fields map.
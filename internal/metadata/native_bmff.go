@@ -0,0 +1,719 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// box is an ISO base media file format (QuickTime, MP4, HEIF) box: its
+// type and the byte range of its payload.
+type box struct {
+	typ        string
+	start, end int64
+}
+
+// maxBoxRead caps the boxes read into memory whole.
+const maxBoxRead = 16 << 20
+
+// readBoxes calls fn for each box between start and end.
+func readBoxes(r io.ReaderAt, start, end int64, fn func(b box) error) error {
+	for off := start; off+8 <= end; {
+		var hdr [16]byte
+		if _, err := r.ReadAt(hdr[:8], off); err != nil {
+			return fmt.Errorf("read box header: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:]))
+		b := box{typ: string(hdr[4:8]), start: off + 8}
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if _, err := r.ReadAt(hdr[8:], off+8); err != nil {
+				return fmt.Errorf("read box header: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:]))
+			b.start += 8
+		}
+		if size < b.start-off {
+			return fmt.Errorf("box %q has invalid size %d", b.typ, size)
+		}
+		// A truncated file ends mid-box; read what is there.
+		size = min(size, end-off)
+		b.end = off + size
+		if err := fn(b); err != nil {
+			return err
+		}
+		off = b.end
+	}
+	return nil
+}
+
+// children calls fn for each box inside b, skipping skip header bytes.
+func children(r io.ReaderAt, b box, skip int64, fn func(b box) error) error {
+	return readBoxes(r, b.start+skip, b.end, fn)
+}
+
+// payload reads b's payload.
+func payload(r io.ReaderAt, b box) ([]byte, error) {
+	if b.end-b.start > maxBoxRead {
+		return nil, fmt.Errorf("box %q too large", b.typ)
+	}
+	data := make([]byte, b.end-b.start)
+	if _, err := r.ReadAt(data, b.start); err != nil {
+		return nil, fmt.Errorf("read box %q: %w", b.typ, err)
+	}
+	return data, nil
+}
+
+// metaSkip is the header size of a meta box: 4 bytes of version and
+// flags in MP4 and HEIF, none in QuickTime movies.
+func metaSkip(r io.ReaderAt, b box) int64 {
+	var v [4]byte
+	if _, err := r.ReadAt(v[:], b.start); err == nil && binary.BigEndian.Uint32(v[:]) == 0 {
+		return 4
+	}
+	return 0
+}
+
+// ftypBrand returns the major brand of a file starting with an ftyp box.
+func ftypBrand(r io.ReaderAt) string {
+	var hdr [12]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil || string(hdr[4:8]) != "ftyp" {
+		return ""
+	}
+	return string(hdr[8:12])
+}
+
+// quickTimeEpoch is the zero of QuickTime and MP4 timestamps.
+var quickTimeEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// canonCR3UUID marks the moov box holding a CR3's TIFF metadata.
+var canonCR3UUID = []byte{0x85, 0xc0, 0xb6, 0x87, 0x82, 0x0f, 0x11, 0xe0, 0x81, 0x11, 0xf4, 0xce, 0x46, 0x2b, 0x6a, 0x48}
+
+// movie collects what readMovie finds in a moov box.
+type movie struct {
+	duration   float64
+	createDate string
+	width      int
+	height     int
+	codec      string
+	frameRate  float64
+	sampleRate int
+	keys       []string
+	keyed      map[string]string
+	udta       map[string]string
+}
+
+// readMovie reads a QuickTime or MP4 movie: MediaCreateDate from the
+// first track's media header, Duration from the movie header, the size,
+// codec and frame rate of the first video track, the sample rate of the
+// first audio track, Make, Model and the position from the Apple metadata
+// keys or the user data box.
+func readMovie(r io.ReaderAt, size int64, fields map[string]interface{}) error {
+	m := &movie{keyed: make(map[string]string), udta: make(map[string]string)}
+	err := readBoxes(r, 0, size, func(b box) error {
+		if b.typ != "moov" {
+			return nil
+		}
+		return children(r, b, 0, func(b box) error {
+			switch b.typ {
+			case "mvhd":
+				data, err := payload(r, b)
+				if err != nil {
+					return err
+				}
+				if _, timescale, duration, ok := mediaHeader(data); ok && timescale > 0 {
+					m.duration = float64(duration) / float64(timescale)
+				}
+			case "trak":
+				return m.readTrack(r, b)
+			case "udta":
+				return m.readUserData(r, b)
+			case "meta":
+				return m.readKeys(r, b)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if m.createDate != "" {
+		fields["MediaCreateDate"] = m.createDate
+	}
+	if m.duration > 0 {
+		fields["Duration"] = formatDuration(m.duration)
+	}
+	if m.width > 0 && m.height > 0 {
+		fields["ImageWidth"], fields["ImageHeight"] = m.width, m.height
+	}
+	if m.codec != "" {
+		fields["CompressorID"] = m.codec
+	}
+	if m.frameRate > 0 {
+		fields["VideoFrameRate"] = m.frameRate
+	}
+	if m.sampleRate > 0 {
+		fields["AudioSampleRate"] = m.sampleRate
+	}
+	for _, src := range []map[string]string{m.udta, m.keyed} {
+		if v := src["make"]; v != "" {
+			fields["Make"] = v
+		}
+		if v := src["model"]; v != "" {
+			fields["Model"] = v
+		}
+		if lat, lon, alt, ok := parseISO6709(src["location"]); ok {
+			fields["GPSLatitude"] = formatDMS(lat, "N")
+			fields["GPSLongitude"] = formatDMS(lon, "E")
+			if alt != nil {
+				setAltitude(fields, *alt)
+			}
+		}
+	}
+	return nil
+}
+
+// mediaHeader parses an mvhd or mdhd payload.
+func mediaHeader(d []byte) (created time.Time, timescale uint32, duration uint64, ok bool) {
+	if len(d) < 24 {
+		return time.Time{}, 0, 0, false
+	}
+	var secs uint64
+	if d[0] == 1 {
+		if len(d) < 36 {
+			return time.Time{}, 0, 0, false
+		}
+		secs = binary.BigEndian.Uint64(d[4:])
+		timescale = binary.BigEndian.Uint32(d[20:])
+		duration = binary.BigEndian.Uint64(d[24:])
+	} else {
+		secs = uint64(binary.BigEndian.Uint32(d[4:]))
+		timescale = binary.BigEndian.Uint32(d[12:])
+		duration = uint64(binary.BigEndian.Uint32(d[16:]))
+	}
+	if secs > 0 && secs < math.MaxInt32*4 {
+		created = quickTimeEpoch.Add(time.Duration(secs) * time.Second)
+	}
+	return created, timescale, duration, true
+}
+
+func (m *movie) readTrack(r io.ReaderAt, trak box) error {
+	var width, height int
+	var handler string
+	var timescale uint32
+	var duration uint64
+	var st sampleTable
+	err := children(r, trak, 0, func(b box) error {
+		switch b.typ {
+		case "tkhd":
+			d, err := payload(r, b)
+			if err != nil {
+				return err
+			}
+			// Width and height are the last two 16.16 fixed-point fields.
+			if len(d) >= 84 {
+				width = int(binary.BigEndian.Uint32(d[len(d)-8:]) >> 16)
+				height = int(binary.BigEndian.Uint32(d[len(d)-4:]) >> 16)
+			}
+		case "mdia":
+			return children(r, b, 0, func(b box) error {
+				switch b.typ {
+				case "mdhd":
+					d, err := payload(r, b)
+					if err != nil {
+						return err
+					}
+					created, ts, dur, ok := mediaHeader(d)
+					if ok {
+						timescale, duration = ts, dur
+					}
+					if m.createDate == "" {
+						m.createDate = "0000:00:00 00:00:00"
+						if ok && !created.IsZero() {
+							m.createDate = created.Format(exifDateTimeLayout)
+						}
+					}
+				case "hdlr":
+					d, err := payload(r, b)
+					if err != nil {
+						return err
+					}
+					if len(d) >= 12 {
+						handler = string(d[8:12])
+					}
+				case "minf":
+					return children(r, b, 0, func(b box) error {
+						if b.typ != "stbl" {
+							return nil
+						}
+						return st.read(r, b)
+					})
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch handler {
+	case "vide":
+		if m.width == 0 {
+			m.width, m.height = width, height
+			m.codec = st.format
+			if timescale > 0 && duration > 0 && st.samples > 0 {
+				fps := float64(st.samples) * float64(timescale) / float64(duration)
+				m.frameRate = math.Round(fps*1000) / 1000
+			}
+		}
+	case "soun":
+		if m.sampleRate == 0 {
+			m.sampleRate = st.sampleRate
+		}
+	}
+	return nil
+}
+
+// sampleTable is what readTrack takes from a track's stbl box: the format
+// and, for sound, the sample rate of the first sample description, and the
+// sample count from the time-to-sample table.
+type sampleTable struct {
+	format     string
+	sampleRate int
+	samples    uint64
+}
+
+func (st *sampleTable) read(r io.ReaderAt, stbl box) error {
+	return children(r, stbl, 0, func(b box) error {
+		switch b.typ {
+		case "stsd":
+			d, err := payload(r, b)
+			if err != nil {
+				return err
+			}
+			// Version and flags, the entry count, then the first entry's
+			// size and format. A sound entry has its 16.16 sample rate
+			// 32 bytes in.
+			if len(d) >= 16 {
+				st.format = strings.TrimRight(string(d[12:16]), " \x00")
+			}
+			if len(d) >= 44 {
+				st.sampleRate = int(binary.BigEndian.Uint32(d[40:]) >> 16)
+			}
+		case "stts":
+			d, err := payload(r, b)
+			if err != nil || len(d) < 8 {
+				return err
+			}
+			n := int(binary.BigEndian.Uint32(d[4:]))
+			for i := 0; i < n && 16+8*i <= len(d); i++ {
+				st.samples += uint64(binary.BigEndian.Uint32(d[8+8*i:]))
+			}
+		}
+		return nil
+	})
+}
+
+// udtaKeys maps QuickTime user data atoms to movie fields.
+var udtaKeys = map[string]string{
+	"\xa9mak": "make",
+	"\xa9mod": "model",
+	"\xa9xyz": "location",
+}
+
+// readUserData reads the ©mak, ©mod and ©xyz text atoms of a udta box.
+func (m *movie) readUserData(r io.ReaderAt, udta box) error {
+	return children(r, udta, 0, func(b box) error {
+		key, ok := udtaKeys[b.typ]
+		if !ok {
+			return nil
+		}
+		d, err := payload(r, b)
+		if err != nil {
+			return err
+		}
+		// International text: 2-byte length, 2-byte language, text.
+		if len(d) >= 4 {
+			n := int(binary.BigEndian.Uint16(d))
+			if 4+n <= len(d) {
+				m.udta[key] = string(bytes.TrimRight(d[4:4+n], "\x00 "))
+			}
+		}
+		return nil
+	})
+}
+
+// appleKeys maps Apple metadata keys to movie fields.
+var appleKeys = map[string]string{
+	"com.apple.quicktime.make":             "make",
+	"com.apple.quicktime.model":            "model",
+	"com.apple.quicktime.location.ISO6709": "location",
+}
+
+// readKeys reads the Apple keys/ilst metadata of a moov meta box.
+func (m *movie) readKeys(r io.ReaderAt, meta box) error {
+	return children(r, meta, metaSkip(r, meta), func(b box) error {
+		switch b.typ {
+		case "keys":
+			d, err := payload(r, b)
+			if err != nil {
+				return err
+			}
+			m.keys = nil
+			for off := 8; off+8 <= len(d); {
+				size := int(binary.BigEndian.Uint32(d[off:]))
+				if size < 8 || off+size > len(d) {
+					break
+				}
+				m.keys = append(m.keys, string(d[off+8:off+size]))
+				off += size
+			}
+		case "ilst":
+			return children(r, b, 0, func(item box) error {
+				idx := int(binary.BigEndian.Uint32([]byte(item.typ)))
+				if idx < 1 || idx > len(m.keys) {
+					return nil
+				}
+				field, ok := appleKeys[m.keys[idx-1]]
+				if !ok {
+					return nil
+				}
+				return children(r, item, 0, func(data box) error {
+					d, err := payload(r, data)
+					// Type indicator 1 is UTF-8 text, after 8 bytes of
+					// type and locale.
+					if err == nil && data.typ == "data" && len(d) >= 8 && binary.BigEndian.Uint32(d) == 1 {
+						m.keyed[field] = string(bytes.TrimRight(d[8:], "\x00 "))
+					}
+					return err
+				})
+			})
+		}
+		return nil
+	})
+}
+
+// iso6709Re matches the latitude, longitude and optional altitude of an
+// ISO 6709 string such as "+37.7749-122.4194+010.000/".
+var iso6709Re = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+func parseISO6709(s string) (lat, lon float64, alt *float64, ok bool) {
+	m := iso6709Re.FindStringSubmatch(s)
+	if m == nil {
+		return 0, 0, nil, false
+	}
+	lat, err1 := strconv.ParseFloat(m[1], 64)
+	lon, err2 := strconv.ParseFloat(m[2], 64)
+	if err1 != nil || err2 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return 0, 0, nil, false
+	}
+	if a, err := strconv.ParseFloat(m[3], 64); m[3] != "" && err == nil {
+		alt = &a
+	}
+	return lat, lon, alt, true
+}
+
+// readCR3 reads the TIFF blocks of a Canon CR3, kept in a uuid box of
+// the moov box: IFD0 in CMT1, the EXIF IFD in CMT2 and the GPS IFD in
+// CMT4.
+func readCR3(r io.ReaderAt, size int64, fields map[string]interface{}) error {
+	return readBoxes(r, 0, size, func(b box) error {
+		if b.typ != "moov" {
+			return nil
+		}
+		return children(r, b, 0, func(b box) error {
+			if b.typ != "uuid" {
+				return nil
+			}
+			return readCanonUUID(r, b, fields)
+		})
+	})
+}
+
+func readCanonUUID(r io.ReaderAt, b box, fields map[string]interface{}) error {
+	var id [16]byte
+	if _, err := r.ReadAt(id[:], b.start); err != nil || !bytes.Equal(id[:], canonCR3UUID) {
+		return nil
+	}
+	return children(r, b, 16, func(b box) error {
+		var t *tiffReader
+		var ifd0 uint32
+		switch b.typ {
+		case "CMT1":
+			return readTIFFFields(r, b.start, fields)
+		case "CMT2", "CMT4":
+			var err error
+			if t, ifd0, err = newTIFFReader(r, b.start); err != nil {
+				return nil
+			}
+		default:
+			return nil
+		}
+		entries, _, err := t.readIFD(ifd0)
+		if err != nil {
+			return nil
+		}
+		if b.typ == "CMT2" {
+			t.readExifIFD(entries, fields)
+		} else {
+			t.readGPSIFD(entries, fields)
+		}
+		return nil
+	})
+}
+
+// heifItem is an item of a HEIF file: its type and, once located, where
+// its data is.
+type heifItem struct {
+	typ     string
+	offset  int64
+	length  int64
+	located bool
+}
+
+// readHEIF reads a HEIF, HEIC or AVIF still: the EXIF item and the size
+// of the primary item.
+func readHEIF(r io.ReaderAt, size int64, fields map[string]interface{}) error {
+	var meta box
+	if err := readBoxes(r, 0, size, func(b box) error {
+		if b.typ == "meta" {
+			meta = b
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if meta.typ == "" {
+		return errors.New("no meta box")
+	}
+
+	items := make(map[uint32]*heifItem)
+	item := func(id uint32) *heifItem {
+		if items[id] == nil {
+			items[id] = &heifItem{}
+		}
+		return items[id]
+	}
+	var primary uint32
+	var sizes [][2]int
+	assoc := make(map[uint32][]int)
+
+	err := children(r, meta, 4, func(b box) error {
+		d, err := payload(r, b)
+		if err != nil {
+			return err
+		}
+		switch b.typ {
+		case "pitm":
+			if len(d) >= 6 && d[0] == 0 {
+				primary = uint32(binary.BigEndian.Uint16(d[4:]))
+			} else if len(d) >= 8 {
+				primary = binary.BigEndian.Uint32(d[4:])
+			}
+		case "iinf":
+			skip := int64(6)
+			if len(d) > 0 && d[0] != 0 {
+				skip = 8
+			}
+			return children(r, b, skip, func(b box) error {
+				d, err := payload(r, b)
+				if err != nil || b.typ != "infe" || len(d) < 4 || d[0] < 2 {
+					return err
+				}
+				if d[0] == 2 && len(d) >= 12 {
+					item(uint32(binary.BigEndian.Uint16(d[4:]))).typ = string(d[8:12])
+				} else if d[0] >= 3 && len(d) >= 14 {
+					item(binary.BigEndian.Uint32(d[4:])).typ = string(d[10:14])
+				}
+				return nil
+			})
+		case "iloc":
+			parseILOC(d, item)
+		case "iprp":
+			return children(r, b, 0, func(b box) error {
+				d, err := payload(r, b)
+				if err != nil {
+					return err
+				}
+				switch b.typ {
+				case "ipco":
+					sizes = nil
+					return children(r, b, 0, func(p box) error {
+						var dims [2]int
+						if p.typ == "ispe" {
+							d, err := payload(r, p)
+							if err != nil {
+								return err
+							}
+							if len(d) >= 12 {
+								dims = [2]int{int(binary.BigEndian.Uint32(d[4:])), int(binary.BigEndian.Uint32(d[8:]))}
+							}
+						}
+						sizes = append(sizes, dims)
+						return nil
+					})
+				case "ipma":
+					parseIPMA(d, assoc)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, it := range items {
+		if it.typ != "Exif" || !it.located || it.length < 4 {
+			continue
+		}
+		// The item starts with the offset of the TIFF header after it.
+		var b [4]byte
+		if _, err := r.ReadAt(b[:], it.offset); err != nil {
+			return fmt.Errorf("read EXIF item: %w", err)
+		}
+		tiffOff := it.offset + 4 + int64(binary.BigEndian.Uint32(b[:]))
+		if err := readTIFFFields(r, tiffOff, fields); err != nil {
+			return fmt.Errorf("read EXIF: %w", err)
+		}
+		break
+	}
+	// The primary item's size wins over any EXIF tags.
+	for _, idx := range assoc[primary] {
+		if idx >= 1 && idx <= len(sizes) && sizes[idx-1][0] > 0 {
+			fields["ImageWidth"], fields["ImageHeight"] = sizes[idx-1][0], sizes[idx-1][1]
+			break
+		}
+	}
+	return nil
+}
+
+// parseILOC records where each item's first extent is. Only items stored
+// in the file itself (construction method 0) are located.
+func parseILOC(d []byte, item func(uint32) *heifItem) {
+	if len(d) < 8 {
+		return
+	}
+	version := d[0]
+	offSize, lenSize := int(d[4]>>4), int(d[4]&0x0F)
+	baseSize, idxSize := int(d[5]>>4), int(d[5]&0x0F)
+	if version == 0 {
+		idxSize = 0
+	}
+	p := 6
+	readN := func(n int) (uint64, bool) {
+		if p+n > len(d) {
+			return 0, false
+		}
+		var v uint64
+		for i := 0; i < n; i++ {
+			v = v<<8 | uint64(d[p+i])
+		}
+		p += n
+		return v, true
+	}
+	idLen := 2
+	if version == 2 {
+		idLen = 4
+	}
+	count, ok := readN(idLen)
+	if !ok {
+		return
+	}
+	for i := uint64(0); i < count; i++ {
+		id, ok := readN(idLen)
+		if !ok {
+			return
+		}
+		method := uint64(0)
+		if version >= 1 {
+			if method, ok = readN(2); !ok {
+				return
+			}
+			method &= 0x0F
+		}
+		if _, ok = readN(2); !ok { // data reference index
+			return
+		}
+		base, ok := readN(baseSize)
+		if !ok {
+			return
+		}
+		extents, ok := readN(2)
+		if !ok {
+			return
+		}
+		for e := uint64(0); e < extents; e++ {
+			if _, ok = readN(idxSize); !ok {
+				return
+			}
+			off, ok1 := readN(offSize)
+			length, ok2 := readN(lenSize)
+			if !ok1 || !ok2 {
+				return
+			}
+			if e == 0 && method == 0 {
+				it := item(uint32(id))
+				it.offset, it.length, it.located = int64(base+off), int64(length), true
+			}
+		}
+	}
+}
+
+// parseIPMA records the 1-based property indexes of each item.
+func parseIPMA(d []byte, assoc map[uint32][]int) {
+	if len(d) < 8 {
+		return
+	}
+	version, flags := d[0], d[3]
+	count := binary.BigEndian.Uint32(d[4:])
+	p := 8
+	for i := uint32(0); i < count; i++ {
+		var id uint32
+		if version < 1 {
+			if p+2 > len(d) {
+				return
+			}
+			id = uint32(binary.BigEndian.Uint16(d[p:]))
+			p += 2
+		} else {
+			if p+4 > len(d) {
+				return
+			}
+			id = binary.BigEndian.Uint32(d[p:])
+			p += 4
+		}
+		if p >= len(d) {
+			return
+		}
+		n := int(d[p])
+		p++
+		for j := 0; j < n; j++ {
+			if flags&1 != 0 {
+				if p+2 > len(d) {
+					return
+				}
+				assoc[id] = append(assoc[id], int(binary.BigEndian.Uint16(d[p:])&0x7FFF))
+				p += 2
+			} else {
+				if p >= len(d) {
+					return
+				}
+				assoc[id] = append(assoc[id], int(d[p]&0x7F))
+				p++
+			}
+		}
+	}
+}
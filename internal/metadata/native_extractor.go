@@ -0,0 +1,261 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+)
+
+// NativeExtractor reads metadata in pure Go, without exiftool. It covers
+// JPEG, PNG, GIF, WebP, BMP, TIFF, HEIF/HEIC/AVIF, QuickTime/MP4 and the
+// common RAW containers (TIFF-based ones, CR3 and RAF), and names the
+// fields it finds as exiftool does so BuildFileMetadata treats both the
+// same. Other formats get a MIME type from their signature or extension
+// and no other metadata.
+type NativeExtractor struct {
+	// Counter, when set, counts the files the extractor opens.
+	Counter *IOCounter
+}
+
+// NewNativeExtractor creates a NativeExtractor.
+func NewNativeExtractor() *NativeExtractor {
+	return &NativeExtractor{}
+}
+
+// Close is a no-op; it lets NativeExtractor stand in for ExifExtractor.
+func (e *NativeExtractor) Close() error {
+	return nil
+}
+
+func (e *NativeExtractor) ioCounter() *IOCounter { return e.Counter }
+
+// Extract reads the metadata of the file at path and returns a
+// FileMetadata.
+func (e *NativeExtractor) Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error) {
+	return extractOnce(e, path, hasher)
+}
+
+// nativeVersion changes whenever the native readers start reporting
+// different fields, so cached results from older versions are not used.
+const nativeVersion = "native 4"
+
+// ReadFields reads the fields of each of files, from its Head where it
+// has one.
+func (e *NativeExtractor) ReadFields(files []HashedFile) ([]map[string]interface{}, []error) {
+	fields := make([]map[string]interface{}, len(files))
+	errs := make([]error, len(files))
+	for i, f := range files {
+		if f.Head == nil {
+			fields[i], errs[i] = readNativeFields(f.Path, e.Counter)
+			continue
+		}
+		r := &headReader{f: f, counter: e.Counter}
+		fields[i] = nativeFields(r, f.Size, f.Path)
+		errs[i] = r.Close()
+	}
+	return fields, errs
+}
+
+// Version names the native reader version.
+func (e *NativeExtractor) Version() string {
+	return nativeVersion
+}
+
+// fileFormat is a file format the native extractor recognises: its MIME
+// type, as exiftool reports it, and the reader of its metadata, if any.
+type fileFormat struct {
+	mime string
+	read func(r io.ReaderAt, size int64, fields map[string]interface{}) error
+}
+
+func readJPEGFile(r io.ReaderAt, _ int64, fields map[string]interface{}) error {
+	return readJPEG(r, 0, fields)
+}
+
+func readTIFFFile(r io.ReaderAt, _ int64, fields map[string]interface{}) error {
+	return readTIFFFields(r, 0, fields)
+}
+
+func readPNGFile(r io.ReaderAt, _ int64, f map[string]interface{}) error  { return readPNG(r, f) }
+func readGIFFile(r io.ReaderAt, _ int64, f map[string]interface{}) error  { return readGIF(r, f) }
+func readWebPFile(r io.ReaderAt, _ int64, f map[string]interface{}) error { return readWebP(r, f) }
+func readBMPFile(r io.ReaderAt, _ int64, f map[string]interface{}) error  { return readBMP(r, f) }
+func readRAFFile(r io.ReaderAt, _ int64, f map[string]interface{}) error  { return readRAF(r, f) }
+func readWAVFile(r io.ReaderAt, _ int64, f map[string]interface{}) error  { return readWAV(r, f) }
+func readFLACFile(r io.ReaderAt, _ int64, f map[string]interface{}) error { return readFLAC(r, f) }
+
+// tiffRAWTypes maps the extensions of TIFF-based RAW formats to their
+// MIME types. Other TIFF files are image/tiff.
+var tiffRAWTypes = map[string]string{
+	".3fr": "image/x-hasselblad-3fr",
+	".arw": "image/x-sony-arw",
+	".cr2": "image/x-canon-cr2",
+	".dng": "image/x-adobe-dng",
+	".erf": "image/x-epson-erf",
+	".iiq": "image/x-phaseone-iiq",
+	".nef": "image/x-nikon-nef",
+	".nrw": "image/x-nikon-nrw",
+	".orf": "image/x-olympus-orf",
+	".pef": "image/x-pentax-pef",
+	".rw2": "image/x-panasonic-rw2",
+	".rwl": "image/x-leica-rwl",
+	".sr2": "image/x-sony-sr2",
+	".srf": "image/x-sony-srf",
+	".srw": "image/x-samsung-srw",
+}
+
+// ftypTypes maps ISO base media major brands to MIME types. Brands not
+// listed are MP4 video.
+var ftypTypes = map[string]string{
+	"qt  ": "video/quicktime",
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"hevc": "image/heic",
+	"hevx": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+	"crx ": "image/x-canon-cr3",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"M4V ": "video/x-m4v",
+	"M4VH": "video/x-m4v",
+	"M4VP": "video/x-m4v",
+}
+
+// extensionTypes gives the MIME type of formats recognised by extension
+// alone, where the signature is ambiguous or absent.
+var extensionTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".aac":  "audio/aac",
+	".mts":  "video/m2ts",
+	".m2ts": "video/m2ts",
+	".ts":   "video/m2ts",
+	".mpg":  "video/mpeg",
+	".mpeg": "video/mpeg",
+	".wmv":  "video/x-ms-wmv",
+	".wma":  "audio/x-ms-wma",
+	".txt":  "text/plain",
+}
+
+// sniff identifies a file from its first bytes and its extension.
+func sniff(head []byte, ext string) fileFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return fileFormat{"image/jpeg", readJPEGFile}
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return fileFormat{"image/png", readPNGFile}
+	case bytes.HasPrefix(head, []byte("GIF8")):
+		return fileFormat{"image/gif", readGIFFile}
+	case bytes.HasPrefix(head, []byte("FUJIFILMCCD-RAW")):
+		return fileFormat{"image/x-fujifilm-raf", readRAFFile}
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		if mime, ok := tiffRAWTypes[ext]; ok {
+			return fileFormat{mime, readTIFFFile}
+		}
+		return fileFormat{"image/tiff", readTIFFFile}
+	case bytes.HasPrefix(head, []byte("IIRO")), bytes.HasPrefix(head, []byte("IIRS")), bytes.HasPrefix(head, []byte("MMOR")):
+		return fileFormat{"image/x-olympus-orf", readTIFFFile}
+	case bytes.HasPrefix(head, []byte("IIU\x00")):
+		return fileFormat{"image/x-panasonic-rw2", readTIFFFile}
+	case len(head) >= 12 && string(head[:4]) == "RIFF":
+		switch string(head[8:12]) {
+		case "WEBP":
+			return fileFormat{"image/webp", readWebPFile}
+		case "WAVE":
+			return fileFormat{"audio/x-wav", readWAVFile}
+		case "AVI ":
+			return fileFormat{"video/x-msvideo", nil}
+		}
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		brand := string(head[8:12])
+		mime, ok := ftypTypes[brand]
+		switch {
+		case strings.HasPrefix(brand, "3g2"):
+			mime = "video/3gpp2"
+		case strings.HasPrefix(brand, "3gp"):
+			mime = "video/3gpp"
+		case !ok:
+			mime = "video/mp4"
+		}
+		switch {
+		case mime == "image/x-canon-cr3":
+			return fileFormat{mime, readCR3}
+		case strings.HasPrefix(mime, "image/"):
+			return fileFormat{mime, readHEIF}
+		}
+		return fileFormat{mime, readMovie}
+	case len(head) >= 8 && isQuickTimeAtom(string(head[4:8])):
+		return fileFormat{"video/quicktime", readMovie}
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return fileFormat{"audio/flac", readFLACFile}
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		if ext == ".webm" {
+			return fileFormat{"video/webm", nil}
+		}
+		return fileFormat{"video/x-matroska", nil}
+	case bytes.HasPrefix(head, []byte("OggS")):
+		if ext == ".ogv" {
+			return fileFormat{"video/ogg", nil}
+		}
+		return fileFormat{"audio/ogg", nil}
+	case bytes.HasPrefix(head, []byte("%PDF")):
+		return fileFormat{"application/pdf", nil}
+	case bytes.HasPrefix(head, []byte("BM")) && ext == ".bmp":
+		return fileFormat{"image/bmp", readBMPFile}
+	}
+	return fileFormat{extensionTypes[ext], nil}
+}
+
+// isQuickTimeAtom reports whether typ is a top-level atom that can start
+// a QuickTime movie without an ftyp box.
+func isQuickTimeAtom(typ string) bool {
+	switch typ {
+	case "moov", "mdat", "wide", "free", "skip", "pnot":
+		return true
+	}
+	return false
+}
+
+// sniffLen is how many leading bytes sniff looks at.
+const sniffLen = 32
+
+// readNativeFields reads the metadata of the file at path into
+// exiftool-named fields.
+func readNativeFields(path string, c *IOCounter) (map[string]interface{}, error) {
+	f, err := c.open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	return nativeFields(f, info.Size(), path), nil
+}
+
+// nativeFields reads the metadata of the size-byte file in r, named path,
+// into exiftool-named fields. Like exiftool, it reports what it could
+// read from a damaged file rather than failing.
+func nativeFields(r io.ReaderAt, size int64, path string) map[string]interface{} {
+	head := make([]byte, sniffLen)
+	n, _ := r.ReadAt(head, 0)
+
+	format := sniff(head[:n], strings.ToLower(filepath.Ext(path)))
+	fields := make(map[string]interface{})
+	if format.mime != "" {
+		fields["MIMEType"] = format.mime
+	}
+	if format.read != nil {
+		_ = format.read(r, size, fields)
+	}
+	return fields
+}
@@ -0,0 +1,295 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// readJPEG reads the EXIF and XMP APP1 segments and the frame size of a JPEG
+// starting at base. The frame size is what exiftool reports as
+// ImageWidth and ImageHeight.
+func readJPEG(r io.ReaderAt, base int64, fields map[string]interface{}) error {
+	off := base + 2
+	exifDone := false
+	for {
+		var hdr [4]byte
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			return fmt.Errorf("read JPEG segment: %w", err)
+		}
+		if hdr[0] != 0xFF {
+			return errors.New("corrupt JPEG segment")
+		}
+		marker := hdr[1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte.
+			off++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8):
+			// Standalone markers carry no length.
+			off += 2
+			continue
+		case marker == 0xD9 || marker == 0xDA:
+			// End of image, or start of scan before any frame header.
+			return nil
+		}
+		length := int64(binary.BigEndian.Uint16(hdr[2:]))
+		if length < 2 {
+			return errors.New("corrupt JPEG segment length")
+		}
+
+		switch {
+		case marker == 0xE1 && length > 8:
+			seg := make([]byte, length-2)
+			if _, err := r.ReadAt(seg, off+4); err != nil {
+				return fmt.Errorf("read JPEG APP1: %w", err)
+			}
+			switch {
+			case bytes.HasPrefix(seg, exifHeader) && !exifDone:
+				exifDone = true
+				if err := readEXIFBlock(seg, fields); err != nil {
+					return fmt.Errorf("read EXIF: %w", err)
+				}
+			case bytes.HasPrefix(seg, xmpHeader):
+				readXMP(seg[len(xmpHeader):], fields)
+			}
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			// Start of frame: precision, height, width.
+			var sof [5]byte
+			if _, err := r.ReadAt(sof[:], off+4); err != nil {
+				return fmt.Errorf("read JPEG frame header: %w", err)
+			}
+			fields["ImageHeight"] = int(binary.BigEndian.Uint16(sof[1:]))
+			fields["ImageWidth"] = int(binary.BigEndian.Uint16(sof[3:]))
+			return nil
+		}
+		off += 2 + length
+	}
+}
+
+// readPNG reads the IHDR size, the eXIf chunk and the XMP of a PNG.
+func readPNG(r io.ReaderAt, fields map[string]interface{}) error {
+	return readChunks(r, 8, binary.BigEndian, false, func(typ string, off, size int64) error {
+		switch typ {
+		case "IHDR":
+			var ihdr [8]byte
+			if _, err := r.ReadAt(ihdr[:], off); err != nil {
+				return err
+			}
+			fields["ImageWidth"] = int(binary.BigEndian.Uint32(ihdr[:]))
+			fields["ImageHeight"] = int(binary.BigEndian.Uint32(ihdr[4:]))
+		case "eXIf":
+			return readEXIFChunk(r, off, size, fields)
+		case "iTXt":
+			if size > maxValueBytes {
+				return nil
+			}
+			data := make([]byte, size)
+			if _, err := r.ReadAt(data, off); err != nil {
+				return err
+			}
+			readXMPChunk(data, fields)
+		case "IEND":
+			return errStopChunks
+		}
+		return nil
+	})
+}
+
+// readWebP reads the canvas size and the EXIF chunk of a WebP.
+func readWebP(r io.ReaderAt, fields map[string]interface{}) error {
+	return readChunks(r, 12, binary.LittleEndian, true, func(typ string, off, size int64) error {
+		var b [10]byte
+		switch typ {
+		case "VP8X":
+			if _, err := r.ReadAt(b[:], off); err != nil {
+				return err
+			}
+			fields["ImageWidth"] = int(uint32(b[4])|uint32(b[5])<<8|uint32(b[6])<<16) + 1
+			fields["ImageHeight"] = int(uint32(b[7])|uint32(b[8])<<8|uint32(b[9])<<16) + 1
+		case "VP8 ":
+			if _, ok := fields["ImageWidth"]; ok {
+				return nil
+			}
+			if _, err := r.ReadAt(b[:], off); err != nil {
+				return err
+			}
+			fields["ImageWidth"] = int(binary.LittleEndian.Uint16(b[6:]) & 0x3FFF)
+			fields["ImageHeight"] = int(binary.LittleEndian.Uint16(b[8:]) & 0x3FFF)
+		case "VP8L":
+			if _, ok := fields["ImageWidth"]; ok {
+				return nil
+			}
+			if _, err := r.ReadAt(b[:5], off); err != nil {
+				return err
+			}
+			bits := binary.LittleEndian.Uint32(b[1:])
+			fields["ImageWidth"] = int(bits&0x3FFF) + 1
+			fields["ImageHeight"] = int(bits>>14&0x3FFF) + 1
+		case "EXIF":
+			return readEXIFChunk(r, off, size, fields)
+		}
+		return nil
+	})
+}
+
+// readGIF reads the logical screen size of a GIF.
+func readGIF(r io.ReaderAt, fields map[string]interface{}) error {
+	var b [4]byte
+	if _, err := r.ReadAt(b[:], 6); err != nil {
+		return fmt.Errorf("read GIF header: %w", err)
+	}
+	fields["ImageWidth"] = int(binary.LittleEndian.Uint16(b[:]))
+	fields["ImageHeight"] = int(binary.LittleEndian.Uint16(b[2:]))
+	return nil
+}
+
+// readBMP reads the size of a BMP.
+func readBMP(r io.ReaderAt, fields map[string]interface{}) error {
+	var b [8]byte
+	if _, err := r.ReadAt(b[:], 18); err != nil {
+		return fmt.Errorf("read BMP header: %w", err)
+	}
+	w, h := int32(binary.LittleEndian.Uint32(b[:])), int32(binary.LittleEndian.Uint32(b[4:]))
+	fields["ImageWidth"] = int(abs32(w))
+	fields["ImageHeight"] = int(abs32(h))
+	return nil
+}
+
+func abs32(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// readRAF reads the EXIF of the JPEG preview embedded in a Fujifilm RAF.
+// The header holds the preview's offset at byte 84.
+func readRAF(r io.ReaderAt, fields map[string]interface{}) error {
+	var b [4]byte
+	if _, err := r.ReadAt(b[:], 84); err != nil {
+		return fmt.Errorf("read RAF header: %w", err)
+	}
+	jpegOff := int64(binary.BigEndian.Uint32(b[:]))
+	jpegFields := make(map[string]interface{})
+	if err := readJPEG(r, jpegOff, jpegFields); err != nil {
+		return fmt.Errorf("read RAF preview: %w", err)
+	}
+	// The preview's frame size is not the RAW size; keep the EXIF only.
+	delete(jpegFields, "ImageWidth")
+	delete(jpegFields, "ImageHeight")
+	for k, v := range jpegFields {
+		fields[k] = v
+	}
+	return nil
+}
+
+// readWAV reads the sample rate of a WAV and computes its duration from
+// the byte rate and data size.
+func readWAV(r io.ReaderAt, fields map[string]interface{}) error {
+	var byteRate uint32
+	return readChunks(r, 12, binary.LittleEndian, true, func(typ string, off, size int64) error {
+		switch typ {
+		case "fmt ":
+			var b [12]byte
+			if _, err := r.ReadAt(b[:], off); err != nil {
+				return err
+			}
+			if rate := binary.LittleEndian.Uint32(b[4:]); rate > 0 {
+				fields["SampleRate"] = int(rate)
+			}
+			byteRate = binary.LittleEndian.Uint32(b[8:])
+		case "data":
+			if byteRate > 0 {
+				fields["Duration"] = formatDuration(float64(size) / float64(byteRate))
+			}
+			return errStopChunks
+		}
+		return nil
+	})
+}
+
+// readFLAC reads the sample rate and duration of a FLAC from its
+// STREAMINFO block.
+func readFLAC(r io.ReaderAt, fields map[string]interface{}) error {
+	var b [18]byte
+	if _, err := r.ReadAt(b[:], 8); err != nil {
+		return fmt.Errorf("read FLAC stream info: %w", err)
+	}
+	rate := uint32(b[10])<<12 | uint32(b[11])<<4 | uint32(b[12])>>4
+	samples := uint64(b[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(b[14:]))
+	if rate > 0 {
+		fields["SampleRate"] = int(rate)
+	}
+	if rate > 0 && samples > 0 {
+		fields["Duration"] = formatDuration(float64(samples) / float64(rate))
+	}
+	return nil
+}
+
+// errStopChunks ends readChunks early without an error.
+var errStopChunks = errors.New("stop")
+
+// readChunks walks the chunks of a PNG or RIFF file from off, calling fn
+// with each chunk's type, data offset and data size. PNG chunks are
+// length-first with a CRC after the data; RIFF chunks are type-first and
+// padded to even sizes.
+func readChunks(r io.ReaderAt, off int64, order binary.ByteOrder, riff bool, fn func(typ string, off, size int64) error) error {
+	for {
+		var hdr [8]byte
+		if _, err := r.ReadAt(hdr[:], off); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		var typ string
+		var size int64
+		if riff {
+			typ, size = string(hdr[:4]), int64(order.Uint32(hdr[4:]))
+		} else {
+			typ, size = string(hdr[4:]), int64(order.Uint32(hdr[:4]))
+		}
+		if err := fn(typ, off+8, size); err != nil {
+			if errors.Is(err, errStopChunks) {
+				return nil
+			}
+			return err
+		}
+		off += 8 + size
+		if riff {
+			off += size & 1
+		} else {
+			off += 4
+		}
+	}
+}
+
+// readEXIFChunk reads an EXIF block stored as a chunk of size bytes.
+func readEXIFChunk(r io.ReaderAt, off, size int64, fields map[string]interface{}) error {
+	if size > maxValueBytes*16 {
+		return nil
+	}
+	b := make([]byte, size)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return err
+	}
+	if err := readEXIFBlock(b, fields); err != nil {
+		return fmt.Errorf("read EXIF: %w", err)
+	}
+	return nil
+}
+
+// formatDuration prints seconds the way exiftool prints durations, so
+// both extractors round alike: "12.34 s" below 30 seconds, "H:MM:SS"
+// rounded to the second above.
+func formatDuration(secs float64) string {
+	if secs < 30 {
+		return fmt.Sprintf("%.2f s", secs)
+	}
+	t := int64(secs + 0.5)
+	return fmt.Sprintf("%d:%02d:%02d", t/3600, t/60%60, t%60)
+}
@@ -0,0 +1,437 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/geo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTag is a TIFF entry for buildTIFF. value is a string (ASCII),
+// []byte (BYTE), []uint16 (SHORT), []uint32 (LONG) or [][2]uint32
+// (RATIONAL).
+type testTag struct {
+	tag   uint16
+	value interface{}
+}
+
+// buildTIFF lays out a TIFF with IFD0 and optional EXIF, GPS and SubIFD
+// directories, adding the pointer tags to IFD0.
+func buildTIFF(bo binary.ByteOrder, ifd0, exif, gps, sub []testTag) []byte {
+	dirs := [][]testTag{append([]testTag(nil), ifd0...)}
+	pointers := []uint16{tagExifIFD, tagGPSIFD, tagSubIFDs}
+	var linked []uint16
+	for i, d := range [][]testTag{exif, gps, sub} {
+		if len(d) > 0 {
+			dirs[0] = append(dirs[0], testTag{pointers[i], []uint32{0}})
+			dirs = append(dirs, d)
+			linked = append(linked, pointers[i])
+		}
+	}
+	offsets := make([]uint32, len(dirs))
+	off := uint32(8)
+	for i, d := range dirs {
+		offsets[i] = off
+		off += uint32(2 + 12*len(d) + 4)
+	}
+	for i, p := range linked {
+		for j := range dirs[0] {
+			if dirs[0][j].tag == p {
+				dirs[0][j].value = []uint32{offsets[i+1]}
+			}
+		}
+	}
+	for _, d := range dirs {
+		sort.Slice(d, func(i, j int) bool { return d[i].tag < d[j].tag })
+	}
+
+	var out, data bytes.Buffer
+	if bo == binary.LittleEndian {
+		out.WriteString("II")
+	} else {
+		out.WriteString("MM")
+	}
+	_ = binary.Write(&out, bo, uint16(42))
+	_ = binary.Write(&out, bo, uint32(8))
+	for _, d := range dirs {
+		_ = binary.Write(&out, bo, uint16(len(d)))
+		for _, t := range d {
+			var typ uint16
+			var raw bytes.Buffer
+			var count int
+			switch v := t.value.(type) {
+			case string:
+				typ, count = 2, len(v)+1
+				raw.WriteString(v + "\x00")
+			case []byte:
+				typ, count = 1, len(v)
+				raw.Write(v)
+			case []uint16:
+				typ, count = 3, len(v)
+				_ = binary.Write(&raw, bo, v)
+			case []uint32:
+				typ, count = 4, len(v)
+				_ = binary.Write(&raw, bo, v)
+			case [][2]uint32:
+				typ, count = 5, len(v)
+				_ = binary.Write(&raw, bo, v)
+			}
+			_ = binary.Write(&out, bo, t.tag)
+			_ = binary.Write(&out, bo, typ)
+			_ = binary.Write(&out, bo, uint32(count))
+			if raw.Len() <= 4 {
+				out.Write(append(raw.Bytes(), make([]byte, 4-raw.Len())...))
+				continue
+			}
+			_ = binary.Write(&out, bo, off+uint32(data.Len()))
+			data.Write(raw.Bytes())
+			if data.Len()%2 == 1 {
+				data.WriteByte(0)
+			}
+		}
+		_ = binary.Write(&out, bo, uint32(0))
+	}
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+// San Francisco: 37°46'29.64" N, 122°25'9.84" W.
+var (
+	testGPS = []testTag{
+		{tagGPSLatitudeRef, "N"},
+		{tagGPSLatitude, [][2]uint32{{37, 1}, {46, 1}, {2964, 100}}},
+		{tagGPSLongitudeRef, "W"},
+		{tagGPSLongitude, [][2]uint32{{122, 1}, {25, 1}, {984, 100}}},
+		{tagGPSAltitudeRef, []byte{0}},
+		{tagGPSAltitude, [][2]uint32{{123, 10}}},
+	}
+	testLat, testLon, testAlt = 37.7749, -122.4194, 12.3
+)
+
+func testEXIF(bo binary.ByteOrder) []byte {
+	return buildTIFF(bo,
+		[]testTag{{tagMake, "Apple"}, {tagModel, "iPhone 15 Pro"}, {tagOrientation, []uint16{6}}, {tagSoftware, "17.5.1"}},
+		[]testTag{{tagDateTimeOriginal, "2024:08:20 18:45:03"}, {tagExifImageWidth, []uint16{16}}, {tagExifImageHeight, []uint16{8}},
+			{tagExposureTime, [][2]uint32{{1, 120}}}, {tagFNumber, [][2]uint32{{178, 100}}}, {tagISO, []uint16{64}},
+			{tagLensModel, "iPhone 15 Pro back camera 6.765mm f/1.78"}, {tagBodySerialNumber, "F2LXK0ABCDEF"}},
+		testGPS, nil)
+}
+
+func testJPEG(t testing.TB, exif []byte) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	require.NoError(t, jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 16, 8)), nil))
+	seg := append(append([]byte{}, exifHeader...), exif...)
+	var out bytes.Buffer
+	out.Write(img.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(img.Bytes()[2:])
+	return out.Bytes()
+}
+
+func testPNG(t *testing.T, exif []byte) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	require.NoError(t, png.Encode(&img, image.NewGray(image.Rect(0, 0, 20, 10))))
+	b := img.Bytes()
+	iend := len(b) - 12
+	var chunk bytes.Buffer
+	_ = binary.Write(&chunk, binary.BigEndian, uint32(len(exif)))
+	chunk.WriteString("eXIf")
+	chunk.Write(exif)
+	_ = binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("eXIf"), exif...)))
+	return append(append(append([]byte{}, b[:iend]...), chunk.Bytes()...), b[iend:]...)
+}
+
+func mkbox(typ string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+// testMOV is a QuickTime movie recorded 2024-01-15 12:00:00 UTC, 12.345 s
+// long, with a 1920x1080 H.264 track of 370 frames, a 48 kHz AAC track,
+// Apple metadata keys and a ©xyz position.
+func testMOV() []byte {
+	created := uint32(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC).Sub(quickTimeEpoch) / time.Second)
+	mvhd := mkbox("mvhd", u32(0), u32(created), u32(created), u32(1000), u32(12345), make([]byte, 80))
+	tkhd := mkbox("tkhd", u32(0), u32(created), u32(created), u32(1), u32(0), u32(12345), make([]byte, 8),
+		make([]byte, 8), make([]byte, 36), u32(1920<<16), u32(1080<<16))
+	mdhd := mkbox("mdhd", u32(0), u32(created), u32(created), u32(600), u32(7407), u16(0), u16(0))
+	hdlr := func(typ string) []byte {
+		return mkbox("hdlr", u32(0), []byte("mhlr"), []byte(typ), make([]byte, 12), []byte{0})
+	}
+	stbl := func(entry []byte, stts ...[]byte) []byte {
+		return mkbox("minf", mkbox("stbl", mkbox("stsd", u32(0), u32(1), entry),
+			mkbox("stts", u32(0), u32(uint32(len(stts))), bytes.Join(stts, nil))))
+	}
+	video := mkbox("avc1", make([]byte, 6), u16(1), make([]byte, 16), u16(1920), u16(1080))
+	trak := mkbox("trak", tkhd, mkbox("mdia", mdhd, hdlr("vide"),
+		stbl(video, append(u32(300), u32(20)...), append(u32(70), u32(20)...))))
+	audio := mkbox("mp4a", make([]byte, 6), u16(1), make([]byte, 8), u16(2), u16(16), u32(0), u32(48000<<16))
+	sound := mkbox("trak", mkbox("mdia", mdhd, hdlr("soun"), stbl(audio, append(u32(577), u32(1024)...))))
+
+	key := func(name string) []byte { return mkbox("mdta", []byte(name)) }
+	keys := mkbox("keys", u32(0), u32(2), key("com.apple.quicktime.make"), key("com.apple.quicktime.model"))
+	item := func(idx uint32, v string) []byte {
+		return append(u32(uint32(8+16+len(v))), append(u32(idx), mkbox("data", u32(1), u32(0), []byte(v))...)...)
+	}
+	meta := mkbox("meta", mkbox("hdlr", u32(0), u32(0), []byte("mdta"), make([]byte, 12), []byte{0}),
+		keys, mkbox("ilst", item(1, "Apple"), item(2, "iPhone 15 Pro")))
+	xyz := "+37.7749-122.4194+012.300/"
+	udta := mkbox("udta", mkbox("\xa9xyz", u16(uint16(len(xyz))), u16(0x15c7), []byte(xyz)))
+
+	return append(mkbox("ftyp", []byte("qt  "), u32(0), []byte("qt  ")),
+		append(mkbox("moov", mvhd, trak, sound, udta, meta), mkbox("mdat", make([]byte, 64))...)...)
+}
+
+// testHEIC is a HEIC with a 4032x3024 primary item and an EXIF item.
+func testHEIC() []byte {
+	ftyp := mkbox("ftyp", []byte("heic"), u32(0), []byte("mif1heic"))
+	exif := append(append(u32(6), exifHeader...), testEXIF(binary.BigEndian)...)
+	build := func(exifOff uint32) []byte {
+		iloc := mkbox("iloc", u32(0), []byte{0x44, 0x00}, u16(1),
+			u16(2), u16(0), u16(1), u32(exifOff), u32(uint32(len(exif))))
+		iinf := mkbox("iinf", u32(0), u16(2),
+			mkbox("infe", []byte{2, 0, 0, 0}, u16(1), u16(0), []byte("hvc1"), []byte{0}),
+			mkbox("infe", []byte{2, 0, 0, 0}, u16(2), u16(0), []byte("Exif"), []byte{0}))
+		ipco := mkbox("ipco", mkbox("ispe", u32(0), u32(4032), u32(3024)))
+		ipma := mkbox("ipma", u32(0), u32(1), u16(1), []byte{1, 0x81})
+		return mkbox("meta", u32(0), mkbox("hdlr", u32(0), u32(0), []byte("pict"), make([]byte, 12), []byte{0}),
+			mkbox("pitm", u32(0), u16(1)), iinf, iloc, mkbox("iprp", ipco, ipma))
+	}
+	meta := build(0)
+	meta = build(uint32(len(ftyp) + len(meta) + 8))
+	return append(append(ftyp, meta...), mkbox("mdat", exif)...)
+}
+
+// testCR3 is a CR3 with its TIFF blocks in the Canon uuid box.
+func testCR3() []byte {
+	cmt1 := buildTIFF(binary.LittleEndian, []testTag{
+		{tagMake, "Canon"}, {tagModel, "Canon EOS R5"},
+		{tagImageWidth, []uint32{8192}}, {tagImageHeight, []uint32{5464}},
+	}, nil, nil, nil)
+	cmt2 := buildTIFF(binary.LittleEndian, []testTag{{tagDateTimeOriginal, "2023:05:06 07:08:09"}}, nil, nil, nil)
+	cmt4 := buildTIFF(binary.LittleEndian, testGPS, nil, nil, nil)
+	uuid := mkbox("uuid", canonCR3UUID, mkbox("CMT1", cmt1), mkbox("CMT2", cmt2), mkbox("CMT4", cmt4))
+	return append(mkbox("ftyp", []byte("crx "), u32(1), []byte("crx isom")), mkbox("moov", uuid)...)
+}
+
+// testWAV is 2 s of 8 kHz 8-bit mono audio.
+func testWAV() []byte {
+	le := binary.LittleEndian
+	fmtChunk := le.AppendUint16(nil, 1)
+	fmtChunk = le.AppendUint16(fmtChunk, 1)
+	fmtChunk = le.AppendUint32(fmtChunk, 8000)
+	fmtChunk = le.AppendUint32(fmtChunk, 8000)
+	fmtChunk = le.AppendUint16(fmtChunk, 1)
+	fmtChunk = le.AppendUint16(fmtChunk, 8)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	_ = binary.Write(&b, le, uint32(4+8+len(fmtChunk)+8+16000))
+	b.WriteString("WAVEfmt ")
+	_ = binary.Write(&b, le, uint32(len(fmtChunk)))
+	b.Write(fmtChunk)
+	b.WriteString("data")
+	_ = binary.Write(&b, le, uint32(16000))
+	b.Write(make([]byte, 16000))
+	return b.Bytes()
+}
+
+// writeFixtures writes one synthetic file per supported container.
+func writeFixtures(t *testing.T) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	nef := buildTIFF(binary.BigEndian,
+		[]testTag{{tagNewSubfileType, []uint32{1}}, {tagImageWidth, []uint32{160}}, {tagImageHeight, []uint32{120}},
+			{tagMake, "NIKON CORPORATION"}, {tagModel, "NIKON D850"}},
+		[]testTag{{tagDateTimeOriginal, "2022:02:03 04:05:06"}},
+		nil,
+		[]testTag{{tagNewSubfileType, []uint32{0}}, {tagImageWidth, []uint32{8256}}, {tagImageHeight, []uint32{5504}}})
+	files := map[string][]byte{
+		"photo.jpg":  testJPEG(t, testEXIF(binary.LittleEndian)),
+		"photo.png":  testPNG(t, testEXIF(binary.BigEndian)),
+		"raw.nef":    nef,
+		"clip.mov":   testMOV(),
+		"photo.heic": testHEIC(),
+		"raw.cr3":    testCR3(),
+		"sound.wav":  testWAV(),
+		"notes.txt":  []byte("just text\n"),
+	}
+	paths := make(map[string]string)
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, data, 0o644))
+		paths[name] = p
+	}
+	return paths
+}
+
+func TestNativeExtractor(t *testing.T) {
+	paths := writeFixtures(t)
+	ext := NewNativeExtractor()
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	extract := func(name string) *FileMetadata {
+		md, err := ext.Extract(paths[name], hasher)
+		require.NoError(t, err, name)
+		return md
+	}
+	assertGPS := func(md *FileMetadata) {
+		t.Helper()
+		require.NotNil(t, md.GPS)
+		assert.InDelta(t, testLat, md.GPS.Latitude, 1e-4)
+		assert.InDelta(t, testLon, md.GPS.Longitude, 1e-4)
+		require.NotNil(t, md.GPS.Altitude)
+		assert.Equal(t, testAlt, *md.GPS.Altitude)
+		assert.Equal(t, &geo.Place{CountryCode: "US", Country: "United States", Region: "California"}, md.Place)
+	}
+
+	for _, name := range []string{"photo.jpg", "photo.png"} {
+		md := extract(name)
+		assert.Equal(t, "Apple", md.Make, name)
+		assert.Equal(t, "iPhone 15 Pro", md.Model, name)
+		assert.Equal(t, time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC), md.DateTime, name)
+		assert.Equal(t, defaults.MediaTypePhoto, md.MediaType, name)
+		assert.Equal(t, 6, md.Orientation, name)
+		assert.Equal(t, "17.5.1", md.Software, name)
+		assert.Equal(t, 1.0/120, md.ExposureTime, name)
+		assert.Equal(t, 1.8, md.Aperture, name)
+		assert.Equal(t, 64, md.ISO, name)
+		assert.Equal(t, "iPhone 15 Pro back camera 6.765mm f/1.78", md.LensModel, name)
+		assert.Equal(t, "F2LXK0ABCDEF", md.SerialNumber, name)
+		assertGPS(md)
+	}
+	md := extract("photo.jpg")
+	assert.Equal(t, "image/jpeg", md.MIMEType)
+	assert.Equal(t, [2]int{16, 8}, [2]int{md.Width, md.Height})
+	full, short, err := ComputeFileHash(paths["photo.jpg"], hasher)
+	require.NoError(t, err)
+	assert.Equal(t, full, md.FullHash)
+	assert.Equal(t, short, md.ShortHash)
+	md = extract("photo.png")
+	assert.Equal(t, "image/png", md.MIMEType)
+	assert.Equal(t, [2]int{20, 10}, [2]int{md.Width, md.Height})
+
+	md = extract("raw.nef")
+	assert.Equal(t, "image/x-nikon-nef", md.MIMEType)
+	assert.Equal(t, "NIKON CORPORATION", md.Make)
+	assert.Equal(t, "NIKON D850", md.Model)
+	assert.Equal(t, time.Date(2022, 2, 3, 4, 5, 6, 0, time.UTC), md.DateTime)
+	assert.Equal(t, [2]int{8256, 5504}, [2]int{md.Width, md.Height})
+
+	md = extract("clip.mov")
+	assert.Equal(t, "video/quicktime", md.MIMEType)
+	assert.Equal(t, defaults.MediaTypeVideo, md.MediaType)
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, "iPhone 15 Pro", md.Model)
+	assert.Equal(t, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), md.DateTime)
+	assert.Equal(t, 12350*time.Millisecond, md.Duration)
+	assert.Equal(t, [2]int{1920, 1080}, [2]int{md.Width, md.Height})
+	assert.Equal(t, "avc1", md.VideoCodec)
+	assert.Equal(t, 29.972, md.FrameRate)
+	assert.Equal(t, 48000, md.AudioSampleRate)
+	assertGPS(md)
+
+	md = extract("photo.heic")
+	assert.Equal(t, "image/heic", md.MIMEType)
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC), md.DateTime)
+	assert.Equal(t, [2]int{4032, 3024}, [2]int{md.Width, md.Height})
+	assertGPS(md)
+
+	md = extract("raw.cr3")
+	assert.Equal(t, "image/x-canon-cr3", md.MIMEType)
+	assert.Equal(t, "Canon", md.Make)
+	assert.Equal(t, "Canon EOS R5", md.Model)
+	assert.Equal(t, time.Date(2023, 5, 6, 7, 8, 9, 0, time.UTC), md.DateTime)
+	assert.Equal(t, [2]int{8192, 5464}, [2]int{md.Width, md.Height})
+	assertGPS(md)
+
+	md = extract("sound.wav")
+	assert.Equal(t, "audio/x-wav", md.MIMEType)
+	assert.Equal(t, defaults.MediaTypeAudio, md.MediaType)
+	assert.Equal(t, 2*time.Second, md.Duration)
+	assert.Equal(t, 8000, md.AudioSampleRate)
+	assert.Equal(t, "Unknown", md.Make)
+
+	md = extract("notes.txt")
+	assert.Equal(t, "text/plain", md.MIMEType)
+	assert.Equal(t, defaults.MediaTypeOther, md.MediaType)
+}
+
+func TestNativeExtractorDamagedFiles(t *testing.T) {
+	dir := t.TempDir()
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+	ext := NewNativeExtractor()
+
+	// A JPEG cut off inside its EXIF segment still is a JPEG.
+	cut := filepath.Join(dir, "cut.jpg")
+	require.NoError(t, os.WriteFile(cut, testJPEG(t, testEXIF(binary.LittleEndian))[:40], 0o644))
+	md, err := ext.Extract(cut, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", md.MIMEType)
+	assert.True(t, md.DateTime.IsZero())
+
+	unknown := filepath.Join(dir, "blob.bin")
+	require.NoError(t, os.WriteFile(unknown, []byte{0, 1, 2, 3}, 0o644))
+	md, err = ext.Extract(unknown, hasher)
+	require.NoError(t, err)
+	assert.Empty(t, md.MIMEType)
+	assert.Equal(t, defaults.MediaTypeOther, md.MediaType)
+
+	_, err = ext.Extract(filepath.Join(dir, "missing.jpg"), hasher)
+	assert.Error(t, err)
+}
+
+func TestFormatDMS(t *testing.T) {
+	assert.Equal(t, `37 deg 46' 29.64" N`, formatDMS(37.7749, "N"))
+	assert.Equal(t, `122 deg 25' 9.84" W`, formatDMS(-122.4194, "E"))
+	assert.Equal(t, `1 deg 0' 0.00" S`, formatDMS(0.9999999999, "S"))
+}
+
+func TestFormatExposureTime(t *testing.T) {
+	assert.Equal(t, "1/120", formatExposureTime(1.0/120))
+	assert.Equal(t, "1/4", formatExposureTime(0.25))
+	assert.Equal(t, "0.3", formatExposureTime(0.3))
+	assert.Equal(t, "2", formatExposureTime(2))
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "12.30 s", formatDuration(12.3))
+	assert.Equal(t, "30.00 s", formatDuration(29.999))
+	assert.Equal(t, "0:00:30", formatDuration(30))
+	assert.Equal(t, "1:01:06", formatDuration(3665.5))
+}
+
+func TestNewExtractor(t *testing.T) {
+	ext, err := NewExtractor(ExtractorNative)
+	require.NoError(t, err)
+	assert.IsType(t, &NativeExtractor{}, ext)
+
+	ext, err = NewExtractor(ExtractorAuto)
+	require.NoError(t, err)
+	require.NoError(t, ext.Close())
+
+	_, err = NewExtractor("magic")
+	assert.ErrorContains(t, err, "unknown extractor")
+}
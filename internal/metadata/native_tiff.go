@@ -0,0 +1,442 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// TIFF tags read by the native extractor.
+const (
+	tagNewSubfileType   = 0x00FE
+	tagImageWidth       = 0x0100
+	tagImageHeight      = 0x0101
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagXMP              = 0x02BC
+	tagSubIFDs          = 0x014A
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagExifImageWidth   = 0xA002
+	tagExifImageHeight  = 0xA003
+	tagBodySerialNumber = 0xA431
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// Sanity limits for malformed files.
+const (
+	maxIFDEntries = 1024
+	maxValueBytes = 1 << 20
+	maxIFDs       = 16
+)
+
+// tiffTypeSizes is the byte size of each TIFF field type, by type number.
+var tiffTypeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4}
+
+// tiffReader reads IFDs from a TIFF structure at base in r: a TIFF or
+// TIFF-based RAW file, or the EXIF block of another container. Offsets
+// inside the structure are relative to base.
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	order binary.ByteOrder
+}
+
+// tiffEntry is one IFD entry with its raw value bytes.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// newTIFFReader reads the TIFF header at base and returns the reader and
+// the offset of IFD0. Besides the standard magic 42 it accepts the
+// variants of Olympus ORF and Panasonic RW2.
+func newTIFFReader(r io.ReaderAt, base int64) (*tiffReader, uint32, error) {
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], base); err != nil {
+		return nil, 0, fmt.Errorf("read TIFF header: %w", err)
+	}
+	var order binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("not a TIFF header")
+	}
+	switch order.Uint16(hdr[2:]) {
+	case 42, 0x4F52, 0x5352, 0x0055:
+	default:
+		return nil, 0, errors.New("not a TIFF header")
+	}
+	return &tiffReader{r: r, base: base, order: order}, order.Uint32(hdr[4:]), nil
+}
+
+// readIFD returns the entries of the IFD at off and the offset of the
+// next IFD in the chain (0 at the end).
+func (t *tiffReader) readIFD(off uint32) ([]tiffEntry, uint32, error) {
+	var hdr [2]byte
+	if _, err := t.r.ReadAt(hdr[:], t.base+int64(off)); err != nil {
+		return nil, 0, fmt.Errorf("read IFD: %w", err)
+	}
+	count := int(t.order.Uint16(hdr[:]))
+	if count > maxIFDEntries {
+		return nil, 0, fmt.Errorf("IFD with %d entries", count)
+	}
+	buf := make([]byte, count*12+4)
+	n, err := t.r.ReadAt(buf, t.base+int64(off)+2)
+	if n < count*12 {
+		return nil, 0, fmt.Errorf("read IFD: %w", err)
+	}
+	var next uint32
+	if n == len(buf) {
+		next = t.order.Uint32(buf[count*12:])
+	}
+
+	entries := make([]tiffEntry, 0, count)
+	for i := 0; i < count; i++ {
+		e := buf[i*12 : i*12+12]
+		ent := tiffEntry{tag: t.order.Uint16(e), typ: t.order.Uint16(e[2:]), count: t.order.Uint32(e[4:])}
+		if int(ent.typ) >= len(tiffTypeSizes) || tiffTypeSizes[ent.typ] == 0 {
+			continue
+		}
+		size := int64(tiffTypeSizes[ent.typ]) * int64(ent.count)
+		switch {
+		case size > maxValueBytes:
+			continue
+		case size <= 4:
+			ent.value = e[8 : 8+size]
+		default:
+			ent.value = make([]byte, size)
+			if _, err := t.r.ReadAt(ent.value, t.base+int64(t.order.Uint32(e[8:]))); err != nil {
+				continue
+			}
+		}
+		entries = append(entries, ent)
+	}
+	return entries, next, nil
+}
+
+// ascii returns an ASCII value without padding, as exiftool prints it.
+func (t *tiffReader) ascii(e tiffEntry) string {
+	s := string(e.value)
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// uints returns an integer value: BYTE, SHORT, LONG or IFD.
+func (t *tiffReader) uints(e tiffEntry) []uint32 {
+	var out []uint32
+	for i := 0; i < int(e.count); i++ {
+		switch e.typ {
+		case 1, 7:
+			out = append(out, uint32(e.value[i]))
+		case 3:
+			out = append(out, uint32(t.order.Uint16(e.value[i*2:])))
+		case 4, 13:
+			out = append(out, t.order.Uint32(e.value[i*4:]))
+		default:
+			return nil
+		}
+	}
+	return out
+}
+
+// rationals returns a RATIONAL value as floats.
+func (t *tiffReader) rationals(e tiffEntry) []float64 {
+	if e.typ != 5 && e.typ != 10 {
+		return nil
+	}
+	out := make([]float64, e.count)
+	for i := range out {
+		num, den := t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		if e.typ == 10 {
+			out[i] = float64(int32(num)) / float64(int32(den))
+		} else {
+			out[i] = float64(num) / float64(den)
+		}
+	}
+	return out
+}
+
+// first returns the first integer of an entry, if any.
+func (t *tiffReader) first(e tiffEntry) (uint32, bool) {
+	v := t.uints(e)
+	if len(v) == 0 {
+		return 0, false
+	}
+	return v[0], true
+}
+
+// readTIFFFields reads a TIFF structure at base into exiftool-named
+// fields: Make, Model, ImageWidth/ImageHeight of the largest image,
+// DateTimeOriginal and ExifImageWidth/Height from the EXIF IFD, and the
+// GPS position.
+func readTIFFFields(r io.ReaderAt, base int64, fields map[string]interface{}) error {
+	t, ifd0, err := newTIFFReader(r, base)
+	if err != nil {
+		return err
+	}
+
+	var exifOff, gpsOff uint32
+	var subIFDs []uint32
+	width, height := 0, 0
+	seen := make(map[uint32]bool)
+	next := ifd0
+	for n := 0; next != 0 && n < maxIFDs && !seen[next]; n++ {
+		seen[next] = true
+		entries, nextIFD, err := t.readIFD(next)
+		if err != nil {
+			if n == 0 {
+				return err
+			}
+			break
+		}
+		w, h := t.readImageIFD(entries, fields, n == 0)
+		if w*h > width*height {
+			width, height = w, h
+		}
+		for _, e := range entries {
+			switch e.tag {
+			case tagExifIFD:
+				if v, ok := t.first(e); ok && exifOff == 0 {
+					exifOff = v
+				}
+			case tagGPSIFD:
+				if v, ok := t.first(e); ok && gpsOff == 0 {
+					gpsOff = v
+				}
+			case tagSubIFDs:
+				subIFDs = append(subIFDs, t.uints(e)...)
+			}
+		}
+		next = nextIFD
+	}
+	// RAW files keep the full-size image in a SubIFD.
+	for i, off := range subIFDs {
+		if i >= maxIFDs || seen[off] {
+			break
+		}
+		entries, _, err := t.readIFD(off)
+		if err != nil {
+			continue
+		}
+		if w, h := t.readImageIFD(entries, nil, false); w*h > width*height {
+			width, height = w, h
+		}
+	}
+	if width > 0 && height > 0 {
+		fields["ImageWidth"], fields["ImageHeight"] = width, height
+	}
+
+	if exifOff != 0 {
+		if entries, _, err := t.readIFD(exifOff); err == nil {
+			t.readExifIFD(entries, fields)
+		}
+	}
+	if gpsOff != 0 {
+		if entries, _, err := t.readIFD(gpsOff); err == nil {
+			t.readGPSIFD(entries, fields)
+		}
+	}
+	return nil
+}
+
+// readImageIFD returns the dimensions of an IFD's full-resolution image
+// (0 for reduced-resolution ones) and, with camera set, copies Make,
+// Model, Software and Orientation, and the edit history of the XMP
+// packet, into fields.
+func (t *tiffReader) readImageIFD(entries []tiffEntry, fields map[string]interface{}, camera bool) (int, int) {
+	var w, h uint32
+	reduced := false
+	for _, e := range entries {
+		switch e.tag {
+		case tagImageWidth:
+			w, _ = t.first(e)
+		case tagImageHeight:
+			h, _ = t.first(e)
+		case tagNewSubfileType:
+			v, _ := t.first(e)
+			reduced = v&1 != 0
+		case tagMake, tagModel, tagSoftware:
+			if camera && e.typ == 2 {
+				name := map[uint16]string{tagMake: "Make", tagModel: "Model", tagSoftware: "Software"}[e.tag]
+				if s := t.ascii(e); s != "" {
+					fields[name] = s
+				}
+			}
+		case tagXMP:
+			if camera {
+				readXMP(e.value, fields)
+			}
+		case tagOrientation:
+			if v, ok := t.first(e); camera && ok && v >= 1 && v <= 8 {
+				fields["Orientation"] = orientationNames[v]
+			}
+		}
+	}
+	if reduced {
+		return 0, 0
+	}
+	return int(w), int(h)
+}
+
+// readExifIFD copies DateTimeOriginal, the EXIF image size, the
+// exposure settings, the lens and the camera serial number.
+func (t *tiffReader) readExifIFD(entries []tiffEntry, fields map[string]interface{}) {
+	for _, e := range entries {
+		switch e.tag {
+		case tagExposureTime:
+			if v := t.rationals(e); len(v) == 1 && v[0] > 0 {
+				fields["ExposureTime"] = formatExposureTime(v[0])
+			}
+		case tagFNumber:
+			if v := t.rationals(e); len(v) == 1 && v[0] > 0 {
+				fields["FNumber"] = math.Round(v[0]*10) / 10
+			}
+		case tagISO:
+			if v, ok := t.first(e); ok {
+				fields["ISO"] = int(v)
+			}
+		case tagLensModel, tagBodySerialNumber:
+			name := "LensModel"
+			if e.tag == tagBodySerialNumber {
+				name = "SerialNumber"
+			}
+			if s := t.ascii(e); s != "" {
+				fields[name] = s
+			}
+		case tagDateTimeOriginal:
+			if s := t.ascii(e); s != "" {
+				fields["DateTimeOriginal"] = s
+			}
+		case tagExifImageWidth:
+			if v, ok := t.first(e); ok {
+				fields["ExifImageWidth"] = int(v)
+			}
+		case tagExifImageHeight:
+			if v, ok := t.first(e); ok {
+				fields["ExifImageHeight"] = int(v)
+			}
+		}
+	}
+}
+
+// readGPSIFD sets GPSLatitude, GPSLongitude and GPSAltitude as exiftool
+// prints them.
+func (t *tiffReader) readGPSIFD(entries []tiffEntry, fields map[string]interface{}) {
+	var lat, lon, alt []float64
+	latRef, lonRef := "N", "E"
+	var below bool
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			if s := t.ascii(e); s != "" {
+				latRef = s
+			}
+		case tagGPSLatitude:
+			lat = t.rationals(e)
+		case tagGPSLongitudeRef:
+			if s := t.ascii(e); s != "" {
+				lonRef = s
+			}
+		case tagGPSLongitude:
+			lon = t.rationals(e)
+		case tagGPSAltitudeRef:
+			v, ok := t.first(e)
+			below = ok && v == 1
+		case tagGPSAltitude:
+			alt = t.rationals(e)
+		}
+	}
+	if len(lat) != 3 || len(lon) != 3 {
+		return
+	}
+	fields["GPSLatitude"] = formatDMS(lat[0]+lat[1]/60+lat[2]/3600, latRef[:1])
+	fields["GPSLongitude"] = formatDMS(lon[0]+lon[1]/60+lon[2]/3600, lonRef[:1])
+	if len(alt) == 1 {
+		if below {
+			alt[0] = -alt[0]
+		}
+		setAltitude(fields, alt[0])
+	}
+}
+
+// setAltitude sets GPSAltitude and GPSAltitudeRef as exiftool prints
+// them: a distance in metres and which side of sea level it lies on.
+func setAltitude(fields map[string]interface{}, metres float64) {
+	ref := "Above Sea Level"
+	if metres < 0 {
+		metres, ref = -metres, "Below Sea Level"
+	}
+	fields["GPSAltitude"] = strconv.FormatFloat(metres, 'f', -1, 64) + " m"
+	fields["GPSAltitudeRef"] = ref
+}
+
+// formatExposureTime prints an exposure time the way exiftool does: as a
+// fraction of a second up to 1/4 s, in seconds above.
+func formatExposureTime(secs float64) string {
+	if secs <= 0.25001 {
+		return fmt.Sprintf("1/%d", int(0.5+1/secs))
+	}
+	return strconv.FormatFloat(math.Round(secs*10)/10, 'f', -1, 64)
+}
+
+// formatDMS prints decimal degrees the way exiftool prints coordinates,
+// `37 deg 46' 29.64" N`, so both extractors round alike. A negative value
+// flips ref to the other hemisphere.
+func formatDMS(deg float64, ref string) string {
+	if deg < 0 {
+		deg = -deg
+		ref = map[string]string{"N": "S", "S": "N", "E": "W", "W": "E"}[ref]
+	}
+	d := math.Floor(deg)
+	m := math.Floor((deg - d) * 60)
+	s := math.Round(((deg-d)*60-m)*60*100) / 100
+	if s >= 60 {
+		s -= 60
+		m++
+	}
+	if m >= 60 {
+		m -= 60
+		d++
+	}
+	return fmt.Sprintf("%d deg %d' %.2f\" %s", int(d), int(m), s, ref)
+}
+
+// exifHeader prefixes the TIFF block in JPEG APP1 segments and some other
+// containers.
+var exifHeader = []byte("Exif\x00\x00")
+
+// readEXIFBlock reads an in-memory EXIF block, with or without the
+// "Exif\0\0" prefix.
+func readEXIFBlock(b []byte, fields map[string]interface{}) error {
+	b = bytes.TrimPrefix(b, exifHeader)
+	return readTIFFFields(bytes.NewReader(b), 0, fields)
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// xmpHeader starts a JPEG APP1 segment holding an XMP packet.
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// xmpPNGKeyword is the keyword of the PNG iTXt chunk holding XMP.
+const xmpPNGKeyword = "XML:com.adobe.xmp"
+
+const (
+	nsXMPMM = "http://ns.adobe.com/xap/1.0/mm/"
+	nsStEvt = "http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+	nsStRef = "http://ns.adobe.com/xap/1.0/sType/ResourceRef#"
+)
+
+// derivedFromFields maps the xmpMM:DerivedFrom properties to the names
+// exiftool gives them.
+var derivedFromFields = map[string]string{
+	"documentID":         "DerivedFromDocumentID",
+	"instanceID":         "DerivedFromInstanceID",
+	"originalDocumentID": "DerivedFromOriginalDocumentID",
+}
+
+// readXMP copies the edit history of an XMP packet into fields: the
+// software agents of xmpMM:History as HistorySoftwareAgent, a list when
+// there are several as in exiftool's JSON, and the xmpMM:DerivedFrom
+// references. Properties may be written as attributes or as elements. A
+// packet that does not parse yields what was read up to the error.
+func readXMP(packet []byte, fields map[string]interface{}) {
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	var agents []interface{}
+	// derived is the element depth inside xmpMM:DerivedFrom, 0 outside.
+	derived := 0
+	// field is the property whose element text is being read.
+	var field string
+	var text strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if derived > 0 {
+				derived++
+			} else if tok.Name.Space == nsXMPMM && tok.Name.Local == "DerivedFrom" {
+				derived = 1
+			}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == nsStEvt && a.Name.Local == "softwareAgent":
+					agents = append(agents, a.Value)
+				case a.Name.Space == nsStRef && derived > 0 && derivedFromFields[a.Name.Local] != "":
+					fields[derivedFromFields[a.Name.Local]] = a.Value
+				}
+			}
+			field = ""
+			switch {
+			case tok.Name.Space == nsStEvt && tok.Name.Local == "softwareAgent":
+				field = "HistorySoftwareAgent"
+			case tok.Name.Space == nsStRef && derived > 0:
+				field = derivedFromFields[tok.Name.Local]
+			}
+			text.Reset()
+		case xml.CharData:
+			if field != "" {
+				text.Write(tok)
+			}
+		case xml.EndElement:
+			if v := strings.TrimSpace(text.String()); field != "" && v != "" {
+				if field == "HistorySoftwareAgent" {
+					agents = append(agents, v)
+				} else {
+					fields[field] = v
+				}
+			}
+			field = ""
+			if derived > 0 {
+				derived--
+			}
+		}
+	}
+
+	switch len(agents) {
+	case 0:
+	case 1:
+		fields["HistorySoftwareAgent"] = agents[0]
+	default:
+		fields["HistorySoftwareAgent"] = agents
+	}
+}
+
+// readXMPChunk reads the XMP of a PNG iTXt chunk: the keyword, the
+// compression flag and method, the language tag and translated keyword,
+// then the text. Compressed XMP is left to exiftool.
+func readXMPChunk(data []byte, fields map[string]interface{}) {
+	keyword, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || string(keyword) != xmpPNGKeyword || len(rest) < 2 || rest[0] != 0 {
+		return
+	}
+	_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+	if !ok {
+		return
+	}
+	_, text, ok := bytes.Cut(rest, []byte{0})
+	if ok {
+		readXMP(text, fields)
+	}
+}
@@ -0,0 +1,116 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testXMP is the XMP a Lightroom export carries: its history as
+// attributes and the reference to the original as elements.
+const testXMP = `<?xpacket begin="" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+    xmlns:stRef="http://ns.adobe.com/xap/1.0/sType/ResourceRef#">
+   <xmpMM:History>
+    <rdf:Seq>
+     <rdf:li stEvt:action="derived" stEvt:softwareAgent="Adobe Photoshop Lightroom Classic 13.0 (Macintosh)"/>
+     <rdf:li rdf:parseType="Resource">
+      <stEvt:action>saved</stEvt:action>
+      <stEvt:softwareAgent>Adobe Photoshop 25.0 (Macintosh)</stEvt:softwareAgent>
+     </rdf:li>
+    </rdf:Seq>
+   </xmpMM:History>
+   <xmpMM:DerivedFrom rdf:parseType="Resource">
+    <stRef:instanceID>xmp.iid:5f1c</stRef:instanceID>
+    <stRef:documentID>xmp.did:9a2b</stRef:documentID>
+   </xmpMM:DerivedFrom>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+
+func TestReadXMP(t *testing.T) {
+	fields := make(map[string]interface{})
+	readXMP([]byte(testXMP), fields)
+	assert.Equal(t, map[string]interface{}{
+		"HistorySoftwareAgent": []interface{}{
+			"Adobe Photoshop Lightroom Classic 13.0 (Macintosh)",
+			"Adobe Photoshop 25.0 (Macintosh)",
+		},
+		"DerivedFromInstanceID": "xmp.iid:5f1c",
+		"DerivedFromDocumentID": "xmp.did:9a2b",
+	}, fields)
+
+	// The attribute form of DerivedFrom, and a single history entry.
+	fields = make(map[string]interface{})
+	readXMP([]byte(`<rdf:Description xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmlns:stEvt="http://ns.adobe.com/xap/1.0/sType/ResourceEvent#"
+    xmlns:stRef="http://ns.adobe.com/xap/1.0/sType/ResourceRef#">
+   <xmpMM:History><rdf:Seq><rdf:li stEvt:softwareAgent="GIMP 2.10"/></rdf:Seq></xmpMM:History>
+   <xmpMM:DerivedFrom stRef:originalDocumentID="ABC123"/>
+   <stRef:documentID>outside DerivedFrom</stRef:documentID>
+  </rdf:Description>`), fields)
+	assert.Equal(t, map[string]interface{}{
+		"HistorySoftwareAgent":          "GIMP 2.10",
+		"DerivedFromOriginalDocumentID": "ABC123",
+	}, fields)
+
+	// A broken packet keeps what was read before the error.
+	fields = make(map[string]interface{})
+	readXMP([]byte(testXMP[:strings.Index(testXMP, "<stEvt:action>")]), fields)
+	assert.Equal(t, "Adobe Photoshop Lightroom Classic 13.0 (Macintosh)", fields["HistorySoftwareAgent"])
+}
+
+func TestNativeExtractorReadsXMP(t *testing.T) {
+	dir := t.TempDir()
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	// JPEG: an XMP APP1 segment after the EXIF one.
+	jpg := testJPEG(t, testEXIF(binary.BigEndian))
+	exifLen := int(binary.BigEndian.Uint16(jpg[4:6]))
+	seg := append(append([]byte{}, xmpHeader...), testXMP...)
+	var app1 bytes.Buffer
+	app1.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&app1, binary.BigEndian, uint16(len(seg)+2))
+	app1.Write(seg)
+	at := 4 + exifLen
+	jpg = append(append(append([]byte{}, jpg[:at]...), app1.Bytes()...), jpg[at:]...)
+
+	// PNG: an uncompressed iTXt chunk before IEND.
+	pngData := testPNG(t, testEXIF(binary.BigEndian))
+	text := append([]byte(xmpPNGKeyword+"\x00\x00\x00\x00\x00"), testXMP...)
+	var chunk bytes.Buffer
+	_ = binary.Write(&chunk, binary.BigEndian, uint32(len(text)))
+	chunk.WriteString("iTXt")
+	chunk.Write(text)
+	_ = binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("iTXt"), text...)))
+	iend := len(pngData) - 12
+	pngData = append(append(append([]byte{}, pngData[:iend]...), chunk.Bytes()...), pngData[iend:]...)
+
+	for name, data := range map[string][]byte{"export.jpg": jpg, "export.png": pngData} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, data, 0o644))
+		md, err := NewNativeExtractor().Extract(p, hasher)
+		require.NoError(t, err, name)
+		assert.Equal(t, "iPhone 15 Pro", md.Model, name)
+		assert.Equal(t, []string{
+			"Adobe Photoshop Lightroom Classic 13.0 (Macintosh)",
+			"Adobe Photoshop 25.0 (Macintosh)",
+		}, md.HistorySoftware, name)
+		assert.Equal(t, "xmp.did:9a2b", md.DerivedFrom, name)
+	}
+}
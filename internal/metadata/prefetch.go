@@ -0,0 +1,148 @@
+package metadata
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+)
+
+// prefetchBatch is how many files a FieldReader reads per call.
+const prefetchBatch = 64
+
+// extraction is the outcome of extracting one file's metadata.
+type extraction struct {
+	md  *FileMetadata
+	err error
+}
+
+// Prefetch extracts the metadata of a list of files ahead of its
+// consumer. With a FieldReader, files are hashed in batches and hashing a
+// batch overlaps with reading the fields of the one before, mostly from
+// the heads kept while hashing; other
+// extractors run one file at a time in the background.
+type Prefetch struct {
+	results chan extraction
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewPrefetch starts extracting the metadata of paths, in order.
+func NewPrefetch(ext FileExtractor, paths []string, hasher *defaults.Hasher) *Prefetch {
+	p := &Prefetch{
+		results: make(chan extraction, prefetchBatch),
+		done:    make(chan struct{}),
+	}
+	if fr, ok := ext.(FieldReader); ok {
+		batches := make(chan hashedBatch, 1)
+		p.wg.Add(2)
+		go p.hashBatches(paths, hasher, counterOf(ext), batches)
+		go p.readBatches(fr, batches)
+	} else {
+		p.wg.Add(1)
+		go p.extractEach(ext, paths, hasher)
+	}
+	return p
+}
+
+// Next returns the metadata of the next file, in the order of the paths
+// given to NewPrefetch. It must be called at most once per path.
+func (p *Prefetch) Next() (*FileMetadata, error) {
+	r := <-p.results
+	return r.md, r.err
+}
+
+// Close stops the prefetch and waits for it, so the extractor is free
+// once Close returns. It is safe to call before every file was consumed.
+func (p *Prefetch) Close() {
+	close(p.done)
+	p.wg.Wait()
+}
+
+// send hands r to the consumer, reporting false once Close was called.
+func (p *Prefetch) send(r extraction) bool {
+	select {
+	case p.results <- r:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// hashedBatch is a batch of files with their hashes, or the errors that
+// kept them from being hashed.
+type hashedBatch struct {
+	files  []HashedFile
+	shorts []string
+	errs   []error
+}
+
+func (p *Prefetch) hashBatches(paths []string, hasher *defaults.Hasher, c *IOCounter, out chan<- hashedBatch) {
+	defer p.wg.Done()
+	defer close(out)
+	for start := 0; start < len(paths); start += prefetchBatch {
+		batch := paths[start:min(start+prefetchBatch, len(paths))]
+		b := hashedBatch{
+			files:  make([]HashedFile, len(batch)),
+			shorts: make([]string, len(batch)),
+			errs:   make([]error, len(batch)),
+		}
+		for i, path := range batch {
+			f, short, err := hashFile(path, hasher, c)
+			if err != nil {
+				err = fmt.Errorf("compute hash: %w", err)
+			}
+			b.files[i] = f
+			b.shorts[i], b.errs[i] = short, err
+		}
+		select {
+		case out <- b:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *Prefetch) readBatches(fr FieldReader, in <-chan hashedBatch) {
+	defer p.wg.Done()
+	for b := range in {
+		var hashed []HashedFile
+		for i, f := range b.files {
+			if b.errs[i] == nil {
+				hashed = append(hashed, f)
+			}
+		}
+		var fields []map[string]interface{}
+		var errs []error
+		if len(hashed) > 0 {
+			fields, errs = fr.ReadFields(hashed)
+		}
+
+		j := 0
+		for i, f := range b.files {
+			r := extraction{err: b.errs[i]}
+			if r.err == nil {
+				if errs[j] != nil {
+					r.err = errs[j]
+				} else {
+					r.md = buildFileMetadata(f.Path, fields[j], f.FullHash, b.shorts[i])
+				}
+				j++
+			}
+			if !p.send(r) {
+				return
+			}
+		}
+	}
+}
+
+func (p *Prefetch) extractEach(ext FileExtractor, paths []string, hasher *defaults.Hasher) {
+	defer p.wg.Done()
+	for _, path := range paths {
+		var r extraction
+		r.md, r.err = ext.Extract(path, hasher)
+		if !p.send(r) {
+			return
+		}
+	}
+}
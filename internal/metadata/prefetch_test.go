@@ -0,0 +1,204 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchReader is a FieldReader that records the size of each batch and
+// fails files named "bad*".
+type batchReader struct {
+	batches []int
+}
+
+func (r *batchReader) Extract(path string, hasher *defaults.Hasher) (*FileMetadata, error) {
+	return nil, errors.New("Extract called on a FieldReader")
+}
+
+func (r *batchReader) Version() string { return "batch 1" }
+
+func (r *batchReader) ReadFields(files []HashedFile) ([]map[string]interface{}, []error) {
+	r.batches = append(r.batches, len(files))
+	fields := make([]map[string]interface{}, len(files))
+	errs := make([]error, len(files))
+	for i, f := range files {
+		if f.FullHash == "" {
+			errs[i] = errors.New("file not hashed")
+			continue
+		}
+		p := f.Path
+		if strings.HasPrefix(filepath.Base(p), "bad") {
+			errs[i] = errors.New("unreadable")
+			continue
+		}
+		fields[i] = map[string]interface{}{"MIMEType": "image/jpeg", "Make": filepath.Base(p)}
+	}
+	return fields, errs
+}
+
+func writeCorpus(t testing.TB, n int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("f%04d.jpg", i))
+		require.NoError(t, os.WriteFile(paths[i], []byte(paths[i]), 0o644))
+	}
+	return paths
+}
+
+func TestPrefetchBatchesInOrder(t *testing.T) {
+	paths := writeCorpus(t, prefetchBatch+10)
+	bad := filepath.Join(filepath.Dir(paths[0]), "bad.jpg")
+	require.NoError(t, os.WriteFile(bad, nil, 0o644))
+	paths[3] = bad
+	missing := filepath.Join(filepath.Dir(paths[0]), "missing.jpg")
+	paths[5] = missing
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	r := &batchReader{}
+	pf := NewPrefetch(r, paths, hasher)
+	for i, p := range paths {
+		md, err := pf.Next()
+		if p == bad {
+			assert.EqualError(t, err, "unreadable")
+			continue
+		}
+		if p == missing {
+			assert.ErrorIs(t, err, os.ErrNotExist)
+			continue
+		}
+		require.NoError(t, err, i)
+		assert.Equal(t, p, md.Path)
+		assert.Equal(t, defaults.NormalizeMake(filepath.Base(p)), md.Make)
+		assert.NotEmpty(t, md.FullHash)
+	}
+	pf.Close()
+	// The file that could not be hashed is not read.
+	assert.Equal(t, []int{prefetchBatch - 1, 10}, r.batches)
+}
+
+// singleExtractor hides everything but Extract.
+type singleExtractor struct{ FileExtractor }
+
+func TestPrefetchSingleFileExtractor(t *testing.T) {
+	paths := writeFixtures(t)
+	names := []string{"photo.jpg", "notes.txt", "clip.mov"}
+	var list []string
+	for _, n := range names {
+		list = append(list, paths[n])
+	}
+	list = append(list, filepath.Join(t.TempDir(), "missing.jpg"))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	pf := NewPrefetch(singleExtractor{NewNativeExtractor()}, list, hasher)
+	defer pf.Close()
+	for _, p := range list[:3] {
+		md, err := pf.Next()
+		require.NoError(t, err)
+		assert.Equal(t, p, md.Path)
+	}
+	_, err = pf.Next()
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestPrefetchCloseEarly(t *testing.T) {
+	paths := writeCorpus(t, 5*prefetchBatch)
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	r := &batchReader{}
+	pf := NewPrefetch(r, paths, hasher)
+	_, err = pf.Next()
+	require.NoError(t, err)
+	pf.Close()
+	// Reading stops within a batch or two of the consumer.
+	assert.Less(t, len(r.batches), 5)
+}
+
+// BenchmarkExtract compares extracting a corpus of small JPEGs one file
+// at a time, with every tag, against prefetching the used tags in
+// batches. The exiftool cases are skipped when it is not installed.
+func BenchmarkExtract(b *testing.B) {
+	data := testJPEG(b, testEXIF(binary.LittleEndian))
+	dir := b.TempDir()
+	paths := make([]string, 500)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("IMG_%04d.jpg", i))
+		require.NoError(b, os.WriteFile(paths[i], data, 0o644))
+	}
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(b, err)
+
+	exiftool := func(b *testing.B) *ExifExtractor {
+		ext, err := NewExifExtractor()
+		if err != nil {
+			b.Skipf("exiftool not available: %v", err)
+		}
+		b.Cleanup(func() { _ = ext.Close() })
+		return ext
+	}
+	prefetch := func(b *testing.B, ext FileExtractor) {
+		for b.Loop() {
+			pf := NewPrefetch(ext, paths, hasher)
+			for range paths {
+				if _, err := pf.Next(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			pf.Close()
+		}
+	}
+
+	b.Run("exiftool/per-file-all-tags", func(b *testing.B) {
+		ext := exiftool(b)
+		for b.Loop() {
+			for _, p := range paths {
+				fields, errs := ext.et.readFields([]string{p}, nil)
+				if errs[0] != nil {
+					b.Fatal(errs[0])
+				}
+				if _, err := BuildFileMetadata(p, fields[0], hasher); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("exiftool/per-file", func(b *testing.B) {
+		ext := exiftool(b)
+		for b.Loop() {
+			for _, p := range paths {
+				if _, err := ext.Extract(p, hasher); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("exiftool/prefetch", func(b *testing.B) {
+		prefetch(b, exiftool(b))
+	})
+	b.Run("native/per-file", func(b *testing.B) {
+		ext := NewNativeExtractor()
+		for b.Loop() {
+			for _, p := range paths {
+				if _, err := ext.Extract(p, hasher); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("native/prefetch", func(b *testing.B) {
+		prefetch(b, NewNativeExtractor())
+	})
+}
@@ -0,0 +1,219 @@
+package metadata
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+)
+
+// headSize is how much of the start of a file hashFile keeps for the
+// metadata readers. It holds the EXIF block of a JPEG, HEIC or RAW file
+// and the moov box of a movie written for streaming.
+const headSize = 256 << 10
+
+// IOStats is the number of files opened and bytes read from them.
+type IOStats struct {
+	Opens int64
+	Bytes int64
+}
+
+// IOCounter counts the files an extractor opens and the bytes it reads
+// from them; tests use it to check how often a file is read. A nil
+// *IOCounter counts nothing.
+type IOCounter struct {
+	opens, bytes atomic.Int64
+}
+
+// Stats returns the I/O counted so far.
+func (c *IOCounter) Stats() IOStats {
+	if c == nil {
+		return IOStats{}
+	}
+	return IOStats{Opens: c.opens.Load(), Bytes: c.bytes.Load()}
+}
+
+// ioCounted is implemented by the extractors that take an IOCounter.
+type ioCounted interface {
+	ioCounter() *IOCounter
+}
+
+// counterOf returns x's IOCounter, or nil.
+func counterOf(x any) *IOCounter {
+	if ic, ok := x.(ioCounted); ok {
+		return ic.ioCounter()
+	}
+	return nil
+}
+
+// countedFile is a file whose reads are counted by an IOCounter. It
+// wraps rather than embeds *os.File so that io.Copy cannot go around
+// Read.
+type countedFile struct {
+	f *os.File
+	c *IOCounter
+}
+
+// open opens the file at path, counting the open and every read.
+func (c *IOCounter) open(path string) (*countedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		c.opens.Add(1)
+	}
+	return &countedFile{f: f, c: c}, nil
+}
+
+func (c *countedFile) count(n int) {
+	if c.c != nil {
+		c.c.bytes.Add(int64(n))
+	}
+}
+
+func (c *countedFile) Read(p []byte) (int, error) {
+	n, err := c.f.Read(p)
+	c.count(n)
+	return n, err
+}
+
+func (c *countedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.f.ReadAt(p, off)
+	c.count(n)
+	return n, err
+}
+
+func (c *countedFile) Stat() (os.FileInfo, error) { return c.f.Stat() }
+
+func (c *countedFile) Close() error { return c.f.Close() }
+
+// hashFile reads the file at path once, hashing it and keeping its first
+// headSize bytes in the result's Head, and returns its short hash too.
+func hashFile(path string, hasher *defaults.Hasher, c *IOCounter) (HashedFile, string, error) {
+	f, err := c.open(path)
+	if err != nil {
+		return HashedFile{}, "", fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := hasher.New()
+	head := make([]byte, headSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return HashedFile{}, "", fmt.Errorf("hash file: %w", err)
+	}
+	head = head[:n]
+	h.Write(head)
+	size := int64(n)
+	if n == headSize {
+		rest, err := io.Copy(h, f)
+		if err != nil {
+			return HashedFile{}, "", fmt.Errorf("hash file: %w", err)
+		}
+		size += rest
+	}
+
+	full := hex.EncodeToString(h.Sum(nil))
+	short, err := shortHash(full, hasher)
+	if err != nil {
+		return HashedFile{}, "", err
+	}
+	return HashedFile{Path: path, HashAlgo: hasher.Algo(), FullHash: full, Size: size, Head: head}, short, nil
+}
+
+// extractOnce builds the metadata of the file at path from a single read:
+// hashFile hashes it and keeps its head, and fr reads the fields from the
+// head, going back to the file only for what lies past it.
+func extractOnce(fr FieldReader, path string, hasher *defaults.Hasher) (*FileMetadata, error) {
+	f, short, err := hashFile(path, hasher, counterOf(fr))
+	if err != nil {
+		return nil, fmt.Errorf("compute hash: %w", err)
+	}
+	fields, errs := fr.ReadFields([]HashedFile{f})
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+	return buildFileMetadata(path, fields[0], f.FullHash, short), nil
+}
+
+// errPastHead is what a headOnly headReader returns for bytes past the
+// head.
+var errPastHead = errors.New("read past the head")
+
+// headReader is an io.ReaderAt over a HashedFile that serves its Head
+// from memory and opens the file only for bytes past it. With headOnly
+// it never opens the file; pastHead records whether anything past the
+// head was asked for either way.
+type headReader struct {
+	f        HashedFile
+	headOnly bool
+	pastHead bool
+	counter  *IOCounter
+	file     *countedFile
+}
+
+func (r *headReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	head := int64(len(r.f.Head))
+	n := 0
+	if off < head {
+		n = copy(p, r.f.Head[off:])
+		if n == len(p) {
+			return n, nil
+		}
+	}
+	if head >= r.f.Size {
+		return n, io.EOF
+	}
+
+	r.pastHead = true
+	if r.headOnly {
+		return n, errPastHead
+	}
+	if r.file == nil {
+		file, err := r.counter.open(r.f.Path)
+		if err != nil {
+			return n, err
+		}
+		r.file = file
+	}
+	m, err := r.file.ReadAt(p[n:], off+int64(n))
+	return n + m, err
+}
+
+func (r *headReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
+
+// headSuffices reports whether f's Head holds all the metadata in the
+// file: either the head is the whole file, or the native reader for its
+// format, which looks at the same structures exiftool does for the used
+// tags, found everything it looks for in the head. Formats with no
+// native reader are assumed to need the whole file.
+func headSuffices(f HashedFile) bool {
+	if f.Head == nil {
+		return false
+	}
+	if int64(len(f.Head)) >= f.Size {
+		return true
+	}
+	format := sniff(f.Head[:min(len(f.Head), sniffLen)], strings.ToLower(filepath.Ext(f.Path)))
+	if format.read == nil {
+		return false
+	}
+	r := &headReader{f: f, headOnly: true}
+	_ = format.read(r, f.Size, make(map[string]interface{}))
+	return !r.pastHead
+}
@@ -0,0 +1,146 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSingleReadFixtures writes a JPEG whose EXIF is in the head but
+// which runs past it, and a movie whose moov box comes after an mdat
+// larger than the head.
+func writeSingleReadFixtures(t *testing.T) (jpg, mov string) {
+	t.Helper()
+	dir := t.TempDir()
+	jpg = filepath.Join(dir, "photo.jpg")
+	data := append(testJPEG(t, testEXIF(binary.BigEndian)), make([]byte, headSize)...)
+	require.NoError(t, os.WriteFile(jpg, data, 0o644))
+
+	m := testMOV()
+	moovAt := bytes.Index(m, []byte("moov")) - 4
+	ftyp, moov := m[:moovAt], m[moovAt:]
+	mov = filepath.Join(dir, "clip.mov")
+	data = append(append(append([]byte{}, ftyp...), mkbox("mdat", make([]byte, headSize))...), moov...)
+	require.NoError(t, os.WriteFile(mov, data, 0o644))
+	return jpg, mov
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Size()
+}
+
+func TestExtractReadsFileOnce(t *testing.T) {
+	jpg, mov := writeSingleReadFixtures(t)
+	hasher, err := defaults.NewHasher("sha256")
+	require.NoError(t, err)
+	full, _, err := ComputeFileHash(jpg, hasher)
+	require.NoError(t, err)
+
+	c := &IOCounter{}
+	md, err := (&NativeExtractor{Counter: c}).Extract(jpg, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, IOStats{Opens: 1, Bytes: fileSize(t, jpg)}, c.Stats())
+	assert.Equal(t, full, md.FullHash)
+	assert.Equal(t, "Apple", md.Make)
+
+	// The moov box lies past the head, so the reader goes back for it,
+	// but only for the bytes it needs.
+	c = &IOCounter{}
+	md, err = (&NativeExtractor{Counter: c}).Extract(mov, hasher)
+	require.NoError(t, err)
+	got := c.Stats()
+	assert.Equal(t, int64(2), got.Opens)
+	assert.Less(t, got.Bytes, fileSize(t, mov)+headSize)
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, 2024, md.DateTime.Year())
+
+	// A cache miss costs no more.
+	cache, err := LoadCache(filepath.Join(t.TempDir(), "metadata.jsonl"), DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	c = &IOCounter{}
+	ce := NewCachingExtractor(&NativeExtractor{Counter: c}, cache)
+	_, err = ce.Extract(jpg, hasher)
+	require.NoError(t, err)
+	assert.Equal(t, IOStats{Opens: 1, Bytes: fileSize(t, jpg)}, c.Stats())
+}
+
+func TestPrefetchReadsFilesOnce(t *testing.T) {
+	paths := writeCorpus(t, prefetchBatch+10)
+	var total int64
+	for i, p := range paths {
+		// Every file a JPEG, so the native reader has something to read.
+		data := append(testJPEG(t, testEXIF(binary.LittleEndian)), make([]byte, i*1000)...)
+		require.NoError(t, os.WriteFile(p, data, 0o644))
+		total += int64(len(data))
+	}
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	c := &IOCounter{}
+	pf := NewPrefetch(&NativeExtractor{Counter: c}, paths, hasher)
+	for range paths {
+		md, err := pf.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "Apple", md.Make)
+	}
+	pf.Close()
+	assert.Equal(t, IOStats{Opens: int64(len(paths)), Bytes: total}, c.Stats())
+}
+
+func TestExifExtractorReadsHeads(t *testing.T) {
+	log := useFakeExiftool(t)
+	jpg, mov := writeSingleReadFixtures(t)
+	small := filepath.Join(filepath.Dir(jpg), "small.bin")
+	require.NoError(t, os.WriteFile(small, []byte("no known format"), 0o644))
+	hasher, err := defaults.NewHasher("md5")
+	require.NoError(t, err)
+
+	ext, err := NewExifExtractor()
+	require.NoError(t, err)
+	c := &IOCounter{}
+	ext.Counter = c
+	pf := NewPrefetch(ext, []string{jpg, mov, small}, hasher)
+	for _, p := range []string{jpg, mov, small} {
+		md, err := pf.Next()
+		require.NoError(t, err)
+		assert.Equal(t, p, md.Path)
+	}
+	pf.Close()
+	// The probe for the movie's moov box stops at the head.
+	assert.Equal(t, IOStats{Opens: 3, Bytes: fileSize(t, jpg) + fileSize(t, mov) + fileSize(t, small)}, c.Stats())
+
+	// exiftool reads the JPEG and the small file from pipes serving their
+	// heads, which are gone once it is done, and the movie itself. The
+	// small file's pipe is never opened, which must not hold anything up.
+	var given, piped []string
+	for _, l := range readLog(t, log) {
+		switch {
+		case strings.HasPrefix(l, "piped "):
+			piped = append(piped, strings.TrimPrefix(l, "piped "))
+		case !strings.HasPrefix(l, "-") && l != "True":
+			given = append(given, l)
+		}
+	}
+	require.Len(t, given, 3)
+	assert.NotEqual(t, jpg, given[0])
+	assert.Equal(t, ".jpg", filepath.Ext(given[0]))
+	assert.NoFileExists(t, given[0])
+	assert.Equal(t, []string{fmt.Sprint(headSize)}, piped)
+	assert.Equal(t, mov, given[1])
+	assert.NotEqual(t, small, given[2])
+	assert.NoFileExists(t, given[2])
+
+	require.NoError(t, ext.Close())
+	assert.NoDirExists(t, filepath.Dir(given[0]))
+}
@@ -4,27 +4,112 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/metadata"
 )
 
 // Options controls path building behavior.
 type Options struct {
 	SeparateVideo bool
+	// Owners maps camera serial numbers to owner labels. Files from a
+	// mapped camera get the label in their device dir, which tells apart
+	// identical devices. Serial numbers match ignoring case.
+	Owners map[string]string
+	// Derived tells edited exports from camera originals and decides
+	// whether BuildPath puts them in processed/.
+	Derived library.DerivedRules
+}
+
+// BuildPath returns the library path of a file and, for an edited export,
+// why it counts as one (see Derived). Edited exports go to
+// BuildProcessedPath unless opts.Derived keeps them in sources/;
+// everything else goes to BuildSourcePath.
+func BuildPath(fm *metadata.FileMetadata, opts Options) (relPath, derived string) {
+	derived = Derived(fm, opts.Derived)
+	if derived != "" && opts.Derived.Mode() == library.DerivedToProcessed {
+		return BuildProcessedPath(fm, opts), derived
+	}
+	return BuildSourcePath(fm, opts), derived
 }
 
 // BuildSourcePath computes the full relative path for a source file.
 // Format: <year>/sources/<device dir>/<date>/<datetime_hash.ext>
 func BuildSourcePath(fm *metadata.FileMetadata, opts Options) string {
+	return buildPath(fm, opts, "sources")
+}
+
+// BuildProcessedPath computes the path of an edited export: that of its
+// original, under processed/ instead of sources/.
+// Format: <year>/processed/<device dir>/<date>/<datetime_hash.ext>
+func BuildProcessedPath(fm *metadata.FileMetadata, opts Options) string {
+	return buildPath(fm, opts, "processed")
+}
+
+func buildPath(fm *metadata.FileMetadata, opts Options, area string) string {
 	year := fm.DateTime.Format("2006")
 	mt := effectiveMediaType(fm.MediaType, opts)
-	device := DeviceDir(fm.Make, fm.Model, mt)
+	device := DeviceDir(fm.Make, fm.Model, opts.owner(fm.SerialNumber), mt)
 	dateDir := fm.DateTime.Format("2006-01-02")
 	filename := BuildSourceFilename(fm.DateTime, fm.ShortHash, fm.Extension)
 
-	return filepath.ToSlash(filepath.Join(year, "sources", device, dateDir, filename))
+	return filepath.ToSlash(filepath.Join(year, area, device, dateDir, filename))
+}
+
+// Derived returns why fm looks like an edited export rather than a camera
+// original under rules, such as "edited with Snapseed 2.0" or "derived
+// from xmp.did:...", or "" for an original. The Software tag is checked
+// before the XMP history, and the DerivedFrom reference last.
+func Derived(fm *metadata.FileMetadata, rules library.DerivedRules) string {
+	if rules.Mode() == library.DerivedOff {
+		return ""
+	}
+	patterns := rules.Software
+	if patterns == nil {
+		patterns = defaults.EditingSoftware
+	}
+	for _, sw := range append([]string{fm.Software}, fm.HistorySoftware...) {
+		for _, p := range patterns {
+			if containsWord(sw, p) {
+				return "edited with " + sw
+			}
+		}
+	}
+	if fm.DerivedFrom != "" && !rules.IgnoreDerivedFrom {
+		return "derived from " + fm.DerivedFrom
+	}
+	return ""
+}
+
+// containsWord reports whether word appears in s, ignoring case, with no
+// letter or digit right before or after it.
+func containsWord(s, word string) bool {
+	s, word = strings.ToLower(s), strings.ToLower(word)
+	if word == "" {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(s[i:], word)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(word)
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
 // BuildSidecarPath replaces the extension of primaryPath with sidecarExt.
@@ -39,12 +124,34 @@ func BuildSourceFilename(dt time.Time, shortHash string, ext string) string {
 }
 
 // DeviceDir builds a device directory name.
-// Format: "<Make> <Model> (<type>)" or "<Make> (<type>)" when model is empty.
-func DeviceDir(make_, model string, mediaType defaults.MediaType) string {
-	if model == "" {
-		return fmt.Sprintf("%s (%s)", make_, mediaType)
+// Format: "<Make> <Model> (<type>)", or "<Make> (<type>)" when model is
+// empty, with " - <owner>" before the type when owner is set.
+func DeviceDir(make_, model, owner string, mediaType defaults.MediaType) string {
+	name := make_
+	if model != "" {
+		name += " " + model
+	}
+	if owner != "" {
+		name += " - " + owner
+	}
+	return fmt.Sprintf("%s (%s)", name, mediaType)
+}
+
+// owner returns the owner label of the camera with serial number serial,
+// or "" when it is not mapped.
+func (o Options) owner(serial string) string {
+	if serial == "" {
+		return ""
+	}
+	if label, ok := o.Owners[serial]; ok {
+		return label
+	}
+	for s, label := range o.Owners {
+		if strings.EqualFold(s, serial) {
+			return label
+		}
 	}
-	return fmt.Sprintf("%s %s (%s)", make_, model, mediaType)
+	return ""
 }
 
 // effectiveMediaType returns the effective media type, mapping video to photo
@@ -58,14 +165,25 @@ func effectiveMediaType(mt defaults.MediaType, opts Options) defaults.MediaType
 
 var deviceDirRegex = regexp.MustCompile(`^.+ \((image|video|audio)\)$`)
 
-// ValidateDeviceDir checks that a directory name matches the "<Make> <Model> (<type>)" pattern.
+// ValidateDeviceDir checks that a directory name matches the
+// "<Make> <Model> [- <Owner>] (<type>)" pattern.
 func ValidateDeviceDir(name string) error {
 	if !deviceDirRegex.MatchString(name) {
-		return fmt.Errorf("directory %q does not match device format '<Make> [Model] (image|video|audio)'", name)
+		return fmt.Errorf("directory %q does not match device format '<Make> [Model] [- Owner] (image|video|audio)'", name)
 	}
 	return nil
 }
 
+// DeviceMediaType returns the media type named in a device directory's
+// "(<type>)" suffix, or false if name is not a valid device dir.
+func DeviceMediaType(name string) (defaults.MediaType, bool) {
+	m := deviceDirRegex.FindStringSubmatch(name)
+	if m == nil {
+		return "", false
+	}
+	return defaults.MediaType(m[1]), true
+}
+
 var dateDirRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
 
 // ValidateDateDir checks that a directory name matches YYYY-MM-DD format and is a valid date.
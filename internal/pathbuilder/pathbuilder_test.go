@@ -1,10 +1,12 @@
 package pathbuilder
 
 import (
+	"encoding/hex"
 	"testing"
 	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/metadata"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -95,6 +97,34 @@ func TestBuildSourcePath(t *testing.T) {
 			opts:     Options{},
 			expected: "2024/sources/Sony (image)/2024-01-01/2024-01-01_00-00-00_11223344.arw",
 		},
+		{
+			name: "owner mapped by serial number",
+			fm: &metadata.FileMetadata{
+				Make:         "Apple",
+				Model:        "iPhone 15 Pro",
+				DateTime:     time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC),
+				MediaType:    defaults.MediaTypeVideo,
+				ShortHash:    "d4e5f6a7",
+				Extension:    ".mov",
+				SerialNumber: "f2lxk0abcdef",
+			},
+			opts:     Options{SeparateVideo: true, Owners: map[string]string{"F2LXK0ABCDEF": "Alice", "F2LXK0999999": "Bob"}},
+			expected: "2024/sources/Apple iPhone 15 Pro - Alice (video)/2024-08-20/2024-08-20_18-45-03_d4e5f6a7.mov",
+		},
+		{
+			name: "serial number without owner",
+			fm: &metadata.FileMetadata{
+				Make:         "Apple",
+				Model:        "iPhone 15 Pro",
+				DateTime:     time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC),
+				MediaType:    defaults.MediaTypePhoto,
+				ShortHash:    "a1b2c3d4",
+				Extension:    ".jpg",
+				SerialNumber: "F2LXK0000000",
+			},
+			opts:     Options{Owners: map[string]string{"F2LXK0ABCDEF": "Alice"}},
+			expected: "2024/sources/Apple iPhone 15 Pro (image)/2024-08-20/2024-08-20_18-45-03_a1b2c3d4.jpg",
+		},
 	}
 
 	for _, tt := range tests {
@@ -121,6 +151,7 @@ func TestDeviceDir(t *testing.T) {
 		name      string
 		make_     string
 		model     string
+		owner     string
 		mediaType defaults.MediaType
 		expected  string
 	}{
@@ -152,11 +183,26 @@ func TestDeviceDir(t *testing.T) {
 			mediaType: defaults.MediaTypeAudio,
 			expected:  "Zoom H6 (audio)",
 		},
+		{
+			name:      "owner",
+			make_:     "Apple",
+			model:     "iPhone 15 Pro",
+			owner:     "Alice",
+			mediaType: defaults.MediaTypePhoto,
+			expected:  "Apple iPhone 15 Pro - Alice (image)",
+		},
+		{
+			name:      "owner without model",
+			make_:     "Sony",
+			owner:     "Bob",
+			mediaType: defaults.MediaTypePhoto,
+			expected:  "Sony - Bob (image)",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := DeviceDir(tt.make_, tt.model, tt.mediaType)
+			result := DeviceDir(tt.make_, tt.model, tt.owner, tt.mediaType)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
@@ -215,6 +261,21 @@ func TestParseSourceFilename(t *testing.T) {
 	}
 }
 
+func TestSourceFilenameRoundTripsEveryHashAlgorithm(t *testing.T) {
+	dt := time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC)
+	for _, algo := range defaults.HashAlgorithms {
+		h, err := defaults.NewHasher(algo)
+		require.NoError(t, err)
+		d := h.New()
+		_, _ = d.Write([]byte("photo"))
+		short := hex.EncodeToString(d.Sum(nil))[:h.ShortLen()]
+
+		result, err := ParseSourceFilename(BuildSourceFilename(dt, short, ".jpg"))
+		require.NoError(t, err, algo)
+		assert.Equal(t, short, result.Hash, algo)
+	}
+}
+
 func TestValidateDeviceDir(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -225,6 +286,7 @@ func TestValidateDeviceDir(t *testing.T) {
 		{"full video", "Apple iPhone 15 Pro (video)", true},
 		{"full audio", "Zoom H6 (audio)", true},
 		{"no model", "Unknown (image)", true},
+		{"owner", "Apple iPhone 15 Pro - Alice (image)", true},
 		{"no type", "Apple iPhone 15 Pro", false},
 		{"wrong type", "Apple iPhone 15 Pro (photo)", false},
 		{"empty", "", false},
@@ -269,3 +331,62 @@ func TestValidateDateDir(t *testing.T) {
 		})
 	}
 }
+
+func TestDeviceMediaType(t *testing.T) {
+	mt, ok := DeviceMediaType("Apple iPhone 15 Pro (video)")
+	assert.True(t, ok)
+	assert.Equal(t, defaults.MediaTypeVideo, mt)
+
+	_, ok = DeviceMediaType("Apple iPhone 15 Pro")
+	assert.False(t, ok)
+}
+
+func TestDerived(t *testing.T) {
+	on := library.DerivedRules{Action: library.DerivedFlag}
+	tests := []struct {
+		name  string
+		fm    metadata.FileMetadata
+		rules library.DerivedRules
+		want  string
+	}{
+		{"camera original", metadata.FileMetadata{Software: "17.5.1"}, on, ""},
+		{"software tag", metadata.FileMetadata{Software: "Adobe Photoshop 25.0 (Macintosh)"}, on, "edited with Adobe Photoshop 25.0 (Macintosh)"},
+		{"history", metadata.FileMetadata{Software: "17.5.1", HistorySoftware: []string{"iOS 17.5.1", "snapseed"}}, on, "edited with snapseed"},
+		{"whole word", metadata.FileMetadata{Software: "Photos 9.0"}, on, "edited with Photos 9.0"},
+		{"part of a word", metadata.FileMetadata{Software: "PhotosSync 4.2"}, on, ""},
+		{"derived from", metadata.FileMetadata{DerivedFrom: "xmp.did:1234"}, on, "derived from xmp.did:1234"},
+		{"derived from ignored", metadata.FileMetadata{DerivedFrom: "xmp.did:1234"}, library.DerivedRules{Action: library.DerivedFlag, IgnoreDerivedFrom: true}, ""},
+		{"own software list", metadata.FileMetadata{Software: "Snapseed 2.0"}, library.DerivedRules{Action: library.DerivedFlag, Software: []string{"darkroom"}}, ""},
+		{"own software match", metadata.FileMetadata{Software: "Darkroom 6"}, library.DerivedRules{Action: library.DerivedFlag, Software: []string{"darkroom"}}, "edited with Darkroom 6"},
+		{"off", metadata.FileMetadata{Software: "GIMP 2.10"}, library.DerivedRules{Action: library.DerivedOff}, ""},
+		{"off by default", metadata.FileMetadata{Software: "GIMP 2.10"}, library.DerivedRules{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Derived(&tt.fm, tt.rules))
+		})
+	}
+}
+
+func TestBuildPathRoutesEditedExports(t *testing.T) {
+	fm := &metadata.FileMetadata{
+		Make: "Apple", Model: "iPhone 15 Pro", MediaType: defaults.MediaTypePhoto, Extension: ".jpg",
+		DateTime: time.Date(2024, 8, 20, 18, 45, 3, 0, time.UTC), ShortHash: "a1b2c3d4", Software: "Snapseed 2.0",
+	}
+	rel, derived := BuildPath(fm, Options{Derived: library.DerivedRules{Action: library.DerivedToProcessed}})
+	assert.Equal(t, "2024/processed/Apple iPhone 15 Pro (image)/2024-08-20/2024-08-20_18-45-03_a1b2c3d4.jpg", rel)
+	assert.Equal(t, "edited with Snapseed 2.0", derived)
+
+	rel, derived = BuildPath(fm, Options{Derived: library.DerivedRules{Action: library.DerivedFlag}})
+	assert.Equal(t, BuildSourcePath(fm, Options{}), rel)
+	assert.Equal(t, "edited with Snapseed 2.0", derived)
+
+	rel, derived = BuildPath(fm, Options{})
+	assert.Equal(t, BuildSourcePath(fm, Options{}), rel)
+	assert.Empty(t, derived)
+
+	fm.Software = ""
+	rel, derived = BuildPath(fm, Options{Derived: library.DerivedRules{Action: library.DerivedToProcessed}})
+	assert.Equal(t, BuildSourcePath(fm, Options{}), rel)
+	assert.Empty(t, derived)
+}
@@ -0,0 +1,111 @@
+package phash
+
+// bkNode is a node of a BK-tree keyed by Hamming distance.
+type bkNode struct {
+	hash     Hash
+	ids      []int
+	children map[int]*bkNode
+}
+
+// bkTree indexes hashes so that all entries within a distance of a query
+// are found without comparing against every entry.
+type bkTree struct {
+	root *bkNode
+}
+
+func (t *bkTree) add(h Hash, id int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: h, ids: []int{id}}
+		return
+	}
+	n := t.root
+	for {
+		d := Distance(h, n.hash)
+		if d == 0 {
+			n.ids = append(n.ids, id)
+			return
+		}
+		child, ok := n.children[d]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[int]*bkNode)
+			}
+			n.children[d] = &bkNode{hash: h, ids: []int{id}}
+			return
+		}
+		n = child
+	}
+}
+
+// within calls fn for every id whose hash is at most maxDist from h.
+func (t *bkTree) within(h Hash, maxDist int, fn func(id int)) {
+	if t.root == nil {
+		return
+	}
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		d := Distance(h, n.hash)
+		if d <= maxDist {
+			for _, id := range n.ids {
+				fn(id)
+			}
+		}
+		for cd, child := range n.children {
+			if cd >= d-maxDist && cd <= d+maxDist {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// Cluster groups hashes[i] by single linkage: two images share a cluster
+// when a chain of images, each within maxDist of the next, connects them.
+// Only clusters with two or more members are returned, as index lists in
+// ascending order, ordered by their first index.
+func Cluster(hashes []Hash, maxDist int) [][]int {
+	var tree bkTree
+	for i, h := range hashes {
+		tree.add(h, i)
+	}
+
+	parent := make([]int, len(hashes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	for i, h := range hashes {
+		tree.within(h, maxDist, func(j int) {
+			if ri, rj := find(i), find(j); ri != rj {
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		})
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for i := range hashes {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], i)
+	}
+
+	var out [][]int
+	for _, r := range roots {
+		if len(groups[r]) > 1 {
+			out = append(out, groups[r])
+		}
+	}
+	return out
+}
@@ -0,0 +1,277 @@
+// Package phash computes perceptual image hashes and clusters images whose
+// hashes lie within a Hamming distance of each other.
+package phash
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoder
+	"image/jpeg"
+	_ "image/png" // register decoder
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hash is a 64-bit difference hash (dHash): for each of 8 rows of a 9×8
+// grayscale thumbnail, one bit per pair of horizontally adjacent pixels,
+// set when the left one is brighter. It survives resizing, re-encoding
+// and mild colour changes, but not crops or rotations.
+type Hash uint64
+
+// String formats h as 16 hex digits.
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse reads a hash written by String.
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q", s)
+	}
+	return Hash(v), nil
+}
+
+// Distance returns the Hamming distance between two hashes.
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// Supported reports whether FromFile can decode files with this
+// extension: JPEG, PNG and GIF. HEIC and RAW files are not.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// FromFile returns the hash and pixel size of the image at path. A JPEG
+// is hashed from its EXIF thumbnail when it has one of the same shape,
+// which is far cheaper than decoding the full image and, as the hash
+// survives resizing, gives the same bits or nearly so.
+func FromFile(path string) (h Hash, width, height int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jpg" || ext == ".jpeg" {
+		if h, width, height, ok := fromThumbnail(f); ok {
+			return h, width, height, nil
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, 0, 0, fmt.Errorf("seek: %w", err)
+		}
+	}
+
+	img, _, err := image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("decode image: %w", err)
+	}
+	b := img.Bounds()
+	return DHash(img), b.Dx(), b.Dy(), nil
+}
+
+// exifSearchLen is how much of the start of a JPEG fromThumbnail looks
+// through for the EXIF segment, which is at most 64 KiB and comes first
+// or after a JFIF one.
+const exifSearchLen = 128 << 10
+
+// fromThumbnail hashes the EXIF thumbnail of the JPEG in f, if it has one
+// whose aspect ratio matches the image's within 2% (cameras pad some
+// thumbnails with black bars, which would change the hash) and which is
+// at least 64 pixels wide.
+func fromThumbnail(f io.ReadSeeker) (h Hash, width, height int, ok bool) {
+	cfg, err := jpeg.DecodeConfig(bufio.NewReader(f))
+	if err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		return 0, 0, 0, false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, 0, false
+	}
+	head := make([]byte, exifSearchLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, 0, 0, false
+	}
+	thumb := exifThumbnail(head[:n])
+	if thumb == nil {
+		return 0, 0, 0, false
+	}
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		return 0, 0, 0, false
+	}
+	tw, th := img.Bounds().Dx(), img.Bounds().Dy()
+	if tw < 64 || th == 0 {
+		return 0, 0, 0, false
+	}
+	skew := tw*cfg.Height - th*cfg.Width
+	if skew < 0 {
+		skew = -skew
+	}
+	if float64(skew) > 0.02*float64(th*cfg.Width) {
+		return 0, 0, 0, false
+	}
+	return DHash(img), cfg.Width, cfg.Height, true
+}
+
+// exifThumbnail returns the JPEG thumbnail stored in IFD1 of the EXIF
+// segment of the JPEG starting at data, or nil.
+func exifThumbnail(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + size
+		if size < 2 || end > len(data) {
+			return nil
+		}
+		if seg := data[pos+4 : end]; marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffThumbnail(seg[6:])
+		}
+		pos = end
+	}
+	return nil
+}
+
+// tiffThumbnail returns the bytes named by the JPEGInterchangeFormat and
+// JPEGInterchangeFormatLength tags of IFD1 of the TIFF structure in t.
+func tiffThumbnail(t []byte) []byte {
+	if len(t) < 8 {
+		return nil
+	}
+	var bo binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil
+	}
+	// nextIFD returns the offset of the IFD after the one at off.
+	nextIFD := func(off uint32) uint32 {
+		if uint64(off)+2 > uint64(len(t)) {
+			return 0
+		}
+		at := uint64(off) + 2 + 12*uint64(bo.Uint16(t[off:]))
+		if at+4 > uint64(len(t)) {
+			return 0
+		}
+		return bo.Uint32(t[at:])
+	}
+	ifd1 := nextIFD(bo.Uint32(t[4:]))
+	if ifd1 == 0 || uint64(ifd1)+2 > uint64(len(t)) {
+		return nil
+	}
+	var start, length uint32
+	for i := range uint32(bo.Uint16(t[ifd1:])) {
+		at := uint64(ifd1) + 2 + 12*uint64(i)
+		if at+12 > uint64(len(t)) {
+			return nil
+		}
+		switch bo.Uint16(t[at:]) {
+		case 0x0201:
+			start = bo.Uint32(t[at+8:])
+		case 0x0202:
+			length = bo.Uint32(t[at+8:])
+		}
+	}
+	if start == 0 || length == 0 || uint64(start)+uint64(length) > uint64(len(t)) {
+		return nil
+	}
+	return t[start : start+length]
+}
+
+// cellSamples caps how many pixels along each axis DHash averages per
+// thumbnail cell: an evenly spaced grid this fine gives the average of
+// the whole cell to well within what would flip a bit.
+const cellSamples = 16
+
+// DHash computes the difference hash of img.
+func DHash(img image.Image) Hash {
+	const w, ht = 9, 8
+	var gray [ht][w]float64
+
+	// Box-average each thumbnail cell; cheap and stable under rescaling.
+	b := img.Bounds()
+	luma := lumaOf(img)
+	for ty := 0; ty < ht; ty++ {
+		y0 := b.Min.Y + ty*b.Dy()/ht
+		y1 := max(b.Min.Y+(ty+1)*b.Dy()/ht, y0+1)
+		ystep := max((y1-y0)/cellSamples, 1)
+		for tx := 0; tx < w; tx++ {
+			x0 := b.Min.X + tx*b.Dx()/w
+			x1 := max(b.Min.X+(tx+1)*b.Dx()/w, x0+1)
+			xstep := max((x1-x0)/cellSamples, 1)
+			var sum float64
+			var n int
+			for y := y0; y < y1 && y < b.Max.Y; y += ystep {
+				for x := x0; x < x1 && x < b.Max.X; x += xstep {
+					sum += luma(x, y)
+					n++
+				}
+			}
+			if n > 0 {
+				gray[ty][tx] = sum / float64(n)
+			}
+		}
+	}
+
+	var h Hash
+	for y := 0; y < ht; y++ {
+		for x := 0; x < w-1; x++ {
+			h <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				h |= 1
+			}
+		}
+	}
+	return h
+}
+
+// lumaOf returns a function giving the brightness of img at (x, y). The
+// scale differs between image types, which is harmless as DHash only
+// compares brightness within one image. The types the decoders return
+// are read directly, without the allocation of img.At.
+func lumaOf(img image.Image) func(x, y int) float64 {
+	rgb := func(r, g, b uint8) float64 {
+		return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+	}
+	switch m := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) float64 { return float64(m.Y[m.YOffset(x, y)]) }
+	case *image.Gray:
+		return func(x, y int) float64 { return float64(m.Pix[m.PixOffset(x, y)]) }
+	case *image.RGBA:
+		return func(x, y int) float64 {
+			p := m.Pix[m.PixOffset(x, y):]
+			return rgb(p[0], p[1], p[2])
+		}
+	case *image.NRGBA:
+		return func(x, y int) float64 {
+			p := m.Pix[m.PixOffset(x, y):]
+			return rgb(p[0], p[1], p[2])
+		}
+	}
+	return func(x, y int) float64 {
+		r, g, b, _ := img.At(x, y).RGBA()
+		return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+	}
+}
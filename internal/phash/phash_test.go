@@ -0,0 +1,186 @@
+package phash
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gradient draws a w×h image with a diagonal brightness ramp and a dark
+// square, so that its hash has both set and unset bits.
+func gradient(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8((x*255/w + y*128/h) / 2)
+			img.Set(x, y, color.RGBA{R: v, G: v, B: 255 - v, A: 255})
+		}
+	}
+	draw.Draw(img, image.Rect(w/4, h/4, w/2, h/2), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	return img
+}
+
+func TestDHashStableUnderResize(t *testing.T) {
+	big := DHash(gradient(900, 600))
+	small := DHash(gradient(180, 120))
+	assert.LessOrEqual(t, Distance(big, small), 4)
+
+	other := image.NewRGBA(image.Rect(0, 0, 180, 120))
+	draw.Draw(other, other.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(other, image.Rect(120, 0, 180, 120), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	assert.Greater(t, Distance(big, DHash(other)), 10)
+}
+
+func TestStringParseRoundTrip(t *testing.T) {
+	h := Hash(0x00ff00ff12345678)
+	assert.Equal(t, "00ff00ff12345678", h.String())
+	got, err := Parse(h.String())
+	require.NoError(t, err)
+	assert.Equal(t, h, got)
+
+	_, err = Parse("xyz")
+	assert.Error(t, err)
+}
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance(0xabc, 0xabc))
+	assert.Equal(t, 64, Distance(0, ^Hash(0)))
+	assert.Equal(t, 2, Distance(0b1010, 0b0000))
+}
+
+func TestFromFileSurvivesReencoding(t *testing.T) {
+	dir := t.TempDir()
+	img := gradient(300, 200)
+
+	pngPath := filepath.Join(dir, "a.png")
+	f, err := os.Create(pngPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, img))
+	require.NoError(t, f.Close())
+
+	jpgPath := filepath.Join(dir, "b.JPG")
+	f, err = os.Create(jpgPath)
+	require.NoError(t, err)
+	require.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 40}))
+	require.NoError(t, f.Close())
+
+	a, w, h, err := FromFile(pngPath)
+	require.NoError(t, err)
+	assert.Equal(t, 300, w)
+	assert.Equal(t, 200, h)
+	b, _, _, err := FromFile(jpgPath)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, Distance(a, b), 4)
+
+	assert.True(t, Supported(jpgPath))
+	assert.False(t, Supported("clip.mov"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.png"), []byte("nope"), 0o644))
+	_, _, _, err = FromFile(filepath.Join(dir, "bad.png"))
+	assert.Error(t, err)
+}
+
+// withThumbnail returns a JPEG of img carrying thumb as its EXIF
+// thumbnail, in a big-endian TIFF with an empty IFD0.
+func withThumbnail(t *testing.T, img, thumb image.Image) []byte {
+	t.Helper()
+	var main, small bytes.Buffer
+	require.NoError(t, jpeg.Encode(&main, img, nil))
+	require.NoError(t, jpeg.Encode(&small, thumb, nil))
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	_ = binary.Write(&tiff, binary.BigEndian, []uint32{8})
+	_ = binary.Write(&tiff, binary.BigEndian, []uint16{0}) // IFD0: no entries
+	_ = binary.Write(&tiff, binary.BigEndian, []uint32{14})
+	_ = binary.Write(&tiff, binary.BigEndian, []uint16{2,
+		0x0201, 4, 0, 1, 0, 44,
+		0x0202, 4, 0, 1})
+	_ = binary.Write(&tiff, binary.BigEndian, []uint32{uint32(small.Len()), 0})
+	tiff.Write(small.Bytes())
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(main.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(main.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestFromFileUsesEXIFThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	img := gradient(600, 400)
+
+	// A thumbnail of another picture shows which one was hashed.
+	other := image.NewRGBA(image.Rect(0, 0, 160, 107))
+	draw.Draw(other, other.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(other, image.Rect(0, 0, 40, 107), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	p := filepath.Join(dir, "a.jpg")
+	require.NoError(t, os.WriteFile(p, withThumbnail(t, img, other), 0o644))
+	h, w, ht, err := FromFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, DHash(other), h)
+	assert.Equal(t, 600, w)
+	assert.Equal(t, 400, ht)
+
+	// A true thumbnail hashes like the image itself.
+	p = filepath.Join(dir, "b.jpg")
+	require.NoError(t, os.WriteFile(p, withThumbnail(t, img, gradient(160, 107)), 0o644))
+	h, _, _, err = FromFile(p)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, Distance(DHash(img), h), 4)
+
+	// A letterboxed thumbnail is not used.
+	p = filepath.Join(dir, "c.jpg")
+	require.NoError(t, os.WriteFile(p, withThumbnail(t, img, image.NewRGBA(image.Rect(0, 0, 160, 120))), 0o644))
+	h, _, _, err = FromFile(p)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, Distance(DHash(img), h), 4)
+}
+
+func TestDHashReadsDecodedTypes(t *testing.T) {
+	// The direct readers agree with the generic one.
+	src := gradient(300, 200)
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}))
+	ycc, err := jpeg.Decode(&buf)
+	require.NoError(t, err)
+	require.IsType(t, &image.YCbCr{}, ycc)
+	assert.LessOrEqual(t, Distance(DHash(src), DHash(ycc)), 2)
+
+	gray := image.NewGray(src.Bounds())
+	draw.Draw(gray, gray.Bounds(), src, image.Point{}, draw.Src)
+	nrgba := image.NewNRGBA(src.Bounds())
+	draw.Draw(nrgba, nrgba.Bounds(), src, image.Point{}, draw.Src)
+	assert.Equal(t, DHash(src), DHash(nrgba))
+	assert.LessOrEqual(t, Distance(DHash(src), DHash(gray)), 2)
+}
+
+func TestCluster(t *testing.T) {
+	hashes := []Hash{
+		0b0000_0000,
+		0xffff_0000_0000_0000,
+		0b0000_0011, // 2 from [0]
+		0b0000_1111, // 2 from [2]: chained into [0]'s cluster
+		0xffff_0000_0000_0001,
+		0x0f0f_0f0f_0f0f_0f0f,
+	}
+	got := Cluster(hashes, 2)
+	assert.Equal(t, [][]int{{0, 2, 3}, {1, 4}}, got)
+
+	assert.Empty(t, Cluster(hashes, 0))
+	assert.Empty(t, Cluster(nil, 10))
+	assert.Equal(t, [][]int{{0, 1}}, Cluster([]Hash{7, 7}, 0))
+}
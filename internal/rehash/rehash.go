@@ -0,0 +1,461 @@
+// Package rehash converts a library from one hash algorithm to another.
+// Every source file is renamed to the short hash of the new algorithm,
+// its sidecars move with it, and the hash manifests, verify caches and
+// index follow.
+package rehash
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/verifier"
+)
+
+// Config controls a rehash.
+type Config struct {
+	LibraryPath string
+	// To is the hash algorithm to convert the library to.
+	To       string
+	FailFast bool
+	// MetadataCache, when set, learns the new hash of every file it knew
+	// by the old one, so the conversion does not cost its entries.
+	MetadataCache *metadata.Cache
+}
+
+// Result holds the outcome counts of a rehash.
+type Result struct {
+	// From lists the algorithms the library was converted from.
+	From    []string
+	Renamed int
+	// Unchanged counts files already named after the new hash, as after
+	// an interrupted run.
+	Unchanged int
+	// Skipped counts files not named after a content hash.
+	Skipped int
+	// Mismatched counts files whose name matches the hash of their
+	// content under no algorithm; they are left for verify to report.
+	Mismatched int
+	Errors     int
+}
+
+// Run converts the library to cfg.To. The library is marked as being
+// rehashed before the first rename and as using cfg.To once every file
+// is done, so an interrupted run is finished by running it again; until
+// then import and verify refuse the library. Files are renamed in place,
+// sidecars before their primary, and each file's name tells whether it
+// was already converted, so a resumed run picks up where the last one
+// stopped.
+func Run(cfg Config, logger *logging.Logger) (*Result, error) {
+	to, err := defaults.NewHasher(cfg.To)
+	if err != nil {
+		return nil, fmt.Errorf("rehash: %w", err)
+	}
+
+	lc, err := library.LoadConfig(cfg.LibraryPath)
+	if err != nil {
+		return nil, err
+	}
+	if lc.HashAlgo == cfg.To && lc.RehashTo == "" {
+		return &Result{}, nil
+	}
+	if lc.RehashTo != "" && cfg.To != lc.RehashTo && cfg.To != lc.HashAlgo {
+		return nil, fmt.Errorf("a rehash from %s to %s is under way; finish it with --to %s or undo it with --to %s",
+			lc.HashAlgo, lc.RehashTo, lc.RehashTo, lc.HashAlgo)
+	}
+
+	from, err := sourceAlgos(cfg.LibraryPath, lc, cfg.To)
+	if err != nil {
+		return nil, err
+	}
+	r := &rehasher{
+		cfg:     cfg,
+		logger:  logger,
+		to:      to,
+		aliases: make(map[string]string),
+		result:  &Result{From: from},
+	}
+	for _, algo := range from {
+		h, err := defaults.NewHasher(algo)
+		if err != nil {
+			return nil, fmt.Errorf("rehash: library hashes: %w", err)
+		}
+		r.from = append(r.from, h)
+	}
+
+	// The library's algorithm stays the one most of it uses until the
+	// end, so that an undo with --to knows where to go back to.
+	started := lc
+	started.RehashTo = cfg.To
+	if (started.HashAlgo == "" || started.HashAlgo == cfg.To) && len(from) > 0 {
+		started.HashAlgo = from[0]
+	}
+	if err := library.SaveConfig(cfg.LibraryPath, started); err != nil {
+		return nil, err
+	}
+
+	years, err := library.ListYears(cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+	ix, err := index.Load(index.FilePath(cfg.LibraryPath))
+	if err != nil {
+		logger.Warn("library index: load failed: %v", err)
+	}
+	r.idx = ix
+
+	for i, year := range years {
+		err := r.rehashYear(year, i+1, len(years))
+		if err != nil {
+			_ = r.close()
+			return r.result, err
+		}
+	}
+	if err := r.close(); err != nil {
+		return r.result, err
+	}
+
+	if r.result.Errors > 0 {
+		return r.result, nil
+	}
+	done := lc
+	done.HashAlgo, done.RehashTo = cfg.To, ""
+	return r.result, library.SaveConfig(cfg.LibraryPath, done)
+}
+
+// sourceAlgos returns the algorithms the library's files may be named
+// after, other than to: those of the settings file and of the manifests,
+// or the default algorithm if neither tells. It is empty for a library
+// already named after to.
+func sourceAlgos(libraryPath string, lc library.Config, to string) ([]string, error) {
+	algos, err := library.ManifestHashAlgos(libraryPath)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var from []string
+	for _, a := range append([]string{lc.HashAlgo, lc.RehashTo}, algos...) {
+		if a != "" && a != to && !seen[a] {
+			seen[a] = true
+			from = append(from, a)
+		}
+	}
+	if len(from) == 0 && to != defaults.DefaultHashAlgorithm {
+		from = append(from, defaults.DefaultHashAlgorithm)
+	}
+	return from, nil
+}
+
+type rehasher struct {
+	cfg    Config
+	logger *logging.Logger
+	to     *defaults.Hasher
+	from   []*defaults.Hasher
+	idx    *index.Index
+	result *Result
+
+	// aliases maps "algo:hash" of each converted file's old hash to its
+	// new one, for the metadata cache.
+	aliases map[string]string
+}
+
+// close flushes the index and hands the new hashes to the metadata cache.
+func (r *rehasher) close() error {
+	r.cfg.MetadataCache.AliasHashes(r.aliases)
+	if err := r.idx.Close(); err != nil {
+		return fmt.Errorf("library index: %w", err)
+	}
+	return nil
+}
+
+// yearState is the per-year state a rehash updates.
+type yearState struct {
+	name     string
+	dir      string
+	manifest *library.Manifest
+	cache    *verifier.Cache
+}
+
+func (r *rehasher) rehashYear(year string, yearIdx, yearTotal int) error {
+	ys := &yearState{name: year, dir: filepath.Join(r.cfg.LibraryPath, year)}
+	paths, err := library.ListSourceFiles(ys.dir)
+	if err != nil {
+		return fmt.Errorf("list source files for %s: %w", year, err)
+	}
+	ys.manifest, err = library.LoadManifest(library.ManifestFilePath(ys.dir))
+	if err != nil {
+		return fmt.Errorf("hash manifest for %s: %w", year, err)
+	}
+	ys.cache, err = verifier.Load(verifier.CacheFilePath(ys.dir))
+	if err != nil {
+		r.logger.Warn("cache for %s: load failed: %v (verify will recheck this year)", year, err)
+	}
+
+	groups := groupByStem(paths)
+	prefix := fmt.Sprintf("[%s %d/%d] ", year, yearIdx, yearTotal)
+	for i, g := range groups {
+		stats := fmt.Sprintf("renamed:%d unchanged:%d errors:%d", r.result.Renamed, r.result.Unchanged, r.result.Errors)
+		r.logger.ProgressWithStats(i+1, len(groups), prefix, stats, g.path)
+
+		if err := r.rehashFile(ys, g); err != nil {
+			r.result.Errors++
+			r.logger.Error("rehash %s: %v", g.path, err)
+			if r.cfg.FailFast {
+				r.persist(ys)
+				return err
+			}
+		}
+	}
+	r.persist(ys)
+	return nil
+}
+
+// persist writes the year's manifest and cache. A manifest that cannot
+// be written counts as an error, so the rehash is not marked finished.
+func (r *rehasher) persist(ys *yearState) {
+	if err := ys.manifest.Persist(); err != nil {
+		r.result.Errors++
+		r.logger.Error("hash manifest for %s: %v", ys.name, err)
+	}
+	if err := ys.cache.Persist(); err != nil {
+		r.logger.Warn("cache for %s: persist failed: %v", ys.name, err)
+	}
+}
+
+// group is a file to rehash with the sidecars that share its stem.
+type group struct {
+	path     string
+	sidecars []string
+}
+
+// groupByStem pairs each primary with its sidecars, the way import does.
+// Sidecars with no primary are files of their own and come last: a run
+// interrupted between moving a primary's sidecars and renaming it leaves
+// them under the new stem, where the primary lands before they are seen.
+func groupByStem(paths []string) []group {
+	sort.Strings(paths)
+	sidecars := make(map[string][]string)
+	var groups []group
+	for _, p := range paths {
+		base := filepath.Base(p)
+		if defaults.IsIgnoredFile(base) {
+			continue
+		}
+		if defaults.IsSidecarExtension(filepath.Ext(base)) {
+			stem := strings.TrimSuffix(p, filepath.Ext(p))
+			sidecars[stem] = append(sidecars[stem], p)
+			continue
+		}
+		groups = append(groups, group{path: p})
+	}
+	for i, g := range groups {
+		stem := strings.TrimSuffix(g.path, filepath.Ext(g.path))
+		groups[i].sidecars = sidecars[stem]
+		delete(sidecars, stem)
+	}
+	// The rest go last, once their primary may have been renamed.
+	var rest []string
+	for _, scs := range sidecars {
+		rest = append(rest, scs...)
+	}
+	sort.Strings(rest)
+	for _, p := range rest {
+		groups = append(groups, group{path: p})
+	}
+	return groups
+}
+
+func (r *rehasher) rehashFile(ys *yearState, g group) error {
+	parsed, err := pathbuilder.ParseSourceFilename(g.path)
+	if err != nil {
+		r.result.Skipped++
+		r.logger.Warn("%s is not named after its content hash; left as is", g.path)
+		return nil
+	}
+	if defaults.IsSidecarExtension(filepath.Ext(g.path)) && hasPrimary(g.path) {
+		return nil
+	}
+	rel, err := relTo(ys.dir, g.path)
+	if err != nil {
+		return err
+	}
+
+	// Files converted by an interrupted run and recorded in the manifest
+	// need no reading.
+	if e, ok := ys.manifest.Lookup(rel); ok && e.HashAlgo == r.to.Algo() && strings.HasPrefix(e.FullHash, parsed.Hash) {
+		r.result.Unchanged++
+		return nil
+	}
+
+	sums, err := r.hashFile(g.path)
+	if err != nil {
+		return err
+	}
+	newShort := sums[r.to.Algo()][:r.to.ShortLen()]
+	dir := filepath.Dir(g.path)
+	newPath := filepath.Join(dir, pathbuilder.BuildSourceFilename(parsed.DateTime, newShort, parsed.Ext))
+
+	if parsed.Hash == newShort {
+		// Renamed by an interrupted run: only the records may be behind.
+		for _, h := range r.from {
+			oldPath := filepath.Join(dir, pathbuilder.BuildSourceFilename(parsed.DateTime, sums[h.Algo()][:h.ShortLen()], parsed.Ext))
+			if err := r.update(ys, oldPath, newPath, h.Algo(), sums); err != nil {
+				return err
+			}
+		}
+		r.result.Unchanged++
+		return nil
+	}
+
+	var from *defaults.Hasher
+	for _, h := range r.from {
+		if sums[h.Algo()][:h.ShortLen()] == parsed.Hash {
+			from = h
+			break
+		}
+	}
+	if from == nil {
+		r.result.Mismatched++
+		r.logger.Warn("%s: name matches no hash of its content; left as is (see imv verify)", g.path)
+		return nil
+	}
+
+	// Sidecars go first: if the run stops before the primary is renamed,
+	// they already sit under its new stem, where the next run finds them.
+	for _, sc := range g.sidecars {
+		if err := renameNoReplace(sc, pathbuilder.BuildSidecarPath(newPath, filepath.Ext(sc))); err != nil {
+			return fmt.Errorf("move sidecar: %w", err)
+		}
+	}
+	if err := renameNoReplace(g.path, newPath); err != nil {
+		return err
+	}
+	r.result.Renamed++
+	return r.update(ys, g.path, newPath, from.Algo(), sums)
+}
+
+// update moves the manifest, verify cache and index records of the file
+// renamed from oldPath (hashed with algo) to newPath over to the new
+// hash. It is idempotent, for resumed runs.
+func (r *rehasher) update(ys *yearState, oldPath, newPath, algo string, sums map[string]string) error {
+	oldRel, err := relTo(ys.dir, oldPath)
+	if err != nil {
+		return err
+	}
+	newRel, err := relTo(ys.dir, newPath)
+	if err != nil {
+		return err
+	}
+	newHash := sums[r.to.Algo()]
+	r.aliases[algo+":"+sums[algo]] = r.to.Algo() + ":" + newHash
+
+	ys.manifest.Delete(oldRel)
+	if err := ys.manifest.Record(library.ManifestEntry{RelPath: newRel, HashAlgo: r.to.Algo(), FullHash: newHash}); err != nil {
+		return err
+	}
+
+	// The file was just read in full and matched its name, which is what
+	// verify would have checked; a rename keeps size and mtime.
+	if e, ok := ys.cache.Lookup(oldRel); ok && e.HashAlgo == algo {
+		if fi, err := os.Stat(newPath); err == nil && ys.cache.Matches(e, fi, algo) {
+			e.RelPath, e.HashAlgo = newRel, r.to.Algo()
+			if err := ys.cache.Record(e); err != nil {
+				r.logger.Warn("cache record failed for %s: %v", newPath, err)
+			}
+		}
+	}
+
+	oldIdx, newIdx := ys.name+"/"+oldRel, ys.name+"/"+newRel
+	rec, ok := r.idx.Get(oldIdx)
+	if !ok {
+		if rec, ok = r.idx.Get(newIdx); !ok || rec.HashAlgo == r.to.Algo() {
+			return nil
+		}
+	}
+	if err := r.idx.Delete(oldIdx); err != nil {
+		r.logger.Warn("index %s: %v", oldIdx, err)
+	}
+	rec.Path, rec.FullHash, rec.HashAlgo = newIdx, newHash, r.to.Algo()
+	if err := r.idx.Put(rec); err != nil {
+		r.logger.Warn("index %s: %v", newIdx, err)
+	}
+	return nil
+}
+
+// hashFile reads path once and returns its full hash under the new
+// algorithm and every old one, keyed by algorithm.
+func (r *rehasher) hashFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	hashers := append([]*defaults.Hasher{r.to}, r.from...)
+	digests := make([]hash.Hash, len(hashers))
+	writers := make([]io.Writer, len(hashers))
+	for i, h := range hashers {
+		digests[i] = h.New()
+		writers[i] = digests[i]
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), f); err != nil {
+		return nil, fmt.Errorf("hash file: %w", err)
+	}
+	sums := make(map[string]string, len(hashers))
+	for i, h := range hashers {
+		sums[h.Algo()] = hex.EncodeToString(digests[i].Sum(nil))
+	}
+	return sums, nil
+}
+
+// hasPrimary reports whether a file other than a sidecar shares the stem
+// of the sidecar at path.
+func hasPrimary(path string) bool {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && !defaults.IsSidecarExtension(filepath.Ext(name)) &&
+			strings.TrimSuffix(name, filepath.Ext(name)) == stem {
+			return true
+		}
+	}
+	return false
+}
+
+// renameNoReplace renames src to dst within a directory, refusing to
+// replace an existing file.
+func renameNoReplace(src, dst string) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// relTo returns path relative to dir, slash-separated.
+func relTo(dir, path string) (string, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return "", fmt.Errorf("relative path: %w", err)
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,216 @@
+package rehash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/verifier"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var shotAt = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+func hashOf(t *testing.T, algo, content string) (full, short string) {
+	t.Helper()
+	h, err := defaults.NewHasher(algo)
+	require.NoError(t, err)
+	d := h.New()
+	_, _ = d.Write([]byte(content))
+	full = fmt.Sprintf("%x", d.Sum(nil))
+	return full, full[:h.ShortLen()]
+}
+
+// placeFile writes content into the fixture date dir under the name import
+// would give it with algo, and returns its year-relative path.
+func placeFile(t *testing.T, lib, algo, content, ext string) string {
+	t.Helper()
+	_, short := hashOf(t, algo, content)
+	rel := filepath.ToSlash(filepath.Join("sources/Canon EOS R5 (image)/2024-01-15", pathbuilder.BuildSourceFilename(shotAt, short, ext)))
+	path := filepath.Join(lib, "2024", filepath.FromSlash(rel))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return rel
+}
+
+func newLogger() *logging.Logger {
+	var buf bytes.Buffer
+	return logging.New(&buf, &buf, false)
+}
+
+func sha256Rel(t *testing.T, content, ext string) string {
+	t.Helper()
+	_, short := hashOf(t, "sha256", content)
+	return "sources/Canon EOS R5 (image)/2024-01-15/" + pathbuilder.BuildSourceFilename(shotAt, short, ext)
+}
+
+func TestRun(t *testing.T) {
+	lib := t.TempDir()
+	yearDir := filepath.Join(lib, "2024")
+	photo := placeFile(t, lib, "md5", "photo", ".jpg")
+	xmp := filepath.Join(yearDir, filepath.FromSlash(pathbuilder.BuildSidecarPath(photo, ".xmp")))
+	require.NoError(t, os.WriteFile(xmp, []byte("sidecar"), 0o644))
+	standalone := placeFile(t, lib, "md5", "lonely sidecar", ".xmp")
+	other := filepath.Join(yearDir, "sources/Canon EOS R5 (image)/2024-01-15/notes.txt")
+	require.NoError(t, os.WriteFile(other, []byte("notes"), 0o644))
+	misnamed := placeFile(t, lib, "md5", "original", ".jpg")
+	require.NoError(t, os.WriteFile(filepath.Join(yearDir, filepath.FromSlash(misnamed)), []byte("changed"), 0o644))
+
+	md5Full, _ := hashOf(t, "md5", "photo")
+	shaFull, _ := hashOf(t, "sha256", "photo")
+	owners := map[string]string{"SN-A": "Alice"}
+	require.NoError(t, library.SaveConfig(lib, library.Config{HashAlgo: "md5", Owners: owners}))
+
+	m, err := library.LoadManifest(library.ManifestFilePath(yearDir))
+	require.NoError(t, err)
+	require.NoError(t, m.Record(library.ManifestEntry{RelPath: photo, HashAlgo: "md5", FullHash: md5Full}))
+	require.NoError(t, m.Persist())
+
+	fi, err := os.Stat(filepath.Join(yearDir, filepath.FromSlash(photo)))
+	require.NoError(t, err)
+	vc, err := verifier.Load(verifier.CacheFilePath(yearDir))
+	require.NoError(t, err)
+	verifiedAt := verifier.NewEntry(photo, fi, "md5")
+	require.NoError(t, vc.Record(verifiedAt))
+	require.NoError(t, vc.Persist())
+
+	ix, err := index.Load(index.FilePath(lib))
+	require.NoError(t, err)
+	require.NoError(t, ix.Put(index.Record{Path: "2024/" + photo, FullHash: md5Full, HashAlgo: "md5", Session: "s1"}))
+	require.NoError(t, ix.Close())
+
+	cache, err := metadata.LoadCache(filepath.Join(t.TempDir(), "metadata.jsonl"), metadata.DefaultCacheMaxBytes)
+	require.NoError(t, err)
+	cache.Put("native 1|md5:"+md5Full+"|.jpg", map[string]interface{}{"Make": "Canon"})
+
+	result, err := Run(Config{LibraryPath: lib, To: "sha256", MetadataCache: cache}, newLogger())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"md5"}, result.From)
+	assert.Equal(t, 2, result.Renamed)
+	assert.Equal(t, 1, result.Skipped)
+	assert.Equal(t, 1, result.Mismatched)
+	assert.Zero(t, result.Errors)
+
+	newPhoto := sha256Rel(t, "photo", ".jpg")
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(newPhoto)))
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(pathbuilder.BuildSidecarPath(newPhoto, ".xmp"))))
+	assert.NoFileExists(t, xmp)
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(sha256Rel(t, "lonely sidecar", ".xmp"))))
+	assert.NoFileExists(t, filepath.Join(yearDir, filepath.FromSlash(standalone)))
+	assert.FileExists(t, other)
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(misnamed)))
+
+	c, err := library.LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, library.Config{HashAlgo: "sha256", Owners: owners}, c)
+
+	m, err = library.LoadManifest(library.ManifestFilePath(yearDir))
+	require.NoError(t, err)
+	_, ok := m.Lookup(photo)
+	assert.False(t, ok)
+	e, ok := m.Lookup(newPhoto)
+	require.True(t, ok)
+	assert.Equal(t, "sha256", e.HashAlgo)
+	assert.Equal(t, shaFull, e.FullHash)
+
+	vc, err = verifier.Load(verifier.CacheFilePath(yearDir))
+	require.NoError(t, err)
+	ce, ok := vc.Lookup(newPhoto)
+	require.True(t, ok)
+	assert.Equal(t, "sha256", ce.HashAlgo)
+	assert.Equal(t, verifiedAt.VerifiedAt, ce.VerifiedAt)
+
+	ix, err = index.Load(index.FilePath(lib))
+	require.NoError(t, err)
+	_, ok = ix.Get("2024/" + photo)
+	assert.False(t, ok)
+	rec, ok := ix.Get("2024/" + newPhoto)
+	require.True(t, ok)
+	assert.Equal(t, shaFull, rec.FullHash)
+	assert.Equal(t, "sha256", rec.HashAlgo)
+	assert.Equal(t, "s1", rec.Session)
+
+	fields, ok := cache.Get("native 1|sha256:" + shaFull + "|.jpg")
+	require.True(t, ok)
+	assert.Equal(t, "Canon", fields["Make"])
+
+	// A second run has nothing left to do.
+	result, err = Run(Config{LibraryPath: lib, To: "sha256"}, newLogger())
+	require.NoError(t, err)
+	assert.Zero(t, result.Renamed)
+}
+
+func TestRunResumesInterruptedRehash(t *testing.T) {
+	lib := t.TempDir()
+	yearDir := filepath.Join(lib, "2024")
+	done := placeFile(t, lib, "sha256", "done", ".jpg")
+	// Stopped between moving the sidecar and renaming its primary.
+	halfway := placeFile(t, lib, "md5", "halfway", ".jpg")
+	require.NoError(t, os.WriteFile(filepath.Join(yearDir, filepath.FromSlash(pathbuilder.BuildSidecarPath(sha256Rel(t, "halfway", ".jpg"), ".xmp"))), []byte("sidecar"), 0o644))
+	todo := placeFile(t, lib, "md5", "todo", ".jpg")
+	require.NoError(t, library.SaveConfig(lib, library.Config{HashAlgo: "md5", RehashTo: "sha256"}))
+	assert.ErrorIs(t, library.CheckHashAlgo(lib, "sha256", true), library.ErrHashAlgoMismatch)
+
+	_, err := Run(Config{LibraryPath: lib, To: "blake3"}, newLogger())
+	assert.Error(t, err, "another target while a rehash is under way")
+
+	result, err := Run(Config{LibraryPath: lib, To: "sha256"}, newLogger())
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Renamed)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Zero(t, result.Mismatched, "the moved sidecar is not taken for a file of its own")
+
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(done)))
+	assert.NoFileExists(t, filepath.Join(yearDir, filepath.FromSlash(halfway)))
+	assert.NoFileExists(t, filepath.Join(yearDir, filepath.FromSlash(todo)))
+	for _, content := range []string{"halfway", "todo"} {
+		assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(sha256Rel(t, content, ".jpg"))))
+	}
+	require.NoError(t, library.CheckHashAlgo(lib, "sha256", false))
+}
+
+func TestRunUndoesInterruptedRehash(t *testing.T) {
+	lib := t.TempDir()
+	yearDir := filepath.Join(lib, "2024")
+	converted := placeFile(t, lib, "sha256", "converted", ".jpg")
+	placeFile(t, lib, "md5", "original", ".jpg")
+	require.NoError(t, library.SaveConfig(lib, library.Config{HashAlgo: "md5", RehashTo: "sha256"}))
+
+	result, err := Run(Config{LibraryPath: lib, To: "md5"}, newLogger())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sha256"}, result.From)
+	assert.Equal(t, 1, result.Renamed)
+	assert.Equal(t, 1, result.Unchanged)
+	assert.NoFileExists(t, filepath.Join(yearDir, filepath.FromSlash(converted)))
+
+	c, err := library.LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, library.Config{HashAlgo: "md5"}, c)
+}
+
+func TestRunErrorsLeaveRehashUnderWay(t *testing.T) {
+	lib := t.TempDir()
+	yearDir := filepath.Join(lib, "2024")
+	rel := placeFile(t, lib, "md5", "photo", ".jpg")
+	// The new name is taken by another file.
+	require.NoError(t, os.WriteFile(filepath.Join(yearDir, filepath.FromSlash(sha256Rel(t, "photo", ".jpg"))), []byte("other"), 0o644))
+
+	result, err := Run(Config{LibraryPath: lib, To: "sha256", FailFast: true}, newLogger())
+	require.Error(t, err)
+	assert.Equal(t, 1, result.Errors)
+	assert.FileExists(t, filepath.Join(yearDir, filepath.FromSlash(rel)))
+
+	c, err := library.LoadConfig(lib)
+	require.NoError(t, err)
+	assert.Equal(t, library.Config{HashAlgo: "md5", RehashTo: "sha256"}, c)
+}
@@ -0,0 +1,252 @@
+// Package stats summarises a library from its layout alone: the year,
+// device and date directories and the source filenames. No file is opened,
+// so stats work without exiftool.
+package stats
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+)
+
+// Default values for Config.
+const (
+	DefaultTop    = 10
+	DefaultMinGap = 30
+)
+
+// Config controls what Collect scans and reports.
+type Config struct {
+	LibraryPath string
+	YearFilter  string
+	// Top is how many of the largest files to list.
+	Top int
+	// MinGap is the shortest run of days without files reported as a
+	// coverage gap.
+	MinGap int
+}
+
+// Bucket aggregates the files sharing a key.
+type Bucket struct {
+	Key   string `json:"key"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// Month is one step of the growth series: files captured in that month
+// and the running totals up to and including it.
+type Month struct {
+	Month      string `json:"month"`
+	Files      int    `json:"files"`
+	Bytes      int64  `json:"bytes"`
+	TotalFiles int    `json:"total_files"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+// File is one entry of the largest-files list.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Gap is a run of days, inclusive, with no captured files.
+type Gap struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	Days int       `json:"days"`
+}
+
+// Stats is the summary of a library.
+type Stats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Undated counts files whose name carries no usable capture date;
+	// they are left out of Growth and Gaps.
+	Undated int `json:"undated"`
+
+	ByYear      []Bucket `json:"by_year"`
+	ByDevice    []Bucket `json:"by_device"`
+	ByMediaType []Bucket `json:"by_media_type"`
+	ByExtension []Bucket `json:"by_extension"`
+	Growth      []Month  `json:"growth"`
+	Largest     []File   `json:"largest"`
+	Gaps        []Gap    `json:"gaps"`
+}
+
+// Collect walks the source files of the selected years and summarises
+// them. Sidecars and OS junk are not counted.
+func Collect(cfg Config, logger *logging.Logger) (*Stats, error) {
+	years, err := library.ListYearsFiltered(cfg.LibraryPath, cfg.YearFilter)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+
+	s := &Stats{}
+	byYear := make(map[string]*Bucket)
+	byDevice := make(map[string]*Bucket)
+	byMedia := make(map[string]*Bucket)
+	byExt := make(map[string]*Bucket)
+	byMonth := make(map[string]*Month)
+	days := make(map[time.Time]bool)
+	var files []File
+
+	for i, year := range years {
+		yearDir := filepath.Join(cfg.LibraryPath, year)
+		logger.ProgressWithStats(i+1, len(years), "[stats] ", "", yearDir)
+
+		paths, err := library.ListSourceFiles(yearDir)
+		if err != nil {
+			return nil, fmt.Errorf("list source files for %s: %w", year, err)
+		}
+		for _, p := range paths {
+			base := filepath.Base(p)
+			if defaults.IsIgnoredFile(base) || defaults.IsSidecarExtension(filepath.Ext(base)) {
+				continue
+			}
+			info, err := os.Stat(p)
+			if err != nil {
+				logger.Warn("stat %s: %v", p, err)
+				continue
+			}
+			size := info.Size()
+			rel, err := filepath.Rel(yearDir, p)
+			if err != nil {
+				continue
+			}
+
+			s.Files++
+			s.Bytes += size
+			files = append(files, File{Path: p, Size: size})
+			add(byYear, year, size)
+
+			device := ""
+			if parts := strings.Split(filepath.ToSlash(rel), "/"); len(parts) >= 3 {
+				device = parts[1]
+			}
+			add(byDevice, orUnknown(device), size)
+			media := "unknown"
+			if mt, ok := pathbuilder.DeviceMediaType(device); ok {
+				media = string(mt)
+			}
+			add(byMedia, media, size)
+			add(byExt, orUnknown(strings.ToLower(filepath.Ext(base))), size)
+
+			parsed, err := pathbuilder.ParseSourceFilename(base)
+			if err != nil || parsed.DateTime.Year() <= 1 {
+				s.Undated++
+				continue
+			}
+			month := parsed.DateTime.Format("2006-01")
+			m, ok := byMonth[month]
+			if !ok {
+				m = &Month{Month: month}
+				byMonth[month] = m
+			}
+			m.Files++
+			m.Bytes += size
+			y, mo, d := parsed.DateTime.Date()
+			days[time.Date(y, mo, d, 0, 0, 0, 0, time.UTC)] = true
+		}
+	}
+
+	s.ByYear = sortedBuckets(byYear, func(a, b Bucket) bool { return a.Key < b.Key })
+	bySize := func(a, b Bucket) bool {
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Key < b.Key
+	}
+	s.ByDevice = sortedBuckets(byDevice, bySize)
+	s.ByMediaType = sortedBuckets(byMedia, bySize)
+	s.ByExtension = sortedBuckets(byExt, bySize)
+	s.Growth = growth(byMonth)
+	s.Largest = largest(files, cfg.Top)
+	s.Gaps = gaps(days, cfg.MinGap)
+	return s, nil
+}
+
+func add(m map[string]*Bucket, key string, size int64) {
+	b, ok := m[key]
+	if !ok {
+		b = &Bucket{Key: key}
+		m[key] = b
+	}
+	b.Files++
+	b.Bytes += size
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func sortedBuckets(m map[string]*Bucket, less func(a, b Bucket) bool) []Bucket {
+	out := make([]Bucket, 0, len(m))
+	for _, b := range m {
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+func growth(byMonth map[string]*Month) []Month {
+	out := make([]Month, 0, len(byMonth))
+	for _, m := range byMonth {
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Month < out[j].Month })
+	var files int
+	var bytes int64
+	for i := range out {
+		files += out[i].Files
+		bytes += out[i].Bytes
+		out[i].TotalFiles, out[i].TotalBytes = files, bytes
+	}
+	return out
+}
+
+func largest(files []File, top int) []File {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Size != files[j].Size {
+			return files[i].Size > files[j].Size
+		}
+		return files[i].Path < files[j].Path
+	})
+	if top < len(files) {
+		files = files[:max(top, 0)]
+	}
+	return files
+}
+
+// gaps returns the runs of at least minGap days without files between the
+// first and the last day that has any.
+func gaps(days map[time.Time]bool, minGap int) []Gap {
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	var out []Gap
+	for i := 1; i < len(sorted); i++ {
+		missing := int(sorted[i].Sub(sorted[i-1]).Hours()/24) - 1
+		if missing >= max(minGap, 1) {
+			out = append(out, Gap{
+				From: sorted[i-1].AddDate(0, 0, 1),
+				To:   sorted[i].AddDate(0, 0, -1),
+				Days: missing,
+			})
+		}
+	}
+	return out
+}
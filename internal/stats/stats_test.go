@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+}
+
+func TestCollect(t *testing.T) {
+	libDir := t.TempDir()
+	img := filepath.Join(libDir, "2023", "sources", "Apple iPhone (image)")
+	vid := filepath.Join(libDir, "2024", "sources", "Apple iPhone (video)")
+	writeFile(t, filepath.Join(img, "2023-01-10", "2023-01-10_10-00-00_aaaaaaaa.jpg"), 100)
+	writeFile(t, filepath.Join(img, "2023-01-10", "2023-01-10_10-00-00_aaaaaaaa.xmp"), 5)
+	writeFile(t, filepath.Join(img, "2023-01-10", ".DS_Store"), 5)
+	writeFile(t, filepath.Join(img, "2023-01-12", "2023-01-12_08-00-00_bbbbbbbb.HEIC"), 300)
+	writeFile(t, filepath.Join(vid, "2024-03-01", "2024-03-01_09-00-00_cccccccc.mov"), 1000)
+	writeFile(t, filepath.Join(vid, "2024-03-01", "clip.mov"), 10)
+
+	s, err := Collect(Config{LibraryPath: libDir, Top: 2, MinGap: 30}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, s.Files)
+	assert.Equal(t, int64(1410), s.Bytes)
+	assert.Equal(t, 1, s.Undated)
+	assert.Equal(t, []Bucket{{"2023", 2, 400}, {"2024", 2, 1010}}, s.ByYear)
+	assert.Equal(t, []Bucket{{"Apple iPhone (video)", 2, 1010}, {"Apple iPhone (image)", 2, 400}}, s.ByDevice)
+	assert.Equal(t, []Bucket{{"video", 2, 1010}, {"image", 2, 400}}, s.ByMediaType)
+	assert.Equal(t, []Bucket{{".mov", 2, 1010}, {".heic", 1, 300}, {".jpg", 1, 100}}, s.ByExtension)
+
+	assert.Equal(t, []Month{
+		{Month: "2023-01", Files: 2, Bytes: 400, TotalFiles: 2, TotalBytes: 400},
+		{Month: "2024-03", Files: 1, Bytes: 1000, TotalFiles: 3, TotalBytes: 1400},
+	}, s.Growth)
+
+	require.Len(t, s.Largest, 2)
+	assert.Equal(t, int64(1000), s.Largest[0].Size)
+	assert.Equal(t, int64(300), s.Largest[1].Size)
+
+	// 2023-01-11 is a one-day gap, below MinGap; the next is reported.
+	require.Len(t, s.Gaps, 1)
+	assert.Equal(t, time.Date(2023, 1, 13, 0, 0, 0, 0, time.UTC), s.Gaps[0].From)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), s.Gaps[0].To)
+	assert.Equal(t, 413, s.Gaps[0].Days)
+}
+
+func TestCollectYearFilter(t *testing.T) {
+	libDir := t.TempDir()
+	writeFile(t, filepath.Join(libDir, "2023", "sources", "A (image)", "2023-01-10", "2023-01-10_10-00-00_aaaaaaaa.jpg"), 1)
+	writeFile(t, filepath.Join(libDir, "2024", "sources", "A (image)", "2024-01-10", "2024-01-10_10-00-00_bbbbbbbb.jpg"), 1)
+
+	s, err := Collect(Config{LibraryPath: libDir, YearFilter: "2024"}, logging.New(os.Stdout, os.Stderr, false))
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Files)
+	assert.Empty(t, s.Largest)
+}
@@ -0,0 +1,67 @@
+package verifier
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/logging"
+)
+
+// Budget caps how much content verification one run performs, so a
+// scheduled job can roll through a large library over several nights.
+// A zero field means no limit on that dimension.
+type Budget struct {
+	Bytes    int64
+	Duration time.Duration
+}
+
+// IsSet reports whether any limit is configured.
+func (b Budget) IsSet() bool {
+	return b.Bytes > 0 || b.Duration > 0
+}
+
+// exhausted reports whether spent bytes or the time since start reach
+// the budget.
+func (b Budget) exhausted(spent int64, start time.Time) bool {
+	if b.Bytes > 0 && spent >= b.Bytes {
+		return true
+	}
+	return b.Duration > 0 && time.Since(start) >= b.Duration
+}
+
+// ParseBudget parses a byte budget ("500GB", "2TB", "1048576") or a time
+// budget ("2h", "45m", "1d").
+func ParseBudget(s string) (Budget, error) {
+	s = strings.TrimSpace(s)
+	if d, err := ParseDuration(s); err == nil {
+		if d <= 0 {
+			return Budget{}, fmt.Errorf("budget %q must be positive", s)
+		}
+		return Budget{Duration: d}, nil
+	}
+	n, err := logging.ParseBytes(s)
+	if err != nil {
+		return Budget{}, fmt.Errorf("budget %q is neither a duration nor a byte size", s)
+	}
+	if n <= 0 {
+		return Budget{}, fmt.Errorf("budget %q must be positive", s)
+	}
+	return Budget{Bytes: n}, nil
+}
+
+// ParseDuration is time.ParseDuration plus single-unit day ("90d") and
+// week ("2w") forms.
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if num, ok := strings.CutSuffix(s, suffix); ok {
+			f, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(f * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
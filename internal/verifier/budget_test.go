@@ -0,0 +1,64 @@
+package verifier
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"90d", 90 * 24 * time.Hour},
+		{"1.5d", 36 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.in)
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.want, got, tt.in)
+	}
+
+	for _, bad := range []string{"", "d", "xd", "10", "10GB"} {
+		_, err := ParseDuration(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseBudget(t *testing.T) {
+	b, err := ParseBudget("2h")
+	require.NoError(t, err)
+	assert.Equal(t, Budget{Duration: 2 * time.Hour}, b)
+
+	b, err = ParseBudget("500GB")
+	require.NoError(t, err)
+	assert.Equal(t, Budget{Bytes: 500 << 30}, b)
+
+	b, err = ParseBudget("5000")
+	require.NoError(t, err)
+	assert.Equal(t, Budget{Bytes: 5000}, b)
+
+	for _, bad := range []string{"0", "0h", "soon"} {
+		_, err := ParseBudget(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestBudgetExhausted(t *testing.T) {
+	assert.False(t, Budget{}.IsSet())
+	assert.False(t, Budget{}.exhausted(1<<40, time.Now().Add(-time.Hour)))
+
+	b := Budget{Bytes: 100}
+	assert.False(t, b.exhausted(99, time.Now()))
+	assert.True(t, b.exhausted(100, time.Now()))
+
+	b = Budget{Duration: time.Minute}
+	assert.False(t, b.exhausted(0, time.Now()))
+	assert.True(t, b.exhausted(0, time.Now().Add(-2*time.Minute)))
+}
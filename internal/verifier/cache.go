@@ -11,11 +11,12 @@ import (
 	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
 )
 
 const (
 	cacheFileName      = "verify.cache"
-	cacheDirName       = ".imv"
+	cacheDirName       = library.StateDirName
 	cacheFormatVersion = "v1"
 	cacheFieldSep      = "\t"
 	persistInterval    = 30 * time.Second
@@ -59,6 +60,23 @@ func CacheFilePath(yearDir string) string {
 	return filepath.Join(yearDir, cacheDirName, cacheFileName)
 }
 
+// DropCaches removes the verify cache of every year of the library at
+// libraryPath, so the next verify checks every file's path again. Needed
+// when the expected paths change, as they do with the owner mapping.
+func DropCaches(libraryPath string) error {
+	years, err := library.ListYears(libraryPath)
+	if err != nil {
+		return fmt.Errorf("list years: %w", err)
+	}
+	for _, year := range years {
+		err := os.Remove(CacheFilePath(filepath.Join(libraryPath, year)))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("drop verify cache of %s: %w", year, err)
+		}
+	}
+	return nil
+}
+
 // CacheDirPath returns the .imv directory path for a year directory.
 func CacheDirPath(yearDir string) string {
 	return filepath.Join(yearDir, cacheDirName)
@@ -275,7 +293,7 @@ func parseCacheLine(line string) (Entry, bool) {
 	if len(parts) != 5 {
 		return Entry{}, false
 	}
-	if parts[0] == "" || parts[3] == "" {
+	if parts[0] == "" || !defaults.IsHashAlgorithm(parts[3]) {
 		return Entry{}, false
 	}
 	size, err := strconv.ParseInt(parts[1], 10, 64)
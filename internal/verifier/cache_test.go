@@ -96,6 +96,7 @@ func TestCacheLoad_MalformedLinesSkipped(t *testing.T) {
 		"p\t100\t1\tmd5\tnot-a-number\n" + // bad verified_at
 		"p\t-1\t1\tmd5\t10\n" + // negative size
 		"p\t100\t1\t\t10\n" + // empty algo
+		"p\t100\t1\tsha512\t10\n" + // unknown algo
 		"valid\t100\t1\tmd5\t10\n"
 	writeCacheFile(t, path, content)
 
@@ -0,0 +1,171 @@
+package verifier
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FindingKind classifies an inconsistency reported by the verifier.
+type FindingKind string
+
+const (
+	// FindingUnexpectedEntry is a file or directory that has no place at
+	// its level of the layout (library root, year dir, sources/, device dir).
+	FindingUnexpectedEntry FindingKind = "unexpected-entry"
+	// FindingInvalidDeviceDir is a directory in sources/ whose name does not
+	// match "<Make> [Model] (<type>)".
+	FindingInvalidDeviceDir FindingKind = "invalid-device-dir"
+	// FindingInvalidDateDir is a directory in a device dir whose name is not
+	// a valid YYYY-MM-DD date.
+	FindingInvalidDateDir FindingKind = "invalid-date-dir"
+	// FindingDateDirYear is a date dir whose year differs from the year level.
+	FindingDateDirYear FindingKind = "date-dir-year"
+	// FindingFilenameDate is a source file whose filename date differs from
+	// its date dir.
+	FindingFilenameDate FindingKind = "filename-date"
+	// FindingInvalidFilename is a source file whose name does not match
+	// YYYY-MM-DD_HH-MM-SS_<hash>.<ext> (fast mode only; full mode reports
+	// these as path mismatches).
+	FindingInvalidFilename FindingKind = "invalid-filename"
+	// FindingPathMismatch is a source file whose path rebuilt from metadata
+	// and content hash differs from where it actually lives.
+	FindingPathMismatch FindingKind = "path-mismatch"
+	// FindingContentCorrupted is a source file whose full content hash no
+	// longer matches the hash recorded in the year's manifest — silent
+	// corruption (bit-rot) rather than a misplaced file.
+	FindingContentCorrupted FindingKind = "content-corrupted"
+	// FindingOrphanSidecar is a sidecar (.xmp, .yaml, .json) in sources/
+	// with no primary file of the same name beside it, typically left
+	// behind when its primary was moved or deleted.
+	FindingOrphanSidecar FindingKind = "orphan-sidecar"
+	// FindingDerivedInSources is an edited export (see pathbuilder.Derived)
+	// in sources/, which is meant for camera originals.
+	FindingDerivedInSources FindingKind = "derived-in-sources"
+)
+
+// FindingKinds lists every kind in the order the summary reports them.
+var FindingKinds = []FindingKind{
+	FindingUnexpectedEntry,
+	FindingInvalidDeviceDir,
+	FindingInvalidDateDir,
+	FindingDateDirYear,
+	FindingFilenameDate,
+	FindingInvalidFilename,
+	FindingPathMismatch,
+	FindingContentCorrupted,
+	FindingOrphanSidecar,
+	FindingDerivedInSources,
+}
+
+// ParseFindingKind returns the FindingKind named s.
+func ParseFindingKind(s string) (FindingKind, error) {
+	for _, k := range FindingKinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	names := make([]string, len(FindingKinds))
+	for i, k := range FindingKinds {
+		names[i] = string(k)
+	}
+	return "", fmt.Errorf("unknown finding kind %q (valid: %s)", s, strings.Join(names, ", "))
+}
+
+// Finding is a single inconsistency discovered during verification.
+type Finding struct {
+	Kind FindingKind `json:"kind"`
+	// Path is the absolute path of the offending file or directory.
+	Path string `json:"path"`
+	// ExpectedPath is where the file should live, when that is known.
+	ExpectedPath string `json:"expected_path,omitempty"`
+	// Details is a short human-readable explanation.
+	Details string `json:"details,omitempty"`
+	// Ignored is set when the kind was excluded by Config.IgnoreKinds or
+	// Config.OnlyKinds: the finding is recorded but does not fail the run.
+	Ignored bool `json:"ignored,omitempty"`
+}
+
+// String formats the finding for log output.
+func (f Finding) String() string {
+	var b strings.Builder
+	b.WriteString(string(f.Kind))
+	b.WriteString(": ")
+	b.WriteString(f.Path)
+	if f.Details != "" {
+		b.WriteString(" (")
+		b.WriteString(f.Details)
+		b.WriteString(")")
+	}
+	if f.ExpectedPath != "" {
+		b.WriteString(" should be at ")
+		b.WriteString(f.ExpectedPath)
+	}
+	return b.String()
+}
+
+// KindCount is the number of findings of one kind.
+type KindCount struct {
+	Kind    FindingKind
+	Count   int
+	Ignored int
+}
+
+// CountByKind groups findings by kind, in FindingKinds order. Kinds with no
+// findings are omitted.
+func (r *Result) CountByKind() []KindCount {
+	counts := make(map[FindingKind]*KindCount)
+	for _, f := range r.Findings {
+		kc, ok := counts[f.Kind]
+		if !ok {
+			kc = &KindCount{Kind: f.Kind}
+			counts[f.Kind] = kc
+		}
+		if f.Ignored {
+			kc.Ignored++
+		} else {
+			kc.Count++
+		}
+	}
+
+	out := make([]KindCount, 0, len(counts))
+	for _, k := range FindingKinds {
+		if kc, ok := counts[k]; ok {
+			out = append(out, *kc)
+		}
+	}
+	return out
+}
+
+// failsRun reports whether findings of kind k count as inconsistencies
+// under the configured kind filters.
+func (v *Verifier) failsRun(k FindingKind) bool {
+	if len(v.cfg.OnlyKinds) > 0 && !slices.Contains(v.cfg.OnlyKinds, k) {
+		return false
+	}
+	return !slices.Contains(v.cfg.IgnoreKinds, k)
+}
+
+// record adds f to result and reports whether it fails the run. A failing
+// finding is logged and counted as an inconsistency; an ignored one is
+// only recorded.
+func (v *Verifier) record(result *Result, f Finding) bool {
+	if !v.failsRun(f.Kind) {
+		f.Ignored = true
+		result.Findings = append(result.Findings, f)
+		return false
+	}
+	result.Findings = append(result.Findings, f)
+	result.Inconsistent++
+	v.logger.Warn("%s", f)
+	return true
+}
+
+// report records f and, under FailFast, returns it as an error when it
+// fails the run.
+func (v *Verifier) report(result *Result, f Finding) error {
+	if v.record(result, f) && v.cfg.FailFast {
+		return fmt.Errorf("%s", f)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package verifier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFindingKind(t *testing.T) {
+	for _, k := range FindingKinds {
+		got, err := ParseFindingKind(string(k))
+		require.NoError(t, err)
+		assert.Equal(t, k, got)
+	}
+
+	_, err := ParseFindingKind("no-such-kind")
+	assert.Error(t, err)
+}
+
+func TestFindingString(t *testing.T) {
+	f := Finding{
+		Kind:         FindingPathMismatch,
+		Path:         "/lib/2024/a.jpg",
+		ExpectedPath: "/lib/2024/b.jpg",
+	}
+	assert.Equal(t, "path-mismatch: /lib/2024/a.jpg should be at /lib/2024/b.jpg", f.String())
+
+	f = Finding{Kind: FindingUnexpectedEntry, Path: "/lib/x", Details: "file in library root"}
+	assert.Equal(t, "unexpected-entry: /lib/x (file in library root)", f.String())
+}
+
+func TestResultCountByKind(t *testing.T) {
+	r := &Result{Findings: []Finding{
+		{Kind: FindingPathMismatch},
+		{Kind: FindingUnexpectedEntry},
+		{Kind: FindingPathMismatch},
+		{Kind: FindingUnexpectedEntry, Ignored: true},
+	}}
+
+	assert.Equal(t, []KindCount{
+		{Kind: FindingUnexpectedEntry, Count: 1, Ignored: 1},
+		{Kind: FindingPathMismatch, Count: 2},
+	}, r.CountByKind())
+}
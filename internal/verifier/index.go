@@ -0,0 +1,95 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/metadata"
+)
+
+// index returns the library index, loading it on first use. Dry runs
+// leave it untouched. A load failure is reported once and leaves a nil
+// (no-op) index.
+func (v *Verifier) index() *index.Index {
+	if v.cfg.DryRun {
+		return nil
+	}
+	if !v.idxLoaded {
+		v.idxLoaded = true
+		ix, err := index.Load(index.FilePath(v.cfg.LibraryPath))
+		if err != nil {
+			v.logger.Warn("library index: load failed: %v", err)
+		}
+		v.idx = ix
+	}
+	return v.idx
+}
+
+// closeIndex flushes the library index and forgets it, so that the next
+// use reloads it — after a re-import, say, which writes to it directly.
+func (v *Verifier) closeIndex() {
+	if err := v.idx.Close(); err != nil {
+		v.logger.Warn("library index: %v", err)
+	}
+	v.idx, v.idxLoaded = nil, false
+}
+
+// indexFile records a verified library file, keeping the import session
+// and perceptual hash of an existing record for the same content.
+func (v *Verifier) indexFile(absPath string, md *metadata.FileMetadata, size int64) {
+	rel, err := v.libraryRel(absPath)
+	if err != nil {
+		return
+	}
+	r := index.FromMetadata(rel, md, v.cfg.HashAlgo, size)
+	prev, ok := v.index().Get(rel)
+	if ok && prev.SameContent(r) {
+		r.Session, r.PHash = prev.Session, prev.PHash
+	}
+	if ok && reflect.DeepEqual(r, prev) {
+		return
+	}
+	if err := v.index().Put(r); err != nil {
+		v.logger.Warn("index %s: %v", rel, err)
+	}
+}
+
+// indexMove moves the index record of a relocated file.
+func (v *Verifier) indexMove(fromAbs, toAbs string) {
+	from, err := v.libraryRel(fromAbs)
+	if err != nil {
+		return
+	}
+	to, err := v.libraryRel(toAbs)
+	if err != nil {
+		return
+	}
+	r, ok := v.index().Get(from)
+	if !ok {
+		return
+	}
+	if err := v.index().Delete(from); err != nil {
+		v.logger.Warn("index %s: %v", from, err)
+	}
+	r.Path = to
+	if err := v.index().Put(r); err != nil {
+		v.logger.Warn("index %s: %v", to, err)
+	}
+}
+
+// pruneIndex drops the records of a year's files that no longer exist.
+func (v *Verifier) pruneIndex(year string) {
+	for _, r := range v.index().Records() {
+		if !strings.HasPrefix(r.Path, year+"/") {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(v.cfg.LibraryPath, filepath.FromSlash(r.Path))); os.IsNotExist(err) {
+			if err := v.index().Delete(r.Path); err != nil {
+				v.logger.Warn("index %s: %v", r.Path, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package verifier
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyUpdatesIndex(t *testing.T) {
+	libDir := t.TempDir()
+	goodDir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	wrongDir := filepath.Join(libDir, "2024", "sources", "WrongDevice (image)", "2024-01-15")
+	good := placeSource(t, goodDir, "indexed good", ".jpg")
+	misplaced := placeSource(t, wrongDir, "indexed misplaced", ".jpg")
+
+	rel := func(p string) string {
+		r, err := filepath.Rel(libDir, p)
+		require.NoError(t, err)
+		return filepath.ToSlash(r)
+	}
+
+	// Seed the index with an import session for the misplaced file and a
+	// record for a file that is gone.
+	full, _, err := metadata.ComputeFileHash(misplaced, mustHasher("md5"))
+	require.NoError(t, err)
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	require.NoError(t, ix.Put(index.Record{Path: rel(misplaced), FullHash: full, HashAlgo: "md5", Session: "s1"}))
+	require.NoError(t, ix.Put(index.Record{Path: "2024/sources/TestMake TestModel (image)/2024-01-15/gone.jpg"}))
+	require.NoError(t, ix.Close())
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Fixed)
+
+	ix, err = index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	moved := filepath.Join(goodDir, filepath.Base(misplaced))
+	assert.Equal(t, 2, ix.Len())
+
+	r, ok := ix.Get(rel(good))
+	require.True(t, ok)
+	assert.Equal(t, "TestMake", r.Make)
+	assert.Equal(t, "md5", r.HashAlgo)
+	assert.NotEmpty(t, r.FullHash)
+
+	r, ok = ix.Get(rel(moved))
+	require.True(t, ok)
+	assert.Equal(t, "s1", r.Session)
+	assert.Equal(t, full, r.FullHash)
+	_, ok = ix.Get(rel(misplaced))
+	assert.False(t, ok)
+}
+
+func TestVerifyDryRunLeavesIndexAlone(t *testing.T) {
+	libDir := t.TempDir()
+	dir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	placeSource(t, dir, "dry run", ".jpg")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true, DryRun: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	_, err = v.Verify()
+	require.NoError(t, err)
+
+	ix, err := index.Load(index.FilePath(libDir))
+	require.NoError(t, err)
+	assert.Equal(t, 0, ix.Len())
+}
@@ -0,0 +1,354 @@
+package verifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/transfer"
+)
+
+// planVersion is bumped when the JSON plan format changes incompatibly.
+const planVersion = 1
+
+// Plan is the relocation plan of a `verify --fix --dry-run` run. Paths are
+// library-relative and slash-separated so a reviewed plan can be applied
+// from the same library on another machine or mount point.
+type Plan struct {
+	Version  int           `json:"version"`
+	Library  string        `json:"library"`
+	HashAlgo string        `json:"hash_algo"`
+	Created  time.Time     `json:"created"`
+	Moves    []PlannedMove `json:"moves"`
+}
+
+// PlannedMove is one file relocation.
+type PlannedMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Hash is the full content hash of From when the plan was made; apply
+	// skips the move if the file changed since.
+	Hash string `json:"hash,omitempty"`
+	// Sidecar marks a sidecar travelling with the preceding primary.
+	Sidecar bool `json:"sidecar,omitempty"`
+	// Duplicate marks a move onto an identical file: applying it just
+	// removes From.
+	Duplicate bool `json:"duplicate,omitempty"`
+	// Conflict, when set, says why the move is not safe; apply skips it.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Conflicts returns how many moves in the plan are marked as conflicts.
+func (p *Plan) Conflicts() int {
+	n := 0
+	for _, m := range p.Moves {
+		if m.Conflict != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// SaveToFile writes the plan as indented JSON.
+func (p *Plan) SaveToFile(filename string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// LoadPlanFromFile reads a plan written by SaveToFile.
+func LoadPlanFromFile(filename string) (*Plan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p Plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if p.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d (expected %d)", p.Version, planVersion)
+	}
+	return &p, nil
+}
+
+// WriteScript writes the plan as a POSIX shell script to run from the
+// library root. Conflicting moves are emitted commented out, and a
+// sidecar is only moved once its primary is gone from where it was.
+func (p *Plan) WriteScript(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#!/bin/sh\n# imv verify --fix plan for %s, created %s\n", p.Library, p.Created.Format(time.RFC3339))
+	b.WriteString("# Run from the library root. Conflicting moves are commented out;\n")
+	b.WriteString("# sidecars move only if their primary did.\nset -e\n\n")
+	var primary string
+	for _, m := range p.Moves {
+		prefix := ""
+		if m.Conflict != "" {
+			fmt.Fprintf(&b, "# conflict: %s\n", m.Conflict)
+			prefix = "# "
+		}
+		if !m.Sidecar {
+			primary = m.From
+		}
+		if m.Duplicate {
+			fmt.Fprintf(&b, "%srm -- %s  # identical copy at %s\n", prefix, shellQuote(m.From), shellQuote(m.To))
+			continue
+		}
+		mv := fmt.Sprintf("mkdir -p -- %s && mv -n -- %s %s",
+			shellQuote(pathDir(m.To)), shellQuote(m.From), shellQuote(m.To))
+		if m.Sidecar {
+			mv = fmt.Sprintf("if [ ! -e %s ]; then %s; fi", shellQuote(primary), mv)
+		}
+		fmt.Fprintf(&b, "%s%s\n", prefix, mv)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func pathDir(slashPath string) string {
+	if i := strings.LastIndex(slashPath, "/"); i >= 0 {
+		return slashPath[:i]
+	}
+	return "."
+}
+
+// planMove records the relocation of a misplaced file and its sidecars
+// instead of performing it. Transfer's own dry run classifies the target.
+// The sidecars of a primary that conflicts are conflicts too, so they are
+// not moved away from it.
+func (v *Verifier) planMove(from, to, fullHash string, result *Result) {
+	primary, ok := v.addPlannedMove(from, to, fullHash, false, "", result)
+	if !ok {
+		return
+	}
+	held := ""
+	if primary.Conflict != "" {
+		held = "its primary is not moved: " + primary.Conflict
+	}
+	for _, sc := range findSidecars(from) {
+		v.addPlannedMove(sc, pathbuilder.BuildSidecarPath(to, filepath.Ext(sc)), "", true, held, result)
+	}
+}
+
+// addPlannedMove adds a move to the plan, with conflict held if set, and
+// returns it; false if the paths are outside the library.
+func (v *Verifier) addPlannedMove(from, to, fullHash string, sidecar bool, held string, result *Result) (PlannedMove, bool) {
+	m := PlannedMove{Hash: fullHash, Sidecar: sidecar}
+	var err error
+	if m.From, err = v.libraryRel(from); err != nil {
+		result.Errors++
+		v.logger.Error("plan move %s: %v", from, err)
+		return m, false
+	}
+	if m.To, err = v.libraryRel(to); err != nil {
+		result.Errors++
+		v.logger.Error("plan move %s: %v", to, err)
+		return m, false
+	}
+	if held != "" {
+		m.Conflict = held
+		result.Plan.Moves = append(result.Plan.Moves, m)
+		return m, true
+	}
+
+	action, err := transfer.TransferFile(from, to, transfer.Options{
+		Move:       true,
+		DryRun:     true,
+		NewHash:    v.hasher.New,
+		SourceHash: fullHash,
+	})
+	switch {
+	case err != nil:
+		m.Conflict = err.Error()
+	case action == transfer.ActionWouldReplace:
+		m.Conflict = "target exists with different content"
+	case action == transfer.ActionWouldMove:
+		if _, statErr := os.Stat(to); statErr == nil {
+			m.Duplicate = true
+		}
+	}
+
+	if prev, ok := v.planned[m.To]; ok && m.Conflict == "" {
+		if fullHash != "" && prev == fullHash {
+			m.Duplicate = true
+		} else {
+			m.Conflict = "another planned move targets the same path"
+		}
+	}
+	if _, ok := v.planned[m.To]; !ok {
+		v.planned[m.To] = fullHash
+	}
+
+	result.Plan.Moves = append(result.Plan.Moves, m)
+	return m, true
+}
+
+// libraryRel converts an absolute library path to the plan's form.
+func (v *Verifier) libraryRel(path string) (string, error) {
+	rel, err := filepath.Rel(v.cfg.LibraryPath, path)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the library", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// ApplyResult holds the outcome counts of applying a plan.
+type ApplyResult struct {
+	Moved   int
+	Skipped int
+	Errors  int
+}
+
+// checkPlanPath rejects a plan path that could reach outside the library:
+// an absolute one, or one with a ".." element. Plans are edited by hand.
+func checkPlanPath(p string) error {
+	fp := filepath.FromSlash(p)
+	if p == "" || strings.HasPrefix(p, "/") || filepath.IsAbs(fp) || filepath.VolumeName(fp) != "" {
+		return fmt.Errorf("%q is not a library-relative path", p)
+	}
+	for _, elem := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if elem == ".." {
+			return fmt.Errorf("%q leaves the library", p)
+		}
+	}
+	return nil
+}
+
+// ApplyPlan executes a reviewed plan against the library. Conflicting
+// moves are skipped, as is any move whose source changed since the plan
+// was made or whose target has since appeared with different content.
+// Sidecars follow their primary: when it is skipped or fails to move,
+// they stay with it. A plan with a path outside the library is rejected
+// as a whole.
+func (v *Verifier) ApplyPlan(p *Plan) (*ApplyResult, error) {
+	if p.HashAlgo != v.cfg.HashAlgo {
+		return nil, fmt.Errorf("plan uses hash algorithm %s, but this run uses %s", p.HashAlgo, v.cfg.HashAlgo)
+	}
+	for _, m := range p.Moves {
+		for _, path := range []string{m.From, m.To} {
+			if err := checkPlanPath(path); err != nil {
+				return nil, fmt.Errorf("plan: %w", err)
+			}
+		}
+	}
+
+	res := &ApplyResult{}
+	defer v.closeIndex()
+	// manifests holds the hash manifest of every year a primary moved
+	// into, so it stays tracked at its new path (see trackedEntries).
+	manifests := make(map[string]*library.Manifest)
+	defer func() {
+		for year, m := range manifests {
+			if m.Dirty() {
+				if err := m.Persist(); err != nil {
+					v.logger.Warn("hash manifest for %s: persist failed: %v", year, err)
+				}
+			}
+		}
+	}()
+	// primaryMoved is whether the primary the next sidecars belong to
+	// was moved.
+	primaryMoved := false
+	for i, m := range p.Moves {
+		v.logger.ProgressWithStats(i+1, len(p.Moves), "[apply] ", fmt.Sprintf("moved:%d skipped:%d", res.Moved, res.Skipped), m.From)
+
+		if !m.Sidecar {
+			primaryMoved = false
+		} else if !primaryMoved {
+			res.Skipped++
+			v.logger.Warn("skip %s: its primary was not moved", m.From)
+			continue
+		}
+		if m.Conflict != "" {
+			res.Skipped++
+			v.logger.Warn("skip %s: %s", m.From, m.Conflict)
+			continue
+		}
+		from := filepath.Join(v.cfg.LibraryPath, filepath.FromSlash(m.From))
+		to := filepath.Join(v.cfg.LibraryPath, filepath.FromSlash(m.To))
+
+		full, _, err := metadata.ComputeFileHash(from, v.hasher)
+		if err != nil {
+			res.Skipped++
+			v.logger.Warn("skip %s: %v", m.From, err)
+			continue
+		}
+		if m.Hash != "" && full != m.Hash {
+			res.Skipped++
+			v.logger.Warn("skip %s: content changed since the plan was made", m.From)
+			continue
+		}
+		if _, err := os.Stat(to); err == nil {
+			target, _, err := metadata.ComputeFileHash(to, v.hasher)
+			if err != nil || target != full {
+				res.Skipped++
+				v.logger.Warn("skip %s: %s exists with different content", m.From, m.To)
+				continue
+			}
+		}
+
+		if _, err := transfer.TransferFile(from, to, transfer.Options{
+			Move:       true,
+			NewHash:    v.hasher.New,
+			SourceHash: full,
+		}); err != nil {
+			res.Errors++
+			v.logger.Error("move %s → %s: %v", m.From, m.To, err)
+			continue
+		}
+		if !m.Sidecar {
+			primaryMoved = true
+			v.indexMove(from, to)
+			v.recordApplied(manifests, m.To, full)
+		}
+		res.Moved++
+	}
+	return res, nil
+}
+
+// recordApplied records the full hash of a primary a plan moved to
+// relPath (library-relative) in its year's manifest, loading that into
+// manifests on first use.
+func (v *Verifier) recordApplied(manifests map[string]*library.Manifest, relPath, fullHash string) {
+	year, relToYear, ok := strings.Cut(relPath, "/")
+	if !ok {
+		return
+	}
+	ym, ok := manifests[year]
+	if !ok {
+		var err error
+		if ym, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(v.cfg.LibraryPath, year))); err != nil {
+			v.logger.Warn("hash manifest for %s: load failed: %v", year, err)
+		}
+		manifests[year] = ym
+	}
+	if err := ym.Record(library.ManifestEntry{
+		RelPath:  relToYear,
+		HashAlgo: v.cfg.HashAlgo,
+		FullHash: fullHash,
+	}); err != nil {
+		v.logger.Warn("hash manifest record failed for %s: %v", relPath, err)
+	}
+}
+
+// isPlanning reports whether fixes are collected into a plan instead of
+// being performed.
+func (v *Verifier) isPlanning() bool {
+	return v.cfg.Fix && v.cfg.DryRun
+}
@@ -0,0 +1,201 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planLibrary builds a library with one misplaced file (plus sidecar),
+// one misplaced copy of a file already in place, and one misplaced file
+// (plus sidecar) whose target is occupied by different content.
+func planLibrary(t *testing.T) (libDir string) {
+	t.Helper()
+	libDir = t.TempDir()
+	wrong := filepath.Join(libDir, "2024", "sources", "WrongDevice (image)", "2024-01-15")
+	good := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+
+	primary := placeSource(t, wrong, "to move", ".jpg")
+	createTestFile(t, strings.TrimSuffix(primary, ".jpg")+".xmp", "xmp")
+
+	placeSource(t, good, "already there", ".jpg")
+	placeSource(t, wrong, "already there", ".jpg")
+
+	blocked := placeSource(t, wrong, "blocked", ".jpg")
+	createTestFile(t, strings.TrimSuffix(blocked, ".jpg")+".xmp", "blocked xmp")
+	createTestFile(t, filepath.Join(good, filepath.Base(blocked)), "squatter")
+	return libDir
+}
+
+func TestVerifyDryRunBuildsPlan(t *testing.T) {
+	libDir := planLibrary(t)
+	before := listTree(t, libDir)
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true, DryRun: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Fixed)
+	assert.Equal(t, before, listTree(t, libDir), "dry run must not touch the library")
+
+	require.NotNil(t, result.Plan)
+	var moves, sidecars, dupes, conflicts int
+	for _, m := range result.Plan.Moves {
+		switch {
+		case m.Conflict != "":
+			conflicts++
+		case m.Duplicate:
+			dupes++
+		case m.Sidecar:
+			sidecars++
+		default:
+			moves++
+		}
+		assert.False(t, filepath.IsAbs(m.From), m.From)
+		assert.True(t, strings.HasPrefix(m.To, "2024/sources/TestMake TestModel (image)/2024-01-15/"), m.To)
+	}
+	// The squatter itself is misplaced (its name doesn't match its hash)
+	// and is planned too, so four primaries plus two sidecars. The
+	// blocked file's sidecar conflicts along with it.
+	assert.Equal(t, 1, sidecars)
+	assert.Equal(t, 1, dupes)
+	assert.Equal(t, 2, conflicts)
+	assert.Equal(t, 2, moves)
+	assert.Equal(t, 2, result.Plan.Conflicts())
+	for _, m := range result.Plan.Moves {
+		if m.Sidecar && m.Conflict != "" {
+			assert.Contains(t, m.Conflict, "its primary is not moved")
+		}
+	}
+}
+
+func TestApplyPlan(t *testing.T) {
+	libDir := planLibrary(t)
+	cfg := Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true, DryRun: true}
+	v, err := New(cfg, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+
+	planFile := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, result.Plan.SaveToFile(planFile))
+	plan, err := LoadPlanFromFile(planFile)
+	require.NoError(t, err)
+	assert.Equal(t, result.Plan.Moves, plan.Moves)
+
+	cfg.Fix, cfg.DryRun = false, false
+	v, err = New(cfg, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	res, err := v.ApplyPlan(plan)
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Errors)
+	assert.Equal(t, 2, res.Skipped, "the conflicting move and its sidecar are skipped")
+	assert.Equal(t, len(plan.Moves)-2, res.Moved)
+
+	for _, m := range plan.Moves {
+		if m.Conflict != "" {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(libDir, m.To))
+		assert.NoError(t, err, m.To)
+		_, err = os.Stat(filepath.Join(libDir, m.From))
+		assert.True(t, os.IsNotExist(err), m.From)
+	}
+}
+
+func TestApplyPlanSkipsChangedSource(t *testing.T) {
+	libDir := planLibrary(t)
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true, DryRun: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+
+	// The primary with a sidecar, and the sidecar.
+	var moves []PlannedMove
+	for i, m := range result.Plan.Moves {
+		if !m.Sidecar && m.Conflict == "" && i+1 < len(result.Plan.Moves) && result.Plan.Moves[i+1].Sidecar {
+			moves = result.Plan.Moves[i : i+2]
+			break
+		}
+	}
+	require.Len(t, moves, 2)
+	createTestFile(t, filepath.Join(libDir, moves[0].From), "edited after review")
+
+	res, err := v.ApplyPlan(&Plan{Version: planVersion, HashAlgo: "md5", Moves: moves})
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Moved)
+	assert.Equal(t, 2, res.Skipped, "the sidecar stays with its primary")
+	assert.FileExists(t, filepath.Join(libDir, moves[1].From))
+
+	_, err = v.ApplyPlan(&Plan{Version: planVersion, HashAlgo: "sha256"})
+	assert.Error(t, err)
+}
+
+func TestApplyPlanRejectsPathsOutsideLibrary(t *testing.T) {
+	libDir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "victim.jpg")
+	createTestFile(t, outside, "not in the library")
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	for _, m := range []PlannedMove{
+		{From: filepath.ToSlash(outside), To: "2024/sources/x.jpg"},
+		{From: "2024/sources/x.jpg", To: "../x.jpg"},
+		{From: "2024/sources/../../../x.jpg", To: "2024/sources/x.jpg"},
+		{From: "", To: "2024/sources/x.jpg"},
+	} {
+		_, err := v.ApplyPlan(&Plan{Version: planVersion, HashAlgo: "md5", Moves: []PlannedMove{m}})
+		assert.Error(t, err, m)
+	}
+	assert.FileExists(t, outside)
+	assert.NoError(t, checkPlanPath("2024/sources/a..b/x.jpg"))
+}
+
+func TestPlanWriteScript(t *testing.T) {
+	p := &Plan{
+		Version: planVersion,
+		Library: "/lib",
+		Created: time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+		Moves: []PlannedMove{
+			{From: "2024/sources/a/x's.jpg", To: "2024/sources/b/2024-01-15/y.jpg"},
+			{From: "2024/sources/a/x's.xmp", To: "2024/sources/b/2024-01-15/y.xmp", Sidecar: true},
+			{From: "2024/sources/a/d.jpg", To: "2024/sources/b/2024-01-15/d.jpg", Duplicate: true},
+			{From: "2024/sources/a/c.jpg", To: "2024/sources/b/2024-01-15/c.jpg", Conflict: "target exists with different content"},
+		},
+	}
+	var b strings.Builder
+	require.NoError(t, p.WriteScript(&b))
+	out := b.String()
+	assert.True(t, strings.HasPrefix(out, "#!/bin/sh\n"))
+	assert.Contains(t, out, `mkdir -p -- '2024/sources/b/2024-01-15' && mv -n -- '2024/sources/a/x'\''s.jpg' '2024/sources/b/2024-01-15/y.jpg'`)
+	assert.Contains(t, out, `if [ ! -e '2024/sources/a/x'\''s.jpg' ]; then mkdir -p -- '2024/sources/b/2024-01-15' && mv -n -- '2024/sources/a/x'\''s.xmp' '2024/sources/b/2024-01-15/y.xmp'; fi`)
+	assert.Contains(t, out, "\nrm -- '2024/sources/a/d.jpg'")
+	assert.Contains(t, out, "# conflict: target exists with different content\n# mkdir -p")
+}
+
+// listTree returns every file path under root, relative to it, leaving
+// out imv's own state directories.
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var out []string
+	require.NoError(t, filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == library.StateDirName {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(root, p)
+			out = append(out, rel)
+		}
+		return nil
+	}))
+	return out
+}
@@ -0,0 +1,208 @@
+package verifier
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/library"
+)
+
+const (
+	quarantineDirName      = "quarantine"
+	quarantineManifestName = "quarantine.manifest"
+)
+
+// QuarantineDir returns the library-level directory holding quarantined
+// entries, one dated subdirectory per run.
+func QuarantineDir(libraryPath string) string {
+	return filepath.Join(libraryPath, library.StateDirName, quarantineDirName)
+}
+
+// quarantine moves unexpected entries out of the library layout into a
+// dated holding directory, mirroring their library-relative paths, and
+// keeps a manifest of where each one came from. The directory is created
+// on first use so a clean run leaves nothing behind.
+type quarantine struct {
+	libraryPath string
+	dir         string
+	moved       []string // absolute original paths, in move order
+}
+
+func newQuarantine(libraryPath string, now time.Time) *quarantine {
+	return &quarantine{
+		libraryPath: libraryPath,
+		dir:         filepath.Join(QuarantineDir(libraryPath), now.Format("2006-01-02_15-04-05")),
+	}
+}
+
+// add moves path (a file or directory inside the library) into the
+// quarantine and returns its new location.
+func (q *quarantine) add(path string) (string, error) {
+	rel, err := filepath.Rel(q.libraryPath, path)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", path, err)
+	}
+	dest := filepath.Join(q.dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("create quarantine dir: %w", err)
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", fmt.Errorf("move to quarantine: %w", err)
+	}
+	q.moved = append(q.moved, path)
+	return dest, nil
+}
+
+// persist writes the manifest of original paths. It is rewritten after
+// every move so an interrupted run still records what it quarantined.
+func (q *quarantine) persist() error {
+	if len(q.moved) == 0 {
+		return nil
+	}
+	return library.WriteFileAtomic(filepath.Join(q.dir, quarantineManifestName), func(w *bufio.Writer) error {
+		if _, err := fmt.Fprintln(w, "# imv quarantine v1 — fields: original_path\\tquarantined_path (relative to this directory)"); err != nil {
+			return err
+		}
+		for _, orig := range q.moved {
+			rel, err := filepath.Rel(q.libraryPath, orig)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", orig, filepath.ToSlash(rel)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// stray is an unexpected file or directory queued by reportStructure.
+type stray struct {
+	path  string
+	isDir bool
+}
+
+// reportStructure reports a file or directory that has no place in the
+// layout. Under FixStructure a failing finding is queued for fixStrays
+// instead of stopping the run.
+func (v *Verifier) reportStructure(result *Result, f Finding, isDir bool) error {
+	if !v.cfg.FixStructure {
+		return v.report(result, f)
+	}
+	// Dry runs only plan --fix moves; structure repairs are not previewed.
+	if v.record(result, f) && !v.cfg.DryRun {
+		v.strays = append(v.strays, stray{path: f.Path, isDir: isDir})
+	}
+	return nil
+}
+
+// fixStrays repairs the queued strays: media files in them are
+// re-imported to their canonical paths, and whatever is left is
+// quarantined. Directories left with nothing but OS junk are removed.
+// Stray files are imported in one batch so sidecars stay paired.
+func (v *Verifier) fixStrays(result *Result) {
+	strays := v.strays
+	v.strays = nil
+	if len(strays) == 0 {
+		return
+	}
+
+	var files []string
+	for _, s := range strays {
+		if !s.isDir {
+			files = append(files, s.path)
+		}
+	}
+	if len(files) > 0 {
+		v.reimport(func(imp *importer.Importer) (*importer.Result, error) { return imp.ImportFiles(files) }, result)
+	}
+
+	for _, s := range strays {
+		if s.isDir {
+			v.reimport(func(imp *importer.Importer) (*importer.Result, error) { return imp.ImportDir(s.path) }, result)
+		}
+
+		if _, err := os.Lstat(s.path); os.IsNotExist(err) {
+			continue
+		}
+		if s.isDir {
+			if empty, err := isEffectivelyEmptyTree(s.path); err == nil && empty {
+				if err := os.RemoveAll(s.path); err != nil {
+					result.Errors++
+					v.logger.Error("remove %s: %v", s.path, err)
+				}
+				continue
+			}
+		}
+		v.quarantineEntry(s.path, result)
+	}
+}
+
+// quarantineEntry moves path into this run's quarantine directory.
+func (v *Verifier) quarantineEntry(path string, result *Result) {
+	if v.quarantine == nil {
+		v.quarantine = newQuarantine(v.cfg.LibraryPath, time.Now())
+	}
+	dest, err := v.quarantine.add(path)
+	if err != nil {
+		result.Errors++
+		v.logger.Error("quarantine %s: %v", path, err)
+		return
+	}
+	result.Quarantined++
+	v.logger.Warn("quarantined %s → %s", path, dest)
+	if err := v.quarantine.persist(); err != nil {
+		v.logger.Warn("quarantine manifest: %v", err)
+	}
+}
+
+// reimport runs an import with Move through the importer, so stray media
+// lands exactly where an import would put it. Non-media files are left
+// in place for the quarantine.
+func (v *Verifier) reimport(run func(*importer.Importer) (*importer.Result, error), result *Result) {
+	// The importer updates the index itself; hand it over.
+	v.closeIndex()
+	imp, err := importer.New(importer.Config{
+		LibraryPath:   v.cfg.LibraryPath,
+		SeparateVideo: v.cfg.SeparateVideo,
+		HashAlgo:      v.cfg.HashAlgo,
+		Move:          true,
+	}, v.ext, v.logger)
+	if err != nil {
+		result.Errors++
+		v.logger.Error("re-import: %v", err)
+		return
+	}
+	ir, err := run(imp)
+	if ir == nil {
+		result.Errors++
+		v.logger.Error("re-import: %v", err)
+		return
+	}
+	// A stray identical to a file already in the library counts as
+	// imported: the move drops the duplicate.
+	result.Fixed += ir.Imported + ir.Replaced
+	result.Errors += ir.Errors
+}
+
+// isEffectivelyEmptyTree reports whether dir holds no files other than
+// OS junk, at any depth.
+func isEffectivelyEmptyTree(dir string) (bool, error) {
+	empty := true
+	err := filepath.WalkDir(dir, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !defaults.IsIgnoredFile(d.Name()) {
+			empty = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return empty, err
+}
@@ -0,0 +1,102 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// otherExtractor reports .txt files as non-media and defers everything
+// else to fakeExtractor.
+type otherExtractor struct{ fakeExtractor }
+
+func (o *otherExtractor) Extract(path string, hasher *defaults.Hasher) (*metadata.FileMetadata, error) {
+	md, err := o.fakeExtractor.Extract(path, hasher)
+	if err == nil && filepath.Ext(path) == ".txt" {
+		md.MIMEType = "text/plain"
+		md.MediaType = defaults.MediaTypeOther
+	}
+	return md, err
+}
+
+func TestVerifyFixStructure(t *testing.T) {
+	libDir := t.TempDir()
+	notes := filepath.Join(libDir, "notes.txt")
+	createTestFile(t, notes, "notes")
+	strayDir := filepath.Join(libDir, "2024", "stray-dir")
+	createTestFile(t, filepath.Join(strayDir, "IMG_0001.jpg"), "stray photo")
+	createTestFile(t, filepath.Join(strayDir, "IMG_0001.xmp"), "stray xmp")
+	createTestFile(t, filepath.Join(strayDir, ".DS_Store"), "junk")
+	badDevice := filepath.Join(libDir, "2024", "sources", "bad-device")
+	createTestFile(t, filepath.Join(badDevice, "readme.txt"), "readme")
+
+	cfg := Config{LibraryPath: libDir, HashAlgo: "md5", FixStructure: true}
+	v, err := New(cfg, &otherExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Inconsistent)
+	assert.Equal(t, 1, result.Fixed)
+	assert.Equal(t, 2, result.Quarantined)
+	assert.Equal(t, 0, result.Errors)
+
+	// The stray photo was imported with its sidecar; its dir is gone.
+	imported, err := filepath.Glob(filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15", "*"))
+	require.NoError(t, err)
+	require.Len(t, imported, 2)
+	assert.Equal(t, pathbuilder.BuildSidecarPath(imported[0], ".xmp"), imported[1])
+	_, err = os.Stat(strayDir)
+	assert.True(t, os.IsNotExist(err))
+
+	// Non-media entries sit in a dated quarantine dir under the same
+	// relative paths, listed in its manifest.
+	runs, err := os.ReadDir(QuarantineDir(libDir))
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	runDir := filepath.Join(QuarantineDir(libDir), runs[0].Name())
+	_, err = os.Stat(filepath.Join(runDir, "notes.txt"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(runDir, "2024", "sources", "bad-device", "readme.txt"))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(runDir, quarantineManifestName))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "#"))
+	assert.Equal(t, notes+"\tnotes.txt", lines[1])
+	assert.Equal(t, badDevice+"\t2024/sources/bad-device", lines[2])
+
+	// The library is now consistent, .imv/ at the root included.
+	cfg.FixStructure = false
+	v, err = New(cfg, &otherExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err = v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Inconsistent)
+	assert.Equal(t, 1, result.Verified)
+}
+
+func TestVerifyWithoutFixStructureLeavesStrays(t *testing.T) {
+	libDir := t.TempDir()
+	notes := filepath.Join(libDir, "notes.txt")
+	createTestFile(t, notes, "notes")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &otherExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Inconsistent)
+	assert.Equal(t, 0, result.Quarantined)
+	_, err = os.Stat(notes)
+	assert.NoError(t, err)
+	_, err = os.Stat(QuarantineDir(libDir))
+	assert.True(t, os.IsNotExist(err))
+}
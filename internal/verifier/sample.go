@@ -0,0 +1,261 @@
+package verifier
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
+)
+
+// sampleZ is the normal quantile for a two-sided 95% confidence interval.
+const sampleZ = 1.959964
+
+// SampleSpec selects a random subset of source files to verify.
+type SampleSpec struct {
+	// Count is the number of files to sample. When zero, Fraction is used.
+	Count int
+	// Fraction is the share of files to sample, in (0, 1].
+	Fraction float64
+	// BySize weights selection by file size, so the estimate describes the
+	// share of bytes in bad files rather than the share of files.
+	BySize bool
+}
+
+// ParseSampleSpec parses "2%" (a fraction of all files) or "5000" (a
+// file count).
+func ParseSampleSpec(s string) (SampleSpec, error) {
+	s = strings.TrimSpace(s)
+	if pct, ok := strings.CutSuffix(s, "%"); ok {
+		f, err := strconv.ParseFloat(pct, 64)
+		if err != nil || f <= 0 || f > 100 {
+			return SampleSpec{}, fmt.Errorf("sample %q: percentage must be in (0, 100]", s)
+		}
+		return SampleSpec{Fraction: f / 100}, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return SampleSpec{}, fmt.Errorf("sample %q: expected a positive count or a percentage", s)
+	}
+	return SampleSpec{Count: n}, nil
+}
+
+// size returns how many of population files the spec selects.
+func (s SampleSpec) size(population int) int {
+	n := s.Count
+	if n == 0 {
+		n = int(math.Ceil(s.Fraction * float64(population)))
+	}
+	return min(n, population)
+}
+
+// SampleResult is the outcome of a sampled verification.
+type SampleResult struct {
+	Result
+
+	Population      int
+	PopulationBytes int64
+	Sampled         int
+	SampledBytes    int64
+	// Failed is the number of sampled files with a failing finding or an error.
+	Failed int
+
+	// ErrorRate is the estimated share of bad files, or of bytes in bad
+	// files when sampling by size; [Low, High] is its 95% interval. By
+	// size, files the sample was certain to include count exactly and a
+	// Wilson score interval covers the rest of the bytes.
+	ErrorRate float64
+	Low       float64
+	High      float64
+	BySize    bool
+}
+
+// Sample verifies a random subset of source files across the selected
+// years and estimates the library-wide error rate. Every sampled file is
+// fully extracted and hashed, and nothing is written: the cache, the
+// index and the hash manifests are read at most, and FailFast, Fix and
+// Scrub do not apply. Structure checks are skipped.
+func (v *Verifier) Sample(spec SampleSpec) (*SampleResult, error) {
+	years, err := library.ListYearsFiltered(v.cfg.LibraryPath, v.cfg.YearFilter)
+	if err != nil {
+		return nil, fmt.Errorf("list years: %w", err)
+	}
+
+	var population []FileEntry
+	var populationYears []string
+	sr := &SampleResult{BySize: spec.BySize}
+	for _, year := range years {
+		entries, err := v.walkAndStatYear(filepath.Join(v.cfg.LibraryPath, year), year)
+		if err != nil {
+			return nil, err
+		}
+		for _, fe := range entries {
+			base := filepath.Base(fe.AbsPath)
+			if isSkippableInLibrary(base) || defaults.IsSidecarExtension(filepath.Ext(base)) {
+				continue
+			}
+			population = append(population, fe)
+			populationYears = append(populationYears, year)
+			sr.PopulationBytes += fe.Info.Size()
+		}
+	}
+	sr.Population = len(population)
+
+	picked, threshold := pickSample(population, spec, rand.Float64)
+
+	// A dry run leaves the index alone, and the manifests loaded here are
+	// only consulted for recorded hashes, never persisted.
+	sv := *v
+	sv.cfg.FailFast = false
+	sv.cfg.Fix = false
+	sv.cfg.Scrub = false
+	sv.cfg.DryRun = true
+	sv.idx, sv.idxLoaded = nil, false
+
+	manifests := make(map[string]*library.Manifest)
+	var est byteEstimate
+	for i, idx := range picked {
+		fe := population[idx]
+		year := populationYears[idx]
+		stats := fmt.Sprintf("failed:%d", sr.Failed)
+		v.logger.ProgressWithStats(i+1, len(picked), "[sample] ", stats, fe.AbsPath)
+
+		ym, ok := manifests[year]
+		if !ok {
+			ym, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(v.cfg.LibraryPath, year)))
+			if err != nil {
+				v.logger.Warn("hash manifest for %s: load failed: %v", year, err)
+			}
+			manifests[year] = ym
+		}
+
+		before := sr.Inconsistent + sr.Errors
+		_ = sv.verifyContent(fe, nil, ym, &sr.Result)
+		failed := sr.Inconsistent+sr.Errors > before
+		if failed {
+			sr.Failed++
+		}
+		sr.Sampled++
+		sr.SampledBytes += fe.Info.Size()
+		sr.ProcessedBytes += fe.Info.Size()
+		est.add(fe, threshold, failed)
+	}
+
+	switch {
+	case spec.BySize && sr.PopulationBytes > 0:
+		sr.ErrorRate, sr.Low, sr.High = est.rate(sr.PopulationBytes)
+	case sr.Sampled > 0:
+		sr.ErrorRate = float64(sr.Failed) / float64(sr.Sampled)
+		sr.Low, sr.High = wilsonInterval(sr.Failed, sr.Sampled, sampleZ)
+	}
+	return sr, nil
+}
+
+// byteEstimate accumulates a size-weighted sample. A file whose weight
+// reaches the sample's priority threshold was certain to be picked, so
+// its bytes are known exactly. Every smaller file was picked with a
+// probability proportional to its size, so each stands for the same
+// number of bytes (the threshold) and the smaller files' failure share
+// estimates the share of bad bytes among all the files not certain to be
+// picked.
+type byteEstimate struct {
+	certainBytes, certainBad int64
+	rest, restFailed         int
+}
+
+func (e *byteEstimate) add(fe FileEntry, threshold float64, failed bool) {
+	if sampleWeight(fe) >= threshold {
+		e.certainBytes += fe.Info.Size()
+		if failed {
+			e.certainBad += fe.Info.Size()
+		}
+		return
+	}
+	e.rest++
+	if failed {
+		e.restFailed++
+	}
+}
+
+// rate returns the estimated share of total bytes in bad files and its
+// 95% interval. A sample that took every file reports the exact share.
+func (e *byteEstimate) rate(total int64) (rate, low, high float64) {
+	restBytes := float64(total - e.certainBytes)
+	known := float64(e.certainBad)
+	if e.rest > 0 {
+		rate = known + restBytes*float64(e.restFailed)/float64(e.rest)
+	} else {
+		rate = known
+	}
+	wl, wh := wilsonInterval(e.restFailed, e.rest, sampleZ)
+	if restBytes == 0 {
+		wl, wh = 0, 0
+	}
+	t := float64(total)
+	return rate / t, (known + restBytes*wl) / t, (known + restBytes*wh) / t
+}
+
+// pickSample returns the indexes of the selected entries, in random
+// order. Size weighting is priority sampling: each file gets the
+// priority w/u (compared in log form) and the highest ones are taken.
+// The threshold returned is the highest priority left out, or zero when
+// every file is taken; a file whose weight reaches it is always picked,
+// and any other with probability w/threshold.
+func pickSample(entries []FileEntry, spec SampleSpec, rnd func() float64) (picked []int, threshold float64) {
+	n := spec.size(len(entries))
+	idx := make([]int, len(entries))
+	for i := range idx {
+		idx[i] = i
+	}
+
+	if !spec.BySize {
+		// Partial Fisher–Yates: the first n slots are a uniform sample.
+		for i := 0; i < n; i++ {
+			j := i + int(rnd()*float64(len(idx)-i))
+			idx[i], idx[j] = idx[j], idx[i]
+		}
+		return idx[:n], 0
+	}
+
+	keys := make([]float64, len(entries))
+	for i, fe := range entries {
+		u := rnd()
+		for u == 0 {
+			u = rnd()
+		}
+		keys[i] = math.Log(sampleWeight(fe)) - math.Log(u)
+	}
+	sort.Slice(idx, func(a, b int) bool { return keys[idx[a]] > keys[idx[b]] })
+	if n < len(idx) {
+		threshold = math.Exp(keys[idx[n]])
+	}
+	return idx[:n], threshold
+}
+
+// sampleWeight is a file's weight in a size-weighted sample. Empty files
+// get weight 1 so they remain selectable.
+func sampleWeight(fe FileEntry) float64 {
+	return float64(max(fe.Info.Size(), 1))
+}
+
+// wilsonInterval returns the Wilson score interval for k successes in n
+// trials at normal quantile z. It behaves well for the small error rates
+// and small samples typical of a quick check, unlike the normal
+// approximation.
+func wilsonInterval(k, n int, z float64) (low, high float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	nf := float64(n)
+	p := float64(k) / nf
+	z2 := z * z
+	denom := 1 + z2/nf
+	center := (p + z2/(2*nf)) / denom
+	half := z * math.Sqrt(p*(1-p)/nf+z2/(4*nf*nf)) / denom
+	return math.Max(0, center-half), math.Min(1, center+half)
+}
@@ -0,0 +1,175 @@
+package verifier
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/index"
+	"github.com/askolesov/image-vault/internal/library"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSampleSpec(t *testing.T) {
+	s, err := ParseSampleSpec("2%")
+	require.NoError(t, err)
+	assert.InDelta(t, 0.02, s.Fraction, 1e-12)
+	assert.Equal(t, 0, s.Count)
+
+	s, err = ParseSampleSpec("5000")
+	require.NoError(t, err)
+	assert.Equal(t, SampleSpec{Count: 5000}, s)
+
+	for _, bad := range []string{"", "0", "-3", "0%", "101%", "abc", "x%"} {
+		_, err := ParseSampleSpec(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSampleSpecSize(t *testing.T) {
+	assert.Equal(t, 3, SampleSpec{Fraction: 0.02}.size(101))
+	assert.Equal(t, 10, SampleSpec{Count: 50}.size(10))
+	assert.Equal(t, 7, SampleSpec{Count: 7}.size(100))
+}
+
+func TestWilsonInterval(t *testing.T) {
+	low, high := wilsonInterval(0, 100, sampleZ)
+	assert.Equal(t, 0.0, low)
+	assert.InDelta(t, 0.037, high, 0.001)
+
+	low, high = wilsonInterval(5, 100, sampleZ)
+	assert.InDelta(t, 0.0215, low, 0.001)
+	assert.InDelta(t, 0.1118, high, 0.001)
+
+	low, high = wilsonInterval(0, 0, sampleZ)
+	assert.Equal(t, 0.0, low)
+	assert.Equal(t, 1.0, high)
+}
+
+// sizedEntries builds FileEntry values with real FileInfo of the given sizes.
+func sizedEntries(t *testing.T, sizes ...int) []FileEntry {
+	t.Helper()
+	dir := t.TempDir()
+	entries := make([]FileEntry, len(sizes))
+	for i, n := range sizes {
+		p := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		require.NoError(t, os.WriteFile(p, make([]byte, n), 0o644))
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		entries[i] = FileEntry{AbsPath: p, Info: info}
+	}
+	return entries
+}
+
+func TestPickSampleCountIsUniqueSubset(t *testing.T) {
+	entries := sizedEntries(t, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1)
+	picked, _ := pickSample(entries, SampleSpec{Count: 4}, func() float64 { return 0.5 })
+	require.Len(t, picked, 4)
+	seen := map[int]bool{}
+	for _, i := range picked {
+		assert.False(t, seen[i], "index %d picked twice", i)
+		seen[i] = true
+	}
+}
+
+func TestPickSampleBySizeFavoursLargeFiles(t *testing.T) {
+	// With identical random draws, the size-weighted key is largest for the
+	// biggest file, so a sample of one must pick it. The threshold is the
+	// runner-up's priority.
+	entries := sizedEntries(t, 10, 1000, 0, 100)
+	picked, threshold := pickSample(entries, SampleSpec{Count: 1, BySize: true}, func() float64 { return 0.5 })
+	assert.Equal(t, []int{1}, picked)
+	assert.InDelta(t, 200, threshold, 1e-9)
+
+	_, threshold = pickSample(entries, SampleSpec{Fraction: 1, BySize: true}, func() float64 { return 0.5 })
+	assert.Equal(t, 0.0, threshold, "a full sample leaves nothing out")
+}
+
+func TestByteEstimate(t *testing.T) {
+	entries := sizedEntries(t, 600, 100, 100, 100, 100)
+
+	// Every file taken: the exact byte share, with no spread.
+	var e byteEstimate
+	e.add(entries[0], 0, true)
+	for _, fe := range entries[1:] {
+		e.add(fe, 0, false)
+	}
+	rate, low, high := e.rate(1000)
+	assert.InDelta(t, 0.6, rate, 1e-12)
+	assert.InDelta(t, 0.6, low, 1e-12)
+	assert.InDelta(t, 0.6, high, 1e-12)
+
+	// The big file was certain to be picked and is good; one of two
+	// smaller files picked failed, so half of the other 400 bytes are
+	// estimated bad.
+	e = byteEstimate{}
+	e.add(entries[0], 250, false)
+	e.add(entries[1], 250, true)
+	e.add(entries[2], 250, false)
+	rate, low, high = e.rate(1000)
+	assert.InDelta(t, 0.2, rate, 1e-12)
+	assert.Less(t, low, 0.2)
+	assert.Greater(t, high, 0.2)
+	assert.LessOrEqual(t, high, 0.4, "the certain bytes are known to be good")
+}
+
+func TestSampleEstimatesErrorRate(t *testing.T) {
+	libDir := t.TempDir()
+	hasher := mustHasher("md5")
+	dt := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	// fakeExtractor reports TestMake/TestModel, so files under another device
+	// directory are misplaced; files under the expected one are fine.
+	good := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	bad := filepath.Join(libDir, "2024", "sources", "WrongDevice (image)", "2024-01-15")
+	var badBytes int
+	for i := range 4 {
+		// Sizes differ so the byte share differs from the file share.
+		content := fmt.Sprintf("sample-%d", i) + strings.Repeat("x", 100*i)
+		dir := good
+		if i%2 == 1 {
+			dir = bad
+			badBytes += len(content)
+		}
+		tmp := filepath.Join(t.TempDir(), "tmp.jpg")
+		createTestFile(t, tmp, content)
+		_, short, err := metadata.ComputeFileHash(tmp, hasher)
+		require.NoError(t, err)
+		createTestFile(t, filepath.Join(dir, pathbuilder.BuildSourceFilename(dt, short, ".jpg")), content)
+	}
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", FailFast: true, Fix: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	sr, err := v.Sample(SampleSpec{Fraction: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 4, sr.Population)
+	assert.Equal(t, 4, sr.Sampled)
+	assert.Equal(t, 2, sr.Failed)
+	assert.InDelta(t, 0.5, sr.ErrorRate, 1e-12)
+	assert.Less(t, sr.Low, 0.5)
+	assert.Greater(t, sr.High, 0.5)
+	assert.Equal(t, 0, sr.Fixed, "sampling must never move files")
+
+	sr, err = v.Sample(SampleSpec{Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 2, sr.Sampled)
+
+	// By size, a full sample reports the share of bytes in bad files.
+	sr, err = v.Sample(SampleSpec{Fraction: 1, BySize: true})
+	require.NoError(t, err)
+	assert.Equal(t, 2, sr.Failed)
+	assert.InDelta(t, float64(badBytes)/float64(sr.PopulationBytes), sr.ErrorRate, 1e-12)
+	assert.InDelta(t, sr.ErrorRate, sr.Low, 1e-12)
+	assert.InDelta(t, sr.ErrorRate, sr.High, 1e-12)
+
+	// Sampling is read-only.
+	assert.NoFileExists(t, library.ManifestFilePath(filepath.Join(libDir, "2024")))
+	assert.NoFileExists(t, index.FilePath(libDir))
+}
@@ -0,0 +1,96 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/askolesov/image-vault/internal/transfer"
+)
+
+// stemKey identifies a file by its path without extension, the way the
+// importer pairs primaries with sidecars.
+func stemKey(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// verifySidecars reports every sidecar in sources/ that has no primary of
+// the same stem in the same directory. Sidecars the importer brought in
+// without a primary are named after their own content hash and are not
+// orphans.
+func (v *Verifier) verifySidecars(entries []FileEntry, result *Result) error {
+	primaries := make(map[string]bool, len(entries))
+	for _, fe := range entries {
+		base := filepath.Base(fe.AbsPath)
+		if !isSkippableInLibrary(base) && !defaults.IsSidecarExtension(filepath.Ext(base)) {
+			primaries[stemKey(fe.AbsPath)] = true
+		}
+	}
+
+	for _, fe := range entries {
+		if !defaults.IsSidecarExtension(filepath.Ext(fe.AbsPath)) {
+			continue
+		}
+		if primaries[stemKey(fe.AbsPath)] || v.isStandaloneSidecar(fe.AbsPath) {
+			continue
+		}
+		if err := v.report(result, Finding{
+			Kind:    FindingOrphanSidecar,
+			Path:    fe.AbsPath,
+			Details: "no primary file with the same name",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isStandaloneSidecar reports whether path is a sidecar imported on its
+// own: its filename carries the short hash of its own content.
+func (v *Verifier) isStandaloneSidecar(path string) bool {
+	parsed, err := pathbuilder.ParseSourceFilename(filepath.Base(path))
+	if err != nil {
+		return false
+	}
+	_, short, err := metadata.ComputeFileHash(path, v.hasher)
+	return err == nil && short == parsed.Hash
+}
+
+// findSidecars returns the sidecars next to primary that share its stem.
+func findSidecars(primary string) []string {
+	dirEntries, err := os.ReadDir(filepath.Dir(primary))
+	if err != nil {
+		return nil
+	}
+	stem := filepath.Base(stemKey(primary))
+	var sidecars []string
+	for _, e := range dirEntries {
+		name := e.Name()
+		if e.IsDir() || !defaults.IsSidecarExtension(filepath.Ext(name)) {
+			continue
+		}
+		if stemKey(name) == stem && name != filepath.Base(primary) {
+			sidecars = append(sidecars, filepath.Join(filepath.Dir(primary), name))
+		}
+	}
+	return sidecars
+}
+
+// moveSidecars moves each sidecar next to the primary's new location,
+// keeping the sidecar's own extension. Failures are counted as errors;
+// a sidecar left behind shows up as an orphan on the next run.
+func (v *Verifier) moveSidecars(sidecars []string, primaryDest string, result *Result) {
+	for _, sc := range sidecars {
+		dest := pathbuilder.BuildSidecarPath(primaryDest, filepath.Ext(sc))
+		if _, err := transfer.TransferFile(sc, dest, transfer.Options{
+			Move:    true,
+			NewHash: v.hasher.New,
+		}); err != nil {
+			result.Errors++
+			v.logger.Error("fix move sidecar %s → %s: %v", sc, dest, err)
+		}
+	}
+}
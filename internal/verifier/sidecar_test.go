@@ -0,0 +1,104 @@
+package verifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/metadata"
+	"github.com/askolesov/image-vault/internal/pathbuilder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// placeSource writes content under dir with its canonical source filename
+// and returns the path.
+func placeSource(t *testing.T, dir, content, ext string) string {
+	t.Helper()
+	tmp := filepath.Join(t.TempDir(), "tmp"+ext)
+	createTestFile(t, tmp, content)
+	_, short, err := metadata.ComputeFileHash(tmp, mustHasher("md5"))
+	require.NoError(t, err)
+	p := filepath.Join(dir, pathbuilder.BuildSourceFilename(time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), short, ext))
+	createTestFile(t, p, content)
+	return p
+}
+
+func TestVerifySidecarWithPrimary(t *testing.T) {
+	libDir := t.TempDir()
+	dir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	primary := placeSource(t, dir, "primary", ".jpg")
+	createTestFile(t, pathbuilder.BuildSidecarPath(primary, ".xmp"), "xmp")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Verified)
+	assert.Equal(t, 0, result.Inconsistent)
+}
+
+func TestVerifyStandaloneSidecarIsNotOrphan(t *testing.T) {
+	libDir := t.TempDir()
+	dir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	placeSource(t, dir, "imported on its own", ".xmp")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fast: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Inconsistent)
+}
+
+func TestVerifyOrphanSidecar(t *testing.T) {
+	libDir := t.TempDir()
+	dir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	// Named like a source file, but the hash is the (moved) primary's.
+	orphan := filepath.Join(dir, "2024-01-15_12-00-00_abcd1234.xmp")
+	createTestFile(t, orphan, "left behind")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fast: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Inconsistent)
+	require.Len(t, result.Findings, 1)
+	assert.Equal(t, FindingOrphanSidecar, result.Findings[0].Kind)
+	assert.Equal(t, orphan, result.Findings[0].Path)
+}
+
+func TestVerifyFixMovesSidecarsWithPrimary(t *testing.T) {
+	libDir := t.TempDir()
+	wrongDir := filepath.Join(libDir, "2024", "sources", "WrongDevice (image)", "2024-01-15")
+	primary := placeSource(t, wrongDir, "moved primary", ".jpg")
+	xmp := pathbuilder.BuildSidecarPath(primary, ".xmp")
+	yaml := pathbuilder.BuildSidecarPath(primary, ".YAML")
+	createTestFile(t, xmp, "xmp")
+	createTestFile(t, yaml, "yaml")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5", Fix: true}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Fixed)
+	assert.Equal(t, 0, result.Errors)
+
+	goodDir := filepath.Join(libDir, "2024", "sources", "TestMake TestModel (image)", "2024-01-15")
+	newPrimary := filepath.Join(goodDir, filepath.Base(primary))
+	for _, p := range []string{newPrimary, pathbuilder.BuildSidecarPath(newPrimary, ".xmp"), pathbuilder.BuildSidecarPath(newPrimary, ".YAML")} {
+		_, err := os.Stat(p)
+		assert.NoError(t, err, p)
+	}
+	for _, p := range []string{primary, xmp, yaml} {
+		_, err := os.Stat(p)
+		assert.True(t, os.IsNotExist(err), p)
+	}
+
+	// The next run sees a consistent library.
+	v, err = New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+	result, err = v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Inconsistent)
+}
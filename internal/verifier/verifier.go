@@ -5,9 +5,12 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/index"
 	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/logging"
 	"github.com/askolesov/image-vault/internal/metadata"
@@ -31,16 +34,44 @@ type Config struct {
 	Randomize     bool
 	YearFilter    string
 	NoCache       bool
+	// Scrub re-hashes every file whose full hash is in the year manifest
+	// and compares it against the recorded hash, bypassing the cache.
+	Scrub bool
+	// MaxAge treats cache entries verified longer ago than this as misses.
+	// Zero means entries never expire.
+	MaxAge time.Duration
+	// Budget caps content verification per run. Unverified files go first,
+	// then cache hits are re-verified oldest-first until it runs out.
+	Budget Budget
+	// IgnoreKinds lists finding kinds that never fail the run.
+	IgnoreKinds []FindingKind
+	// OnlyKinds, when non-empty, restricts failing findings to these kinds.
+	OnlyKinds []FindingKind
+	// FixStructure re-imports media found in unexpected places and moves
+	// every other unexpected entry into a dated quarantine under .imv/.
+	FixStructure bool
+	// DryRun, with Fix, collects the moves --fix would make into
+	// Result.Plan instead of performing them.
+	DryRun bool
 }
 
-// Result holds the outcome counts of a verify operation.
+// Result holds the outcome counts of a verify operation. Inconsistent
+// counts the findings that fail the run; Findings holds every finding,
+// including ignored ones.
 type Result struct {
 	Verified       int
 	Inconsistent   int
 	Fixed          int
 	Errors         int
 	CacheHits      int
+	Refreshed      int
+	Deferred       int
+	Corrupted      int
+	Quarantined    int
 	ProcessedBytes int64
+	Findings       []Finding
+	// Plan holds the relocations a dry run would perform; nil otherwise.
+	Plan *Plan
 }
 
 // FileEntry is one source file discovered during the per-year pre-walk.
@@ -50,27 +81,59 @@ type FileEntry struct {
 	Info      os.FileInfo
 }
 
+// refreshCandidate is a cache hit held back for the budgeted refresh pass.
+type refreshCandidate struct {
+	year       string
+	entry      FileEntry
+	verifiedAt int64
+}
+
 // Verifier orchestrates integrity checks on the library.
 type Verifier struct {
 	cfg    Config
 	ext    MetadataExtractor
 	logger *logging.Logger
 	hasher *defaults.Hasher
+	// pbOpts rebuilds expected paths, with the library's owner mapping.
+	pbOpts pathbuilder.Options
+
+	// Budget bookkeeping, reset by each Verify call.
+	budgetStart time.Time
+	budgetSpent int64
+	refresh     []refreshCandidate
+
+	// Structure repair state, reset by each Verify call.
+	strays     []stray
+	quarantine *quarantine
+
+	// planned maps each planned target (library-relative) to the hash of
+	// the file headed there, to spot two moves onto one path.
+	planned map[string]string
+
+	// idx is the library metadata index, loaded on first use.
+	idx       *index.Index
+	idxLoaded bool
 }
 
-// New creates a new Verifier, initializing the hasher from cfg.HashAlgo.
-// Returns an error if cfg.HashAlgo is unsupported so callers can surface
-// the misconfiguration instead of silently substituting the default.
+// New creates a new Verifier, initializing the hasher from cfg.HashAlgo
+// and reading the owner mapping from the library config. Returns an error
+// if cfg.HashAlgo is unsupported so callers can surface the
+// misconfiguration instead of silently substituting the default.
 func New(cfg Config, ext MetadataExtractor, logger *logging.Logger) (*Verifier, error) {
 	hasher, err := defaults.NewHasher(cfg.HashAlgo)
 	if err != nil {
 		return nil, fmt.Errorf("verifier: %w", err)
 	}
+	lc, err := library.LoadConfig(cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("verifier: %w", err)
+	}
 	return &Verifier{
 		cfg:    cfg,
 		ext:    ext,
 		logger: logger,
 		hasher: hasher,
+		pbOpts: pathbuilder.Options{SeparateVideo: cfg.SeparateVideo, Owners: lc.Owners, Derived: lc.Derived},
 	}, nil
 }
 
@@ -88,12 +151,28 @@ func (v *Verifier) Verify() (*Result, error) {
 	}
 
 	result := &Result{}
+	v.budgetStart = time.Now()
+	v.budgetSpent = 0
+	v.refresh = nil
+	v.strays = nil
+	v.quarantine = nil
+	v.planned = make(map[string]string)
+	defer v.closeIndex()
+	if v.isPlanning() {
+		result.Plan = &Plan{
+			Version:  planVersion,
+			Library:  v.cfg.LibraryPath,
+			HashAlgo: v.cfg.HashAlgo,
+			Created:  v.budgetStart,
+		}
+	}
 
 	// Validate library root — only year dirs allowed (skip when filtering by year)
 	if v.cfg.YearFilter == "" {
 		if err := v.verifyLibraryRoot(result); err != nil {
 			return result, err
 		}
+		v.fixStrays(result)
 	}
 
 	for i, year := range years {
@@ -108,17 +187,20 @@ func (v *Verifier) Verify() (*Result, error) {
 		if err := v.verifySourcesStructure(yearDir, year, result); err != nil {
 			return result, err
 		}
+		v.fixStrays(result)
 
-		// Pre-walk this year's source files and stat each once.
+		// Pre-walk this year's source and processed files and stat each once.
 		entries, err := v.walkAndStatYear(yearDir, year)
 		if err != nil {
 			return result, err
 		}
 
-		// Open the per-year cache (nil if disabled/fast/failed).
+		// Open the per-year hash manifest and cache (nil if disabled/fast/failed).
+		ym := v.openYearManifest(yearDir, year, entries)
+		entries = trackedEntries(entries, ym)
 		yc := v.openYearCache(yearDir, year, entries)
 
-		err = v.verifySourceFiles(year, entries, yc, i+1, len(years), result)
+		err = v.verifySourceFiles(year, entries, yc, ym, i+1, len(years), result)
 		// End-of-year persist: runs on success and error paths alike, matching
 		// the old Close() semantics. Best-effort; failure is logged but does
 		// not fail Verify. openYearCache already did the initial persist, so
@@ -128,21 +210,102 @@ func (v *Verifier) Verify() (*Result, error) {
 				v.logger.Warn("cache for %s: end-of-year persist failed: %v", year, perr)
 			}
 		}
+		if ym.Dirty() {
+			if perr := ym.Persist(); perr != nil {
+				v.logger.Warn("hash manifest for %s: persist failed: %v", year, perr)
+			}
+		}
 		if err != nil {
 			return result, err
 		}
+		v.pruneIndex(year)
+	}
+
+	if err := v.refreshOldest(result); err != nil {
+		return result, err
 	}
 
 	return result, nil
 }
 
-// walkAndStatYear lists all source files under yearDir and stats each.
-// Paths that disappear between walk and stat are silently dropped.
+// refreshOldest re-verifies the cache hits held back under a budget,
+// least recently verified first, until the budget runs out. The rest
+// count as ordinary cache hits.
+func (v *Verifier) refreshOldest(result *Result) error {
+	sort.SliceStable(v.refresh, func(i, j int) bool {
+		return v.refresh[i].verifiedAt < v.refresh[j].verifiedAt
+	})
+
+	caches := make(map[string]*Cache)
+	manifests := make(map[string]*library.Manifest)
+	defer func() {
+		for year, c := range caches {
+			if c != nil && c.dirty {
+				if err := c.Persist(); err != nil {
+					v.logger.Warn("cache for %s: persist failed: %v", year, err)
+				}
+			}
+		}
+		for year, m := range manifests {
+			if m.Dirty() {
+				if err := m.Persist(); err != nil {
+					v.logger.Warn("hash manifest for %s: persist failed: %v", year, err)
+				}
+			}
+		}
+	}()
+
+	total := len(v.refresh)
+	for i, rc := range v.refresh {
+		if v.cfg.Budget.exhausted(v.budgetSpent, v.budgetStart) {
+			result.Verified += total - i
+			result.CacheHits += total - i
+			break
+		}
+
+		stats := fmt.Sprintf("refreshed:%d inconsistent:%d", result.Refreshed, result.Inconsistent)
+		v.logger.ProgressWithStats(i+1, total, "[refresh] ", stats, rc.entry.AbsPath)
+
+		yearDir := filepath.Join(v.cfg.LibraryPath, rc.year)
+		yc, ok := caches[rc.year]
+		if !ok {
+			var err error
+			if yc, err = Load(CacheFilePath(yearDir)); err != nil {
+				v.logger.Warn("cache for %s: load failed: %v", rc.year, err)
+			}
+			caches[rc.year] = yc
+		}
+		ym, ok := manifests[rc.year]
+		if !ok {
+			var err error
+			if ym, err = library.LoadManifest(library.ManifestFilePath(yearDir)); err != nil {
+				v.logger.Warn("hash manifest for %s: load failed: %v", rc.year, err)
+			}
+			manifests[rc.year] = ym
+		}
+
+		v.budgetSpent += rc.entry.Info.Size()
+		result.Refreshed++
+		if err := v.verifyContent(rc.entry, yc, ym, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkAndStatYear lists all source and processed files under yearDir and
+// stats each. Paths that disappear between walk and stat are silently
+// dropped.
 func (v *Verifier) walkAndStatYear(yearDir, year string) ([]FileEntry, error) {
 	paths, err := library.ListSourceFiles(yearDir)
 	if err != nil {
 		return nil, fmt.Errorf("list source files for %s: %w", year, err)
 	}
+	processed, err := library.ListProcessedFiles(yearDir)
+	if err != nil {
+		return nil, fmt.Errorf("list processed files for %s: %w", year, err)
+	}
+	paths = append(paths, processed...)
 	entries := make([]FileEntry, 0, len(paths))
 	for _, p := range paths {
 		fi, err := os.Stat(p)
@@ -186,6 +349,9 @@ func (v *Verifier) openYearCache(yearDir, year string, entries []FileEntry) *Cac
 		if !c.Matches(existing, fe.Info, v.cfg.HashAlgo) {
 			continue
 		}
+		if v.cfg.MaxAge > 0 && time.Since(time.Unix(existing.VerifiedAt, 0)) > v.cfg.MaxAge {
+			continue
+		}
 		keep[fe.RelToYear] = existing
 	}
 
@@ -198,15 +364,123 @@ func (v *Verifier) openYearCache(yearDir, year string, entries []FileEntry) *Cac
 	return c
 }
 
-// verifySourceFiles checks each file in sources/ for correct path and hash.
+// openYearManifest loads the year's hash manifest and forgets entries for
+// files no longer on disk. Returns nil in fast mode or if loading fails.
+func (v *Verifier) openYearManifest(yearDir, year string, entries []FileEntry) *library.Manifest {
+	if v.cfg.Fast {
+		return nil
+	}
+
+	m, err := library.LoadManifest(library.ManifestFilePath(yearDir))
+	if err != nil {
+		v.logger.Warn("hash manifest for %s: load failed: %v (continuing without manifest)", year, err)
+		return nil
+	}
+
+	onDisk := make(map[string]bool, len(entries))
+	for _, fe := range entries {
+		onDisk[fe.RelToYear] = true
+	}
+	m.Retain(onDisk)
+	return m
+}
+
+// trackedEntries drops the files in processed/ that imv did not put
+// there: processed/ is freeform, and only the edited exports import and
+// verify --fix place in it have a hash in the manifest. Without a
+// manifest (fast mode) none are kept.
+func trackedEntries(entries []FileEntry, ym *library.Manifest) []FileEntry {
+	kept := entries[:0]
+	for _, fe := range entries {
+		if strings.HasPrefix(fe.RelToYear, "processed/") {
+			if _, ok := ym.Lookup(fe.RelToYear); !ok {
+				continue
+			}
+		}
+		kept = append(kept, fe)
+	}
+	return kept
+}
+
+// recordMoved records the full hash of a file moved from from to to in
+// the manifest of its new year: ym, the manifest of from's year, when the
+// year is the same, else that year's, loaded and persisted here. The old
+// entry is dropped by the next run's Retain.
+func (v *Verifier) recordMoved(ym *library.Manifest, from, to, fullHash string) {
+	fromRel, err1 := v.libraryRel(from)
+	toRel, err2 := v.libraryRel(to)
+	if err1 != nil || err2 != nil {
+		return
+	}
+	fromYear, _, _ := strings.Cut(fromRel, "/")
+	toYear, relToYear, ok := strings.Cut(toRel, "/")
+	if !ok {
+		return
+	}
+	m := ym
+	if toYear != fromYear {
+		var err error
+		if m, err = library.LoadManifest(library.ManifestFilePath(filepath.Join(v.cfg.LibraryPath, toYear))); err != nil {
+			v.logger.Warn("hash manifest for %s: load failed: %v", toYear, err)
+			return
+		}
+		defer func() {
+			if err := m.Persist(); err != nil {
+				v.logger.Warn("hash manifest for %s: persist failed: %v", toYear, err)
+			}
+		}()
+	}
+	if err := m.Record(library.ManifestEntry{
+		RelPath:  relToYear,
+		HashAlgo: v.cfg.HashAlgo,
+		FullHash: fullHash,
+	}); err != nil {
+		v.logger.Warn("hash manifest record failed for %s: %v", to, err)
+	}
+}
+
+// recordedHash returns the manifest's full hash for relPath when it was
+// recorded with the hash algorithm in use.
+func (v *Verifier) recordedHash(ym *library.Manifest, relPath string) (string, bool) {
+	e, ok := ym.Lookup(relPath)
+	if !ok || e.HashAlgo != v.cfg.HashAlgo {
+		return "", false
+	}
+	return e.FullHash, true
+}
+
+// reportCorrupted reports a file whose content hash differs from the one
+// recorded in the manifest.
+func (v *Verifier) reportCorrupted(result *Result, path, actual, recorded string) error {
+	f := Finding{
+		Kind:    FindingContentCorrupted,
+		Path:    path,
+		Details: fmt.Sprintf("content hash %s, recorded %s", actual, recorded),
+	}
+	if v.record(result, f) {
+		result.Corrupted++
+		if v.cfg.FailFast {
+			return fmt.Errorf("%s", f)
+		}
+	}
+	return nil
+}
+
+// verifySourceFiles checks each file in sources/, and each edited export
+// imv placed in processed/, for correct path and hash.
 // Consumes pre-walked entries; no internal walk or stat.
 func (v *Verifier) verifySourceFiles(
 	year string,
 	entries []FileEntry,
 	yc *Cache,
+	ym *library.Manifest,
 	yearIdx, yearTotal int,
 	result *Result,
 ) error {
+	if err := v.verifySidecars(entries, result); err != nil {
+		return err
+	}
+
 	if v.cfg.Randomize {
 		rand.Shuffle(len(entries), func(i, j int) {
 			entries[i], entries[j] = entries[j], entries[i]
@@ -230,7 +504,7 @@ func (v *Verifier) verifySourceFiles(
 			continue
 		}
 
-		// Skip sidecar files
+		// Sidecars were checked by verifySidecars and move with their primary
 		ext := filepath.Ext(baseName)
 		if defaults.IsSidecarExtension(ext) {
 			continue
@@ -247,10 +521,12 @@ func (v *Verifier) verifySourceFiles(
 			// shorter or mismatched prefix is always inconsistent; don't
 			// silently pass when len(dateDir) < 4.
 			if len(dateDir) < 4 || dateDir[:4] != year {
-				result.Inconsistent++
-				v.logger.Warn("date dir %s has wrong year (expected %s): %s", dateDir, year, filePath)
-				if v.cfg.FailFast {
-					return fmt.Errorf("date dir %s has wrong year in %s", dateDir, filePath)
+				if err := v.report(result, Finding{
+					Kind:    FindingDateDirYear,
+					Path:    filePath,
+					Details: fmt.Sprintf("date dir %s is not in year %s", dateDir, year),
+				}); err != nil {
+					return err
 				}
 				continue
 			}
@@ -259,10 +535,12 @@ func (v *Verifier) verifySourceFiles(
 			if parseErr == nil {
 				fileDate := parsed.DateTime.Format("2006-01-02")
 				if fileDate != dateDir {
-					result.Inconsistent++
-					v.logger.Warn("filename date %s doesn't match date dir %s: %s", fileDate, dateDir, filePath)
-					if v.cfg.FailFast {
-						return fmt.Errorf("filename date mismatch in %s", filePath)
+					if err := v.report(result, Finding{
+						Kind:    FindingFilenameDate,
+						Path:    filePath,
+						Details: fmt.Sprintf("filename date %s doesn't match date dir %s", fileDate, dateDir),
+					}); err != nil {
+						return err
 					}
 					continue
 				}
@@ -273,10 +551,12 @@ func (v *Verifier) verifySourceFiles(
 		if v.cfg.Fast {
 			_, err := pathbuilder.ParseSourceFilename(baseName)
 			if err != nil {
-				result.Inconsistent++
-				v.logger.Warn("invalid source filename: %s (%v)", filePath, err)
-				if v.cfg.FailFast {
-					return fmt.Errorf("invalid source filename %q: %w", baseName, err)
+				if err := v.report(result, Finding{
+					Kind:    FindingInvalidFilename,
+					Path:    filePath,
+					Details: err.Error(),
+				}); err != nil {
+					return err
 				}
 			} else {
 				result.Verified++
@@ -284,69 +564,172 @@ func (v *Verifier) verifySourceFiles(
 			continue
 		}
 
-		// Cache hit: skip expensive ext.Extract + path rebuild.
-		if yc != nil {
+		// Cache hit: skip expensive ext.Extract + path rebuild. Under a
+		// budget, hits are set aside for the oldest-first refresh pass.
+		if !v.cfg.Scrub {
 			if entry, ok := yc.Lookup(fe.RelToYear); ok && yc.Matches(entry, fe.Info, v.cfg.HashAlgo) {
+				if v.cfg.Budget.IsSet() {
+					v.refresh = append(v.refresh, refreshCandidate{year: year, entry: fe, verifiedAt: entry.VerifiedAt})
+					continue
+				}
 				result.Verified++
 				result.CacheHits++
 				continue
 			}
 		}
 
-		// Full mode: extract metadata, verify path and hash
-		md, err := v.ext.Extract(filePath, v.hasher)
-		if err != nil {
-			result.Errors++
-			v.logger.Error("extract metadata for %s: %v", filePath, err)
-			if v.cfg.FailFast {
-				return fmt.Errorf("extract metadata: %w", err)
-			}
+		// Never-verified (or expired) files come first; once the budget is
+		// spent they wait for a later run.
+		if v.cfg.Budget.exhausted(v.budgetSpent, v.budgetStart) {
+			result.Deferred++
 			continue
 		}
+		v.budgetSpent += fe.Info.Size()
 
-		// Compute expected path
-		pbOpts := pathbuilder.Options{SeparateVideo: v.cfg.SeparateVideo}
-		relPath := pathbuilder.BuildSourcePath(md, pbOpts)
-		expectedPath := filepath.Join(v.cfg.LibraryPath, relPath)
+		if err := v.verifyContent(fe, yc, ym, result); err != nil {
+			return err
+		}
+	}
 
-		// Compare absolute paths
-		absActual, err := filepath.Abs(filePath)
-		if err != nil {
-			result.Errors++
-			v.logger.Error("resolve path %s: %v", filePath, err)
-			continue
+	return nil
+}
+
+// verifyContent checks a file's bytes: against the manifest's recorded
+// full hash (scrub), or by extracting metadata and comparing the rebuilt
+// path. Returns an error only when FailFast should stop the run.
+func (v *Verifier) verifyContent(fe FileEntry, yc *Cache, ym *library.Manifest, result *Result) error {
+	filePath := fe.AbsPath
+
+	// Scrub: a file with a recorded full hash only needs re-hashing,
+	// not metadata extraction — the hash alone proves the bytes are
+	// the ones that were imported.
+	if v.cfg.Scrub {
+		if recorded, ok := v.recordedHash(ym, fe.RelToYear); ok {
+			full, _, err := metadata.ComputeFileHash(filePath, v.hasher)
+			if err != nil {
+				result.Errors++
+				v.logger.Error("hash %s: %v", filePath, err)
+				if v.cfg.FailFast {
+					return fmt.Errorf("hash file: %w", err)
+				}
+				return nil
+			}
+			if full != recorded {
+				if err := v.reportCorrupted(result, filePath, full, recorded); err != nil {
+					return err
+				}
+				return nil
+			}
+			result.Verified++
+			if err := yc.Record(NewEntry(fe.RelToYear, fe.Info, v.cfg.HashAlgo)); err != nil {
+				v.logger.Warn("cache record failed for %s: %v", filePath, err)
+			}
+			return nil
 		}
-		absExpected, err := filepath.Abs(expectedPath)
-		if err != nil {
-			result.Errors++
-			v.logger.Error("resolve path %s: %v", expectedPath, err)
-			continue
+	}
+
+	// Full mode: extract metadata, verify path and hash
+	md, err := v.ext.Extract(filePath, v.hasher)
+	if err != nil {
+		result.Errors++
+		v.logger.Error("extract metadata for %s: %v", filePath, err)
+		if v.cfg.FailFast {
+			return fmt.Errorf("extract metadata: %w", err)
 		}
+		return nil
+	}
+
+	// A recorded full hash is stronger evidence than the 8-char prefix
+	// in the filename: a mismatch means the bytes changed in place, so
+	// report corruption and leave the file where it is.
+	if recorded, ok := v.recordedHash(ym, fe.RelToYear); ok && md.FullHash != recorded {
+		if err := v.reportCorrupted(result, filePath, md.FullHash, recorded); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// Compute expected path
+	relPath, derived := pathbuilder.BuildPath(md, v.pbOpts)
+	expectedPath := filepath.Join(v.cfg.LibraryPath, relPath)
 
-		if absActual == absExpected {
-			// Path matches — hash is correct by definition since the expected
-			// path is built from the content hash
+	// Compare absolute paths
+	absActual, err := filepath.Abs(filePath)
+	if err != nil {
+		result.Errors++
+		v.logger.Error("resolve path %s: %v", filePath, err)
+		return nil
+	}
+	absExpected, err := filepath.Abs(expectedPath)
+	if err != nil {
+		result.Errors++
+		v.logger.Error("resolve path %s: %v", expectedPath, err)
+		return nil
+	}
+
+	if absActual == absExpected {
+		// Path matches — hash is correct by definition since the expected
+		// path is built from the content hash. An edited export the rules
+		// keep in sources/ is flagged instead, and left out of the cache
+		// so every run flags it.
+		inSources := strings.HasPrefix(fe.RelToYear, "sources/")
+		f := Finding{Kind: FindingDerivedInSources, Path: absActual, Details: derived}
+		flagged := derived != "" && inSources && v.record(result, f)
+		if flagged && v.cfg.FailFast {
+			return fmt.Errorf("%s", f)
+		}
+		if !flagged {
 			result.Verified++
 			if err := yc.Record(NewEntry(fe.RelToYear, fe.Info, v.cfg.HashAlgo)); err != nil {
 				v.logger.Warn("cache record failed for %s: %v", filePath, err)
 			}
-		} else {
-			// Path mismatch (wrong dir, wrong hash in filename, etc.)
-			result.Inconsistent++
-			v.logger.Warn("path mismatch: %s should be at %s", absActual, absExpected)
-			if v.cfg.Fix {
-				if _, err := transfer.TransferFile(filePath, expectedPath, transfer.Options{
-					Move:    true,
-					NewHash: v.hasher.New,
-				}); err != nil {
-					result.Errors++
-					v.logger.Error("fix move %s → %s: %v", filePath, expectedPath, err)
-				} else {
-					result.Fixed++
-					// Deliberately not caching fixed files — they'll re-verify next run.
-				}
-			} else if v.cfg.FailFast {
-				return fmt.Errorf("path mismatch: %s should be at %s", absActual, absExpected)
+		}
+		v.indexFile(absActual, md, fe.Info.Size())
+		if _, ok := v.recordedHash(ym, fe.RelToYear); !ok {
+			if err := ym.Record(library.ManifestEntry{
+				RelPath:  fe.RelToYear,
+				HashAlgo: v.cfg.HashAlgo,
+				FullHash: md.FullHash,
+			}); err != nil {
+				v.logger.Warn("hash manifest record failed for %s: %v", filePath, err)
+			}
+		}
+	} else {
+		// Path mismatch (wrong dir, wrong hash in filename, an edited
+		// export that belongs in processed/, etc.). Under --fix a failing
+		// mismatch is repaired instead of aborting the run; ignored kinds
+		// are left alone.
+		f := Finding{
+			Kind:         FindingPathMismatch,
+			Path:         absActual,
+			ExpectedPath: absExpected,
+		}
+		if derived != "" && strings.HasPrefix(fe.RelToYear, "sources/") {
+			f.Kind, f.Details = FindingDerivedInSources, derived
+		}
+		if !v.cfg.Fix {
+			if err := v.report(result, f); err != nil {
+				return err
+			}
+		} else if v.record(result, f) {
+			if v.isPlanning() {
+				v.planMove(absActual, absExpected, md.FullHash, result)
+				return nil
+			}
+			sidecars := findSidecars(filePath)
+			if _, err := transfer.TransferFile(filePath, expectedPath, transfer.Options{
+				Move:    true,
+				NewHash: v.hasher.New,
+			}); err != nil {
+				result.Errors++
+				v.logger.Error("fix move %s → %s: %v", filePath, expectedPath, err)
+			} else {
+				result.Fixed++
+				// Deliberately not caching fixed files — they'll re-verify next run.
+				v.moveSidecars(sidecars, expectedPath, result)
+				v.recordMoved(ym, absActual, absExpected, md.FullHash)
+				v.indexMove(absActual, absExpected)
+				v.indexFile(absExpected, md, fe.Info.Size())
 			}
 		}
 	}
@@ -362,22 +745,27 @@ func (v *Verifier) verifyLibraryRoot(result *Result) error {
 	}
 
 	for _, e := range entries {
-		if isSkippableInLibrary(e.Name()) {
+		if isSkippableInLibrary(e.Name()) || e.Name() == library.StateDirName {
 			continue
 		}
+		path := filepath.Join(v.cfg.LibraryPath, e.Name())
 		if !e.IsDir() {
-			result.Inconsistent++
-			v.logger.Warn("unexpected file in library root: %s", e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected file in library root: %s", e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: "file in library root",
+			}, false); err != nil {
+				return err
 			}
 			continue
 		}
 		if !library.IsYearDir(e.Name()) {
-			result.Inconsistent++
-			v.logger.Warn("unexpected directory in library root: %s (expected YYYY)", e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected directory in library root: %s", e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: "directory in library root, expected YYYY",
+			}, true); err != nil {
+				return err
 			}
 		}
 	}
@@ -404,19 +792,24 @@ func (v *Verifier) verifyYearLevel(yearDir, year string, result *Result) error {
 		if isSkippableInLibrary(e.Name()) {
 			continue
 		}
+		path := filepath.Join(yearDir, e.Name())
 		if !e.IsDir() {
-			result.Inconsistent++
-			v.logger.Warn("unexpected file in %s/: %s", year, e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected file in %s/: %s", year, e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: fmt.Sprintf("file in %s/", year),
+			}, false); err != nil {
+				return err
 			}
 			continue
 		}
 		if !allowed[e.Name()] {
-			result.Inconsistent++
-			v.logger.Warn("unexpected directory in %s/: %s (expected sources/ or processed/)", year, e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected directory in %s/: %s", year, e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: fmt.Sprintf("directory in %s/, expected sources/ or processed/", year),
+			}, true); err != nil {
+				return err
 			}
 		}
 	}
@@ -440,21 +833,26 @@ func (v *Verifier) verifySourcesStructure(yearDir, year string, result *Result)
 		if isSkippableInLibrary(e.Name()) {
 			continue
 		}
+		path := filepath.Join(sourcesDir, e.Name())
 		if !e.IsDir() {
-			result.Inconsistent++
-			v.logger.Warn("unexpected file in %s/sources/: %s", year, e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected file in %s/sources/: %s", year, e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: fmt.Sprintf("file in %s/sources/", year),
+			}, false); err != nil {
+				return err
 			}
 			continue
 		}
 
 		// Validate device dir name
 		if err := pathbuilder.ValidateDeviceDir(e.Name()); err != nil {
-			result.Inconsistent++
-			v.logger.Warn("invalid device directory in %s/sources/: %s (%v)", year, e.Name(), err)
-			if v.cfg.FailFast {
-				return fmt.Errorf("invalid device directory: %s", e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingInvalidDeviceDir,
+				Path:    path,
+				Details: err.Error(),
+			}, true); err != nil {
+				return err
 			}
 			continue
 		}
@@ -480,19 +878,24 @@ func (v *Verifier) verifyDeviceDir(deviceDir, year, deviceName string, result *R
 		if isSkippableInLibrary(e.Name()) {
 			continue
 		}
+		path := filepath.Join(deviceDir, e.Name())
 		if !e.IsDir() {
-			result.Inconsistent++
-			v.logger.Warn("unexpected file in %s/sources/%s/: %s", year, deviceName, e.Name())
-			if v.cfg.FailFast {
-				return fmt.Errorf("unexpected file in %s/sources/%s/: %s", year, deviceName, e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingUnexpectedEntry,
+				Path:    path,
+				Details: fmt.Sprintf("file in %s/sources/%s/", year, deviceName),
+			}, false); err != nil {
+				return err
 			}
 			continue
 		}
 		if err := pathbuilder.ValidateDateDir(e.Name()); err != nil {
-			result.Inconsistent++
-			v.logger.Warn("invalid date directory in %s/sources/%s/: %s (%v)", year, deviceName, e.Name(), err)
-			if v.cfg.FailFast {
-				return fmt.Errorf("invalid date directory: %s", e.Name())
+			if err := v.reportStructure(result, Finding{
+				Kind:    FindingInvalidDateDir,
+				Path:    path,
+				Details: err.Error(),
+			}, true); err != nil {
+				return err
 			}
 		}
 	}
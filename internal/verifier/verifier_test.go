@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/library"
 	"github.com/askolesov/image-vault/internal/logging"
 	"github.com/askolesov/image-vault/internal/metadata"
 	"github.com/askolesov/image-vault/internal/pathbuilder"
@@ -439,7 +440,8 @@ func TestVerifyExtractErrorFailFast(t *testing.T) {
 }
 
 // TestVerifyProcessedDirFailFast: invalid dir with FailFast → returns error
-// TestVerifySkipsIgnoredAndSidecarFiles: .DS_Store and .xmp files are skipped
+// TestVerifySkipsIgnoredAndSidecarFiles: .DS_Store is skipped; an .xmp is
+// never verified as content, only reported when it has no primary.
 func TestVerifySkipsIgnoredAndSidecarFiles(t *testing.T) {
 	libDir := t.TempDir()
 
@@ -456,10 +458,12 @@ func TestVerifySkipsIgnoredAndSidecarFiles(t *testing.T) {
 	require.NoError(t, err)
 	result, err := v.Verify()
 	require.NoError(t, err)
-	// Both should be skipped, no errors or inconsistencies
+	// Neither is verified; the lone sidecar is an orphan
 	assert.Equal(t, 0, result.Verified)
-	assert.Equal(t, 0, result.Inconsistent)
+	assert.Equal(t, 1, result.Inconsistent)
 	assert.Equal(t, 0, result.Errors)
+	require.Len(t, result.Findings, 1)
+	assert.Equal(t, FindingOrphanSidecar, result.Findings[0].Kind)
 }
 
 // TestVerifySourceFileWithBadFilename: filename that can't be parsed → Errors++
@@ -960,3 +964,220 @@ func TestVerifyFilenameDateMismatchFastMode(t *testing.T) {
 	require.NoError(t, err)
 	assert.GreaterOrEqual(t, result.Inconsistent, 1)
 }
+
+// --- Finding kind tests ---
+
+func TestVerifyFindingsCarryKind(t *testing.T) {
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(libDir, "stray-file.txt"), "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(libDir, "2024", "sources", "bad-device"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(libDir, "2024", "sources", "Apple iPhone (image)", "not-a-date"), 0o755))
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	result, err := v.Verify()
+	require.NoError(t, err)
+	require.Len(t, result.Findings, 3)
+
+	byKind := make(map[FindingKind]Finding)
+	for _, f := range result.Findings {
+		byKind[f.Kind] = f
+	}
+	assert.Equal(t, filepath.Join(libDir, "stray-file.txt"), byKind[FindingUnexpectedEntry].Path)
+	assert.Equal(t, filepath.Join(libDir, "2024", "sources", "bad-device"), byKind[FindingInvalidDeviceDir].Path)
+	assert.Equal(t, filepath.Join(libDir, "2024", "sources", "Apple iPhone (image)", "not-a-date"), byKind[FindingInvalidDateDir].Path)
+}
+
+func TestVerifyPathMismatchFindingHasExpectedPath(t *testing.T) {
+	libDir := t.TempDir()
+	wrongDir := filepath.Join(libDir, "2024", "sources", "OtherMake OtherModel (image)", "2024-01-15")
+	createTestFile(t, filepath.Join(wrongDir, "a.jpg"), "content-a")
+
+	v, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	result, err := v.Verify()
+	require.NoError(t, err)
+	require.Len(t, result.Findings, 1)
+	f := result.Findings[0]
+	assert.Equal(t, FindingPathMismatch, f.Kind)
+	assert.Contains(t, f.ExpectedPath, filepath.Join("TestMake TestModel (image)", "2024-01-15"))
+}
+
+func TestVerifyIgnoreKind(t *testing.T) {
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(libDir, "stray-file.txt"), "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(libDir, "2024", "sources", "bad-device"), 0o755))
+
+	v, err := New(Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		FailFast:    true,
+		IgnoreKinds: []FindingKind{FindingUnexpectedEntry},
+	}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	// The stray root file is ignored, so FailFast trips on the device dir.
+	result, err := v.Verify()
+	require.Error(t, err)
+	assert.Equal(t, 1, result.Inconsistent)
+	require.Len(t, result.Findings, 2)
+	assert.True(t, result.Findings[0].Ignored)
+	assert.Equal(t, FindingInvalidDeviceDir, result.Findings[1].Kind)
+	assert.False(t, result.Findings[1].Ignored)
+}
+
+func TestVerifyOnlyKind(t *testing.T) {
+	libDir := t.TempDir()
+	createTestFile(t, filepath.Join(libDir, "stray-file.txt"), "data")
+	require.NoError(t, os.MkdirAll(filepath.Join(libDir, "2024", "sources", "bad-device"), 0o755))
+
+	v, err := New(Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		FailFast:    true,
+		OnlyKinds:   []FindingKind{FindingPathMismatch},
+	}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Inconsistent)
+	assert.Len(t, result.Findings, 2)
+}
+
+func TestVerifyIgnoredPathMismatchNotFixed(t *testing.T) {
+	libDir := t.TempDir()
+	wrongPath := filepath.Join(libDir, "2024", "sources", "OtherMake OtherModel (image)", "2024-01-15", "a.jpg")
+	createTestFile(t, wrongPath, "content-a")
+
+	v, err := New(Config{
+		LibraryPath: libDir,
+		HashAlgo:    "md5",
+		Fix:         true,
+		IgnoreKinds: []FindingKind{FindingPathMismatch},
+	}, &fakeExtractor{}, newTestLogger())
+	require.NoError(t, err)
+
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Fixed)
+	assert.FileExists(t, wrongPath)
+}
+
+// TestVerifyEnforcesOwners: once a camera's serial number is mapped to an
+// owner, its files belong in the owner's device dir, and files of other
+// cameras do not.
+func TestVerifyEnforcesOwners(t *testing.T) {
+	libDir := t.TempDir()
+	hasher := mustHasher("md5")
+	dt := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	ext := &fakeExtractor{results: make(map[string]*metadata.FileMetadata)}
+	place := func(device, content, serial string) string {
+		tmp := filepath.Join(t.TempDir(), "tmp.jpg")
+		createTestFile(t, tmp, content)
+		full, short, err := metadata.ComputeFileHash(tmp, hasher)
+		require.NoError(t, err)
+		p := filepath.Join(libDir, "2024", "sources", device, "2024-01-15", pathbuilder.BuildSourceFilename(dt, short, ".jpg"))
+		createTestFile(t, p, content)
+		ext.results[p] = &metadata.FileMetadata{
+			Path: p, Extension: ".jpg", Make: "Apple", Model: "iPhone 15 Pro", DateTime: dt,
+			MIMEType: "image/jpeg", MediaType: defaults.MediaTypePhoto, FullHash: full, ShortHash: short,
+			SerialNumber: serial,
+		}
+		return p
+	}
+	alice := place("Apple iPhone 15 Pro (image)", "alice's photo", "SN-A")
+	bob := place("Apple iPhone 15 Pro - Alice (image)", "bob's photo", "SN-B")
+
+	cfg := Config{LibraryPath: libDir, HashAlgo: "md5"}
+	v, err := New(cfg, ext, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Inconsistent, "without a mapping only the owner dir is wrong")
+
+	require.NoError(t, library.SaveConfig(libDir, library.Config{HashAlgo: "md5", Owners: map[string]string{"sn-a": "Alice"}}))
+	// The first run cached alice's file as verified; a changed mapping
+	// needs the caches dropped for it to be looked at again.
+	assert.FileExists(t, CacheFilePath(filepath.Join(libDir, "2024")))
+	require.NoError(t, DropCaches(libDir))
+	assert.NoFileExists(t, CacheFilePath(filepath.Join(libDir, "2024")))
+
+	cfg.Fix = true
+	v, err = New(cfg, ext, newTestLogger())
+	require.NoError(t, err)
+	result, err = v.Verify()
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Fixed)
+	assert.NoFileExists(t, alice)
+	assert.NoFileExists(t, bob)
+	assert.FileExists(t, filepath.Join(libDir, "2024", "sources", "Apple iPhone 15 Pro - Alice (image)", "2024-01-15", filepath.Base(alice)))
+	assert.FileExists(t, filepath.Join(libDir, "2024", "sources", "Apple iPhone 15 Pro (image)", "2024-01-15", filepath.Base(bob)))
+}
+
+func TestNewVerifierRejectsBadOwner(t *testing.T) {
+	libDir := t.TempDir()
+	require.NoError(t, library.SaveConfig(libDir, library.Config{Owners: map[string]string{"SN": "Alice (work)"}}))
+	_, err := New(Config{LibraryPath: libDir, HashAlgo: "md5"}, &fakeExtractor{}, newTestLogger())
+	assert.ErrorContains(t, err, "parentheses")
+}
+
+func TestVerifyFlagsEditedExportsInSources(t *testing.T) {
+	libDir := t.TempDir()
+	hasher := mustHasher("md5")
+	dt := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	content := "lightroom export"
+	tmp := filepath.Join(t.TempDir(), "tmp.jpg")
+	createTestFile(t, tmp, content)
+	full, short, err := metadata.ComputeFileHash(tmp, hasher)
+	require.NoError(t, err)
+	name := pathbuilder.BuildSourceFilename(dt, short, ".jpg")
+	p := filepath.Join(libDir, "2024", "sources", "Apple iPhone 15 Pro (image)", "2024-01-15", name)
+	createTestFile(t, p, content)
+	ext := &fakeExtractor{results: map[string]*metadata.FileMetadata{p: {
+		Path: p, Extension: ".jpg", Make: "Apple", Model: "iPhone 15 Pro", DateTime: dt,
+		MIMEType: "image/jpeg", MediaType: defaults.MediaTypePhoto, FullHash: full, ShortHash: short,
+		HistorySoftware: []string{"Adobe Photoshop Lightroom Classic 13.0 (Macintosh)"},
+	}}}
+
+	// Kept in sources/ by the rules: flagged on every run, never cached.
+	require.NoError(t, library.SaveConfig(libDir, library.Config{HashAlgo: "md5", Derived: library.DerivedRules{Action: library.DerivedFlag}}))
+	cfg := Config{LibraryPath: libDir, HashAlgo: "md5"}
+	for range 2 {
+		v, err := New(cfg, ext, newTestLogger())
+		require.NoError(t, err)
+		result, err := v.Verify()
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Inconsistent)
+		require.Len(t, result.Findings, 1)
+		f := result.Findings[0]
+		assert.Equal(t, FindingDerivedInSources, f.Kind)
+		assert.Empty(t, f.ExpectedPath)
+		assert.Equal(t, "edited with Adobe Photoshop Lightroom Classic 13.0 (Macintosh)", f.Details)
+	}
+
+	// Without rules it is an original: nothing to report or fix.
+	require.NoError(t, library.SaveConfig(libDir, library.Config{HashAlgo: "md5"}))
+	cfg.Fix = true
+	v, err := New(cfg, ext, newTestLogger())
+	require.NoError(t, err)
+	result, err := v.Verify()
+	require.NoError(t, err)
+	assert.Empty(t, result.Findings)
+	assert.FileExists(t, p)
+
+	// Routed to processed/ by the rules: --fix moves it there.
+	require.NoError(t, library.SaveConfig(libDir, library.Config{HashAlgo: "md5", Derived: library.DerivedRules{Action: library.DerivedToProcessed}}))
+	cfg.NoCache = true
+	v, err = New(cfg, ext, newTestLogger())
+	require.NoError(t, err)
+	result, err = v.Verify()
+	require.NoError(t, err)
+	require.Len(t, result.Findings, 1)
+	assert.Equal(t, FindingDerivedInSources, result.Findings[0].Kind)
+	assert.Equal(t, 1, result.Fixed)
+	assert.NoFileExists(t, p)
+	assert.FileExists(t, filepath.Join(libDir, "2024", "processed", "Apple iPhone 15 Pro (image)", "2024-01-15", name))
+}
@@ -0,0 +1,153 @@
+//go:build linux
+
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that mean a file was written or
+// appeared. IN_CREATE and IN_MOVED_TO also report new subdirectories.
+const watchMask = unix.IN_CREATE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+
+// inotify is the Linux notifier.
+type inotify struct {
+	f       *os.File
+	fd      int
+	root    string
+	watches map[int]string
+	events  chan string
+	errors  chan error
+	done    chan struct{}
+}
+
+func newNotifier(root string) (notifier, error) {
+	// A non-blocking fd lets the runtime poller serve Read, and Close
+	// unblock it.
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	n := &inotify{
+		f:       os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		root:    root,
+		watches: make(map[int]string),
+		events:  make(chan string, 256),
+		errors:  make(chan error, 1),
+		done:    make(chan struct{}),
+	}
+	if err := n.addTree(root, false); err != nil {
+		_ = n.f.Close()
+		return nil, err
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) Events() <-chan string { return n.events }
+func (n *inotify) Errors() <-chan error  { return n.errors }
+
+func (n *inotify) Close() error {
+	close(n.done)
+	return n.f.Close()
+}
+
+// addTree watches dir and its subdirectories. With emit, the files found
+// are reported too: they were written before the watch existed.
+func (n *inotify) addTree(dir string, emit bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path != dir && (os.IsPermission(err) || os.IsNotExist(err)) {
+				return nil
+			}
+			return err
+		}
+		if path != dir && skipName(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			wd, err := unix.InotifyAddWatch(n.fd, path, watchMask)
+			if err != nil {
+				if path != dir && (errors.Is(err, unix.ENOENT) || errors.Is(err, unix.EACCES)) {
+					return filepath.SkipDir
+				}
+				return fmt.Errorf("watch %s: %w", path, err)
+			}
+			n.watches[wd] = path
+			return nil
+		}
+		if emit && d.Type().IsRegular() {
+			n.send(path)
+		}
+		return nil
+	})
+}
+
+func (n *inotify) send(path string) {
+	select {
+	case n.events <- path:
+	case <-n.done:
+	}
+}
+
+func (n *inotify) fail(err error) {
+	select {
+	case n.errors <- err:
+	case <-n.done:
+	}
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.fail(fmt.Errorf("inotify read: %w", err))
+			}
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= size; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameStart := off + unix.SizeofInotifyEvent
+			off = nameStart + int(ev.Len)
+			name := strings.TrimRight(string(buf[nameStart:off]), "\x00")
+
+			switch {
+			case ev.Mask&unix.IN_Q_OVERFLOW != 0:
+				// Events were lost: look at everything again.
+				if err := n.addTree(n.root, true); err != nil {
+					n.fail(err)
+					return
+				}
+			case ev.Mask&unix.IN_IGNORED != 0:
+				delete(n.watches, int(ev.Wd))
+			case name == "":
+			case ev.Mask&unix.IN_ISDIR != 0:
+				if ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && !skipName(name) {
+					err := n.addTree(filepath.Join(n.watches[int(ev.Wd)], name), true)
+					if err != nil && !errors.Is(err, fs.ErrNotExist) {
+						n.fail(err)
+						return
+					}
+				}
+			default:
+				if dir, ok := n.watches[int(ev.Wd)]; ok {
+					n.send(filepath.Join(dir, name))
+				}
+			}
+		}
+	}
+}
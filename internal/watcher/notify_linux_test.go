@@ -0,0 +1,38 @@
+//go:build linux
+
+package watcher
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInotifyReportsFilesInNewDirs(t *testing.T) {
+	src := t.TempDir()
+	n, err := newNotifier(src)
+	require.NoError(t, err)
+	defer func() { _ = n.Close() }()
+
+	photo := filepath.Join(src, "DCIM", "100", "a.jpg")
+	write(t, photo, "jpeg")
+	write(t, filepath.Join(src, ".syncthing.b.jpg.tmp"), "partial")
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-n.Events():
+			assert.NotContains(t, p, ".syncthing.")
+			if p == photo {
+				return
+			}
+		case err := <-n.Errors():
+			require.NoError(t, err)
+		case <-deadline:
+			t.Fatal("no event for a file in a new directory")
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package watcher
+
+import "errors"
+
+func newNotifier(string) (notifier, error) {
+	return nil, errors.New("watching needs inotify, which is only available on Linux")
+}
@@ -0,0 +1,352 @@
+// Package watcher imports files into the library as they appear in a
+// source directory, such as a folder a phone syncs into.
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/defaults"
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/logging"
+)
+
+// DefaultSettle is the default for Config.Settle.
+const DefaultSettle = 5 * time.Second
+
+// batchSize caps how many files go to one ImportFiles call, so a shutdown
+// request is honoured between batches of a large backlog.
+const batchSize = 100
+
+// Importer is the part of importer.Importer the watcher drives.
+type Importer interface {
+	ImportFiles(files []string) (*importer.Result, error)
+	ImportSidecars(sidecars []string, libraryFile string) error
+}
+
+// Config controls a Watcher.
+type Config struct {
+	SourceDir   string
+	LibraryPath string
+	// Settle is how long a file must go unchanged before it is imported.
+	Settle time.Duration
+}
+
+// notifier reports the paths of files created or written under a
+// directory tree, watching new subdirectories as they appear. An error
+// on Errors is fatal.
+type notifier interface {
+	Events() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// pendingFile is a file waiting to settle.
+type pendingFile struct {
+	seen  time.Time
+	size  int64
+	mtime time.Time
+}
+
+// Watcher imports the files of a source directory once they stop
+// changing.
+type Watcher struct {
+	cfg     Config
+	imp     Importer
+	logger  *logging.Logger
+	pending map[string]*pendingFile
+	total   importer.Result
+	// placed maps the stem of every primary imported this session to
+	// its library path, so sidecars arriving later join it there even
+	// after --move took the primary out of the source directory.
+	placed map[string]string
+}
+
+// New creates a Watcher. The library may not be inside the source
+// directory, or imports would trigger more imports.
+func New(cfg Config, imp Importer, logger *logging.Logger) (*Watcher, error) {
+	src, err := filepath.Abs(cfg.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("resolve source path: %w", err)
+	}
+	lib, err := filepath.Abs(cfg.LibraryPath)
+	if err != nil {
+		return nil, fmt.Errorf("resolve library path: %w", err)
+	}
+	if rel, err := filepath.Rel(src, lib); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("library %s is inside the watched directory %s", lib, src)
+	}
+	if cfg.Settle <= 0 {
+		cfg.Settle = DefaultSettle
+	}
+	cfg.SourceDir, cfg.LibraryPath = src, lib
+	return &Watcher{
+		cfg:     cfg,
+		imp:     imp,
+		logger:  logger,
+		pending: make(map[string]*pendingFile),
+		placed:  make(map[string]string),
+	}, nil
+}
+
+// Run watches the source directory until ctx is done, importing files
+// already there and every file created or changed later. It returns the
+// totals of all imports; files still settling at shutdown are left for
+// the next run.
+func (w *Watcher) Run(ctx context.Context) (*importer.Result, error) {
+	n, err := newNotifier(w.cfg.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("watch %s: %w", w.cfg.SourceDir, err)
+	}
+	defer func() { _ = n.Close() }()
+
+	existing, err := scan(w.cfg.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("scan %s: %w", w.cfg.SourceDir, err)
+	}
+	now := time.Now()
+	for _, p := range existing {
+		w.touch(p, now)
+	}
+	w.logger.Info("watching %s (%d files waiting)", w.cfg.SourceDir, len(w.pending))
+
+	if err := w.loop(ctx, n); err != nil {
+		return &w.total, err
+	}
+	return &w.total, nil
+}
+
+func (w *Watcher) loop(ctx context.Context, n notifier) error {
+	tick := min(max(w.cfg.Settle/4, 10*time.Millisecond), time.Second)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if len(w.pending) > 0 {
+				w.logger.Info("stopping; %d files still settling are left for the next run", len(w.pending))
+			}
+			return nil
+		case err := <-n.Errors():
+			return err
+		case p := <-n.Events():
+			w.touch(p, time.Now())
+		case <-ticker.C:
+			w.flush(ctx, time.Now())
+		}
+	}
+}
+
+// touch records that path changed at now.
+func (w *Watcher) touch(path string, now time.Time) {
+	if skipName(filepath.Base(path)) {
+		return
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		delete(w.pending, path)
+		return
+	}
+	f, ok := w.pending[path]
+	if !ok {
+		f = &pendingFile{}
+		w.pending[path] = f
+		w.logger.Info("detected %s", path)
+	}
+	f.seen, f.size, f.mtime = now, info.Size(), info.ModTime()
+}
+
+// flush imports the files that have not changed for cfg.Settle. A file
+// waits while another file of its sidecar group is still settling.
+func (w *Watcher) flush(ctx context.Context, now time.Time) {
+	settling := make(map[string]bool)
+	var ready []string
+	for p, f := range w.pending {
+		info, err := os.Lstat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			delete(w.pending, p)
+			continue
+		}
+		if info.Size() != f.size || !info.ModTime().Equal(f.mtime) {
+			f.seen, f.size, f.mtime = now, info.Size(), info.ModTime()
+		}
+		if now.Sub(f.seen) < w.cfg.Settle {
+			settling[stem(p)] = true
+			continue
+		}
+		ready = append(ready, p)
+	}
+
+	groups := make(map[string][]string)
+	for _, p := range ready {
+		if s := stem(p); !settling[s] {
+			groups[s] = append(groups[s], p)
+			delete(w.pending, p)
+		}
+	}
+	if len(groups) == 0 {
+		return
+	}
+
+	stems := make([]string, 0, len(groups))
+	for s := range groups {
+		stems = append(stems, s)
+	}
+	sort.Strings(stems)
+
+	var batch []string
+	for i, s := range stems {
+		if lib, ok := w.placedPrimary(groups[s]); ok {
+			w.importSidecars(groups[s], lib)
+		} else {
+			batch = append(batch, w.withPrimary(groups[s])...)
+		}
+		if len(batch) >= batchSize || (i == len(stems)-1 && len(batch) > 0) {
+			w.importBatch(batch)
+			batch = nil
+			if ctx.Err() != nil {
+				// Put the rest back; the next run picks them up.
+				for _, s := range stems[i+1:] {
+					for _, p := range groups[s] {
+						w.pending[p] = &pendingFile{seen: now}
+					}
+				}
+				return
+			}
+		}
+	}
+}
+
+// placedPrimary returns the library path of the primary of a group of
+// sidecars, if this session imported it and it is still there.
+func (w *Watcher) placedPrimary(group []string) (string, bool) {
+	for _, p := range group {
+		if !defaults.IsSidecarExtension(filepath.Ext(p)) {
+			return "", false
+		}
+	}
+	lib, ok := w.placed[stem(group[0])]
+	if !ok {
+		return "", false
+	}
+	if _, err := os.Lstat(lib); err != nil {
+		delete(w.placed, stem(group[0]))
+		return "", false
+	}
+	return lib, true
+}
+
+// withPrimary adds to a group of sidecars the primary file of the same
+// name already in the source directory, so the sidecars land next to it
+// in the library instead of being imported on their own.
+func (w *Watcher) withPrimary(group []string) []string {
+	for _, p := range group {
+		if !defaults.IsSidecarExtension(filepath.Ext(p)) {
+			return group
+		}
+	}
+	dir := filepath.Dir(group[0])
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return group
+	}
+	s := stem(group[0])
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.Type().IsRegular() && stem(p) == s && !skipName(e.Name()) &&
+			!defaults.IsSidecarExtension(filepath.Ext(p)) && w.pending[p] == nil {
+			group = append(group, p)
+		}
+	}
+	return group
+}
+
+func (w *Watcher) importBatch(files []string) {
+	sort.Strings(files)
+	w.logger.Info("importing %d files", len(files))
+	res, err := w.imp.ImportFiles(files)
+	w.logger.ClearProgress()
+	if err != nil {
+		w.logger.Error("import: %v", err)
+	}
+	if res == nil {
+		return
+	}
+	w.logger.Info("imported %d, skipped %d, replaced %d, dropped %d, errors %d",
+		res.Imported, res.Skipped, res.Replaced, res.Dropped, res.Errors)
+	w.total.Imported += res.Imported
+	w.total.Skipped += res.Skipped
+	w.total.Replaced += res.Replaced
+	w.total.Dropped += res.Dropped
+	w.total.Errors += res.Errors
+	w.total.ProcessedBytes += res.ProcessedBytes
+	w.total.Derived += res.Derived
+	w.total.Session = res.Session
+	for src, lib := range res.Placed {
+		w.placed[stem(src)] = lib
+	}
+}
+
+// importSidecars brings late sidecars in next to their primary's
+// library copy.
+func (w *Watcher) importSidecars(sidecars []string, libraryFile string) {
+	sort.Strings(sidecars)
+	w.logger.Info("adding %d sidecars to %s", len(sidecars), libraryFile)
+	if err := w.imp.ImportSidecars(sidecars, libraryFile); err != nil {
+		w.logger.Error("import sidecars: %v", err)
+		w.total.Errors++
+	}
+}
+
+// stem is the sidecar grouping key of a path: the path without its
+// extension, as the importer groups sidecars.
+func stem(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// syncDirs are directories of sync tools that never hold new media:
+// Syncthing's folder marker and its archive of old file versions.
+var syncDirs = map[string]bool{
+	".stfolder":   true,
+	".stversions": true,
+}
+
+// skipName reports whether a file or directory name is never imported:
+// OS junk, sync tool state, and the temporary files sync tools write
+// before renaming them into place.
+func skipName(name string) bool {
+	return defaults.IsIgnoredFile(name) || syncDirs[name] || name == ".stignore" ||
+		(strings.HasPrefix(name, ".syncthing.") && strings.HasSuffix(name, ".tmp")) ||
+		strings.HasPrefix(name, "~syncthing~")
+}
+
+// scan lists the files under root, skipping what skipName rejects.
+func scan(root string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if path != root && skipName(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,218 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/askolesov/image-vault/internal/importer"
+	"github.com/askolesov/image-vault/internal/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeImporter struct {
+	batches [][]string
+	// imported, if set, receives each batch.
+	imported chan []string
+	// library, if set, is where ImportFiles places each file, by name.
+	library string
+	// sidecars maps library files to the sidecars added to them.
+	sidecars map[string][]string
+}
+
+func (f *fakeImporter) ImportFiles(files []string) (*importer.Result, error) {
+	f.batches = append(f.batches, append([]string(nil), files...))
+	if f.imported != nil {
+		f.imported <- files
+	}
+	res := &importer.Result{Imported: len(files), Session: "s1", Placed: make(map[string]string)}
+	if f.library != "" {
+		for _, p := range files {
+			lib := filepath.Join(f.library, filepath.Base(p))
+			if err := os.WriteFile(lib, nil, 0o644); err != nil {
+				return nil, err
+			}
+			res.Placed[p] = lib
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeImporter) ImportSidecars(sidecars []string, libraryFile string) error {
+	if f.sidecars == nil {
+		f.sidecars = make(map[string][]string)
+	}
+	f.sidecars[libraryFile] = append(f.sidecars[libraryFile], sidecars...)
+	return nil
+}
+
+func newTestWatcher(t *testing.T, src string) (*Watcher, *fakeImporter, *bytes.Buffer) {
+	t.Helper()
+	var stderr bytes.Buffer
+	imp := &fakeImporter{}
+	w, err := New(Config{SourceDir: src, LibraryPath: t.TempDir(), Settle: time.Minute}, imp, logging.New(&bytes.Buffer{}, &stderr, false))
+	require.NoError(t, err)
+	return w, imp, &stderr
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestFlushWaitsForFilesToSettle(t *testing.T) {
+	src := t.TempDir()
+	w, imp, stderr := newTestWatcher(t, src)
+	t0 := time.Now()
+
+	photo := filepath.Join(src, "a.jpg")
+	write(t, photo, "jpeg")
+	w.touch(photo, t0)
+	assert.Contains(t, stderr.String(), "[info] detected "+photo)
+
+	w.flush(context.Background(), t0.Add(30*time.Second))
+	assert.Empty(t, imp.batches)
+
+	// A change seen only by flush restarts the wait.
+	write(t, photo, "jpeg, longer")
+	w.flush(context.Background(), t0.Add(61*time.Second))
+	assert.Empty(t, imp.batches)
+
+	w.flush(context.Background(), t0.Add(122*time.Second))
+	assert.Equal(t, [][]string{{photo}}, imp.batches)
+	assert.Empty(t, w.pending)
+	assert.Equal(t, 1, w.total.Imported)
+}
+
+func TestFlushKeepsSidecarGroupsTogether(t *testing.T) {
+	src := t.TempDir()
+	w, imp, _ := newTestWatcher(t, src)
+	t0 := time.Now()
+
+	photo := filepath.Join(src, "a.jpg")
+	sidecar := filepath.Join(src, "a.xmp")
+	other := filepath.Join(src, "b.jpg")
+	write(t, photo, "jpeg")
+	write(t, other, "jpeg-b")
+	w.touch(photo, t0)
+	w.touch(other, t0)
+	write(t, sidecar, "xmp")
+	w.touch(sidecar, t0.Add(50*time.Second))
+
+	// a.jpg has settled but waits for its sidecar.
+	w.flush(context.Background(), t0.Add(70*time.Second))
+	assert.Equal(t, [][]string{{other}}, imp.batches)
+
+	w.flush(context.Background(), t0.Add(120*time.Second))
+	assert.Equal(t, []string{photo, sidecar}, imp.batches[1])
+}
+
+func TestFlushAddsPrimaryForLateSidecar(t *testing.T) {
+	src := t.TempDir()
+	w, imp, _ := newTestWatcher(t, src)
+	t0 := time.Now()
+
+	photo := filepath.Join(src, "a.jpg")
+	sidecar := filepath.Join(src, "a.xmp")
+	write(t, photo, "jpeg")
+	write(t, sidecar, "xmp")
+	w.touch(sidecar, t0)
+
+	w.flush(context.Background(), t0.Add(2*time.Minute))
+	assert.Equal(t, [][]string{{photo, sidecar}}, imp.batches)
+}
+
+func TestFlushSendsLateSidecarToLibraryCopy(t *testing.T) {
+	src := t.TempDir()
+	w, imp, _ := newTestWatcher(t, src)
+	imp.library = t.TempDir()
+	t0 := time.Now()
+
+	photo := filepath.Join(src, "a.jpg")
+	write(t, photo, "jpeg")
+	w.touch(photo, t0)
+	w.flush(context.Background(), t0.Add(2*time.Minute))
+	require.Equal(t, [][]string{{photo}}, imp.batches)
+	// Imported with --move.
+	require.NoError(t, os.Remove(photo))
+
+	sidecar := filepath.Join(src, "a.xmp")
+	write(t, sidecar, "xmp")
+	w.touch(sidecar, t0.Add(3*time.Minute))
+	w.flush(context.Background(), t0.Add(5*time.Minute))
+	assert.Len(t, imp.batches, 1, "the sidecar is not imported on its own")
+	assert.Equal(t, map[string][]string{filepath.Join(imp.library, "a.jpg"): {sidecar}}, imp.sidecars)
+
+	// Once the library copy is gone, a late sidecar is imported as before.
+	require.NoError(t, os.Remove(filepath.Join(imp.library, "a.jpg")))
+	other := filepath.Join(src, "a.json")
+	write(t, other, "{}")
+	w.touch(other, t0.Add(6*time.Minute))
+	w.flush(context.Background(), t0.Add(8*time.Minute))
+	assert.Equal(t, []string{other}, imp.batches[1])
+}
+
+func TestTouchSkipsSyncState(t *testing.T) {
+	src := t.TempDir()
+	w, _, _ := newTestWatcher(t, src)
+
+	for _, name := range []string{".syncthing.a.jpg.tmp", "~syncthing~a.jpg.tmp", ".DS_Store", ".stignore"} {
+		p := filepath.Join(src, name)
+		write(t, p, "x")
+		w.touch(p, time.Now())
+	}
+	w.touch(filepath.Join(src, "gone.jpg"), time.Now())
+	assert.Empty(t, w.pending)
+
+	write(t, filepath.Join(src, ".stversions", "old.jpg"), "x")
+	write(t, filepath.Join(src, "sub", "new.jpg"), "x")
+	files, err := scan(src)
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(src, "sub", "new.jpg")}, files)
+}
+
+func TestNewRefusesLibraryInsideSource(t *testing.T) {
+	src := t.TempDir()
+	_, err := New(Config{SourceDir: src, LibraryPath: filepath.Join(src, "library")}, &fakeImporter{}, logging.New(&bytes.Buffer{}, &bytes.Buffer{}, false))
+	assert.ErrorContains(t, err, "inside the watched directory")
+}
+
+type fakeNotifier struct {
+	events chan string
+	errors chan error
+}
+
+func (n *fakeNotifier) Events() <-chan string { return n.events }
+func (n *fakeNotifier) Errors() <-chan error  { return n.errors }
+func (n *fakeNotifier) Close() error          { return nil }
+
+func TestLoopImportsAndStops(t *testing.T) {
+	src := t.TempDir()
+	imp := &fakeImporter{imported: make(chan []string, 1)}
+	w, err := New(Config{SourceDir: src, LibraryPath: t.TempDir(), Settle: 20 * time.Millisecond}, imp, logging.New(&bytes.Buffer{}, &bytes.Buffer{}, false))
+	require.NoError(t, err)
+
+	n := &fakeNotifier{events: make(chan string), errors: make(chan error)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.loop(ctx, n) }()
+
+	photo := filepath.Join(src, "a.jpg")
+	write(t, photo, "jpeg")
+	n.events <- photo
+	select {
+	case files := <-imp.imported:
+		assert.Equal(t, []string{photo}, files)
+	case <-time.After(5 * time.Second):
+		t.Fatal("file was not imported")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, w.total.Imported)
+}